@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log"
 	"os"
 	"os/signal"
@@ -13,8 +15,13 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
 	defer cancel()
 
-	err := cmd.ServerCmd(ctx)
-	if err != nil {
+	var err error
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		err = cmd.ConfigCmd(os.Args[2:])
+	} else {
+		err = cmd.ServerCmd(ctx, os.Args[1:])
+	}
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/cmd"
+)
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	defer cancel()
+
+	err := cmd.WsctlCmd(ctx, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "wsctl:", err)
+		os.Exit(1)
+	}
+}
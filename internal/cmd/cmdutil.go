@@ -8,23 +8,52 @@ import (
 	"strings"
 	"time"
 
+	"github.com/bjarke-xyz/ws-gateway/internal/config"
 	"github.com/bjarke-xyz/ws-gateway/internal/repository"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-func newLogger(service string) *slog.Logger {
-	env := os.Getenv("ENV")
+func newLogger(service string, env string) *slog.Logger {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 	child := logger.With(slog.Group("service_info", slog.String("env", env), slog.String("service", service)))
 	return child
 }
 
-func newDatabasePool(ctx context.Context, maxConns int) (*pgxpool.Pool, error) {
+// newRepositories returns the repositories of the configured database driver, migrating the database first
+func newRepositories(ctx context.Context, logger *slog.Logger, cfg config.DatabaseConfig) (repository.Repositories, error) {
+	switch cfg.Driver {
+	case config.DriverSqlite:
+		db, err := repository.OpenSqlite(cfg.SqlitePath)
+		if err != nil {
+			return repository.Repositories{}, fmt.Errorf("error opening sqlite database: %w", err)
+		}
+		logger.Info("using sqlite database", slog.String("path", cfg.SqlitePath))
+		return repository.NewSqliteRepositories(db), nil
+	case config.DriverMemory:
+		logger.Warn("using in-memory database, nothing is kept when the server stops")
+		return repository.NewMemoryRepositories(), nil
+	default:
+		pool, err := newDatabasePool(ctx, cfg)
+		if err != nil {
+			return repository.Repositories{}, fmt.Errorf("error creating db pool: %w", err)
+		}
+		return repository.NewPostgresRepositories(pool), nil
+	}
+}
+
+func newDatabasePool(ctx context.Context, cfg config.DatabaseConfig) (*pgxpool.Pool, error) {
+	maxConns := cfg.MaxConns
 	if maxConns == 0 {
 		maxConns = 1
 	}
-	unformattedConnStr := os.Getenv("DATABASE_CONNECTION_POOL_URL")
+	unformattedConnStr := cfg.URL
 	err := repository.Migrate("up", unformattedConnStr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to migrate: %w", err)
@@ -52,3 +81,27 @@ func newDatabasePool(ctx context.Context, maxConns int) (*pgxpool.Pool, error) {
 	config.MaxConnIdleTime = 30 * time.Second
 	return pgxpool.NewWithConfig(ctx, config)
 }
+
+// setupTracing sets the global propagator to W3C trace context, and exports spans over OTLP/HTTP if an endpoint is configured,
+// e.g. http://localhost:4318 for a local collector. The returned func flushes the remaining spans.
+func setupTracing(ctx context.Context, service string, cfg config.Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if cfg.Tracing.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Tracing.OTLPEndpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create otlp exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(service),
+		semconv.DeploymentEnvironment(cfg.Env),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create otel resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
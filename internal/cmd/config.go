@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/config"
+	"github.com/joho/godotenv"
+)
+
+const configUsage = `ws-gateway config shows the configuration of the server.
+
+Usage:
+  ws-gateway config print [--config FILE] [flags]
+
+print writes the effective configuration as YAML, with the source of every value as a comment.
+Secrets are masked. It takes the same flags as the server, see ws-gateway --help.
+`
+
+// loadConfig loads and validates the configuration, see package config
+func loadConfig(name string, args []string) (config.Config, error) {
+	cfg, sources, err := config.Load(name, args, os.Getenv)
+	if err != nil {
+		return cfg, err
+	}
+	err = cfg.Validate(sources)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+func ConfigCmd(args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(os.Stdout, configUsage)
+		return nil
+	}
+	if args[0] != "print" {
+		return fmt.Errorf("unknown config command %q, see ws-gateway config help", args[0])
+	}
+	godotenv.Load()
+	// An invalid configuration is printed too, as print is used to find out why it is invalid
+	cfg, sources, err := config.Load("ws-gateway config print", args[1:], os.Getenv)
+	if err != nil {
+		return err
+	}
+	err = config.Print(os.Stdout, cfg, sources)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(sources); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+	}
+	return nil
+}
@@ -4,9 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
-	"os"
-	"strconv"
 
 	firebase "firebase.google.com/go/v4"
 	serverPkg "github.com/bjarke-xyz/ws-gateway/internal/server"
@@ -16,47 +15,61 @@ import (
 	"google.golang.org/api/option"
 )
 
-func ServerCmd(ctx context.Context) error {
+func ServerCmd(ctx context.Context, args []string) error {
 	godotenv.Load()
-	port := 9090
-	_port := os.Getenv("PORT")
-	if _port != "" {
-		port, _ = strconv.Atoi(_port)
+	cfg, err := loadConfig("ws-gateway", args)
+	if err != nil {
+		return err
+	}
+	logger := newLogger("api", cfg.Env)
+	shutdownTracing, err := setupTracing(ctx, "ws-gateway", cfg)
+	if err != nil {
+		return fmt.Errorf("error setting up tracing: %w", err)
 	}
-	logger := newLogger("api")
-	credentialsJson := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS_CONTENT")
-	credentialsJsonBytes := []byte(credentialsJson)
-	opt := option.WithCredentialsJSON(credentialsJsonBytes)
+	opt := option.WithCredentialsJSON([]byte(cfg.Firebase.CredentialsJSON))
 	app, err := firebase.NewApp(ctx, nil, opt)
 	if err != nil {
 		return fmt.Errorf("error initializing app: %w", err)
 	}
-	authClient := service.NewFirebaseAuthRestClient(os.Getenv("FIREBASE_WEB_API_KEY"), os.Getenv("FIREBASE_PROJECT_ID"))
+	authClient := service.NewFirebaseAuthRestClient(cfg.Firebase.WebAPIKey, cfg.Firebase.ProjectID)
 
-	pool, err := newDatabasePool(ctx, 16)
+	repos, err := newRepositories(ctx, logger, cfg.Database)
 	if err != nil {
-		return fmt.Errorf("error creating db pool: %w", err)
+		return err
 	}
 
-	server, err := serverPkg.NewServer(ctx, logger, app, authClient, pool)
+	server, err := serverPkg.NewServer(ctx, logger, cfg, app, authClient, serverPkg.NewFirebaseTicketIssuer(app, authClient), repos)
 	if err != nil {
 		return fmt.Errorf("error creating server")
 	}
 
-	srv := server.Server(port)
+	srv := server.Server(cfg.Server.Port)
 
 	// metrics
 	go func() {
 		mux := http.NewServeMux()
 		mux.Handle("/metrics", promhttp.Handler())
-		http.ListenAndServe(":9091", mux)
+		http.ListenAndServe(fmt.Sprintf(":%d", cfg.Server.MetricsPort), mux)
 	}()
 
 	go func() {
 		_ = srv.ListenAndServe()
 	}()
-	logger.Info("started server", slog.Int("port", port))
+	logger.Info("started server", slog.Int("port", cfg.Server.Port))
+
+	grpcServer := server.GrpcServer()
+	grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Server.GrpcPort))
+	if err != nil {
+		return fmt.Errorf("error listening on grpc port: %w", err)
+	}
+	go func() {
+		_ = grpcServer.Serve(grpcListener)
+	}()
+	logger.Info("started grpc server", slog.Int("port", cfg.Server.GrpcPort))
+
 	<-ctx.Done()
 	_ = srv.Shutdown(ctx)
+	grpcServer.Stop()
+	_ = shutdownTracing(context.Background())
 	return nil
 }
@@ -0,0 +1,679 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/pkg/client"
+)
+
+const wsctlUsage = `wsctl manages and uses a ws-gateway over its HTTP apis.
+
+Usage:
+  wsctl login [--token TOKEN]
+  wsctl orgs list
+  wsctl apps list
+  wsctl apps create --name NAME [--org ORG_ID]
+  wsctl apps get APP_ID
+  wsctl apps update APP_ID [--file FILE]
+  wsctl apps delete APP_ID
+  wsctl apps usage APP_ID [--from DATE] [--to DATE]
+  wsctl keys list
+  wsctl keys create [--org ORG_ID] --app APP_ID [--app APP_ID ...]
+  wsctl keys get KEY_ID
+  wsctl keys access KEY_ID --app APP_ID [--app APP_ID ...]
+  wsctl keys delete KEY_ID
+  wsctl ticket --user USER_ID --topic TOPIC
+  wsctl broadcast --topic TOPIC [--event EVENT] [--ttl DURATION] [--file FILE] [--lines]
+  wsctl tail --topic TOPIC --user USER_ID [--filter EXPRESSION] [--raw]
+
+Every command takes --url, default $WSCTL_URL or the url used to log in.
+login stores a personal access token, created on the admin page, in the wsctl config file. It is used by orgs, apps and keys.
+$WSCTL_TOKEN overrides the stored token, e.g. with a personal access token in CI.
+--org can be left out for users in a single organization.
+apps update reads the fields to change as JSON, e.g. {"name":"chat","reliableTopics":["orders"]}.
+apps usage shows the usage per day, by default of the last 30 days. Dates are like 2006-01-02.
+ticket, broadcast and tail use an api key, from --app and --key or $WSCTL_APP_ID and $WSCTL_API_KEY.
+`
+
+const wsctlDefaultURL = "http://localhost:9090"
+
+// wsctlConfig is stored by login
+type wsctlConfig struct {
+	URL   string `json:"url"`
+	Token string `json:"token"`
+}
+
+func wsctlConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "wsctl", "config.json"), nil
+}
+
+func loadWsctlConfig() wsctlConfig {
+	config := wsctlConfig{}
+	path, err := wsctlConfigPath()
+	if err == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			_ = json.Unmarshal(data, &config)
+		}
+	}
+	if url := os.Getenv("WSCTL_URL"); url != "" {
+		config.URL = url
+	}
+	if token := os.Getenv("WSCTL_TOKEN"); token != "" {
+		config.Token = token
+	}
+	if config.URL == "" {
+		config.URL = wsctlDefaultURL
+	}
+	return config
+}
+
+func saveWsctlConfig(config wsctlConfig) error {
+	path, err := wsctlConfigPath()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// wsctl holds what every command needs
+type wsctl struct {
+	config wsctlConfig
+	out    io.Writer
+	in     io.Reader
+	// appID and apiKey are used by the commands that call the app api
+	appID  string
+	apiKey string
+}
+
+func WsctlCmd(ctx context.Context, args []string) error {
+	c := &wsctl{config: loadWsctlConfig(), out: os.Stdout, in: os.Stdin}
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(c.out, wsctlUsage)
+		return nil
+	}
+	command, args := args[0], args[1:]
+	switch command {
+	case "login":
+		return c.login(ctx, args)
+	case "orgs":
+		return c.subcommand(ctx, "orgs", args, map[string]func(context.Context, []string) error{
+			"list": c.listOrganizations,
+		})
+	case "apps":
+		return c.subcommand(ctx, "apps", args, map[string]func(context.Context, []string) error{
+			"list":   c.listApps,
+			"create": c.createApp,
+			"get":    c.getApp,
+			"update": c.updateApp,
+			"delete": c.deleteApp,
+			"usage":  c.appUsage,
+		})
+	case "keys":
+		return c.subcommand(ctx, "keys", args, map[string]func(context.Context, []string) error{
+			"list":   c.listKeys,
+			"create": c.createKey,
+			"get":    c.getKey,
+			"access": c.updateKeyAccess,
+			"delete": c.deleteKey,
+		})
+	case "ticket":
+		return c.ticket(ctx, args)
+	case "broadcast":
+		return c.broadcast(ctx, args)
+	case "tail":
+		return c.tail(ctx, args)
+	default:
+		return fmt.Errorf("unknown command %q, see wsctl help", command)
+	}
+}
+
+func (c *wsctl) subcommand(ctx context.Context, command string, args []string, subcommands map[string]func(context.Context, []string) error) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing %v command, see wsctl help", command)
+	}
+	run, ok := subcommands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown %v command %q, see wsctl help", command, args[0])
+	}
+	return run(ctx, args[1:])
+}
+
+// flags returns a flag set with the flags common to every command
+func (c *wsctl) flags(name string, appFlags bool) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&c.config.URL, "url", c.config.URL, "gateway url")
+	if appFlags {
+		fs.StringVar(&c.appID, "app", os.Getenv("WSCTL_APP_ID"), "app id")
+		fs.StringVar(&c.apiKey, "key", os.Getenv("WSCTL_API_KEY"), "api key")
+	}
+	return fs
+}
+
+func (c *wsctl) baseURL() string {
+	return strings.TrimSuffix(c.config.URL, "/")
+}
+
+func (c *wsctl) appClient() (*client.Client, error) {
+	if c.appID == "" || c.apiKey == "" {
+		return nil, errors.New("missing app id or api key, set --app and --key or $WSCTL_APP_ID and $WSCTL_API_KEY")
+	}
+	return client.New(c.baseURL(), c.appID, c.apiKey), nil
+}
+
+// stringsFlag collects a flag that can be repeated
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func (c *wsctl) printJSON(v any) error {
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// login stores a personal access token. Unlike admin sessions, access tokens do not expire,
+// so wsctl keeps working until the token is deleted on the admin page.
+func (c *wsctl) login(ctx context.Context, args []string) error {
+	fs := c.flags("login", false)
+	accessToken := fs.String("token", "", "personal access token, read from stdin if not set")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *accessToken == "" {
+		fmt.Fprint(c.out, "Token: ")
+		line, _ := bufio.NewReader(c.in).ReadString('\n')
+		*accessToken = strings.TrimSpace(line)
+	}
+	c.config.Token = *accessToken
+	// Check the token before storing it
+	err := c.manage(ctx, http.MethodGet, "/apps", nil, nil)
+	if err != nil {
+		return err
+	}
+	err = saveWsctlConfig(c.config)
+	if err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	fmt.Fprintln(c.out, "Logged in")
+	return nil
+}
+
+// manage calls the management api with the access token from login
+func (c *wsctl) manage(ctx context.Context, method string, path string, input any, output any) error {
+	if c.config.Token == "" {
+		return errors.New("not logged in, run wsctl login")
+	}
+	var body io.Reader
+	if input != nil {
+		inputBytes, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(inputBytes)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL()+"/api/v1"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errors.New("invalid access token, run wsctl login")
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return fmt.Errorf("%v: %v", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if output == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(output)
+}
+
+type wsctlOrganization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type wsctlApp struct {
+	ID             string    `json:"id"`
+	OrganizationID string    `json:"organizationId"`
+	Name           string    `json:"name"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+type wsctlUsageDay struct {
+	Day               string `json:"day"`
+	Messages          int64  `json:"messages"`
+	DeliveredBytes    int64  `json:"deliveredBytes"`
+	PeakConnections   int    `json:"peakConnections"`
+	ConnectionMinutes int64  `json:"connectionMinutes"`
+}
+
+type wsctlAppUsage struct {
+	Days  []wsctlUsageDay `json:"days"`
+	Total wsctlUsageDay   `json:"total"`
+}
+
+type wsctlKey struct {
+	ID             string    `json:"id"`
+	OrganizationID string    `json:"organizationId"`
+	KeyPreview     string    `json:"keyPreview"`
+	Apps           []string  `json:"apps"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+func (c *wsctl) listOrganizations(ctx context.Context, args []string) error {
+	if err := c.flags("orgs list", false).Parse(args); err != nil {
+		return err
+	}
+	orgs := make([]wsctlOrganization, 0)
+	err := c.manage(ctx, http.MethodGet, "/organizations", nil, &orgs)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tROLE\tCREATED")
+	for _, org := range orgs {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", org.ID, org.Name, org.Role, org.CreatedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+func (c *wsctl) listApps(ctx context.Context, args []string) error {
+	if err := c.flags("apps list", false).Parse(args); err != nil {
+		return err
+	}
+	apps := make([]wsctlApp, 0)
+	err := c.manage(ctx, http.MethodGet, "/apps", nil, &apps)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tORG\tNAME\tCREATED")
+	for _, app := range apps {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", app.ID, app.OrganizationID, app.Name, app.CreatedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+func (c *wsctl) createApp(ctx context.Context, args []string) error {
+	fs := c.flags("apps create", false)
+	name := fs.String("name", "", "app name")
+	org := fs.String("org", "", "id of the organization to create the app in")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return errors.New("missing --name")
+	}
+	var app json.RawMessage
+	err := c.manage(ctx, http.MethodPost, "/apps", map[string]string{"name": *name, "organizationId": *org}, &app)
+	if err != nil {
+		return err
+	}
+	return c.printJSON(app)
+}
+
+// idArg parses the flags and returns the single positional argument
+func (c *wsctl) idArg(name string, args []string) (string, error) {
+	fs := c.flags(name, false)
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 {
+		return "", fmt.Errorf("%v takes exactly one id", name)
+	}
+	return fs.Arg(0), nil
+}
+
+func (c *wsctl) getApp(ctx context.Context, args []string) error {
+	id, err := c.idArg("apps get", args)
+	if err != nil {
+		return err
+	}
+	var app json.RawMessage
+	err = c.manage(ctx, http.MethodGet, "/apps/"+url.PathEscape(id), nil, &app)
+	if err != nil {
+		return err
+	}
+	return c.printJSON(app)
+}
+
+func (c *wsctl) updateApp(ctx context.Context, args []string) error {
+	fs := c.flags("apps update", false)
+	file := fs.String("file", "-", "file with the JSON fields to change, - for stdin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("apps update takes exactly one id")
+	}
+	data, err := c.readInput(*file)
+	if err != nil {
+		return err
+	}
+	var input json.RawMessage
+	err = json.Unmarshal(data, &input)
+	if err != nil {
+		return fmt.Errorf("input must be JSON: %w", err)
+	}
+	var app json.RawMessage
+	err = c.manage(ctx, http.MethodPut, "/apps/"+url.PathEscape(fs.Arg(0)), input, &app)
+	if err != nil {
+		return err
+	}
+	return c.printJSON(app)
+}
+
+// readInput reads all of file, or stdin if file is -
+func (c *wsctl) readInput(file string) ([]byte, error) {
+	if file == "-" {
+		return io.ReadAll(c.in)
+	}
+	return os.ReadFile(file)
+}
+
+func (c *wsctl) deleteApp(ctx context.Context, args []string) error {
+	id, err := c.idArg("apps delete", args)
+	if err != nil {
+		return err
+	}
+	return c.manage(ctx, http.MethodDelete, "/apps/"+url.PathEscape(id), nil, nil)
+}
+
+func (c *wsctl) appUsage(ctx context.Context, args []string) error {
+	fs := c.flags("apps usage", false)
+	from := fs.String("from", "", "first day, default the 30 days up to --to")
+	to := fs.String("to", "", "last day, default today")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("apps usage takes exactly one id")
+	}
+	query := url.Values{}
+	if *from != "" {
+		query.Set("from", *from)
+	}
+	if *to != "" {
+		query.Set("to", *to)
+	}
+	usage := wsctlAppUsage{}
+	err := c.manage(ctx, http.MethodGet, "/apps/"+url.PathEscape(fs.Arg(0))+"/usage?"+query.Encode(), nil, &usage)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DAY	MESSAGES	BYTES	PEAK CONNECTIONS	CONNECTION MINUTES")
+	for _, day := range append(usage.Days, usage.Total) {
+		if day.Day == "" {
+			day.Day = "total"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", day.Day, day.Messages, day.DeliveredBytes, day.PeakConnections, day.ConnectionMinutes)
+	}
+	return tw.Flush()
+}
+
+func (c *wsctl) listKeys(ctx context.Context, args []string) error {
+	if err := c.flags("keys list", false).Parse(args); err != nil {
+		return err
+	}
+	keys := make([]wsctlKey, 0)
+	err := c.manage(ctx, http.MethodGet, "/keys", nil, &keys)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tORG\tPREVIEW\tAPPS\tCREATED")
+	for _, key := range keys {
+		fmt.Fprintf(tw, "%v\t%v\t%v...\t%v\t%v\n", key.ID, key.OrganizationID, key.KeyPreview, strings.Join(key.Apps, ","), key.CreatedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+func (c *wsctl) createKey(ctx context.Context, args []string) error {
+	fs := c.flags("keys create", false)
+	apps := stringsFlag{}
+	fs.Var(&apps, "app", "id of an app the key gives access to, can be repeated")
+	org := fs.String("org", "", "id of the organization to create the key in")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	input := map[string]any{"apps": nonNilApps(apps), "organizationId": *org}
+	var key json.RawMessage
+	err := c.manage(ctx, http.MethodPost, "/keys", input, &key)
+	if err != nil {
+		return err
+	}
+	return c.printJSON(key)
+}
+
+func nonNilApps(apps stringsFlag) []string {
+	if apps == nil {
+		return []string{}
+	}
+	return apps
+}
+
+func (c *wsctl) getKey(ctx context.Context, args []string) error {
+	id, err := c.idArg("keys get", args)
+	if err != nil {
+		return err
+	}
+	var key json.RawMessage
+	err = c.manage(ctx, http.MethodGet, "/keys/"+url.PathEscape(id), nil, &key)
+	if err != nil {
+		return err
+	}
+	return c.printJSON(key)
+}
+
+// updateKeyAccess replaces the apps the key gives access to
+func (c *wsctl) updateKeyAccess(ctx context.Context, args []string) error {
+	fs := c.flags("keys access", false)
+	apps := stringsFlag{}
+	fs.Var(&apps, "app", "id of an app the key gives access to, can be repeated")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("keys access takes exactly one id")
+	}
+	var key json.RawMessage
+	err := c.manage(ctx, http.MethodPut, "/keys/"+url.PathEscape(fs.Arg(0))+"/apps", map[string][]string{"apps": nonNilApps(apps)}, &key)
+	if err != nil {
+		return err
+	}
+	return c.printJSON(key)
+}
+
+func (c *wsctl) deleteKey(ctx context.Context, args []string) error {
+	id, err := c.idArg("keys delete", args)
+	if err != nil {
+		return err
+	}
+	return c.manage(ctx, http.MethodDelete, "/keys/"+url.PathEscape(id), nil, nil)
+}
+
+func (c *wsctl) ticket(ctx context.Context, args []string) error {
+	fs := c.flags("ticket", true)
+	user := fs.String("user", "", "user id")
+	topic := fs.String("topic", "", "topic")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *user == "" || *topic == "" {
+		return errors.New("missing --user or --topic")
+	}
+	appClient, err := c.appClient()
+	if err != nil {
+		return err
+	}
+	token, err := appClient.CreateTicket(ctx, *user, *topic)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, token)
+	return nil
+}
+
+// broadcast sends the payload read from a file or stdin. With --lines every line is a payload.
+func (c *wsctl) broadcast(ctx context.Context, args []string) error {
+	fs := c.flags("broadcast", true)
+	topic := fs.String("topic", "", "topic")
+	event := fs.String("event", "", "event name")
+	ttl := fs.Duration("ttl", 0, "drop the message if not delivered within ttl")
+	file := fs.String("file", "-", "file with the JSON payload, - for stdin")
+	lines := fs.Bool("lines", false, "broadcast every line as a separate payload")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *topic == "" {
+		return errors.New("missing --topic")
+	}
+	appClient, err := c.appClient()
+	if err != nil {
+		return err
+	}
+	in := c.in
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	send := func(data []byte) error {
+		payload := make(map[string]any)
+		err := json.Unmarshal(data, &payload)
+		if err != nil {
+			return fmt.Errorf("payload must be a JSON object: %w", err)
+		}
+		return appClient.Broadcast(ctx, *topic, client.Broadcast{Event: *event, Payload: payload, TTL: *ttl})
+	}
+	if !*lines {
+		data, err := io.ReadAll(in)
+		if err != nil {
+			return err
+		}
+		return send(data)
+	}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		err := send(line)
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// tail prints messages on the topic until interrupted, reconnecting with a new ticket when disconnected
+func (c *wsctl) tail(ctx context.Context, args []string) error {
+	fs := c.flags("tail", true)
+	topic := fs.String("topic", "", "topic")
+	user := fs.String("user", "", "user id to create tickets for")
+	filter := fs.String("filter", "", "only show messages matching the CEL expression")
+	raw := fs.Bool("raw", false, "print messages as received, one per line")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *topic == "" || *user == "" {
+		return errors.New("missing --topic or --user")
+	}
+	appClient, err := c.appClient()
+	if err != nil {
+		return err
+	}
+	ticket := func(ctx context.Context) (string, error) {
+		return appClient.CreateTicket(ctx, *user, *topic)
+	}
+	sub := client.Subscribe(ctx, c.baseURL(), c.appID, *topic, ticket,
+		client.WithFilter(*filter),
+		client.OnConnect(func() {
+			fmt.Fprintln(os.Stderr, "connected to", *topic)
+		}),
+		client.OnDisconnect(func(err error) {
+			fmt.Fprintln(os.Stderr, "disconnected:", err)
+		}),
+	)
+	defer sub.Close()
+	for msg := range sub.Messages() {
+		if *raw {
+			fmt.Fprintln(c.out, string(msg.Payload))
+			continue
+		}
+		c.printMessage(msg)
+	}
+	return nil
+}
+
+func (c *wsctl) printMessage(msg client.Message) {
+	header := make([]string, 0)
+	if msg.Topic != "" {
+		header = append(header, "topic="+msg.Topic)
+	}
+	if msg.Event != "" {
+		header = append(header, "event="+msg.Event)
+	}
+	if msg.Seq != 0 {
+		header = append(header, fmt.Sprintf("seq=%d", msg.Seq))
+	}
+	if msg.ID != "" {
+		header = append(header, "id="+msg.ID)
+	}
+	fmt.Fprintf(c.out, "--- %v %v\n", time.Now().Format(time.TimeOnly), strings.Join(header, " "))
+	pretty := bytes.Buffer{}
+	if err := json.Indent(&pretty, msg.Payload, "", "  "); err != nil {
+		fmt.Fprintln(c.out, string(msg.Payload))
+		return
+	}
+	fmt.Fprintln(c.out, pretty.String())
+}
@@ -0,0 +1,172 @@
+// Package config loads the settings of the gateway server.
+//
+// Settings come from defaults, a YAML or TOML file, environment variables and flags, where later sources
+// take precedence over earlier ones. The file is given by --config or $WS_GATEWAY_CONFIG, and is read as
+// TOML if its name ends in .toml. Both formats use the same keys, see config.example.yaml.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Config is the configuration of the gateway server. Every setting has a yaml key,
+// and most have an environment variable and a flag. Secrets have no flag, as flags are visible to other users of the machine.
+type Config struct {
+	Env       string          `yaml:"env" env:"ENV" flag:"env" help:"name of the environment, e.g. dev or prod"`
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Firebase  FirebaseConfig  `yaml:"firebase"`
+	Websocket WebsocketConfig `yaml:"websocket"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+}
+
+type ServerConfig struct {
+	Port        int `yaml:"port" env:"PORT" flag:"port" help:"port of the http server"`
+	GrpcPort    int `yaml:"grpc_port" env:"GRPC_PORT" flag:"grpc-port" help:"port of the grpc server"`
+	MetricsPort int `yaml:"metrics_port" env:"METRICS_PORT" flag:"metrics-port" help:"port serving prometheus metrics on /metrics"`
+}
+
+type DatabaseConfig struct {
+	Driver     string `yaml:"driver" env:"DATABASE_DRIVER" flag:"database-driver" help:"postgres, sqlite or memory. memory keeps nothing when the server stops"`
+	URL        string `yaml:"url" env:"DATABASE_CONNECTION_POOL_URL" secret:"true" help:"postgres connection url"`
+	MaxConns   int    `yaml:"max_conns" env:"DATABASE_MAX_CONNS" flag:"database-max-conns" help:"size of the postgres connection pool"`
+	SqlitePath string `yaml:"sqlite_path" env:"DATABASE_SQLITE_PATH" flag:"database-sqlite-path" help:"sqlite database file, created if it does not exist"`
+}
+
+// Database drivers. sqlite and memory are for running the gateway locally, as they can not be shared by several instances.
+const (
+	DriverPostgres = "postgres"
+	DriverSqlite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
+type FirebaseConfig struct {
+	ProjectID       string `yaml:"project_id" env:"FIREBASE_PROJECT_ID" flag:"firebase-project-id" help:"firebase project of the users"`
+	WebAPIKey       string `yaml:"web_api_key" env:"FIREBASE_WEB_API_KEY" secret:"true" help:"firebase web api key, used to sign in users"`
+	CredentialsJSON string `yaml:"credentials_json" env:"GOOGLE_APPLICATION_CREDENTIALS_CONTENT" secret:"true" help:"service account credentials, as JSON"`
+}
+
+type WebsocketConfig struct {
+	ReadBufferSize  int `yaml:"read_buffer_size" env:"WS_READ_BUFFER_SIZE" flag:"ws-read-buffer-size" help:"read buffer size of websocket connections, in bytes"`
+	WriteBufferSize int `yaml:"write_buffer_size" env:"WS_WRITE_BUFFER_SIZE" flag:"ws-write-buffer-size" help:"write buffer size of websocket connections, in bytes"`
+}
+
+type TracingConfig struct {
+	OTLPEndpoint string `yaml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" flag:"otlp-endpoint" help:"OTLP/HTTP endpoint to export spans to, e.g. http://localhost:4318. Tracing is off if empty"`
+}
+
+// maxBufferSize keeps a typo in a buffer size from using all memory, as every connection gets its own buffers
+const maxBufferSize = 1 << 20
+
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:        9090,
+			GrpcPort:    9092,
+			MetricsPort: 9091,
+		},
+		Database: DatabaseConfig{
+			Driver:     DriverPostgres,
+			MaxConns:   16,
+			SqlitePath: "ws-gateway.db",
+		},
+		Websocket: WebsocketConfig{
+			ReadBufferSize:  2 << 10,
+			WriteBufferSize: 2 << 10,
+		},
+	}
+}
+
+// Validate returns every invalid setting, naming where each value came from
+func (c Config) Validate(sources Sources) error {
+	errs := make([]error, 0)
+	invalid := func(key string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%v %v, set by %v", key, fmt.Sprintf(format, args...), sources.of(key)))
+	}
+	required := func(key string) {
+		errs = append(errs, fmt.Errorf("%v is required, set it in %v", key, strings.Join(settingSources(key), " or ")))
+	}
+
+	ports := map[string]int{
+		"server.port":         c.Server.Port,
+		"server.grpc_port":    c.Server.GrpcPort,
+		"server.metrics_port": c.Server.MetricsPort,
+	}
+	usedBy := make(map[int]string)
+	for _, key := range []string{"server.port", "server.grpc_port", "server.metrics_port"} {
+		port := ports[key]
+		if port < 1 || port > 65535 {
+			invalid(key, "must be between 1 and 65535, got %v", port)
+			continue
+		}
+		if other, ok := usedBy[port]; ok {
+			invalid(key, "must differ from %v, both are %v", other, port)
+			continue
+		}
+		usedBy[port] = key
+	}
+
+	switch c.Database.Driver {
+	case DriverPostgres:
+		if c.Database.URL == "" {
+			required("database.url")
+		} else if u, err := url.Parse(c.Database.URL); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			// The url is not part of the error, as it holds the password
+			invalid("database.url", "must be a postgres:// url")
+		}
+		if c.Database.MaxConns < 1 {
+			invalid("database.max_conns", "must be at least 1, got %v", c.Database.MaxConns)
+		}
+	case DriverSqlite:
+		if c.Database.SqlitePath == "" {
+			required("database.sqlite_path")
+		}
+	case DriverMemory:
+	default:
+		invalid("database.driver", "must be %v, %v or %v, got %q", DriverPostgres, DriverSqlite, DriverMemory, c.Database.Driver)
+	}
+
+	if c.Firebase.ProjectID == "" {
+		required("firebase.project_id")
+	}
+	if c.Firebase.WebAPIKey == "" {
+		required("firebase.web_api_key")
+	}
+
+	if c.Websocket.ReadBufferSize < 1 || c.Websocket.ReadBufferSize > maxBufferSize {
+		invalid("websocket.read_buffer_size", "must be between 1 and %v, got %v", maxBufferSize, c.Websocket.ReadBufferSize)
+	}
+	if c.Websocket.WriteBufferSize < 1 || c.Websocket.WriteBufferSize > maxBufferSize {
+		invalid("websocket.write_buffer_size", "must be between 1 and %v, got %v", maxBufferSize, c.Websocket.WriteBufferSize)
+	}
+
+	if c.Tracing.OTLPEndpoint != "" {
+		u, err := url.Parse(c.Tracing.OTLPEndpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("tracing.otlp_endpoint", "must be an http:// or https:// url, got %q", c.Tracing.OTLPEndpoint)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// settingSources lists the ways to set the setting, for error messages
+func settingSources(key string) []string {
+	c := Config{}
+	for _, s := range settings(&c) {
+		if s.key != key {
+			continue
+		}
+		list := []string{"the config file"}
+		if s.env != "" {
+			list = append(list, "$"+s.env)
+		}
+		if s.flag != "" {
+			list = append(list, "--"+s.flag)
+		}
+		return list
+	}
+	return nil
+}
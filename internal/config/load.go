@@ -0,0 +1,355 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv is the environment variable naming the config file, used if --config is not given
+const FileEnv = "WS_GATEWAY_CONFIG"
+
+const sourceDefault = "default"
+
+// Sources tells where the value of each setting came from, keyed by yaml path like server.port
+type Sources map[string]string
+
+func (s Sources) of(key string) string {
+	if source, ok := s[key]; ok {
+		return source
+	}
+	return sourceDefault
+}
+
+// setting is a leaf of Config, see the struct tags on Config
+type setting struct {
+	key    string
+	env    string
+	flag   string
+	help   string
+	secret bool
+	value  reflect.Value
+}
+
+// settings returns the settings of c in field order. The values point into c.
+func settings(c *Config) []setting {
+	return appendSettings(nil, "", reflect.ValueOf(c).Elem())
+}
+
+func appendSettings(list []setting, prefix string, v reflect.Value) []setting {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := field.Tag.Get("yaml")
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if field.Type.Kind() == reflect.Struct {
+			list = appendSettings(list, key, v.Field(i))
+			continue
+		}
+		list = append(list, setting{
+			key:    key,
+			env:    field.Tag.Get("env"),
+			flag:   field.Tag.Get("flag"),
+			help:   field.Tag.Get("help"),
+			secret: field.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+	return list
+}
+
+// set parses raw into the setting
+func (s setting) set(raw string) error {
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("must be a whole number, got %q", raw)
+		}
+		s.value.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("must be true or false, got %q", raw)
+		}
+		s.value.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %v", s.value.Type())
+	}
+	return nil
+}
+
+// Load returns the configuration from defaults, the config file, environment variables and args, in increasing order of precedence.
+// getenv is usually os.Getenv. The configuration is not validated, see Validate.
+func Load(name string, args []string, getenv func(string) string) (Config, Sources, error) {
+	c := Default()
+	sources := make(Sources)
+	list := settings(&c)
+
+	// Flags are parsed first to find the config file, and applied last
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	file := fs.String("config", getenv(FileEnv), "YAML or TOML config file, default $"+FileEnv)
+	flagValues := make(map[string]string)
+	for _, s := range list {
+		if s.flag == "" {
+			continue
+		}
+		fs.Func(s.flag, s.help, func(raw string) error {
+			flagValues[s.flag] = raw
+			return nil
+		})
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return c, sources, err
+	}
+	if fs.NArg() > 0 {
+		return c, sources, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	if *file != "" {
+		err = loadFile(*file, list, sources)
+		if err != nil {
+			return c, sources, err
+		}
+	}
+
+	errs := make([]error, 0)
+	for _, s := range list {
+		if s.env == "" {
+			continue
+		}
+		raw := getenv(s.env)
+		if raw == "" {
+			continue
+		}
+		if err := s.set(raw); err != nil {
+			errs = append(errs, fmt.Errorf("env %v for %v %w", s.env, s.key, err))
+			continue
+		}
+		sources[s.key] = "env " + s.env
+	}
+	for _, s := range list {
+		raw, ok := flagValues[s.flag]
+		if !ok {
+			continue
+		}
+		if err := s.set(raw); err != nil {
+			errs = append(errs, fmt.Errorf("flag --%v for %v %w", s.flag, s.key, err))
+			continue
+		}
+		sources[s.key] = "flag --" + s.flag
+	}
+	return c, sources, errors.Join(errs...)
+}
+
+// loadFile applies the settings of a YAML file, or a TOML file if the name ends in .toml.
+// Both use the keys of the yaml tags, with sections as mappings or tables.
+func loadFile(path string, list []setting, sources Sources) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	l := newFileLoader(path, list, sources)
+	if strings.HasSuffix(strings.ToLower(path), ".toml") {
+		return l.loadToml(data)
+	}
+	return l.loadYaml(data)
+}
+
+// fileLoader applies the values of a config file to the settings
+type fileLoader struct {
+	path     string
+	byKey    map[string]setting
+	sections map[string]bool
+	sources  Sources
+}
+
+func newFileLoader(path string, list []setting, sources Sources) *fileLoader {
+	l := &fileLoader{
+		path:     path,
+		byKey:    make(map[string]setting, len(list)),
+		sections: make(map[string]bool),
+		sources:  sources,
+	}
+	for _, s := range list {
+		l.byKey[s.key] = s
+		parts := strings.Split(s.key, ".")
+		for i := 1; i < len(parts); i++ {
+			l.sections[strings.Join(parts[:i], ".")] = true
+		}
+	}
+	return l
+}
+
+// errorf prefixes the error with the file, and the line if it is known
+func (l *fileLoader) errorf(line int, format string, args ...any) error {
+	if line > 0 {
+		return fmt.Errorf("%v line %v: %w", l.path, line, fmt.Errorf(format, args...))
+	}
+	return fmt.Errorf("%v: %w", l.path, fmt.Errorf(format, args...))
+}
+
+// lookup returns the setting of key. isSection is true if key is a section instead, anything else is an unknown setting.
+func (l *fileLoader) lookup(key string, line int) (s setting, isSection bool, err error) {
+	if s, ok := l.byKey[key]; ok {
+		return s, false, nil
+	}
+	if l.sections[key] {
+		return s, true, nil
+	}
+	return s, false, l.errorf(line, "unknown setting %v", key)
+}
+
+func (l *fileLoader) set(s setting, raw string, line int) error {
+	if err := s.set(raw); err != nil {
+		return l.errorf(line, "%v %w", s.key, err)
+	}
+	l.sources[s.key] = "file " + l.path
+	return nil
+}
+
+func (l *fileLoader) loadYaml(data []byte) error {
+	root := yaml.Node{}
+	err := yaml.Unmarshal(data, &root)
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %v: %w", l.path, err)
+	}
+	if len(root.Content) == 0 {
+		// Empty file
+		return nil
+	}
+	var walk func(node *yaml.Node, prefix string) error
+	walk = func(node *yaml.Node, prefix string) error {
+		if node.Kind != yaml.MappingNode {
+			if prefix == "" {
+				return l.errorf(node.Line, "must be a mapping of settings")
+			}
+			return l.errorf(node.Line, "%v must be a mapping of settings", prefix)
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valueNode := node.Content[i], node.Content[i+1]
+			key := keyNode.Value
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			s, isSection, err := l.lookup(key, keyNode.Line)
+			if err != nil {
+				return err
+			}
+			if isSection {
+				if err := walk(valueNode, key); err != nil {
+					return err
+				}
+				continue
+			}
+			if valueNode.Kind != yaml.ScalarNode {
+				return l.errorf(valueNode.Line, "%v must be a single value", key)
+			}
+			if err := l.set(s, valueNode.Value, valueNode.Line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(root.Content[0], "")
+}
+
+// loadToml walks the keys in the order of the file. The TOML parser does not report the lines of keys.
+func (l *fileLoader) loadToml(data []byte) error {
+	values := make(map[string]any)
+	md, err := toml.Decode(string(data), &values)
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %v: %w", l.path, err)
+	}
+	for _, tomlKey := range md.Keys() {
+		key := strings.Join(tomlKey, ".")
+		s, isSection, err := l.lookup(key, 0)
+		if err != nil {
+			return err
+		}
+		value := tomlValue(values, tomlKey)
+		_, isTable := value.(map[string]any)
+		if isSection {
+			if !isTable {
+				return l.errorf(0, "%v must be a table of settings", key)
+			}
+			continue
+		}
+		switch value.(type) {
+		case map[string]any, []any, []map[string]any:
+			return l.errorf(0, "%v must be a single value", key)
+		}
+		if err := l.set(s, fmt.Sprint(value), 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tomlValue returns the decoded value of key
+func tomlValue(values map[string]any, key toml.Key) any {
+	var value any = values
+	for _, part := range key {
+		table, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = table[part]
+	}
+	return value
+}
+
+const maskedSecret = "********"
+
+// Print writes the configuration as YAML, with the source of each value as a comment. Secrets are masked.
+func Print(w io.Writer, c Config, sources Sources) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sectionNodes := map[string]*yaml.Node{"": root}
+	for _, s := range settings(&c) {
+		parent := root
+		parts := strings.Split(s.key, ".")
+		for i := 1; i < len(parts); i++ {
+			section := strings.Join(parts[:i], ".")
+			node, ok := sectionNodes[section]
+			if !ok {
+				node = &yaml.Node{Kind: yaml.MappingNode}
+				parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: parts[i-1]}, node)
+				sectionNodes[section] = node
+			}
+			parent = node
+		}
+		value := &yaml.Node{Kind: yaml.ScalarNode, LineComment: sources.of(s.key)}
+		switch {
+		case s.secret && s.value.String() != "":
+			value.Value = maskedSecret
+		case s.value.Kind() == reflect.String:
+			value.Value = s.value.String()
+			value.Tag = "!!str"
+			if value.Value == "" {
+				value.Style = yaml.DoubleQuotedStyle
+			}
+		default:
+			value.Value = fmt.Sprint(s.value.Interface())
+		}
+		parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: parts[len(parts)-1]}, value)
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	err := encoder.Encode(root)
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
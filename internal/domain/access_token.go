@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// AccessToken is a personal access token, used instead of an admin session with the management api
+type AccessToken struct {
+	ID           string
+	OwnerUserID  string
+	Name         string
+	TokenHash    string
+	TokenPreview string
+	LastUsedAt   *time.Time
+	CreatedAt    time.Time
+}
+
+type AccessTokenRepository interface {
+	GetByID(ctx context.Context, id string) (AccessToken, error)
+	GetByUserID(ctx context.Context, userID string) ([]AccessToken, error)
+	Create(context.Context, *AccessToken) error
+	UpdateTokenPreview(ctx context.Context, id string, tokenPreview string) error
+	UpdateLastUsed(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string) error
+}
@@ -2,20 +2,61 @@ package domain
 
 import (
 	"context"
+	"slices"
 	"time"
 )
 
 type Application struct {
-	ID          string
-	OwnerUserID string
-	Name        string
-	CreatedAt   time.Time
-	UpdatedAt   *time.Time
+	ID string
+	// OwnerUserID is the user that created the app, access is given by the organization
+	OwnerUserID    string
+	OrganizationID string
+	Name           string
+	CreatedAt      time.Time
+	UpdatedAt      *time.Time
+
+	// Lifecycle events are POSTed to WebhookURL, signed with WebhookSecret
+	WebhookURL    string
+	WebhookSecret string
+	WebhookEvents []string
+
+	// PusherEnabled accepts pusher-js clients and Pusher trigger requests for the app,
+	// signed with the pusher secret of an api key with access to it
+	PusherEnabled bool
+
+	// Messages on ReliableTopics must be acknowledged by clients, and are redelivered
+	// every AckTimeoutSeconds until they are, at most MaxDeliveryAttempts times
+	ReliableTopics      []string
+	AckTimeoutSeconds   int
+	MaxDeliveryAttempts int
+
+	// Messages on SequencedTopics are numbered and kept for a while, so clients can detect and fill gaps
+	SequencedTopics []string
+}
+
+const (
+	DefaultAckTimeoutSeconds   = 30
+	DefaultMaxDeliveryAttempts = 5
+)
+
+// IsReliableTopic reports whether messages on topic are delivered at least once
+func (a Application) IsReliableTopic(topic string) bool {
+	return slices.Contains(a.ReliableTopics, topic)
+}
+
+// IsSequencedTopic reports whether messages on topic get sequence numbers
+func (a Application) IsSequencedTopic(topic string) bool {
+	return slices.Contains(a.SequencedTopics, topic)
+}
+
+// WantsWebhook reports whether the app has a webhook configured for the given event
+func (a Application) WantsWebhook(event string) bool {
+	return a.WebhookURL != "" && slices.Contains(a.WebhookEvents, event)
 }
 
 type ApplicationRepository interface {
 	GetByID(context.Context, string) (Application, error)
-	GetByUserID(context.Context, string) ([]Application, error)
+	GetByOrganizationIDs(ctx context.Context, organizationIDs []string) ([]Application, error)
 	Update(context.Context, *Application) error
 	Create(context.Context, *Application) error
 	Delete(context.Context, string) error
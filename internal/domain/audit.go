@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditActionLogin       = "auth.login"
+	AuditActionLoginFailed = "auth.login_failed"
+
+	AuditActionAppCreate = "app.create"
+	AuditActionAppUpdate = "app.update"
+	AuditActionAppDelete = "app.delete"
+
+	AuditActionKeyCreate = "key.create"
+	AuditActionKeyUpdate = "key.update"
+	AuditActionKeyDelete = "key.delete"
+
+	AuditActionRoutingRuleCreate = "routing_rule.create"
+	AuditActionRoutingRuleUpdate = "routing_rule.update"
+	AuditActionRoutingRuleDelete = "routing_rule.delete"
+
+	AuditActionAccessTokenCreate = "access_token.create"
+	AuditActionAccessTokenDelete = "access_token.delete"
+
+	AuditActionOrganizationCreate   = "organization.create"
+	AuditActionOrganizationUpdate   = "organization.update"
+	AuditActionOrganizationDelete   = "organization.delete"
+	AuditActionOrganizationTransfer = "organization.transfer"
+	AuditActionMemberAdd            = "member.add"
+	AuditActionMemberUpdate         = "member.update"
+	AuditActionMemberRemove         = "member.remove"
+
+	AuditActionTopicPublish = "topic.publish"
+)
+
+// AuditActions lists every action written to the audit log
+var AuditActions = []string{
+	AuditActionLogin,
+	AuditActionLoginFailed,
+	AuditActionAppCreate,
+	AuditActionAppUpdate,
+	AuditActionAppDelete,
+	AuditActionKeyCreate,
+	AuditActionKeyUpdate,
+	AuditActionKeyDelete,
+	AuditActionRoutingRuleCreate,
+	AuditActionRoutingRuleUpdate,
+	AuditActionRoutingRuleDelete,
+	AuditActionAccessTokenCreate,
+	AuditActionAccessTokenDelete,
+	AuditActionOrganizationCreate,
+	AuditActionOrganizationUpdate,
+	AuditActionOrganizationDelete,
+	AuditActionOrganizationTransfer,
+	AuditActionMemberAdd,
+	AuditActionMemberUpdate,
+	AuditActionMemberRemove,
+	AuditActionTopicPublish,
+}
+
+// AuditEvent records an administrative or security relevant action. Audit events are never updated or deleted.
+type AuditEvent struct {
+	ID string
+	// ActorUserID is empty for failed logins, where only ActorEmail is known
+	ActorUserID string
+	ActorEmail  string
+	// OrganizationID is empty for events outside an organization, like logins and personal access tokens
+	OrganizationID string
+	Action         string
+	TargetType     string
+	TargetID       string
+	// Before and After are JSON snapshots of the target, without secrets. They are null when the target did not exist.
+	Before    json.RawMessage
+	After     json.RawMessage
+	IP        string
+	UserAgent string
+	CreatedAt time.Time
+}
+
+// AuditEventFilter selects audit events. Empty fields match everything.
+type AuditEventFilter struct {
+	// OrganizationIDs and UserID limit the events to those in one of the organizations, or done by the user
+	OrganizationIDs []string
+	UserID          string
+	// Actor matches the user id or email of the actor
+	Actor    string
+	Action   string
+	TargetID string
+	From     time.Time
+	To       time.Time
+	// Limit of 0 returns every matching event
+	Limit int
+}
+
+type AuditEventRepository interface {
+	// Get returns the events matching the filter, newest first
+	Get(ctx context.Context, filter AuditEventFilter) ([]AuditEvent, error)
+	Create(context.Context, *AuditEvent) error
+}
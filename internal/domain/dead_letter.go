@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// DeadLetter is a message on a reliable topic that a user never acknowledged
+type DeadLetter struct {
+	ID        string
+	AppID     string
+	Topic     string
+	UserID    string
+	MessageID string
+	Event     string
+	Payload   json.RawMessage
+	Attempts  int
+	Reason    string
+	CreatedAt time.Time
+}
+
+type DeadLetterRepository interface {
+	GetByAppID(ctx context.Context, appID string, limit int) ([]DeadLetter, error)
+	Create(context.Context, *DeadLetter) error
+	Delete(ctx context.Context, appID string, id string) error
+}
@@ -6,13 +6,18 @@ import (
 )
 
 type ApiKey struct {
-	ID          string
-	OwnerUserID string
-	KeyHash     string
-	KeyPreview  string
-	CreatedAt   time.Time
-	UpdatedAt   *time.Time
-	Access      []ApiKeyAccess
+	ID string
+	// OwnerUserID is the user that created the key, access is given by the organization
+	OwnerUserID    string
+	OrganizationID string
+	KeyHash        string
+	KeyPreview     string
+	// PusherSecret signs Pusher channel auth and trigger requests made with the key. Pusher server
+	// libraries sign requests instead of sending the key, so it is stored as is, unlike the key.
+	PusherSecret string
+	CreatedAt    time.Time
+	UpdatedAt    *time.Time
+	Access       []ApiKeyAccess
 }
 
 type ApiKeyAccess struct {
@@ -22,7 +27,7 @@ type ApiKeyAccess struct {
 
 type ApiKeyRepository interface {
 	GetByID(context.Context, string) (ApiKey, error)
-	GetByUserID(context.Context, string) ([]ApiKey, error)
+	GetByOrganizationIDs(ctx context.Context, organizationIDs []string) ([]ApiKey, error)
 	GetByAppID(context.Context, string) ([]ApiKey, error)
 	Create(context.Context, *ApiKey) error
 	Update(ctx context.Context, apiKeyID string, accessList []ApiKeyAccess) error
@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Organization owns apps and keys, and gives its members access to them by role
+type Organization struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt *time.Time
+}
+
+type Role string
+
+const (
+	// RoleOwner can do everything, including transferring ownership and deleting the organization.
+	// An organization has exactly one owner.
+	RoleOwner Role = "owner"
+	// RoleAdmin can create and delete apps and keys, and manage members
+	RoleAdmin Role = "admin"
+	// RoleDeveloper can edit apps and create keys
+	RoleDeveloper Role = "developer"
+	// RoleViewer can only view apps and keys
+	RoleViewer Role = "viewer"
+)
+
+var Roles = []Role{RoleOwner, RoleAdmin, RoleDeveloper, RoleViewer}
+
+// Permission is something a role may be allowed to do. Each role has the permissions of the roles below it.
+type Permission int
+
+const (
+	PermissionView Permission = iota
+	PermissionEdit
+	PermissionDelete
+	PermissionManageMembers
+	PermissionManageOrganization
+)
+
+// rolePermissions is the highest permission of each role
+var rolePermissions = map[Role]Permission{
+	RoleViewer:    PermissionView,
+	RoleDeveloper: PermissionEdit,
+	RoleAdmin:     PermissionManageMembers,
+	RoleOwner:     PermissionManageOrganization,
+}
+
+// Can reports whether the role has the permission. Unknown roles, including the empty role of non-members, have none.
+func (r Role) Can(p Permission) bool {
+	highest, ok := rolePermissions[r]
+	return ok && p <= highest
+}
+
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+type OrganizationMember struct {
+	OrganizationID string
+	UserID         string
+	// Email is the email the member was invited with, it is empty for members added by migrations
+	Email     string
+	Role      Role
+	CreatedAt time.Time
+}
+
+type OrganizationRepository interface {
+	GetByID(ctx context.Context, id string) (Organization, error)
+	GetByUserID(ctx context.Context, userID string) ([]Organization, error)
+	// Create creates the organization with owner as its first member
+	Create(ctx context.Context, org *Organization, owner *OrganizationMember) error
+	Update(context.Context, *Organization) error
+	Delete(ctx context.Context, id string) error
+
+	GetMembers(ctx context.Context, organizationID string) ([]OrganizationMember, error)
+	GetMember(ctx context.Context, organizationID string, userID string) (OrganizationMember, error)
+	GetMembershipsByUserID(ctx context.Context, userID string) ([]OrganizationMember, error)
+	AddMember(context.Context, *OrganizationMember) error
+	UpdateMemberRole(ctx context.Context, organizationID string, userID string, role Role) error
+	RemoveMember(ctx context.Context, organizationID string, userID string) error
+	// TransferOwnership makes toUserID the owner, and fromUserID an admin
+	TransferOwnership(ctx context.Context, organizationID string, fromUserID string, toUserID string) error
+}
@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// RoutingRule delivers messages broadcast to topics matching SourceTopic to TargetTopic as well
+type RoutingRule struct {
+	ID    string
+	AppID string
+	// SourceTopic is a topic name, or a pattern with + and # wildcards like subscriptions
+	SourceTopic string
+	// Condition is an optional CEL expression on event and payload
+	Condition string
+	// TargetTopic can contain {field} placeholders that are replaced with payload fields
+	TargetTopic string
+	// Transform is an optional CEL expression whose result replaces the payload
+	Transform string
+	CreatedAt time.Time
+	UpdatedAt *time.Time
+}
+
+type RoutingRuleRepository interface {
+	GetByID(ctx context.Context, id string) (RoutingRule, error)
+	GetByAppID(ctx context.Context, appID string) ([]RoutingRule, error)
+	Create(context.Context, *RoutingRule) error
+	Update(context.Context, *RoutingRule) error
+	Delete(ctx context.Context, id string) error
+}
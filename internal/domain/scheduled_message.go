@@ -0,0 +1,34 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// ScheduledMessage is a broadcast that is published at DeliverAt
+type ScheduledMessage struct {
+	ID      string
+	AppID   string
+	Topic   string
+	Event   string
+	Payload json.RawMessage
+	// TTLSeconds is counted from DeliverAt, 0 means no ttl
+	TTLSeconds int
+	DeliverAt  time.Time
+	CreatedAt  time.Time
+	// ClaimedUntil is set while a gateway instance is delivering the message, see ClaimDue
+	ClaimedUntil *time.Time
+}
+
+type ScheduledMessageRepository interface {
+	GetByAppID(ctx context.Context, appID string, limit int) ([]ScheduledMessage, error)
+	Create(context.Context, *ScheduledMessage) error
+	// Delete returns ErrNotFound if the message does not exist, or has already been delivered.
+	// It is also used to remove messages once they are delivered.
+	Delete(ctx context.Context, appID string, id string) error
+	// ClaimDue returns messages due at now that are not claimed, and claims them until now+lease.
+	// A message is only returned to one claim at a time, also with several gateway instances claiming
+	// concurrently. Claimed messages are kept until deleted, and can be claimed again once the lease has passed.
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]ScheduledMessage, error)
+}
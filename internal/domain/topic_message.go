@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// TopicMessage is a message broadcast on a sequenced topic
+type TopicMessage struct {
+	AppID string
+	Topic string
+	Seq   int64
+	// SourceTopic is the topic the message was broadcast to, if Topic is a wildcard topic
+	SourceTopic string
+	Event       string
+	Payload     json.RawMessage
+	// ExpiresAt is nil for messages without a ttl
+	ExpiresAt *time.Time
+	CreatedAt time.Time
+}
+
+type TopicMessageRepository interface {
+	// Append assigns the next sequence number of the topic to msg and stores it
+	Append(context.Context, *TopicMessage) error
+	// GetRange returns unexpired messages with sequence numbers from and to, both inclusive
+	GetRange(ctx context.Context, appID string, topic string, from int64, to int64) ([]TopicMessage, error)
+	DeleteOlderThan(context.Context, time.Time) error
+}
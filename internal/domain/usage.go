@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// AppUsage is the usage of an app on a day, in UTC
+type AppUsage struct {
+	AppID string
+	Day   time.Time
+	// Messages counts the messages broadcast, not the number of clients they were delivered to
+	Messages       int64
+	DeliveredBytes int64
+	// PeakConnections is the highest number of open connections on all gateway instances together.
+	// It is the highest sum of the peaks the instances report for the same minute.
+	PeakConnections int
+	// ConnectionMinutes is the time connections were open, rounded down to whole minutes
+	ConnectionMinutes int64
+}
+
+type AppUsageRepository interface {
+	// GetByAppID returns the usage on the days from from to to, both inclusive, oldest first. Days without usage are left out.
+	GetByAppID(ctx context.Context, appID string, from time.Time, to time.Time) ([]AppUsage, error)
+	// Add adds the counts to the usage of the day. PeakConnections is the peak of the instance during minute, which is
+	// added to the peaks of the other instances in that minute. The peak of the day is raised if the sum is higher.
+	Add(ctx context.Context, instanceID string, minute time.Time, usage []AppUsage) error
+}
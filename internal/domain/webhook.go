@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	WebhookEventClientConnected    = "client.connected"
+	WebhookEventClientDisconnected = "client.disconnected"
+	WebhookEventTopicOccupied      = "topic.occupied"
+	WebhookEventTopicVacated       = "topic.vacated"
+	WebhookEventClientMessage      = "client.message"
+)
+
+// WebhookEvents lists every lifecycle event an application can subscribe to
+var WebhookEvents = []string{
+	WebhookEventClientConnected,
+	WebhookEventClientDisconnected,
+	WebhookEventTopicOccupied,
+	WebhookEventTopicVacated,
+	WebhookEventClientMessage,
+}
+
+// WebhookDelivery is the log entry of a single webhook event, updated after every attempt
+type WebhookDelivery struct {
+	ID          string
+	AppID       string
+	Event       string
+	URL         string
+	RequestBody string
+	Attempts    int
+	StatusCode  int
+	Error       string
+	Success     bool
+	CreatedAt   time.Time
+	UpdatedAt   *time.Time
+}
+
+type WebhookDeliveryRepository interface {
+	GetByAppID(ctx context.Context, appID string, limit int) ([]WebhookDelivery, error)
+	Create(context.Context, *WebhookDelivery) error
+	Update(context.Context, *WebhookDelivery) error
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+)
+
+type memoryAccessTokenRepository struct {
+	// tokens are in the order they were created
+	tokens []domain.AccessToken
+	*sync.RWMutex
+}
+
+func NewMemoryAccessToken() domain.AccessTokenRepository {
+	return &memoryAccessTokenRepository{RWMutex: &sync.RWMutex{}}
+}
+
+// token returns the index of the token in m.tokens, or -1
+func (m *memoryAccessTokenRepository) token(id string) int {
+	for i, token := range m.tokens {
+		if token.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetByID implements domain.AccessTokenRepository.
+func (m *memoryAccessTokenRepository) GetByID(ctx context.Context, id string) (domain.AccessToken, error) {
+	m.RLock()
+	defer m.RUnlock()
+	i := m.token(id)
+	if i < 0 {
+		return domain.AccessToken{}, domain.ErrNotFound
+	}
+	return m.tokens[i], nil
+}
+
+// GetByUserID implements domain.AccessTokenRepository.
+func (m *memoryAccessTokenRepository) GetByUserID(ctx context.Context, userID string) ([]domain.AccessToken, error) {
+	m.RLock()
+	defer m.RUnlock()
+	tokens := make([]domain.AccessToken, 0)
+	for _, token := range m.tokens {
+		if token.OwnerUserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+// Create implements domain.AccessTokenRepository.
+func (m *memoryAccessTokenRepository) Create(ctx context.Context, token *domain.AccessToken) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.token(token.ID) >= 0 {
+		return domain.ErrConflict
+	}
+	m.tokens = append(m.tokens, domain.AccessToken{
+		ID:           token.ID,
+		OwnerUserID:  token.OwnerUserID,
+		Name:         token.Name,
+		TokenHash:    token.TokenHash,
+		TokenPreview: token.TokenPreview,
+		CreatedAt:    time.Now().UTC(),
+	})
+	return nil
+}
+
+// UpdateTokenPreview implements domain.AccessTokenRepository.
+func (m *memoryAccessTokenRepository) UpdateTokenPreview(ctx context.Context, id string, tokenPreview string) error {
+	m.Lock()
+	defer m.Unlock()
+	if i := m.token(id); i >= 0 {
+		m.tokens[i].TokenPreview = tokenPreview
+	}
+	return nil
+}
+
+// UpdateLastUsed implements domain.AccessTokenRepository.
+func (m *memoryAccessTokenRepository) UpdateLastUsed(ctx context.Context, id string) error {
+	m.Lock()
+	defer m.Unlock()
+	if i := m.token(id); i >= 0 {
+		now := time.Now().UTC()
+		m.tokens[i].LastUsedAt = &now
+	}
+	return nil
+}
+
+// Delete implements domain.AccessTokenRepository.
+func (m *memoryAccessTokenRepository) Delete(ctx context.Context, id string) error {
+	m.Lock()
+	defer m.Unlock()
+	if i := m.token(id); i >= 0 {
+		m.tokens = append(m.tokens[:i], m.tokens[i+1:]...)
+	}
+	return nil
+}
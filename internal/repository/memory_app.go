@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+)
+
+type memoryAppRepository struct {
+	apps map[string]domain.Application
+	*sync.RWMutex
+}
+
+func NewMemoryApp() domain.ApplicationRepository {
+	return &memoryAppRepository{apps: make(map[string]domain.Application), RWMutex: &sync.RWMutex{}}
+}
+
+// copyApp copies the slices of app, so callers can not change the stored app
+func copyApp(app domain.Application) domain.Application {
+	app.WebhookEvents = slices.Clone(nonNil(app.WebhookEvents))
+	app.ReliableTopics = slices.Clone(nonNil(app.ReliableTopics))
+	app.SequencedTopics = slices.Clone(nonNil(app.SequencedTopics))
+	return app
+}
+
+// GetByID implements domain.ApplicationRepository.
+func (m *memoryAppRepository) GetByID(ctx context.Context, id string) (domain.Application, error) {
+	m.RLock()
+	defer m.RUnlock()
+	app, ok := m.apps[id]
+	if !ok {
+		return domain.Application{}, domain.ErrNotFound
+	}
+	return copyApp(app), nil
+}
+
+// GetByOrganizationIDs implements domain.ApplicationRepository.
+func (m *memoryAppRepository) GetByOrganizationIDs(ctx context.Context, organizationIDs []string) ([]domain.Application, error) {
+	m.RLock()
+	defer m.RUnlock()
+	apps := make([]domain.Application, 0)
+	for _, app := range m.apps {
+		if slices.Contains(organizationIDs, app.OrganizationID) {
+			apps = append(apps, copyApp(app))
+		}
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].Name < apps[j].Name })
+	return apps, nil
+}
+
+// Update implements domain.ApplicationRepository.
+func (m *memoryAppRepository) Update(ctx context.Context, app *domain.Application) error {
+	m.Lock()
+	defer m.Unlock()
+	stored, ok := m.apps[app.ID]
+	if !ok {
+		return nil
+	}
+	now := time.Now().UTC()
+	stored.Name = app.Name
+	stored.WebhookURL = app.WebhookURL
+	stored.WebhookSecret = app.WebhookSecret
+	stored.WebhookEvents = app.WebhookEvents
+	stored.PusherEnabled = app.PusherEnabled
+	stored.ReliableTopics = app.ReliableTopics
+	stored.AckTimeoutSeconds = app.AckTimeoutSeconds
+	stored.MaxDeliveryAttempts = app.MaxDeliveryAttempts
+	stored.SequencedTopics = app.SequencedTopics
+	stored.UpdatedAt = &now
+	m.apps[app.ID] = copyApp(stored)
+	return nil
+}
+
+// Create implements domain.ApplicationRepository.
+func (m *memoryAppRepository) Create(ctx context.Context, app *domain.Application) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.apps[app.ID]; ok {
+		return domain.ErrConflict
+	}
+	stored := copyApp(*app)
+	stored.CreatedAt = time.Now().UTC()
+	stored.UpdatedAt = nil
+	m.apps[app.ID] = stored
+	return nil
+}
+
+// Delete implements domain.ApplicationRepository.
+func (m *memoryAppRepository) Delete(ctx context.Context, appID string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.apps, appID)
+	return nil
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+)
+
+// memoryAuditEventRepository is append-only, like the audit_events table
+type memoryAuditEventRepository struct {
+	// events are in the order they were created
+	events []domain.AuditEvent
+	*sync.RWMutex
+}
+
+func NewMemoryAuditEvent() domain.AuditEventRepository {
+	return &memoryAuditEventRepository{RWMutex: &sync.RWMutex{}}
+}
+
+// matchAuditEvent reports whether e matches the filter, with the same rules as the postgres query
+func matchAuditEvent(e domain.AuditEvent, filter domain.AuditEventFilter) bool {
+	if filter.OrganizationIDs != nil || filter.UserID != "" {
+		if !slices.Contains(filter.OrganizationIDs, e.OrganizationID) && e.ActorUserID != filter.UserID {
+			return false
+		}
+	}
+	if filter.Actor != "" && e.ActorUserID != filter.Actor && e.ActorEmail != filter.Actor {
+		return false
+	}
+	if filter.Action != "" && e.Action != filter.Action {
+		return false
+	}
+	if filter.TargetID != "" && e.TargetID != filter.TargetID {
+		return false
+	}
+	if !filter.From.IsZero() && e.CreatedAt.Before(filter.From) {
+		return false
+	}
+	if !filter.To.IsZero() && !e.CreatedAt.Before(filter.To) {
+		return false
+	}
+	return true
+}
+
+// Get implements domain.AuditEventRepository.
+func (m *memoryAuditEventRepository) Get(ctx context.Context, filter domain.AuditEventFilter) ([]domain.AuditEvent, error) {
+	m.RLock()
+	defer m.RUnlock()
+	events := make([]domain.AuditEvent, 0)
+	for i := len(m.events) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(events) >= filter.Limit {
+			break
+		}
+		if matchAuditEvent(m.events[i], filter) {
+			events = append(events, m.events[i])
+		}
+	}
+	return events, nil
+}
+
+// Create implements domain.AuditEventRepository.
+func (m *memoryAuditEventRepository) Create(ctx context.Context, e *domain.AuditEvent) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, event := range m.events {
+		if event.ID == e.ID {
+			return domain.ErrConflict
+		}
+	}
+	stored := *e
+	stored.Before = nil
+	stored.After = nil
+	if len(e.Before) > 0 {
+		stored.Before = slices.Clone(e.Before)
+	}
+	if len(e.After) > 0 {
+		stored.After = slices.Clone(e.After)
+	}
+	stored.CreatedAt = time.Now().UTC()
+	m.events = append(m.events, stored)
+	return nil
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+)
+
+type memoryDeadLetterRepository struct {
+	// deadLetters are in the order they were created
+	deadLetters []domain.DeadLetter
+	*sync.RWMutex
+}
+
+func NewMemoryDeadLetter() domain.DeadLetterRepository {
+	return &memoryDeadLetterRepository{RWMutex: &sync.RWMutex{}}
+}
+
+// jsonOrNullPayload returns the payload as stored by the postgres repositories, where an empty payload is JSON null
+func jsonOrNullPayload(payload []byte) []byte {
+	if len(payload) == 0 {
+		return []byte("null")
+	}
+	return slices.Clone(payload)
+}
+
+// GetByAppID implements domain.DeadLetterRepository.
+func (m *memoryDeadLetterRepository) GetByAppID(ctx context.Context, appID string, limit int) ([]domain.DeadLetter, error) {
+	m.RLock()
+	defer m.RUnlock()
+	deadLetters := make([]domain.DeadLetter, 0)
+	for i := len(m.deadLetters) - 1; i >= 0 && len(deadLetters) < limit; i-- {
+		if m.deadLetters[i].AppID == appID {
+			deadLetters = append(deadLetters, m.deadLetters[i])
+		}
+	}
+	return deadLetters, nil
+}
+
+// Create implements domain.DeadLetterRepository.
+func (m *memoryDeadLetterRepository) Create(ctx context.Context, d *domain.DeadLetter) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, deadLetter := range m.deadLetters {
+		if deadLetter.ID == d.ID {
+			return domain.ErrConflict
+		}
+	}
+	stored := *d
+	stored.Payload = jsonOrNullPayload(d.Payload)
+	stored.CreatedAt = time.Now().UTC()
+	m.deadLetters = append(m.deadLetters, stored)
+	return nil
+}
+
+// Delete implements domain.DeadLetterRepository.
+func (m *memoryDeadLetterRepository) Delete(ctx context.Context, appID string, id string) error {
+	m.Lock()
+	defer m.Unlock()
+	m.deadLetters = slices.DeleteFunc(m.deadLetters, func(d domain.DeadLetter) bool {
+		return d.AppID == appID && d.ID == id
+	})
+	return nil
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+)
+
+type memoryKeyRepository struct {
+	keys map[string]domain.ApiKey
+	*sync.RWMutex
+}
+
+func NewMemoryKey() domain.ApiKeyRepository {
+	return &memoryKeyRepository{keys: make(map[string]domain.ApiKey), RWMutex: &sync.RWMutex{}}
+}
+
+// keyAccess returns the access of the key to the apps, with nil for no access like the postgres repository
+func keyAccess(apiKeyID string, list []domain.ApiKeyAccess) []domain.ApiKeyAccess {
+	if len(list) == 0 {
+		return nil
+	}
+	access := make([]domain.ApiKeyAccess, 0, len(list))
+	for _, a := range list {
+		access = append(access, domain.ApiKeyAccess{ApiKeyID: apiKeyID, AppID: a.AppID})
+	}
+	return access
+}
+
+// GetByID implements domain.ApiKeyRepository.
+func (m *memoryKeyRepository) GetByID(ctx context.Context, id string) (domain.ApiKey, error) {
+	m.RLock()
+	defer m.RUnlock()
+	key, ok := m.keys[id]
+	if !ok {
+		return domain.ApiKey{}, domain.ErrNotFound
+	}
+	key.Access = slices.Clone(key.Access)
+	return key, nil
+}
+
+// GetByOrganizationIDs implements domain.ApiKeyRepository.
+func (m *memoryKeyRepository) GetByOrganizationIDs(ctx context.Context, organizationIDs []string) ([]domain.ApiKey, error) {
+	m.RLock()
+	defer m.RUnlock()
+	keys := make([]domain.ApiKey, 0)
+	for _, key := range m.keys {
+		if slices.Contains(organizationIDs, key.OrganizationID) {
+			key.Access = slices.Clone(key.Access)
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// GetByAppID implements domain.ApiKeyRepository.
+// Like the postgres repository, the keys only include their access to the app.
+func (m *memoryKeyRepository) GetByAppID(ctx context.Context, appID string) ([]domain.ApiKey, error) {
+	m.RLock()
+	defer m.RUnlock()
+	keys := make([]domain.ApiKey, 0)
+	for _, key := range m.keys {
+		for _, access := range key.Access {
+			if access.AppID == appID {
+				key.Access = []domain.ApiKeyAccess{access}
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	return keys, nil
+}
+
+// Create implements domain.ApiKeyRepository.
+func (m *memoryKeyRepository) Create(ctx context.Context, key *domain.ApiKey) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.keys[key.ID]; ok {
+		return domain.ErrConflict
+	}
+	stored := *key
+	stored.Access = keyAccess(key.ID, key.Access)
+	stored.CreatedAt = time.Now().UTC()
+	stored.UpdatedAt = nil
+	m.keys[key.ID] = stored
+	return nil
+}
+
+// Update implements domain.ApiKeyRepository.
+func (m *memoryKeyRepository) Update(ctx context.Context, apiKeyID string, accessList []domain.ApiKeyAccess) error {
+	m.Lock()
+	defer m.Unlock()
+	key, ok := m.keys[apiKeyID]
+	if !ok {
+		return nil
+	}
+	key.Access = keyAccess(apiKeyID, accessList)
+	m.keys[apiKeyID] = key
+	return nil
+}
+
+// UpdateKeyPreview implements domain.ApiKeyRepository.
+func (m *memoryKeyRepository) UpdateKeyPreview(ctx context.Context, apikeyID string, keyPreview string) error {
+	m.Lock()
+	defer m.Unlock()
+	key, ok := m.keys[apikeyID]
+	if !ok {
+		return nil
+	}
+	key.KeyPreview = keyPreview
+	m.keys[apikeyID] = key
+	return nil
+}
+
+// Delete implements domain.ApiKeyRepository.
+func (m *memoryKeyRepository) Delete(ctx context.Context, keyID string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.keys, keyID)
+	return nil
+}
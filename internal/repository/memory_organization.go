@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+)
+
+type memoryOrganizationRepository struct {
+	organizations map[string]domain.Organization
+	// members are in the order they were added
+	members []domain.OrganizationMember
+	*sync.RWMutex
+}
+
+func NewMemoryOrganization() domain.OrganizationRepository {
+	return &memoryOrganizationRepository{organizations: make(map[string]domain.Organization), RWMutex: &sync.RWMutex{}}
+}
+
+// member returns the index of the member in m.members, or -1
+func (m *memoryOrganizationRepository) member(organizationID string, userID string) int {
+	for i, member := range m.members {
+		if member.OrganizationID == organizationID && member.UserID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetByID implements domain.OrganizationRepository.
+func (m *memoryOrganizationRepository) GetByID(ctx context.Context, id string) (domain.Organization, error) {
+	m.RLock()
+	defer m.RUnlock()
+	org, ok := m.organizations[id]
+	if !ok {
+		return domain.Organization{}, domain.ErrNotFound
+	}
+	return org, nil
+}
+
+// GetByUserID implements domain.OrganizationRepository.
+func (m *memoryOrganizationRepository) GetByUserID(ctx context.Context, userID string) ([]domain.Organization, error) {
+	m.RLock()
+	defer m.RUnlock()
+	orgs := make([]domain.Organization, 0)
+	for _, member := range m.members {
+		if member.UserID == userID {
+			orgs = append(orgs, m.organizations[member.OrganizationID])
+		}
+	}
+	sort.SliceStable(orgs, func(i, j int) bool { return orgs[i].Name < orgs[j].Name })
+	return orgs, nil
+}
+
+// Create implements domain.OrganizationRepository.
+func (m *memoryOrganizationRepository) Create(ctx context.Context, org *domain.Organization, owner *domain.OrganizationMember) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.organizations[org.ID]; ok {
+		return domain.ErrConflict
+	}
+	now := time.Now().UTC()
+	m.organizations[org.ID] = domain.Organization{ID: org.ID, Name: org.Name, CreatedAt: now}
+	m.members = append(m.members, domain.OrganizationMember{
+		OrganizationID: org.ID,
+		UserID:         owner.UserID,
+		Email:          owner.Email,
+		Role:           owner.Role,
+		CreatedAt:      now,
+	})
+	return nil
+}
+
+// Update implements domain.OrganizationRepository.
+func (m *memoryOrganizationRepository) Update(ctx context.Context, org *domain.Organization) error {
+	m.Lock()
+	defer m.Unlock()
+	stored, ok := m.organizations[org.ID]
+	if !ok {
+		return nil
+	}
+	now := time.Now().UTC()
+	stored.Name = org.Name
+	stored.UpdatedAt = &now
+	m.organizations[org.ID] = stored
+	return nil
+}
+
+// Delete implements domain.OrganizationRepository.
+// The members are deleted with the organization.
+func (m *memoryOrganizationRepository) Delete(ctx context.Context, id string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.organizations, id)
+	members := m.members[:0]
+	for _, member := range m.members {
+		if member.OrganizationID != id {
+			members = append(members, member)
+		}
+	}
+	m.members = members
+	return nil
+}
+
+// GetMembers implements domain.OrganizationRepository.
+func (m *memoryOrganizationRepository) GetMembers(ctx context.Context, organizationID string) ([]domain.OrganizationMember, error) {
+	m.RLock()
+	defer m.RUnlock()
+	members := make([]domain.OrganizationMember, 0)
+	for _, member := range m.members {
+		if member.OrganizationID == organizationID {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+// GetMember implements domain.OrganizationRepository.
+func (m *memoryOrganizationRepository) GetMember(ctx context.Context, organizationID string, userID string) (domain.OrganizationMember, error) {
+	m.RLock()
+	defer m.RUnlock()
+	i := m.member(organizationID, userID)
+	if i < 0 {
+		return domain.OrganizationMember{}, domain.ErrNotFound
+	}
+	return m.members[i], nil
+}
+
+// GetMembershipsByUserID implements domain.OrganizationRepository.
+func (m *memoryOrganizationRepository) GetMembershipsByUserID(ctx context.Context, userID string) ([]domain.OrganizationMember, error) {
+	m.RLock()
+	defer m.RUnlock()
+	members := make([]domain.OrganizationMember, 0)
+	for _, member := range m.members {
+		if member.UserID == userID {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+// AddMember implements domain.OrganizationRepository.
+func (m *memoryOrganizationRepository) AddMember(ctx context.Context, member *domain.OrganizationMember) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.organizations[member.OrganizationID]; !ok {
+		return domain.ErrNotFound
+	}
+	if m.member(member.OrganizationID, member.UserID) >= 0 {
+		return domain.ErrConflict
+	}
+	m.members = append(m.members, domain.OrganizationMember{
+		OrganizationID: member.OrganizationID,
+		UserID:         member.UserID,
+		Email:          member.Email,
+		Role:           member.Role,
+		CreatedAt:      time.Now().UTC(),
+	})
+	return nil
+}
+
+// UpdateMemberRole implements domain.OrganizationRepository.
+func (m *memoryOrganizationRepository) UpdateMemberRole(ctx context.Context, organizationID string, userID string, role domain.Role) error {
+	m.Lock()
+	defer m.Unlock()
+	if i := m.member(organizationID, userID); i >= 0 {
+		m.members[i].Role = role
+	}
+	return nil
+}
+
+// RemoveMember implements domain.OrganizationRepository.
+func (m *memoryOrganizationRepository) RemoveMember(ctx context.Context, organizationID string, userID string) error {
+	m.Lock()
+	defer m.Unlock()
+	if i := m.member(organizationID, userID); i >= 0 {
+		m.members = append(m.members[:i], m.members[i+1:]...)
+	}
+	return nil
+}
+
+// TransferOwnership implements domain.OrganizationRepository.
+func (m *memoryOrganizationRepository) TransferOwnership(ctx context.Context, organizationID string, fromUserID string, toUserID string) error {
+	m.Lock()
+	defer m.Unlock()
+	to := m.member(organizationID, toUserID)
+	if to < 0 {
+		return domain.ErrNotFound
+	}
+	m.members[to].Role = domain.RoleOwner
+	if from := m.member(organizationID, fromUserID); from >= 0 {
+		m.members[from].Role = domain.RoleAdmin
+	}
+	return nil
+}
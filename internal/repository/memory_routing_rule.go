@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+)
+
+type memoryRoutingRuleRepository struct {
+	// rules are in the order they were created
+	rules []domain.RoutingRule
+	*sync.RWMutex
+}
+
+func NewMemoryRoutingRule() domain.RoutingRuleRepository {
+	return &memoryRoutingRuleRepository{RWMutex: &sync.RWMutex{}}
+}
+
+// rule returns the index of the rule in m.rules, or -1
+func (m *memoryRoutingRuleRepository) rule(id string) int {
+	for i, rule := range m.rules {
+		if rule.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetByID implements domain.RoutingRuleRepository.
+func (m *memoryRoutingRuleRepository) GetByID(ctx context.Context, id string) (domain.RoutingRule, error) {
+	m.RLock()
+	defer m.RUnlock()
+	i := m.rule(id)
+	if i < 0 {
+		return domain.RoutingRule{}, domain.ErrNotFound
+	}
+	return m.rules[i], nil
+}
+
+// GetByAppID implements domain.RoutingRuleRepository.
+func (m *memoryRoutingRuleRepository) GetByAppID(ctx context.Context, appID string) ([]domain.RoutingRule, error) {
+	m.RLock()
+	defer m.RUnlock()
+	rules := make([]domain.RoutingRule, 0)
+	for _, rule := range m.rules {
+		if rule.AppID == appID {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// Create implements domain.RoutingRuleRepository.
+func (m *memoryRoutingRuleRepository) Create(ctx context.Context, rule *domain.RoutingRule) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.rule(rule.ID) >= 0 {
+		return domain.ErrConflict
+	}
+	stored := *rule
+	stored.CreatedAt = time.Now().UTC()
+	stored.UpdatedAt = nil
+	m.rules = append(m.rules, stored)
+	return nil
+}
+
+// Update implements domain.RoutingRuleRepository.
+func (m *memoryRoutingRuleRepository) Update(ctx context.Context, rule *domain.RoutingRule) error {
+	m.Lock()
+	defer m.Unlock()
+	i := m.rule(rule.ID)
+	if i < 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	m.rules[i].SourceTopic = rule.SourceTopic
+	m.rules[i].Condition = rule.Condition
+	m.rules[i].TargetTopic = rule.TargetTopic
+	m.rules[i].Transform = rule.Transform
+	m.rules[i].UpdatedAt = &now
+	return nil
+}
+
+// Delete implements domain.RoutingRuleRepository.
+func (m *memoryRoutingRuleRepository) Delete(ctx context.Context, id string) error {
+	m.Lock()
+	defer m.Unlock()
+	if i := m.rule(id); i >= 0 {
+		m.rules = append(m.rules[:i], m.rules[i+1:]...)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+)
+
+type memoryScheduledMessageRepository struct {
+	messages []domain.ScheduledMessage
+	*sync.Mutex
+}
+
+func NewMemoryScheduledMessage() domain.ScheduledMessageRepository {
+	return &memoryScheduledMessageRepository{Mutex: &sync.Mutex{}}
+}
+
+// GetByAppID implements domain.ScheduledMessageRepository.
+func (m *memoryScheduledMessageRepository) GetByAppID(ctx context.Context, appID string, limit int) ([]domain.ScheduledMessage, error) {
+	m.Lock()
+	defer m.Unlock()
+	messages := make([]domain.ScheduledMessage, 0)
+	for _, msg := range m.messages {
+		if msg.AppID == appID && len(messages) < limit {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+// Create implements domain.ScheduledMessageRepository.
+// The messages are kept ordered by DeliverAt.
+func (m *memoryScheduledMessageRepository) Create(ctx context.Context, msg *domain.ScheduledMessage) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, existing := range m.messages {
+		if existing.ID == msg.ID {
+			return domain.ErrConflict
+		}
+	}
+	stored := *msg
+	stored.Payload = jsonOrNullPayload(msg.Payload)
+	stored.DeliverAt = msg.DeliverAt.UTC()
+	stored.CreatedAt = time.Now().UTC()
+	i := sort.Search(len(m.messages), func(i int) bool { return m.messages[i].DeliverAt.After(stored.DeliverAt) })
+	m.messages = append(m.messages, domain.ScheduledMessage{})
+	copy(m.messages[i+1:], m.messages[i:])
+	m.messages[i] = stored
+	return nil
+}
+
+// Delete implements domain.ScheduledMessageRepository.
+func (m *memoryScheduledMessageRepository) Delete(ctx context.Context, appID string, id string) error {
+	m.Lock()
+	defer m.Unlock()
+	for i, msg := range m.messages {
+		if msg.AppID == appID && msg.ID == id {
+			m.messages = append(m.messages[:i], m.messages[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrNotFound
+}
+
+// ClaimDue implements domain.ScheduledMessageRepository.
+func (m *memoryScheduledMessageRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]domain.ScheduledMessage, error) {
+	m.Lock()
+	defer m.Unlock()
+	messages := make([]domain.ScheduledMessage, 0)
+	claimedUntil := now.Add(lease).UTC()
+	for i := 0; i < len(m.messages) && len(messages) < limit && !m.messages[i].DeliverAt.After(now); i++ {
+		if m.messages[i].ClaimedUntil != nil && m.messages[i].ClaimedUntil.After(now) {
+			continue
+		}
+		m.messages[i].ClaimedUntil = &claimedUntil
+		messages = append(messages, m.messages[i])
+	}
+	return messages, nil
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+)
+
+type memoryTopicKey struct {
+	appID string
+	topic string
+}
+
+type memoryTopicMessageRepository struct {
+	// sequences is the last sequence number of each topic, it is kept when the messages are deleted
+	sequences map[memoryTopicKey]int64
+	// messages of each topic are ordered by sequence number
+	messages map[memoryTopicKey][]domain.TopicMessage
+	*sync.RWMutex
+}
+
+func NewMemoryTopicMessage() domain.TopicMessageRepository {
+	return &memoryTopicMessageRepository{
+		sequences: make(map[memoryTopicKey]int64),
+		messages:  make(map[memoryTopicKey][]domain.TopicMessage),
+		RWMutex:   &sync.RWMutex{},
+	}
+}
+
+// Append implements domain.TopicMessageRepository.
+func (m *memoryTopicMessageRepository) Append(ctx context.Context, msg *domain.TopicMessage) error {
+	m.Lock()
+	defer m.Unlock()
+	key := memoryTopicKey{appID: msg.AppID, topic: msg.Topic}
+	m.sequences[key]++
+	msg.Seq = m.sequences[key]
+	msg.CreatedAt = time.Now().UTC()
+	stored := *msg
+	stored.Payload = jsonOrNullPayload(msg.Payload)
+	if msg.ExpiresAt != nil {
+		expiresAt := msg.ExpiresAt.UTC()
+		stored.ExpiresAt = &expiresAt
+	}
+	m.messages[key] = append(m.messages[key], stored)
+	return nil
+}
+
+// GetRange implements domain.TopicMessageRepository.
+func (m *memoryTopicMessageRepository) GetRange(ctx context.Context, appID string, topic string, from int64, to int64) ([]domain.TopicMessage, error) {
+	m.RLock()
+	defer m.RUnlock()
+	now := time.Now()
+	messages := make([]domain.TopicMessage, 0)
+	for _, msg := range m.messages[memoryTopicKey{appID: appID, topic: topic}] {
+		if msg.Seq < from || msg.Seq > to {
+			continue
+		}
+		if msg.ExpiresAt != nil && !msg.ExpiresAt.After(now) {
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// DeleteOlderThan implements domain.TopicMessageRepository.
+func (m *memoryTopicMessageRepository) DeleteOlderThan(ctx context.Context, t time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	for key, messages := range m.messages {
+		messages = slices.DeleteFunc(messages, func(msg domain.TopicMessage) bool { return msg.CreatedAt.Before(t) })
+		if len(messages) == 0 {
+			delete(m.messages, key)
+			continue
+		}
+		m.messages[key] = messages
+	}
+	return nil
+}
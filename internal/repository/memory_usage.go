@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+)
+
+// usageSampleRetention is how long the peaks of instances are kept, to be summed with the peaks other instances report for the same minute
+const usageSampleRetention = time.Hour
+
+type memoryUsageKey struct {
+	appID string
+	day   time.Time
+}
+
+type memoryUsageSampleKey struct {
+	appID      string
+	minute     time.Time
+	instanceID string
+}
+
+type memoryAppUsageRepository struct {
+	usage   map[memoryUsageKey]domain.AppUsage
+	samples map[memoryUsageSampleKey]int
+	*sync.RWMutex
+}
+
+func NewMemoryAppUsage() domain.AppUsageRepository {
+	return &memoryAppUsageRepository{
+		usage:   make(map[memoryUsageKey]domain.AppUsage),
+		samples: make(map[memoryUsageSampleKey]int),
+		RWMutex: &sync.RWMutex{},
+	}
+}
+
+// usageDate returns the UTC date of t, like a DATE column
+func usageDate(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// GetByAppID implements domain.AppUsageRepository.
+func (m *memoryAppUsageRepository) GetByAppID(ctx context.Context, appID string, from time.Time, to time.Time) ([]domain.AppUsage, error) {
+	m.RLock()
+	defer m.RUnlock()
+	usage := make([]domain.AppUsage, 0)
+	for key, u := range m.usage {
+		if key.appID == appID && !key.day.Before(from) && !key.day.After(to) {
+			usage = append(usage, u)
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Day.Before(usage[j].Day) })
+	return usage, nil
+}
+
+// Add implements domain.AppUsageRepository.
+func (m *memoryAppUsageRepository) Add(ctx context.Context, instanceID string, minute time.Time, usage []domain.AppUsage) error {
+	m.Lock()
+	defer m.Unlock()
+	minute = minute.UTC()
+	for _, u := range usage {
+		key := memoryUsageKey{appID: u.AppID, day: usageDate(u.Day)}
+		stored, ok := m.usage[key]
+		if !ok {
+			stored = domain.AppUsage{AppID: u.AppID, Day: key.day}
+		}
+		stored.Messages += u.Messages
+		stored.DeliveredBytes += u.DeliveredBytes
+		stored.ConnectionMinutes += u.ConnectionMinutes
+		if u.PeakConnections != 0 {
+			sampleKey := memoryUsageSampleKey{appID: u.AppID, minute: minute, instanceID: instanceID}
+			m.samples[sampleKey] = max(m.samples[sampleKey], u.PeakConnections)
+			sum := 0
+			for k, peak := range m.samples {
+				if k.appID == u.AppID && k.minute.Equal(minute) {
+					sum += peak
+				}
+			}
+			stored.PeakConnections = max(stored.PeakConnections, sum)
+		}
+		m.usage[key] = stored
+	}
+	for k := range m.samples {
+		if k.minute.Before(minute.Add(-usageSampleRetention)) {
+			delete(m.samples, k)
+		}
+	}
+	return nil
+}
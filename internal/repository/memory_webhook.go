@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+)
+
+type memoryWebhookDeliveryRepository struct {
+	// deliveries are in the order they were created
+	deliveries []domain.WebhookDelivery
+	*sync.RWMutex
+}
+
+func NewMemoryWebhookDelivery() domain.WebhookDeliveryRepository {
+	return &memoryWebhookDeliveryRepository{RWMutex: &sync.RWMutex{}}
+}
+
+// GetByAppID implements domain.WebhookDeliveryRepository.
+func (m *memoryWebhookDeliveryRepository) GetByAppID(ctx context.Context, appID string, limit int) ([]domain.WebhookDelivery, error) {
+	m.RLock()
+	defer m.RUnlock()
+	deliveries := make([]domain.WebhookDelivery, 0)
+	for i := len(m.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if m.deliveries[i].AppID == appID {
+			deliveries = append(deliveries, m.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+// Create implements domain.WebhookDeliveryRepository.
+func (m *memoryWebhookDeliveryRepository) Create(ctx context.Context, d *domain.WebhookDelivery) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, delivery := range m.deliveries {
+		if delivery.ID == d.ID {
+			return domain.ErrConflict
+		}
+	}
+	stored := *d
+	stored.CreatedAt = time.Now().UTC()
+	stored.UpdatedAt = nil
+	m.deliveries = append(m.deliveries, stored)
+	return nil
+}
+
+// Update implements domain.WebhookDeliveryRepository.
+func (m *memoryWebhookDeliveryRepository) Update(ctx context.Context, d *domain.WebhookDelivery) error {
+	m.Lock()
+	defer m.Unlock()
+	for i := range m.deliveries {
+		if m.deliveries[i].ID != d.ID {
+			continue
+		}
+		now := time.Now().UTC()
+		m.deliveries[i].Attempts = d.Attempts
+		m.deliveries[i].StatusCode = d.StatusCode
+		m.deliveries[i].Error = d.Error
+		m.deliveries[i].Success = d.Success
+		m.deliveries[i].UpdatedAt = &now
+	}
+	return nil
+}
@@ -1,12 +1,14 @@
 package repository
 
 import (
+	"database/sql"
 	"embed"
 	"errors"
 	"fmt"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 )
@@ -14,6 +16,11 @@ import (
 //go:embed migrations/*.sql
 var fs embed.FS
 
+// sqliteFs has the sqlite migrations, which are numbered separately from the postgres ones
+//
+//go:embed sqlite_migrations/*.sql
+var sqliteFs embed.FS
+
 func Migrate(direction string, dbConnStr string) error {
 	d, err := iofs.New(fs, "migrations")
 	if err != nil {
@@ -35,3 +42,24 @@ func Migrate(direction string, dbConnStr string) error {
 	}
 	return nil
 }
+
+// MigrateSqlite runs the sqlite migrations up on db
+func MigrateSqlite(db *sql.DB) error {
+	d, err := iofs.New(sqliteFs, "sqlite_migrations")
+	if err != nil {
+		return fmt.Errorf("failed to load migration files: %w", err)
+	}
+	// The driver is made from db, so in-memory databases are migrated on the connection the repositories use
+	driver, err := sqlite3.WithInstance(db, &sqlite3.Config{})
+	if err != nil {
+		return fmt.Errorf("failed to create sqlite migration driver: %w", err)
+	}
+	m, err := migrate.NewWithInstance("iofs", d, "sqlite3", driver)
+	if err != nil {
+		return fmt.Errorf("failed create new source instance: %w", err)
+	}
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to migrate up: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS webhook_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS webhook_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS webhook_events TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries(
+    id TEXT PRIMARY KEY,
+    app_id TEXT,
+    event TEXT,
+    url TEXT,
+    request_body TEXT,
+    attempts INT NOT NULL DEFAULT 0,
+    status_code INT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_app_id_idx ON webhook_deliveries(app_id, created_at);
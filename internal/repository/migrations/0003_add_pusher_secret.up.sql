@@ -0,0 +1 @@
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS pusher_secret TEXT NOT NULL DEFAULT '';
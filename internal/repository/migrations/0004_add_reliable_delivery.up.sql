@@ -0,0 +1,18 @@
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS reliable_topics TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS ack_timeout_seconds INT NOT NULL DEFAULT 30;
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS max_delivery_attempts INT NOT NULL DEFAULT 5;
+
+CREATE TABLE IF NOT EXISTS dead_letters(
+    id TEXT PRIMARY KEY,
+    app_id TEXT,
+    topic TEXT,
+    user_id TEXT,
+    message_id TEXT,
+    event TEXT,
+    payload JSONB,
+    attempts INT NOT NULL DEFAULT 0,
+    reason TEXT,
+    created_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS dead_letters_app_id_idx ON dead_letters(app_id, created_at);
@@ -0,0 +1,20 @@
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS sequenced_topics TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS topic_sequences(
+    app_id TEXT,
+    topic TEXT,
+    seq BIGINT NOT NULL,
+    PRIMARY KEY (app_id, topic)
+);
+
+CREATE TABLE IF NOT EXISTS topic_messages(
+    app_id TEXT,
+    topic TEXT,
+    seq BIGINT,
+    event TEXT,
+    payload JSONB,
+    created_at TIMESTAMP,
+    PRIMARY KEY (app_id, topic, seq)
+);
+
+CREATE INDEX IF NOT EXISTS topic_messages_created_at_idx ON topic_messages(created_at);
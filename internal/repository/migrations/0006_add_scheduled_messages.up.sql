@@ -0,0 +1,15 @@
+ALTER TABLE topic_messages ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS scheduled_messages(
+    id TEXT PRIMARY KEY,
+    app_id TEXT,
+    topic TEXT,
+    event TEXT,
+    payload JSONB,
+    ttl_seconds INT NOT NULL DEFAULT 0,
+    deliver_at TIMESTAMP,
+    created_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_messages_deliver_at_idx ON scheduled_messages(deliver_at);
+CREATE INDEX IF NOT EXISTS scheduled_messages_app_id_idx ON scheduled_messages(app_id);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS routing_rules(
+    id TEXT PRIMARY KEY,
+    app_id TEXT REFERENCES apps(id) ON DELETE CASCADE,
+    source_topic TEXT NOT NULL,
+    condition TEXT NOT NULL DEFAULT '',
+    target_topic TEXT NOT NULL,
+    transform TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS routing_rules_app_id_idx ON routing_rules(app_id);
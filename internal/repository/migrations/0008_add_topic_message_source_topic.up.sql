@@ -0,0 +1 @@
+ALTER TABLE topic_messages ADD COLUMN IF NOT EXISTS source_topic TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS access_tokens(
+    id TEXT PRIMARY KEY,
+    owner_user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    token_preview TEXT NOT NULL,
+    last_used_at TIMESTAMP NULL,
+    created_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS access_tokens_owner_user_id_idx ON access_tokens(owner_user_id);
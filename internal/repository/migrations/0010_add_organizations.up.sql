@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS organizations(
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP NULL
+);
+
+CREATE TABLE IF NOT EXISTS organization_members(
+    organization_id TEXT REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    email TEXT NOT NULL DEFAULT '',
+    role TEXT NOT NULL,
+    created_at TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS organization_members_user_id_idx ON organization_members(user_id);
+
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS organization_id TEXT REFERENCES organizations(id);
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS organization_id TEXT REFERENCES organizations(id);
+
+-- Apps and keys move to a personal organization owned by their owner
+INSERT INTO organizations (id, name, created_at)
+SELECT 'personal-' || owner_user_id, 'Personal', NOW()
+FROM (SELECT owner_user_id FROM apps UNION SELECT owner_user_id FROM api_keys) owners
+WHERE owner_user_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+INSERT INTO organization_members (organization_id, user_id, role, created_at)
+SELECT 'personal-' || owner_user_id, owner_user_id, 'owner', NOW()
+FROM (SELECT owner_user_id FROM apps UNION SELECT owner_user_id FROM api_keys) owners
+WHERE owner_user_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+UPDATE apps SET organization_id = 'personal-' || owner_user_id WHERE organization_id IS NULL AND owner_user_id IS NOT NULL;
+UPDATE api_keys SET organization_id = 'personal-' || owner_user_id WHERE organization_id IS NULL AND owner_user_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS apps_organization_id_idx ON apps(organization_id);
+CREATE INDEX IF NOT EXISTS api_keys_organization_id_idx ON api_keys(organization_id);
@@ -0,0 +1,10 @@
+-- Usage is kept when the app is deleted, so it can still be billed
+CREATE TABLE IF NOT EXISTS app_usage(
+    app_id TEXT NOT NULL,
+    day DATE NOT NULL,
+    messages BIGINT NOT NULL DEFAULT 0,
+    delivered_bytes BIGINT NOT NULL DEFAULT 0,
+    peak_connections INTEGER NOT NULL DEFAULT 0,
+    connection_minutes BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (app_id, day)
+);
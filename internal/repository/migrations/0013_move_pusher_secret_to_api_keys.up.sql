@@ -0,0 +1,7 @@
+-- Pusher requests are signed with a secret of the api key used, instead of a secret of the app
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS pusher_enabled BOOLEAN NOT NULL DEFAULT false;
+UPDATE apps SET pusher_enabled = true WHERE pusher_secret <> '';
+ALTER TABLE apps DROP COLUMN IF EXISTS pusher_secret;
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS pusher_secret TEXT NOT NULL DEFAULT '';
+UPDATE api_keys SET pusher_secret = replace(gen_random_uuid()::text, '-', '') WHERE pusher_secret = '';
@@ -0,0 +1 @@
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP;
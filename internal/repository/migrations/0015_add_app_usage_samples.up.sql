@@ -0,0 +1,9 @@
+-- The peak connections of each instance per minute, summed to get the peak of all instances.
+-- Samples are only needed until every instance has reported the minute, and are deleted after an hour.
+CREATE TABLE IF NOT EXISTS app_usage_samples(
+    app_id TEXT NOT NULL,
+    minute TIMESTAMP NOT NULL,
+    instance_id TEXT NOT NULL,
+    peak_connections INTEGER NOT NULL,
+    PRIMARY KEY (app_id, minute, instance_id)
+);
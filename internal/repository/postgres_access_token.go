@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/pgxscan"
+)
+
+type postgresAccessTokenRepository struct {
+	conn Connection
+}
+
+func NewPostgresAccessToken(conn Connection) domain.AccessTokenRepository {
+	return &postgresAccessTokenRepository{conn: conn}
+}
+
+// GetByID implements domain.AccessTokenRepository.
+func (p *postgresAccessTokenRepository) GetByID(ctx context.Context, id string) (domain.AccessToken, error) {
+	var token domain.AccessToken
+	rows, err := p.conn.Query(ctx, "SELECT * FROM access_tokens WHERE id = $1", id)
+	if err != nil {
+		return token, err
+	}
+	err = pgxscan.ScanOne(&token, rows)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return token, domain.ErrNotFound
+		}
+		return token, err
+	}
+	return token, nil
+}
+
+// GetByUserID implements domain.AccessTokenRepository.
+func (p *postgresAccessTokenRepository) GetByUserID(ctx context.Context, userID string) ([]domain.AccessToken, error) {
+	tokens := make([]domain.AccessToken, 0)
+	err := pgxscan.Select(ctx, p.conn, &tokens, "SELECT * FROM access_tokens WHERE owner_user_id = $1 ORDER BY created_at", userID)
+	return tokens, err
+}
+
+// Create implements domain.AccessTokenRepository.
+func (p *postgresAccessTokenRepository) Create(ctx context.Context, token *domain.AccessToken) error {
+	query := `
+		INSERT INTO access_tokens (id, owner_user_id, name, token_hash, token_preview, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())`
+	_, err := p.conn.Exec(ctx, query, token.ID, token.OwnerUserID, token.Name, token.TokenHash, token.TokenPreview)
+	return err
+}
+
+// UpdateTokenPreview implements domain.AccessTokenRepository.
+func (p *postgresAccessTokenRepository) UpdateTokenPreview(ctx context.Context, id string, tokenPreview string) error {
+	_, err := p.conn.Exec(ctx, "UPDATE access_tokens SET token_preview = $1 WHERE id = $2", tokenPreview, id)
+	return err
+}
+
+// UpdateLastUsed implements domain.AccessTokenRepository.
+func (p *postgresAccessTokenRepository) UpdateLastUsed(ctx context.Context, id string) error {
+	_, err := p.conn.Exec(ctx, "UPDATE access_tokens SET last_used_at = NOW() WHERE id = $1", id)
+	return err
+}
+
+// Delete implements domain.AccessTokenRepository.
+func (p *postgresAccessTokenRepository) Delete(ctx context.Context, id string) error {
+	_, err := p.conn.Exec(ctx, "DELETE FROM access_tokens WHERE id = $1", id)
+	return err
+}
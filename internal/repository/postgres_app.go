@@ -32,10 +32,10 @@ func (p *postgresAppRepository) GetByID(ctx context.Context, id string) (domain.
 	return app, nil
 }
 
-// GetByUserID implements domain.ApplicationRepository.
-func (p *postgresAppRepository) GetByUserID(ctx context.Context, userId string) ([]domain.Application, error) {
+// GetByOrganizationIDs implements domain.ApplicationRepository.
+func (p *postgresAppRepository) GetByOrganizationIDs(ctx context.Context, organizationIDs []string) ([]domain.Application, error) {
 	apps := make([]domain.Application, 0)
-	err := pgxscan.Select(ctx, p.conn, &apps, "SELECT * FROM apps WHERE owner_user_id = $1", userId)
+	err := pgxscan.Select(ctx, p.conn, &apps, "SELECT * FROM apps WHERE organization_id = ANY($1) ORDER BY name", organizationIDs)
 	if err != nil {
 		return apps, err
 	}
@@ -44,19 +44,34 @@ func (p *postgresAppRepository) GetByUserID(ctx context.Context, userId string)
 
 // Update implements domain.ApplicationRepository.
 func (p *postgresAppRepository) Update(ctx context.Context, app *domain.Application) error {
-	_, err := p.conn.Exec(ctx, "UPDATE apps SET name = $1, updated_at = NOW() WHERE id = $2", app.Name, app.ID)
+	query := `
+		UPDATE apps SET name = $1, webhook_url = $2, webhook_secret = $3, webhook_events = $4, pusher_enabled = $5,
+			reliable_topics = $6, ack_timeout_seconds = $7, max_delivery_attempts = $8, sequenced_topics = $9, updated_at = NOW()
+		WHERE id = $10`
+	_, err := p.conn.Exec(ctx, query, app.Name, app.WebhookURL, app.WebhookSecret, nonNil(app.WebhookEvents), app.PusherEnabled,
+		nonNil(app.ReliableTopics), app.AckTimeoutSeconds, app.MaxDeliveryAttempts, nonNil(app.SequencedTopics), app.ID)
 	return err
 }
 
 // Create implements domain.ApplicationRepository.
 func (p *postgresAppRepository) Create(ctx context.Context, app *domain.Application) error {
 	query := `
-		INSERT INTO apps (id, owner_user_id, name, created_at)
-		VALUES ($1, $2, $3, NOW())`
-	_, err := p.conn.Exec(ctx, query, app.ID, app.OwnerUserID, app.Name)
+		INSERT INTO apps (id, owner_user_id, organization_id, name, webhook_url, webhook_secret, webhook_events, pusher_enabled,
+			reliable_topics, ack_timeout_seconds, max_delivery_attempts, sequenced_topics, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW())`
+	_, err := p.conn.Exec(ctx, query, app.ID, app.OwnerUserID, app.OrganizationID, app.Name, app.WebhookURL, app.WebhookSecret, nonNil(app.WebhookEvents), app.PusherEnabled,
+		nonNil(app.ReliableTopics), app.AckTimeoutSeconds, app.MaxDeliveryAttempts, nonNil(app.SequencedTopics))
 	return err
 }
 
+// nonNil avoids writing NULL to the non-null array columns
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
 // Delete implements domain.ApplicationRepository.
 func (p *postgresAppRepository) Delete(ctx context.Context, appID string) error {
 	_, err := p.conn.Exec(ctx, "DELETE FROM apps WHERE id = $1", appID)
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/pgxscan"
+)
+
+type postgresAuditEventRepository struct {
+	conn Connection
+}
+
+func NewPostgresAuditEvent(conn Connection) domain.AuditEventRepository {
+	return &postgresAuditEventRepository{conn: conn}
+}
+
+// Get implements domain.AuditEventRepository.
+func (p *postgresAuditEventRepository) Get(ctx context.Context, filter domain.AuditEventFilter) ([]domain.AuditEvent, error) {
+	conditions := make([]string, 0)
+	args := make([]any, 0)
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if filter.OrganizationIDs != nil || filter.UserID != "" {
+		conditions = append(conditions, fmt.Sprintf("(organization_id = ANY(%v) OR actor_user_id = %v)", arg(filter.OrganizationIDs), arg(filter.UserID)))
+	}
+	if filter.Actor != "" {
+		actor := arg(filter.Actor)
+		conditions = append(conditions, fmt.Sprintf("(actor_user_id = %v OR actor_email = %v)", actor, actor))
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = "+arg(filter.Action))
+	}
+	if filter.TargetID != "" {
+		conditions = append(conditions, "target_id = "+arg(filter.TargetID))
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "created_at >= "+arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(filter.To))
+	}
+	query := "SELECT * FROM audit_events"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+	events := make([]domain.AuditEvent, 0)
+	err := pgxscan.Select(ctx, p.conn, &events, query, args...)
+	return events, err
+}
+
+// Create implements domain.AuditEventRepository.
+func (p *postgresAuditEventRepository) Create(ctx context.Context, e *domain.AuditEvent) error {
+	query := `
+		INSERT INTO audit_events (id, actor_user_id, actor_email, organization_id, action, target_type, target_id, before, after, ip, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW())`
+	_, err := p.conn.Exec(ctx, query, e.ID, e.ActorUserID, e.ActorEmail, e.OrganizationID, e.Action, e.TargetType, e.TargetID,
+		jsonOrNull(e.Before), jsonOrNull(e.After), e.IP, e.UserAgent)
+	return err
+}
+
+// jsonOrNull returns nil for empty snapshots, so they are stored as NULL
+func jsonOrNull(value []byte) any {
+	if len(value) == 0 {
+		return nil
+	}
+	return string(value)
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/pgxscan"
+)
+
+type postgresDeadLetterRepository struct {
+	conn Connection
+}
+
+func NewPostgresDeadLetter(conn Connection) domain.DeadLetterRepository {
+	return &postgresDeadLetterRepository{conn: conn}
+}
+
+// GetByAppID implements domain.DeadLetterRepository.
+func (p *postgresDeadLetterRepository) GetByAppID(ctx context.Context, appID string, limit int) ([]domain.DeadLetter, error) {
+	deadLetters := make([]domain.DeadLetter, 0)
+	query := "SELECT * FROM dead_letters WHERE app_id = $1 ORDER BY created_at DESC LIMIT $2"
+	err := pgxscan.Select(ctx, p.conn, &deadLetters, query, appID, limit)
+	return deadLetters, err
+}
+
+// Create implements domain.DeadLetterRepository.
+func (p *postgresDeadLetterRepository) Create(ctx context.Context, d *domain.DeadLetter) error {
+	query := `
+		INSERT INTO dead_letters (id, app_id, topic, user_id, message_id, event, payload, attempts, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())`
+	payload := string(d.Payload)
+	if payload == "" {
+		payload = "null"
+	}
+	_, err := p.conn.Exec(ctx, query, d.ID, d.AppID, d.Topic, d.UserID, d.MessageID, d.Event, payload, d.Attempts, d.Reason)
+	return err
+}
+
+// Delete implements domain.DeadLetterRepository.
+func (p *postgresDeadLetterRepository) Delete(ctx context.Context, appID string, id string) error {
+	_, err := p.conn.Exec(ctx, "DELETE FROM dead_letters WHERE app_id = $1 AND id = $2", appID, id)
+	return err
+}
@@ -21,12 +21,14 @@ func NewPostgresKey(conn Connection) domain.ApiKeyRepository {
 
 func mapDtoKey(dto apiKeyDto) domain.ApiKey {
 	return domain.ApiKey{
-		ID:          dto.ID,
-		OwnerUserID: dto.OwnerUserId,
-		KeyHash:     dto.KeyHash,
-		KeyPreview:  dto.KeyPreview,
-		CreatedAt:   dto.CreatedAt,
-		UpdatedAt:   dto.UpdatedAt,
+		ID:             dto.ID,
+		OwnerUserID:    dto.OwnerUserId,
+		OrganizationID: dto.OrganizationId,
+		KeyHash:        dto.KeyHash,
+		KeyPreview:     dto.KeyPreview,
+		PusherSecret:   dto.PusherSecret,
+		CreatedAt:      dto.CreatedAt,
+		UpdatedAt:      dto.UpdatedAt,
 	}
 }
 func mapDtoKeys(dtos []apiKeyDto) []domain.ApiKey {
@@ -60,21 +62,24 @@ func (p *postgresKeyRepository) GetByID(ctx context.Context, id string) (domain.
 		LEFT JOIN api_key_access a ON a.api_key_id = k.id
 		WHERE k.id = $1`
 	err := pgxscan.Select(ctx, p.conn, &dtoKeys, query, id)
-	if pgxscan.NotFound(err) {
-		return domain.ApiKey{}, domain.ErrNotFound
+	if err != nil {
+		return domain.ApiKey{}, err
 	}
 	keys := mapDtoKeys(dtoKeys)
-	return keys[0], err
+	if len(keys) == 0 {
+		return domain.ApiKey{}, domain.ErrNotFound
+	}
+	return keys[0], nil
 }
 
-// GetByUserID implements domain.ApiKeyRepository.
-func (p *postgresKeyRepository) GetByUserID(ctx context.Context, userID string) ([]domain.ApiKey, error) {
+// GetByOrganizationIDs implements domain.ApiKeyRepository.
+func (p *postgresKeyRepository) GetByOrganizationIDs(ctx context.Context, organizationIDs []string) ([]domain.ApiKey, error) {
 	dtoKeys := make([]apiKeyDto, 0)
 	query := `
 		SELECT k.*, a.* FROM api_keys k
 		LEFT JOIN api_key_access a ON a.api_key_id = k.id
-		WHERE k.owner_user_id = $1`
-	err := pgxscan.Select(ctx, p.conn, &dtoKeys, query, userID)
+		WHERE k.organization_id = ANY($1)`
+	err := pgxscan.Select(ctx, p.conn, &dtoKeys, query, organizationIDs)
 	keys := mapDtoKeys(dtoKeys)
 	return keys, err
 }
@@ -92,12 +97,14 @@ func (p *postgresKeyRepository) GetByAppID(ctx context.Context, appID string) ([
 }
 
 type apiKeyDto struct {
-	ID          string
-	OwnerUserId string
-	KeyHash     string
-	KeyPreview  string
-	CreatedAt   time.Time
-	UpdatedAt   *time.Time
+	ID             string
+	OwnerUserId    string
+	OrganizationId string
+	KeyHash        string
+	KeyPreview     string
+	PusherSecret   string
+	CreatedAt      time.Time
+	UpdatedAt      *time.Time
 
 	// From api_key_access table
 	ApiKeyId *string
@@ -111,8 +118,8 @@ func (p *postgresKeyRepository) Create(ctx context.Context, key *domain.ApiKey)
 		return err
 	}
 	defer tx.Rollback(ctx)
-	_, err = tx.Exec(ctx, `INSERT INTO api_keys (id, owner_user_id, key_hash, key_preview, created_at)
-		VALUES ($1, $2, $3, $4, NOW())`, key.ID, key.OwnerUserID, key.KeyHash, key.KeyPreview)
+	_, err = tx.Exec(ctx, `INSERT INTO api_keys (id, owner_user_id, organization_id, key_hash, key_preview, pusher_secret, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())`, key.ID, key.OwnerUserID, key.OrganizationID, key.KeyHash, key.KeyPreview, key.PusherSecret)
 	if err != nil {
 		return err
 	}
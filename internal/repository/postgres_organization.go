@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/pgxscan"
+)
+
+type postgresOrganizationRepository struct {
+	conn Connection
+}
+
+func NewPostgresOrganization(conn Connection) domain.OrganizationRepository {
+	return &postgresOrganizationRepository{conn: conn}
+}
+
+// GetByID implements domain.OrganizationRepository.
+func (p *postgresOrganizationRepository) GetByID(ctx context.Context, id string) (domain.Organization, error) {
+	var org domain.Organization
+	rows, err := p.conn.Query(ctx, "SELECT * FROM organizations WHERE id = $1", id)
+	if err != nil {
+		return org, err
+	}
+	err = pgxscan.ScanOne(&org, rows)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return org, domain.ErrNotFound
+		}
+		return org, err
+	}
+	return org, nil
+}
+
+// GetByUserID implements domain.OrganizationRepository.
+func (p *postgresOrganizationRepository) GetByUserID(ctx context.Context, userID string) ([]domain.Organization, error) {
+	orgs := make([]domain.Organization, 0)
+	query := `
+		SELECT o.* FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.user_id = $1
+		ORDER BY o.name`
+	err := pgxscan.Select(ctx, p.conn, &orgs, query, userID)
+	return orgs, err
+}
+
+// Create implements domain.OrganizationRepository.
+func (p *postgresOrganizationRepository) Create(ctx context.Context, org *domain.Organization, owner *domain.OrganizationMember) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(ctx, "INSERT INTO organizations (id, name, created_at) VALUES ($1, $2, NOW())", org.ID, org.Name)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO organization_members (organization_id, user_id, email, role, created_at)
+		VALUES ($1, $2, $3, $4, NOW())`, org.ID, owner.UserID, owner.Email, string(owner.Role))
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Update implements domain.OrganizationRepository.
+func (p *postgresOrganizationRepository) Update(ctx context.Context, org *domain.Organization) error {
+	_, err := p.conn.Exec(ctx, "UPDATE organizations SET name = $1, updated_at = NOW() WHERE id = $2", org.Name, org.ID)
+	return err
+}
+
+// Delete implements domain.OrganizationRepository.
+func (p *postgresOrganizationRepository) Delete(ctx context.Context, id string) error {
+	_, err := p.conn.Exec(ctx, "DELETE FROM organizations WHERE id = $1", id)
+	return err
+}
+
+// GetMembers implements domain.OrganizationRepository.
+func (p *postgresOrganizationRepository) GetMembers(ctx context.Context, organizationID string) ([]domain.OrganizationMember, error) {
+	members := make([]domain.OrganizationMember, 0)
+	err := pgxscan.Select(ctx, p.conn, &members, "SELECT * FROM organization_members WHERE organization_id = $1 ORDER BY created_at", organizationID)
+	return members, err
+}
+
+// GetMember implements domain.OrganizationRepository.
+func (p *postgresOrganizationRepository) GetMember(ctx context.Context, organizationID string, userID string) (domain.OrganizationMember, error) {
+	var member domain.OrganizationMember
+	rows, err := p.conn.Query(ctx, "SELECT * FROM organization_members WHERE organization_id = $1 AND user_id = $2", organizationID, userID)
+	if err != nil {
+		return member, err
+	}
+	err = pgxscan.ScanOne(&member, rows)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return member, domain.ErrNotFound
+		}
+		return member, err
+	}
+	return member, nil
+}
+
+// GetMembershipsByUserID implements domain.OrganizationRepository.
+func (p *postgresOrganizationRepository) GetMembershipsByUserID(ctx context.Context, userID string) ([]domain.OrganizationMember, error) {
+	members := make([]domain.OrganizationMember, 0)
+	err := pgxscan.Select(ctx, p.conn, &members, "SELECT * FROM organization_members WHERE user_id = $1", userID)
+	return members, err
+}
+
+// AddMember implements domain.OrganizationRepository.
+func (p *postgresOrganizationRepository) AddMember(ctx context.Context, member *domain.OrganizationMember) error {
+	query := `
+		INSERT INTO organization_members (organization_id, user_id, email, role, created_at)
+		VALUES ($1, $2, $3, $4, NOW())`
+	_, err := p.conn.Exec(ctx, query, member.OrganizationID, member.UserID, member.Email, string(member.Role))
+	return err
+}
+
+// UpdateMemberRole implements domain.OrganizationRepository.
+func (p *postgresOrganizationRepository) UpdateMemberRole(ctx context.Context, organizationID string, userID string, role domain.Role) error {
+	_, err := p.conn.Exec(ctx, "UPDATE organization_members SET role = $1 WHERE organization_id = $2 AND user_id = $3", string(role), organizationID, userID)
+	return err
+}
+
+// RemoveMember implements domain.OrganizationRepository.
+func (p *postgresOrganizationRepository) RemoveMember(ctx context.Context, organizationID string, userID string) error {
+	_, err := p.conn.Exec(ctx, "DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2", organizationID, userID)
+	return err
+}
+
+// TransferOwnership implements domain.OrganizationRepository.
+func (p *postgresOrganizationRepository) TransferOwnership(ctx context.Context, organizationID string, fromUserID string, toUserID string) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, "UPDATE organization_members SET role = $1 WHERE organization_id = $2 AND user_id = $3",
+		string(domain.RoleOwner), organizationID, toUserID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+	_, err = tx.Exec(ctx, "UPDATE organization_members SET role = $1 WHERE organization_id = $2 AND user_id = $3",
+		string(domain.RoleAdmin), organizationID, fromUserID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
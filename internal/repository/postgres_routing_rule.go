@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/pgxscan"
+)
+
+type postgresRoutingRuleRepository struct {
+	conn Connection
+}
+
+func NewPostgresRoutingRule(conn Connection) domain.RoutingRuleRepository {
+	return &postgresRoutingRuleRepository{conn: conn}
+}
+
+// GetByID implements domain.RoutingRuleRepository.
+func (p *postgresRoutingRuleRepository) GetByID(ctx context.Context, id string) (domain.RoutingRule, error) {
+	var rule domain.RoutingRule
+	rows, err := p.conn.Query(ctx, "SELECT * FROM routing_rules WHERE id = $1", id)
+	if err != nil {
+		return rule, err
+	}
+	err = pgxscan.ScanOne(&rule, rows)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return rule, domain.ErrNotFound
+		}
+		return rule, err
+	}
+	return rule, nil
+}
+
+// GetByAppID implements domain.RoutingRuleRepository.
+func (p *postgresRoutingRuleRepository) GetByAppID(ctx context.Context, appID string) ([]domain.RoutingRule, error) {
+	rules := make([]domain.RoutingRule, 0)
+	err := pgxscan.Select(ctx, p.conn, &rules, "SELECT * FROM routing_rules WHERE app_id = $1 ORDER BY created_at", appID)
+	return rules, err
+}
+
+// Create implements domain.RoutingRuleRepository.
+func (p *postgresRoutingRuleRepository) Create(ctx context.Context, rule *domain.RoutingRule) error {
+	query := `
+		INSERT INTO routing_rules (id, app_id, source_topic, condition, target_topic, transform, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())`
+	_, err := p.conn.Exec(ctx, query, rule.ID, rule.AppID, rule.SourceTopic, rule.Condition, rule.TargetTopic, rule.Transform)
+	return err
+}
+
+// Update implements domain.RoutingRuleRepository.
+func (p *postgresRoutingRuleRepository) Update(ctx context.Context, rule *domain.RoutingRule) error {
+	query := `
+		UPDATE routing_rules SET source_topic = $1, condition = $2, target_topic = $3, transform = $4, updated_at = NOW()
+		WHERE id = $5`
+	_, err := p.conn.Exec(ctx, query, rule.SourceTopic, rule.Condition, rule.TargetTopic, rule.Transform, rule.ID)
+	return err
+}
+
+// Delete implements domain.RoutingRuleRepository.
+func (p *postgresRoutingRuleRepository) Delete(ctx context.Context, id string) error {
+	_, err := p.conn.Exec(ctx, "DELETE FROM routing_rules WHERE id = $1", id)
+	return err
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/pgxscan"
+)
+
+type postgresScheduledMessageRepository struct {
+	conn Connection
+}
+
+func NewPostgresScheduledMessage(conn Connection) domain.ScheduledMessageRepository {
+	return &postgresScheduledMessageRepository{conn: conn}
+}
+
+// GetByAppID implements domain.ScheduledMessageRepository.
+func (p *postgresScheduledMessageRepository) GetByAppID(ctx context.Context, appID string, limit int) ([]domain.ScheduledMessage, error) {
+	messages := make([]domain.ScheduledMessage, 0)
+	query := "SELECT * FROM scheduled_messages WHERE app_id = $1 ORDER BY deliver_at LIMIT $2"
+	err := pgxscan.Select(ctx, p.conn, &messages, query, appID, limit)
+	return messages, err
+}
+
+// Create implements domain.ScheduledMessageRepository.
+func (p *postgresScheduledMessageRepository) Create(ctx context.Context, m *domain.ScheduledMessage) error {
+	query := `
+		INSERT INTO scheduled_messages (id, app_id, topic, event, payload, ttl_seconds, deliver_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())`
+	payload := string(m.Payload)
+	if payload == "" {
+		payload = "null"
+	}
+	_, err := p.conn.Exec(ctx, query, m.ID, m.AppID, m.Topic, m.Event, payload, m.TTLSeconds, m.DeliverAt)
+	return err
+}
+
+// Delete implements domain.ScheduledMessageRepository.
+func (p *postgresScheduledMessageRepository) Delete(ctx context.Context, appID string, id string) error {
+	tag, err := p.conn.Exec(ctx, "DELETE FROM scheduled_messages WHERE app_id = $1 AND id = $2", appID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// ClaimDue implements domain.ScheduledMessageRepository.
+// Rows locked by another instance are skipped, and claimed rows are updated in the same statement.
+func (p *postgresScheduledMessageRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]domain.ScheduledMessage, error) {
+	messages := make([]domain.ScheduledMessage, 0)
+	query := `
+		UPDATE scheduled_messages SET claimed_until = $2
+		WHERE id IN (
+			SELECT id FROM scheduled_messages
+			WHERE deliver_at <= $1 AND (claimed_until IS NULL OR claimed_until <= $1)
+			ORDER BY deliver_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`
+	err := pgxscan.Select(ctx, p.conn, &messages, query, now, now.Add(lease), limit)
+	return messages, err
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/pgxscan"
+)
+
+type postgresTopicMessageRepository struct {
+	conn Connection
+}
+
+func NewPostgresTopicMessage(conn Connection) domain.TopicMessageRepository {
+	return &postgresTopicMessageRepository{conn: conn}
+}
+
+// Append implements domain.TopicMessageRepository.
+// The counter row is locked by the upsert, so sequence numbers are consistent across gateway instances.
+func (p *postgresTopicMessageRepository) Append(ctx context.Context, msg *domain.TopicMessage) error {
+	query := `
+		WITH next AS (
+			INSERT INTO topic_sequences (app_id, topic, seq) VALUES ($1, $2, 1)
+			ON CONFLICT (app_id, topic) DO UPDATE SET seq = topic_sequences.seq + 1
+			RETURNING seq
+		)
+		INSERT INTO topic_messages (app_id, topic, seq, source_topic, event, payload, expires_at, created_at)
+		SELECT $1, $2, seq, $3, $4, $5, $6, NOW() FROM next
+		RETURNING seq, created_at`
+	payload := string(msg.Payload)
+	if payload == "" {
+		payload = "null"
+	}
+	return p.conn.QueryRow(ctx, query, msg.AppID, msg.Topic, msg.SourceTopic, msg.Event, payload, msg.ExpiresAt).Scan(&msg.Seq, &msg.CreatedAt)
+}
+
+// GetRange implements domain.TopicMessageRepository.
+func (p *postgresTopicMessageRepository) GetRange(ctx context.Context, appID string, topic string, from int64, to int64) ([]domain.TopicMessage, error) {
+	messages := make([]domain.TopicMessage, 0)
+	query := `
+		SELECT * FROM topic_messages
+		WHERE app_id = $1 AND topic = $2 AND seq >= $3 AND seq <= $4 AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY seq`
+	err := pgxscan.Select(ctx, p.conn, &messages, query, appID, topic, from, to)
+	return messages, err
+}
+
+// DeleteOlderThan implements domain.TopicMessageRepository.
+func (p *postgresTopicMessageRepository) DeleteOlderThan(ctx context.Context, t time.Time) error {
+	_, err := p.conn.Exec(ctx, "DELETE FROM topic_messages WHERE created_at < $1", t)
+	return err
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/pgxscan"
+)
+
+type postgresAppUsageRepository struct {
+	conn Connection
+}
+
+func NewPostgresAppUsage(conn Connection) domain.AppUsageRepository {
+	return &postgresAppUsageRepository{conn: conn}
+}
+
+// GetByAppID implements domain.AppUsageRepository.
+func (p *postgresAppUsageRepository) GetByAppID(ctx context.Context, appID string, from time.Time, to time.Time) ([]domain.AppUsage, error) {
+	usage := make([]domain.AppUsage, 0)
+	query := "SELECT * FROM app_usage WHERE app_id = $1 AND day >= $2 AND day <= $3 ORDER BY day"
+	err := pgxscan.Select(ctx, p.conn, &usage, query, appID, from, to)
+	return usage, err
+}
+
+// Add implements domain.AppUsageRepository.
+// The usage row of the day stays locked until commit, so instances adding the same minute wait for each other,
+// and the last one sums all samples. Rows are locked in app id order, so instances do not deadlock.
+func (p *postgresAppUsageRepository) Add(ctx context.Context, instanceID string, minute time.Time, usage []domain.AppUsage) error {
+	usageQuery := `
+		INSERT INTO app_usage (app_id, day, messages, delivered_bytes, peak_connections, connection_minutes)
+		VALUES ($1, $2, $3, $4, 0, $5)
+		ON CONFLICT (app_id, day) DO UPDATE SET
+			messages = app_usage.messages + EXCLUDED.messages,
+			delivered_bytes = app_usage.delivered_bytes + EXCLUDED.delivered_bytes,
+			connection_minutes = app_usage.connection_minutes + EXCLUDED.connection_minutes`
+	sampleQuery := `
+		INSERT INTO app_usage_samples (app_id, minute, instance_id, peak_connections)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (app_id, minute, instance_id) DO UPDATE SET
+			peak_connections = GREATEST(app_usage_samples.peak_connections, EXCLUDED.peak_connections)`
+	peakQuery := `
+		UPDATE app_usage SET peak_connections = GREATEST(peak_connections,
+			(SELECT SUM(peak_connections) FROM app_usage_samples WHERE app_id = $1 AND minute = $3))
+		WHERE app_id = $1 AND day = $2`
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	usage = slices.Clone(usage)
+	slices.SortFunc(usage, func(a, b domain.AppUsage) int { return strings.Compare(a.AppID, b.AppID) })
+	for _, u := range usage {
+		_, err = tx.Exec(ctx, usageQuery, u.AppID, u.Day, u.Messages, u.DeliveredBytes, u.ConnectionMinutes)
+		if err != nil {
+			return err
+		}
+		if u.PeakConnections == 0 {
+			continue
+		}
+		_, err = tx.Exec(ctx, sampleQuery, u.AppID, minute, instanceID, u.PeakConnections)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, peakQuery, u.AppID, u.Day, minute)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(ctx, "DELETE FROM app_usage_samples WHERE minute < $1", minute.Add(-usageSampleRetention))
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/pgxscan"
+)
+
+type postgresWebhookDeliveryRepository struct {
+	conn Connection
+}
+
+func NewPostgresWebhookDelivery(conn Connection) domain.WebhookDeliveryRepository {
+	return &postgresWebhookDeliveryRepository{conn: conn}
+}
+
+// GetByAppID implements domain.WebhookDeliveryRepository.
+func (p *postgresWebhookDeliveryRepository) GetByAppID(ctx context.Context, appID string, limit int) ([]domain.WebhookDelivery, error) {
+	deliveries := make([]domain.WebhookDelivery, 0)
+	query := "SELECT * FROM webhook_deliveries WHERE app_id = $1 ORDER BY created_at DESC LIMIT $2"
+	err := pgxscan.Select(ctx, p.conn, &deliveries, query, appID, limit)
+	return deliveries, err
+}
+
+// Create implements domain.WebhookDeliveryRepository.
+func (p *postgresWebhookDeliveryRepository) Create(ctx context.Context, d *domain.WebhookDelivery) error {
+	query := `
+		INSERT INTO webhook_deliveries (id, app_id, event, url, request_body, attempts, status_code, error, success, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())`
+	_, err := p.conn.Exec(ctx, query, d.ID, d.AppID, d.Event, d.URL, d.RequestBody, d.Attempts, d.StatusCode, d.Error, d.Success)
+	return err
+}
+
+// Update implements domain.WebhookDeliveryRepository.
+func (p *postgresWebhookDeliveryRepository) Update(ctx context.Context, d *domain.WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries SET attempts = $1, status_code = $2, error = $3, success = $4, updated_at = NOW()
+		WHERE id = $5`
+	_, err := p.conn.Exec(ctx, query, d.Attempts, d.StatusCode, d.Error, d.Success, d.ID)
+	return err
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+)
+
+// Repositories holds one implementation of every repository, backed by the same store
+type Repositories struct {
+	Apps              domain.ApplicationRepository
+	Keys              domain.ApiKeyRepository
+	WebhookDeliveries domain.WebhookDeliveryRepository
+	DeadLetters       domain.DeadLetterRepository
+	TopicMessages     domain.TopicMessageRepository
+	ScheduledMessages domain.ScheduledMessageRepository
+	RoutingRules      domain.RoutingRuleRepository
+	AccessTokens      domain.AccessTokenRepository
+	Organizations     domain.OrganizationRepository
+	AuditEvents       domain.AuditEventRepository
+	AppUsage          domain.AppUsageRepository
+}
+
+func NewPostgresRepositories(conn Connection) Repositories {
+	return Repositories{
+		Apps:              NewPostgresApp(conn),
+		Keys:              NewPostgresKey(conn),
+		WebhookDeliveries: NewPostgresWebhookDelivery(conn),
+		DeadLetters:       NewPostgresDeadLetter(conn),
+		TopicMessages:     NewPostgresTopicMessage(conn),
+		ScheduledMessages: NewPostgresScheduledMessage(conn),
+		RoutingRules:      NewPostgresRoutingRule(conn),
+		AccessTokens:      NewPostgresAccessToken(conn),
+		Organizations:     NewPostgresOrganization(conn),
+		AuditEvents:       NewPostgresAuditEvent(conn),
+		AppUsage:          NewPostgresAppUsage(conn),
+	}
+}
+
+// NewSqliteRepositories returns repositories on a database opened with OpenSqlite
+func NewSqliteRepositories(db *sql.DB) Repositories {
+	return Repositories{
+		Apps:              NewSqliteApp(db),
+		Keys:              NewSqliteKey(db),
+		WebhookDeliveries: NewSqliteWebhookDelivery(db),
+		DeadLetters:       NewSqliteDeadLetter(db),
+		TopicMessages:     NewSqliteTopicMessage(db),
+		ScheduledMessages: NewSqliteScheduledMessage(db),
+		RoutingRules:      NewSqliteRoutingRule(db),
+		AccessTokens:      NewSqliteAccessToken(db),
+		Organizations:     NewSqliteOrganization(db),
+		AuditEvents:       NewSqliteAuditEvent(db),
+		AppUsage:          NewSqliteAppUsage(db),
+	}
+}
+
+// NewMemoryRepositories returns repositories that keep everything in memory, for tests and trying out the gateway.
+// Nothing is persisted, and nothing is shared between gateway instances.
+func NewMemoryRepositories() Repositories {
+	return Repositories{
+		Apps:              NewMemoryApp(),
+		Keys:              NewMemoryKey(),
+		WebhookDeliveries: NewMemoryWebhookDelivery(),
+		DeadLetters:       NewMemoryDeadLetter(),
+		TopicMessages:     NewMemoryTopicMessage(),
+		ScheduledMessages: NewMemoryScheduledMessage(),
+		RoutingRules:      NewMemoryRoutingRule(),
+		AccessTokens:      NewMemoryAccessToken(),
+		Organizations:     NewMemoryOrganization(),
+		AuditEvents:       NewMemoryAuditEvent(),
+		AppUsage:          NewMemoryAppUsage(),
+	}
+}
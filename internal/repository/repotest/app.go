@@ -0,0 +1,222 @@
+package repotest
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/bjarke-xyz/ws-gateway/internal/repository"
+)
+
+func testApplications(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	org, _ := newOrganization(t, repos, "Apps")
+	otherOrg, _ := newOrganization(t, repos, "Other apps")
+
+	app := domain.Application{
+		ID:                  newID(),
+		OwnerUserID:         newID(),
+		OrganizationID:      org.ID,
+		Name:                "b app",
+		WebhookURL:          "https://example.com/hook",
+		WebhookSecret:       "secret",
+		WebhookEvents:       []string{domain.WebhookEventClientConnected},
+		PusherEnabled:       true,
+		ReliableTopics:      []string{"orders", "payments"},
+		AckTimeoutSeconds:   10,
+		MaxDeliveryAttempts: 3,
+	}
+	must(t, repos.Apps.Create(ctx, &app))
+	if err := repos.Apps.Create(ctx, &app); err == nil {
+		t.Error("creating an app with an existing id succeeded")
+	}
+
+	got, err := repos.Apps.GetByID(ctx, app.ID)
+	must(t, err)
+	equal(t, "ID", got.ID, app.ID)
+	equal(t, "OwnerUserID", got.OwnerUserID, app.OwnerUserID)
+	equal(t, "OrganizationID", got.OrganizationID, org.ID)
+	equal(t, "Name", got.Name, app.Name)
+	equal(t, "WebhookURL", got.WebhookURL, app.WebhookURL)
+	equal(t, "WebhookSecret", got.WebhookSecret, app.WebhookSecret)
+	equalStrings(t, "WebhookEvents", got.WebhookEvents, app.WebhookEvents)
+	equal(t, "PusherEnabled", got.PusherEnabled, true)
+	equalStrings(t, "ReliableTopics", got.ReliableTopics, app.ReliableTopics)
+	equal(t, "AckTimeoutSeconds", got.AckTimeoutSeconds, 10)
+	equal(t, "MaxDeliveryAttempts", got.MaxDeliveryAttempts, 3)
+	equalStrings(t, "SequencedTopics", got.SequencedTopics, nil)
+	recent(t, "CreatedAt", got.CreatedAt)
+	if got.UpdatedAt != nil {
+		t.Errorf("UpdatedAt of a new app is %v, want nil", got.UpdatedAt)
+	}
+
+	_, err = repos.Apps.GetByID(ctx, newID())
+	mustNotFound(t, err)
+
+	got.Name = "d app"
+	got.WebhookEvents = nil
+	got.ReliableTopics = []string{"orders"}
+	got.SequencedTopics = []string{"chat"}
+	got.AckTimeoutSeconds = 20
+	got.OrganizationID = otherOrg.ID
+	must(t, repos.Apps.Update(ctx, &got))
+	updated, err := repos.Apps.GetByID(ctx, app.ID)
+	must(t, err)
+	equal(t, "Name", updated.Name, "d app")
+	equalStrings(t, "WebhookEvents", updated.WebhookEvents, nil)
+	equalStrings(t, "ReliableTopics", updated.ReliableTopics, []string{"orders"})
+	equalStrings(t, "SequencedTopics", updated.SequencedTopics, []string{"chat"})
+	equal(t, "AckTimeoutSeconds", updated.AckTimeoutSeconds, 20)
+	equal(t, "OrganizationID", updated.OrganizationID, org.ID)
+	if updated.UpdatedAt == nil {
+		t.Error("UpdatedAt of an updated app is nil")
+	} else {
+		recent(t, "UpdatedAt", *updated.UpdatedAt)
+	}
+
+	a := newApp(t, repos, org, "a app")
+	c := newApp(t, repos, otherOrg, "c app")
+	apps, err := repos.Apps.GetByOrganizationIDs(ctx, []string{org.ID})
+	must(t, err)
+	equalStrings(t, "apps of organization", appIDs(apps), []string{a.ID, app.ID})
+	apps, err = repos.Apps.GetByOrganizationIDs(ctx, []string{org.ID, otherOrg.ID})
+	must(t, err)
+	equalStrings(t, "apps of organizations", appIDs(apps), []string{a.ID, c.ID, app.ID})
+	apps, err = repos.Apps.GetByOrganizationIDs(ctx, []string{})
+	must(t, err)
+	if apps == nil || len(apps) != 0 {
+		t.Errorf("apps of no organizations is %v, want empty", apps)
+	}
+
+	must(t, repos.Apps.Delete(ctx, app.ID))
+	_, err = repos.Apps.GetByID(ctx, app.ID)
+	mustNotFound(t, err)
+	must(t, repos.Apps.Delete(ctx, app.ID))
+}
+
+func appIDs(apps []domain.Application) []string {
+	ids := make([]string, 0, len(apps))
+	for _, app := range apps {
+		ids = append(ids, app.ID)
+	}
+	return ids
+}
+
+func testApiKeys(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	org, _ := newOrganization(t, repos, "Keys")
+	otherOrg, _ := newOrganization(t, repos, "Other keys")
+	app1 := newApp(t, repos, org, "app 1")
+	app2 := newApp(t, repos, org, "app 2")
+
+	key := domain.ApiKey{
+		ID:             newID(),
+		OwnerUserID:    newID(),
+		OrganizationID: org.ID,
+		KeyHash:        "hash",
+		KeyPreview:     "wsg_1234",
+		PusherSecret:   "pusher",
+		Access:         []domain.ApiKeyAccess{{AppID: app1.ID}, {AppID: app2.ID}},
+	}
+	must(t, repos.Keys.Create(ctx, &key))
+	if err := repos.Keys.Create(ctx, &key); err == nil {
+		t.Error("creating a key with an existing id succeeded")
+	}
+
+	got, err := repos.Keys.GetByID(ctx, key.ID)
+	must(t, err)
+	equal(t, "ID", got.ID, key.ID)
+	equal(t, "OwnerUserID", got.OwnerUserID, key.OwnerUserID)
+	equal(t, "OrganizationID", got.OrganizationID, org.ID)
+	equal(t, "KeyHash", got.KeyHash, "hash")
+	equal(t, "KeyPreview", got.KeyPreview, "wsg_1234")
+	equal(t, "PusherSecret", got.PusherSecret, "pusher")
+	recent(t, "CreatedAt", got.CreatedAt)
+	equalStrings(t, "access", accessAppIDs(t, got), sorted(app1.ID, app2.ID))
+
+	_, err = repos.Keys.GetByID(ctx, newID())
+	mustNotFound(t, err)
+
+	noAccess := domain.ApiKey{ID: newID(), OwnerUserID: newID(), OrganizationID: org.ID, KeyHash: "hash2", KeyPreview: "wsg_5678"}
+	must(t, repos.Keys.Create(ctx, &noAccess))
+	got, err = repos.Keys.GetByID(ctx, noAccess.ID)
+	must(t, err)
+	equalStrings(t, "access of key without access", accessAppIDs(t, got), nil)
+	otherKey := domain.ApiKey{ID: newID(), OwnerUserID: newID(), OrganizationID: otherOrg.ID, KeyHash: "hash3", KeyPreview: "wsg_9012"}
+	must(t, repos.Keys.Create(ctx, &otherKey))
+
+	keys, err := repos.Keys.GetByOrganizationIDs(ctx, []string{org.ID})
+	must(t, err)
+	equalStrings(t, "keys of organization", keyIDs(keys), sorted(key.ID, noAccess.ID))
+	keys, err = repos.Keys.GetByOrganizationIDs(ctx, []string{org.ID, otherOrg.ID})
+	must(t, err)
+	equalStrings(t, "keys of organizations", keyIDs(keys), sorted(key.ID, noAccess.ID, otherKey.ID))
+	for _, k := range keys {
+		if k.ID == key.ID {
+			equalStrings(t, "access of listed key", accessAppIDs(t, k), sorted(app1.ID, app2.ID))
+		}
+	}
+
+	keys, err = repos.Keys.GetByAppID(ctx, app2.ID)
+	must(t, err)
+	equalStrings(t, "keys of app", keyIDs(keys), []string{key.ID})
+	if len(keys) == 1 {
+		// Only the access to the app is included
+		equalStrings(t, "access of key of app", accessAppIDs(t, keys[0]), []string{app2.ID})
+	}
+
+	must(t, repos.Keys.Update(ctx, key.ID, []domain.ApiKeyAccess{{ApiKeyID: key.ID, AppID: app1.ID}}))
+	got, err = repos.Keys.GetByID(ctx, key.ID)
+	must(t, err)
+	equalStrings(t, "access after update", accessAppIDs(t, got), []string{app1.ID})
+	keys, err = repos.Keys.GetByAppID(ctx, app2.ID)
+	must(t, err)
+	equalStrings(t, "keys of app after update", keyIDs(keys), nil)
+
+	must(t, repos.Keys.Update(ctx, key.ID, nil))
+	got, err = repos.Keys.GetByID(ctx, key.ID)
+	must(t, err)
+	equalStrings(t, "access after removing all", accessAppIDs(t, got), nil)
+
+	must(t, repos.Keys.UpdateKeyPreview(ctx, key.ID, "wsg_abcd"))
+	got, err = repos.Keys.GetByID(ctx, key.ID)
+	must(t, err)
+	equal(t, "KeyPreview", got.KeyPreview, "wsg_abcd")
+	equal(t, "KeyHash", got.KeyHash, "hash")
+
+	must(t, repos.Keys.Update(ctx, key.ID, []domain.ApiKeyAccess{{AppID: app2.ID}}))
+	must(t, repos.Keys.Delete(ctx, key.ID))
+	_, err = repos.Keys.GetByID(ctx, key.ID)
+	mustNotFound(t, err)
+	keys, err = repos.Keys.GetByAppID(ctx, app2.ID)
+	must(t, err)
+	equalStrings(t, "keys of app after delete", keyIDs(keys), nil)
+}
+
+// accessAppIDs returns the sorted apps the key has access to, checking that the access belongs to the key
+func accessAppIDs(t *testing.T, key domain.ApiKey) []string {
+	t.Helper()
+	ids := make([]string, 0, len(key.Access))
+	for _, access := range key.Access {
+		equal(t, "ApiKeyID of access", access.ApiKeyID, key.ID)
+		ids = append(ids, access.AppID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// keyIDs returns the sorted ids of keys, as keys are listed in no particular order
+func keyIDs(keys []domain.ApiKey) []string {
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		ids = append(ids, key.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func sorted(values ...string) []string {
+	slices.Sort(values)
+	return values
+}
@@ -0,0 +1,257 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/bjarke-xyz/ws-gateway/internal/repository"
+)
+
+func testRoutingRules(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	org, _ := newOrganization(t, repos, "Routing")
+	app := newApp(t, repos, org, "routing app")
+	first := domain.RoutingRule{ID: newID(), AppID: app.ID, SourceTopic: "orders.*", Condition: "payload.total > 100", TargetTopic: "big-orders"}
+	second := domain.RoutingRule{ID: newID(), AppID: app.ID, SourceTopic: "chat", TargetTopic: "chat.{room}"}
+	must(t, repos.RoutingRules.Create(ctx, &first))
+	must(t, repos.RoutingRules.Create(ctx, &second))
+
+	got, err := repos.RoutingRules.GetByID(ctx, first.ID)
+	must(t, err)
+	equal(t, "AppID", got.AppID, app.ID)
+	equal(t, "SourceTopic", got.SourceTopic, "orders.*")
+	equal(t, "Condition", got.Condition, "payload.total > 100")
+	equal(t, "TargetTopic", got.TargetTopic, "big-orders")
+	recent(t, "CreatedAt", got.CreatedAt)
+	_, err = repos.RoutingRules.GetByID(ctx, newID())
+	mustNotFound(t, err)
+
+	rules, err := repos.RoutingRules.GetByAppID(ctx, app.ID)
+	must(t, err)
+	ids := make([]string, 0)
+	for _, rule := range rules {
+		ids = append(ids, rule.ID)
+	}
+	equalStrings(t, "rules of app", ids, []string{first.ID, second.ID})
+
+	got.TargetTopic = "large-orders"
+	got.Transform = "{'id': payload.id}"
+	must(t, repos.RoutingRules.Update(ctx, &got))
+	got, err = repos.RoutingRules.GetByID(ctx, first.ID)
+	must(t, err)
+	equal(t, "TargetTopic after update", got.TargetTopic, "large-orders")
+	equal(t, "Transform after update", got.Transform, "{'id': payload.id}")
+	if got.UpdatedAt == nil {
+		t.Error("UpdatedAt of an updated rule is nil")
+	}
+
+	must(t, repos.RoutingRules.Delete(ctx, first.ID))
+	_, err = repos.RoutingRules.GetByID(ctx, first.ID)
+	mustNotFound(t, err)
+}
+
+func testWebhookDeliveries(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	appID := newID()
+	deliveries := make([]domain.WebhookDelivery, 3)
+	for i := range deliveries {
+		deliveries[i] = domain.WebhookDelivery{ID: newID(), AppID: appID, Event: domain.WebhookEventClientConnected, URL: "https://example.com", RequestBody: "{}", Attempts: 1}
+		must(t, repos.WebhookDeliveries.Create(ctx, &deliveries[i]))
+	}
+	must(t, repos.WebhookDeliveries.Create(ctx, &domain.WebhookDelivery{ID: newID(), AppID: newID()}))
+
+	got, err := repos.WebhookDeliveries.GetByAppID(ctx, appID, 2)
+	must(t, err)
+	ids := make([]string, 0)
+	for _, d := range got {
+		ids = append(ids, d.ID)
+	}
+	equalStrings(t, "deliveries of app, newest first", ids, []string{deliveries[2].ID, deliveries[1].ID})
+
+	d := deliveries[2]
+	d.Attempts = 2
+	d.StatusCode = 500
+	d.Error = "server error"
+	must(t, repos.WebhookDeliveries.Update(ctx, &d))
+	d.Attempts = 3
+	d.StatusCode = 200
+	d.Error = ""
+	d.Success = true
+	must(t, repos.WebhookDeliveries.Update(ctx, &d))
+	got, err = repos.WebhookDeliveries.GetByAppID(ctx, appID, 1)
+	must(t, err)
+	if len(got) != 1 {
+		t.Fatalf("got %v deliveries, want 1", len(got))
+	}
+	equal(t, "Attempts", got[0].Attempts, 3)
+	equal(t, "StatusCode", got[0].StatusCode, 200)
+	equal(t, "Error", got[0].Error, "")
+	equal(t, "Success", got[0].Success, true)
+	equal(t, "RequestBody", got[0].RequestBody, "{}")
+	recent(t, "CreatedAt", got[0].CreatedAt)
+	if got[0].UpdatedAt == nil {
+		t.Error("UpdatedAt of an updated delivery is nil")
+	}
+}
+
+func testDeadLetters(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	appID := newID()
+	first := domain.DeadLetter{ID: newID(), AppID: appID, Topic: "orders", UserID: "user", MessageID: "msg-1", Event: "created",
+		Payload: []byte(`{"id": 1}`), Attempts: 5, Reason: "max attempts"}
+	second := domain.DeadLetter{ID: newID(), AppID: appID, Topic: "orders", UserID: "user", MessageID: "msg-2", Event: "created"}
+	must(t, repos.DeadLetters.Create(ctx, &first))
+	must(t, repos.DeadLetters.Create(ctx, &second))
+
+	got, err := repos.DeadLetters.GetByAppID(ctx, appID, 10)
+	must(t, err)
+	if len(got) != 2 {
+		t.Fatalf("got %v dead letters, want 2", len(got))
+	}
+	equal(t, "newest dead letter", got[0].ID, second.ID)
+	// An empty payload is stored as null
+	equalJSON(t, "empty Payload", got[0].Payload, "null")
+	equal(t, "Topic", got[1].Topic, "orders")
+	equal(t, "MessageID", got[1].MessageID, "msg-1")
+	equal(t, "Attempts", got[1].Attempts, 5)
+	equal(t, "Reason", got[1].Reason, "max attempts")
+	equalJSON(t, "Payload", got[1].Payload, `{"id": 1}`)
+	recent(t, "CreatedAt", got[1].CreatedAt)
+
+	// Dead letters are only deleted from their own app
+	must(t, repos.DeadLetters.Delete(ctx, newID(), first.ID))
+	must(t, repos.DeadLetters.Delete(ctx, appID, second.ID))
+	got, err = repos.DeadLetters.GetByAppID(ctx, appID, 10)
+	must(t, err)
+	if len(got) != 1 || got[0].ID != first.ID {
+		t.Errorf("got %v dead letters after delete, want only %v", len(got), first.ID)
+	}
+}
+
+func testScheduledMessages(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	appID := newID()
+	now := time.Now().UTC().Truncate(time.Second)
+	later := domain.ScheduledMessage{ID: newID(), AppID: appID, Topic: "news", Event: "later", Payload: []byte(`{"n":3}`), DeliverAt: now.Add(time.Hour)}
+	due := domain.ScheduledMessage{ID: newID(), AppID: appID, Topic: "news", Event: "due", Payload: []byte(`{"n":2}`), TTLSeconds: 60, DeliverAt: now.Add(-time.Minute)}
+	overdue := domain.ScheduledMessage{ID: newID(), AppID: appID, Topic: "news", Event: "overdue", DeliverAt: now.Add(-time.Hour)}
+	for _, m := range []*domain.ScheduledMessage{&later, &due, &overdue} {
+		must(t, repos.ScheduledMessages.Create(ctx, m))
+	}
+
+	messages, err := repos.ScheduledMessages.GetByAppID(ctx, appID, 10)
+	must(t, err)
+	equalStrings(t, "scheduled messages by delivery time", scheduledIDs(messages), []string{overdue.ID, due.ID, later.ID})
+	if len(messages) == 3 {
+		equal(t, "Topic", messages[1].Topic, "news")
+		equal(t, "Event", messages[1].Event, "due")
+		equal(t, "TTLSeconds", messages[1].TTLSeconds, 60)
+		equalJSON(t, "Payload", messages[1].Payload, `{"n":2}`)
+		equalJSON(t, "empty Payload", messages[0].Payload, "null")
+		if !messages[1].DeliverAt.Equal(due.DeliverAt) {
+			t.Errorf("DeliverAt is %v, want %v", messages[1].DeliverAt, due.DeliverAt)
+		}
+		recent(t, "CreatedAt", messages[1].CreatedAt)
+	}
+	messages, err = repos.ScheduledMessages.GetByAppID(ctx, appID, 1)
+	must(t, err)
+	equalStrings(t, "scheduled messages with limit", scheduledIDs(messages), []string{overdue.ID})
+
+	mustNotFound(t, repos.ScheduledMessages.Delete(ctx, appID, newID()))
+	mustNotFound(t, repos.ScheduledMessages.Delete(ctx, newID(), later.ID))
+
+	// Other tests may have due messages in the same database, so only the messages of this test are checked
+	claimedIDs := func(at time.Time) []string {
+		claimed, err := repos.ScheduledMessages.ClaimDue(ctx, at, time.Minute, 1000)
+		must(t, err)
+		ids := make([]string, 0)
+		for _, m := range claimed {
+			if m.AppID == appID {
+				ids = append(ids, m.ID)
+				if m.ClaimedUntil == nil || !m.ClaimedUntil.Equal(at.Add(time.Minute)) {
+					t.Errorf("ClaimedUntil is %v, want %v", m.ClaimedUntil, at.Add(time.Minute))
+				}
+			}
+		}
+		return ids
+	}
+	equalStrings(t, "claimed messages", claimedIDs(now), []string{overdue.ID, due.ID})
+	equalStrings(t, "messages claimed during the lease", claimedIDs(now.Add(30*time.Second)), nil)
+	// The lease has passed without the messages being deleted as delivered
+	equalStrings(t, "messages claimed after the lease", claimedIDs(now.Add(2*time.Minute)), []string{overdue.ID, due.ID})
+	must(t, repos.ScheduledMessages.Delete(ctx, appID, due.ID))
+	must(t, repos.ScheduledMessages.Delete(ctx, appID, overdue.ID))
+	mustNotFound(t, repos.ScheduledMessages.Delete(ctx, appID, due.ID))
+
+	must(t, repos.ScheduledMessages.Delete(ctx, appID, later.ID))
+	messages, err = repos.ScheduledMessages.GetByAppID(ctx, appID, 10)
+	must(t, err)
+	equalStrings(t, "scheduled messages after delete", scheduledIDs(messages), nil)
+}
+
+func scheduledIDs(messages []domain.ScheduledMessage) []string {
+	ids := make([]string, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func testTopicMessages(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	appID := newID()
+	expired := time.Now().Add(-time.Minute)
+	unexpired := time.Now().Add(time.Hour)
+	messages := []domain.TopicMessage{
+		{AppID: appID, Topic: "chat.*", SourceTopic: "chat.general", Event: "message", Payload: []byte(`{"text":"hi"}`)},
+		{AppID: appID, Topic: "chat.*", Event: "message", ExpiresAt: &expired},
+		{AppID: appID, Topic: "chat.*", Event: "message", ExpiresAt: &unexpired},
+		{AppID: appID, Topic: "other", Event: "message"},
+	}
+	for i := range messages {
+		must(t, repos.TopicMessages.Append(ctx, &messages[i]))
+		recent(t, "CreatedAt", messages[i].CreatedAt)
+	}
+	equal(t, "first Seq", messages[0].Seq, int64(1))
+	equal(t, "second Seq", messages[1].Seq, int64(2))
+	equal(t, "third Seq", messages[2].Seq, int64(3))
+	equal(t, "Seq of other topic", messages[3].Seq, int64(1))
+
+	got, err := repos.TopicMessages.GetRange(ctx, appID, "chat.*", 1, 3)
+	must(t, err)
+	// The expired message is left out
+	if len(got) != 2 {
+		t.Fatalf("got %v messages, want 2", len(got))
+	}
+	equal(t, "Seq", got[0].Seq, int64(1))
+	equal(t, "SourceTopic", got[0].SourceTopic, "chat.general")
+	equal(t, "Event", got[0].Event, "message")
+	equalJSON(t, "Payload", got[0].Payload, `{"text":"hi"}`)
+	if got[0].ExpiresAt != nil {
+		t.Errorf("ExpiresAt is %v, want nil", got[0].ExpiresAt)
+	}
+	equal(t, "Seq", got[1].Seq, int64(3))
+	equalJSON(t, "empty Payload", got[1].Payload, "null")
+	if got[1].ExpiresAt == nil || got[1].ExpiresAt.Sub(unexpired).Abs() > time.Millisecond {
+		t.Errorf("ExpiresAt is %v, want %v", got[1].ExpiresAt, unexpired)
+	}
+
+	got, err = repos.TopicMessages.GetRange(ctx, appID, "chat.*", 2, 2)
+	must(t, err)
+	if len(got) != 0 {
+		t.Errorf("got %v expired messages, want 0", len(got))
+	}
+
+	must(t, repos.TopicMessages.DeleteOlderThan(ctx, time.Now().Add(time.Hour)))
+	got, err = repos.TopicMessages.GetRange(ctx, appID, "chat.*", 1, 3)
+	must(t, err)
+	if len(got) != 0 {
+		t.Errorf("got %v messages after deleting them, want 0", len(got))
+	}
+	// Sequence numbers are not reused
+	msg := domain.TopicMessage{AppID: appID, Topic: "chat.*", Event: "message"}
+	must(t, repos.TopicMessages.Append(ctx, &msg))
+	equal(t, "Seq after delete", msg.Seq, int64(4))
+}
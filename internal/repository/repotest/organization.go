@@ -0,0 +1,225 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/bjarke-xyz/ws-gateway/internal/repository"
+)
+
+func testOrganizations(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	org, owner := newOrganization(t, repos, "b organization")
+
+	got, err := repos.Organizations.GetByID(ctx, org.ID)
+	must(t, err)
+	equal(t, "Name", got.Name, "b organization")
+	recent(t, "CreatedAt", got.CreatedAt)
+	_, err = repos.Organizations.GetByID(ctx, newID())
+	mustNotFound(t, err)
+
+	member, err := repos.Organizations.GetMember(ctx, org.ID, owner.UserID)
+	must(t, err)
+	equal(t, "Role of creator", member.Role, domain.RoleOwner)
+	equal(t, "Email of creator", member.Email, owner.Email)
+	_, err = repos.Organizations.GetMember(ctx, org.ID, newID())
+	mustNotFound(t, err)
+
+	developer := domain.OrganizationMember{OrganizationID: org.ID, UserID: newID(), Email: "dev@example.com", Role: domain.RoleDeveloper}
+	must(t, repos.Organizations.AddMember(ctx, &developer))
+	if err := repos.Organizations.AddMember(ctx, &developer); err == nil {
+		t.Error("adding an existing member succeeded")
+	}
+	members, err := repos.Organizations.GetMembers(ctx, org.ID)
+	must(t, err)
+	equalStrings(t, "members", memberUserIDs(members), []string{owner.UserID, developer.UserID})
+
+	// The developer is also in another organization, which sorts first by name
+	otherOrg := domain.Organization{ID: newID(), Name: "a organization"}
+	must(t, repos.Organizations.Create(ctx, &otherOrg, &domain.OrganizationMember{OrganizationID: otherOrg.ID, UserID: developer.UserID, Role: domain.RoleOwner}))
+	orgs, err := repos.Organizations.GetByUserID(ctx, developer.UserID)
+	must(t, err)
+	equalStrings(t, "organizations of member", organizationIDs(orgs), []string{otherOrg.ID, org.ID})
+	memberships, err := repos.Organizations.GetMembershipsByUserID(ctx, developer.UserID)
+	must(t, err)
+	if len(memberships) != 2 {
+		t.Errorf("member has %v memberships, want 2", len(memberships))
+	}
+	orgs, err = repos.Organizations.GetByUserID(ctx, newID())
+	must(t, err)
+	equalStrings(t, "organizations of non-member", organizationIDs(orgs), nil)
+
+	must(t, repos.Organizations.UpdateMemberRole(ctx, org.ID, developer.UserID, domain.RoleViewer))
+	member, err = repos.Organizations.GetMember(ctx, org.ID, developer.UserID)
+	must(t, err)
+	equal(t, "Role after update", member.Role, domain.RoleViewer)
+
+	err = repos.Organizations.TransferOwnership(ctx, org.ID, owner.UserID, newID())
+	mustNotFound(t, err)
+	member, err = repos.Organizations.GetMember(ctx, org.ID, owner.UserID)
+	must(t, err)
+	equal(t, "Role after failed transfer", member.Role, domain.RoleOwner)
+
+	must(t, repos.Organizations.TransferOwnership(ctx, org.ID, owner.UserID, developer.UserID))
+	member, err = repos.Organizations.GetMember(ctx, org.ID, developer.UserID)
+	must(t, err)
+	equal(t, "Role of new owner", member.Role, domain.RoleOwner)
+	member, err = repos.Organizations.GetMember(ctx, org.ID, owner.UserID)
+	must(t, err)
+	equal(t, "Role of previous owner", member.Role, domain.RoleAdmin)
+
+	must(t, repos.Organizations.RemoveMember(ctx, org.ID, owner.UserID))
+	_, err = repos.Organizations.GetMember(ctx, org.ID, owner.UserID)
+	mustNotFound(t, err)
+
+	got.Name = "c organization"
+	must(t, repos.Organizations.Update(ctx, &got))
+	got, err = repos.Organizations.GetByID(ctx, org.ID)
+	must(t, err)
+	equal(t, "Name after update", got.Name, "c organization")
+	if got.UpdatedAt == nil {
+		t.Error("UpdatedAt of an updated organization is nil")
+	}
+
+	must(t, repos.Organizations.Delete(ctx, org.ID))
+	_, err = repos.Organizations.GetByID(ctx, org.ID)
+	mustNotFound(t, err)
+	members, err = repos.Organizations.GetMembers(ctx, org.ID)
+	must(t, err)
+	equalStrings(t, "members of deleted organization", memberUserIDs(members), nil)
+	orgs, err = repos.Organizations.GetByUserID(ctx, developer.UserID)
+	must(t, err)
+	equalStrings(t, "organizations after delete", organizationIDs(orgs), []string{otherOrg.ID})
+}
+
+func memberUserIDs(members []domain.OrganizationMember) []string {
+	ids := make([]string, 0, len(members))
+	for _, member := range members {
+		ids = append(ids, member.UserID)
+	}
+	return ids
+}
+
+func organizationIDs(orgs []domain.Organization) []string {
+	ids := make([]string, 0, len(orgs))
+	for _, org := range orgs {
+		ids = append(ids, org.ID)
+	}
+	return ids
+}
+
+func testAccessTokens(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	userID := newID()
+	first := domain.AccessToken{ID: newID(), OwnerUserID: userID, Name: "ci", TokenHash: "hash1", TokenPreview: "wsgpat_1"}
+	second := domain.AccessToken{ID: newID(), OwnerUserID: userID, Name: "laptop", TokenHash: "hash2", TokenPreview: "wsgpat_2"}
+	must(t, repos.AccessTokens.Create(ctx, &first))
+	must(t, repos.AccessTokens.Create(ctx, &second))
+	if err := repos.AccessTokens.Create(ctx, &first); err == nil {
+		t.Error("creating a token with an existing id succeeded")
+	}
+
+	got, err := repos.AccessTokens.GetByID(ctx, first.ID)
+	must(t, err)
+	equal(t, "Name", got.Name, "ci")
+	equal(t, "TokenHash", got.TokenHash, "hash1")
+	equal(t, "TokenPreview", got.TokenPreview, "wsgpat_1")
+	recent(t, "CreatedAt", got.CreatedAt)
+	if got.LastUsedAt != nil {
+		t.Errorf("LastUsedAt of a new token is %v, want nil", got.LastUsedAt)
+	}
+	_, err = repos.AccessTokens.GetByID(ctx, newID())
+	mustNotFound(t, err)
+
+	tokens, err := repos.AccessTokens.GetByUserID(ctx, userID)
+	must(t, err)
+	ids := make([]string, 0)
+	for _, token := range tokens {
+		ids = append(ids, token.ID)
+	}
+	equalStrings(t, "tokens of user", ids, []string{first.ID, second.ID})
+
+	must(t, repos.AccessTokens.UpdateTokenPreview(ctx, first.ID, "wsgpat_x"))
+	must(t, repos.AccessTokens.UpdateLastUsed(ctx, first.ID))
+	got, err = repos.AccessTokens.GetByID(ctx, first.ID)
+	must(t, err)
+	equal(t, "TokenPreview after update", got.TokenPreview, "wsgpat_x")
+	if got.LastUsedAt == nil {
+		t.Error("LastUsedAt of a used token is nil")
+	} else {
+		recent(t, "LastUsedAt", *got.LastUsedAt)
+	}
+
+	must(t, repos.AccessTokens.Delete(ctx, first.ID))
+	_, err = repos.AccessTokens.GetByID(ctx, first.ID)
+	mustNotFound(t, err)
+}
+
+func testAuditEvents(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	start := time.Now().Add(-time.Minute)
+	orgID := newID()
+	userID := newID()
+	events := []domain.AuditEvent{
+		{ID: newID(), ActorUserID: userID, ActorEmail: "a@example.com", OrganizationID: orgID, Action: domain.AuditActionAppCreate,
+			TargetType: "app", TargetID: "app-1", After: []byte(`{"name":"app"}`), IP: "127.0.0.1", UserAgent: "test"},
+		{ID: newID(), ActorUserID: userID, ActorEmail: "a@example.com", OrganizationID: orgID, Action: domain.AuditActionAppUpdate,
+			TargetType: "app", TargetID: "app-1", Before: []byte(`{"name":"app"}`), After: []byte(`{"name":"renamed"}`)},
+		{ID: newID(), ActorEmail: "b@example.com", OrganizationID: orgID, Action: domain.AuditActionAppDelete, TargetType: "app", TargetID: "app-2"},
+	}
+	for i := range events {
+		must(t, repos.AuditEvents.Create(ctx, &events[i]))
+	}
+
+	// Like the server, filters always have the user viewing the events, here a member who did nothing
+	viewerID := newID()
+	got, err := repos.AuditEvents.Get(ctx, domain.AuditEventFilter{OrganizationIDs: []string{orgID}, UserID: viewerID})
+	must(t, err)
+	equalStrings(t, "events of organization, newest first", auditEventIDs(got), []string{events[2].ID, events[1].ID, events[0].ID})
+	if len(got) == 3 {
+		first := got[2]
+		equal(t, "ActorUserID", first.ActorUserID, userID)
+		equal(t, "ActorEmail", first.ActorEmail, "a@example.com")
+		equal(t, "Action", first.Action, domain.AuditActionAppCreate)
+		equal(t, "TargetType", first.TargetType, "app")
+		equal(t, "IP", first.IP, "127.0.0.1")
+		equal(t, "UserAgent", first.UserAgent, "test")
+		recent(t, "CreatedAt", first.CreatedAt)
+		if len(first.Before) != 0 {
+			t.Errorf("Before of a created target is %s, want empty", first.Before)
+		}
+		equalJSON(t, "After", first.After, `{"name":"app"}`)
+		equalJSON(t, "Before of update", got[1].Before, `{"name":"app"}`)
+	}
+
+	filters := []struct {
+		name   string
+		filter domain.AuditEventFilter
+		want   []string
+	}{
+		{"by user", domain.AuditEventFilter{OrganizationIDs: []string{newID()}, UserID: userID}, []string{events[1].ID, events[0].ID}},
+		{"by actor email", domain.AuditEventFilter{OrganizationIDs: []string{orgID}, UserID: viewerID, Actor: "b@example.com"}, []string{events[2].ID}},
+		{"by actor id", domain.AuditEventFilter{OrganizationIDs: []string{orgID}, UserID: viewerID, Actor: userID}, []string{events[1].ID, events[0].ID}},
+		{"by action", domain.AuditEventFilter{OrganizationIDs: []string{orgID}, UserID: viewerID, Action: domain.AuditActionAppUpdate}, []string{events[1].ID}},
+		{"by target", domain.AuditEventFilter{OrganizationIDs: []string{orgID}, UserID: viewerID, TargetID: "app-1"}, []string{events[1].ID, events[0].ID}},
+		{"with limit", domain.AuditEventFilter{OrganizationIDs: []string{orgID}, UserID: viewerID, Limit: 2}, []string{events[2].ID, events[1].ID}},
+		{"from", domain.AuditEventFilter{OrganizationIDs: []string{orgID}, UserID: viewerID, From: start}, []string{events[2].ID, events[1].ID, events[0].ID}},
+		{"to", domain.AuditEventFilter{OrganizationIDs: []string{orgID}, UserID: viewerID, To: start}, nil},
+		{"other organization", domain.AuditEventFilter{OrganizationIDs: []string{newID()}, UserID: newID()}, nil},
+	}
+	for _, f := range filters {
+		got, err := repos.AuditEvents.Get(ctx, f.filter)
+		must(t, err)
+		equalStrings(t, "events "+f.name, auditEventIDs(got), f.want)
+	}
+}
+
+func auditEventIDs(events []domain.AuditEvent) []string {
+	ids := make([]string, 0, len(events))
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
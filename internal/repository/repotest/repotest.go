@@ -0,0 +1,143 @@
+// Package repotest is a conformance suite for the repositories in package repository.
+// The postgres, sqlite and in-memory implementations must all pass it, so they can be used interchangeably.
+// It is run from a test, with a func returning the repositories to test:
+//
+//	func TestSqliteRepositories(t *testing.T) {
+//		repotest.Run(t, func(t *testing.T) repository.Repositories {
+//			db, err := repository.OpenSqlite(":memory:")
+//			if err != nil {
+//				t.Fatal(err)
+//			}
+//			t.Cleanup(func() { db.Close() })
+//			return repository.NewSqliteRepositories(db)
+//		})
+//	}
+//
+// Every test uses new ids, so the repositories may share a database with other tests, like a postgres test database.
+// The repository package runs the suite against postgres when $WS_GATEWAY_TEST_DATABASE_URL is set.
+package repotest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/bjarke-xyz/ws-gateway/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Run runs the suite against the repositories returned by newRepositories, which is called once per test
+func Run(t *testing.T, newRepositories func(t *testing.T) repository.Repositories) {
+	tests := []struct {
+		name string
+		test func(*testing.T, repository.Repositories)
+	}{
+		{"Applications", testApplications},
+		{"ApiKeys", testApiKeys},
+		{"Organizations", testOrganizations},
+		{"AccessTokens", testAccessTokens},
+		{"RoutingRules", testRoutingRules},
+		{"WebhookDeliveries", testWebhookDeliveries},
+		{"DeadLetters", testDeadLetters},
+		{"ScheduledMessages", testScheduledMessages},
+		{"TopicMessages", testTopicMessages},
+		{"AuditEvents", testAuditEvents},
+		{"AppUsage", testAppUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepositories(t))
+		})
+	}
+}
+
+func newID() string {
+	return uuid.NewString()
+}
+
+// must fails the test if err is not nil
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustNotFound(t *testing.T, err error) {
+	t.Helper()
+	if !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, domain.ErrNotFound)
+	}
+}
+
+func equal[T comparable](t *testing.T, name string, got T, want T) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%v is %v, want %v", name, got, want)
+	}
+}
+
+func equalStrings(t *testing.T, name string, got []string, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%v is %q, want %q", name, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%v is %q, want %q", name, got, want)
+			return
+		}
+	}
+}
+
+// equalJSON compares JSON by value, as postgres does not keep the formatting of JSONB
+func equalJSON(t *testing.T, name string, got json.RawMessage, want string) {
+	t.Helper()
+	var gotValue, wantValue any
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Errorf("%v is not JSON: %q", name, got)
+		return
+	}
+	must(t, json.Unmarshal([]byte(want), &wantValue))
+	gotJSON, _ := json.Marshal(gotValue)
+	wantJSON, _ := json.Marshal(wantValue)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("%v is %s, want %s", name, got, want)
+	}
+}
+
+// recent fails the test if ts is not close to now. The margin allows for the clock of a database server.
+func recent(t *testing.T, name string, ts time.Time) {
+	t.Helper()
+	if d := time.Since(ts); d > time.Minute || d < -time.Minute {
+		t.Errorf("%v is %v, want about now", name, ts)
+	}
+}
+
+// newOrganization creates an organization owned by a new user, as apps and keys belong to one
+func newOrganization(t *testing.T, repos repository.Repositories, name string) (domain.Organization, domain.OrganizationMember) {
+	t.Helper()
+	org := domain.Organization{ID: newID(), Name: name}
+	owner := domain.OrganizationMember{OrganizationID: org.ID, UserID: newID(), Email: "owner@example.com", Role: domain.RoleOwner}
+	must(t, repos.Organizations.Create(context.Background(), &org, &owner))
+	return org, owner
+}
+
+func newApp(t *testing.T, repos repository.Repositories, org domain.Organization, name string) domain.Application {
+	t.Helper()
+	app := domain.Application{
+		ID:                  newID(),
+		OwnerUserID:         newID(),
+		OrganizationID:      org.ID,
+		Name:                name,
+		AckTimeoutSeconds:   domain.DefaultAckTimeoutSeconds,
+		MaxDeliveryAttempts: domain.DefaultMaxDeliveryAttempts,
+	}
+	must(t, repos.Apps.Create(context.Background(), &app))
+	return app
+}
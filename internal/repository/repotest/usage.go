@@ -0,0 +1,66 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/bjarke-xyz/ws-gateway/internal/repository"
+)
+
+func testAppUsage(t *testing.T, repos repository.Repositories) {
+	ctx := context.Background()
+	appID := newID()
+	day := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	nextDay := day.AddDate(0, 0, 1)
+
+	minute := day.Add(10 * time.Hour)
+	must(t, repos.AppUsage.Add(ctx, "instance-a", minute, []domain.AppUsage{
+		{AppID: appID, Day: day, Messages: 10, DeliveredBytes: 1000, PeakConnections: 5, ConnectionMinutes: 60},
+		{AppID: newID(), Day: day, Messages: 1},
+	}))
+	// A lower peak reported again by the same instance does not lower its peak of the minute
+	must(t, repos.AppUsage.Add(ctx, "instance-a", minute, []domain.AppUsage{{AppID: appID, Day: day, PeakConnections: 1}}))
+	must(t, repos.AppUsage.Add(ctx, "instance-b", minute, []domain.AppUsage{
+		{AppID: appID, Day: day, Messages: 5, DeliveredBytes: 500, PeakConnections: 3, ConnectionMinutes: 30},
+	}))
+	must(t, repos.AppUsage.Add(ctx, "instance-a", minute.Add(time.Minute), []domain.AppUsage{
+		{AppID: appID, Day: day, PeakConnections: 6},
+	}))
+	must(t, repos.AppUsage.Add(ctx, "instance-a", nextDay, []domain.AppUsage{
+		{AppID: appID, Day: nextDay, Messages: 1, PeakConnections: 8},
+	}))
+	must(t, repos.AppUsage.Add(ctx, "instance-a", nextDay, nil))
+
+	usage, err := repos.AppUsage.GetByAppID(ctx, appID, day.AddDate(0, 0, -7), nextDay)
+	must(t, err)
+	if len(usage) != 2 {
+		t.Fatalf("got %v days, want 2", len(usage))
+	}
+	first := usage[0]
+	equal(t, "AppID", first.AppID, appID)
+	if !first.Day.Equal(day) {
+		t.Errorf("Day is %v, want %v", first.Day, day)
+	}
+	equal(t, "Messages", first.Messages, int64(15))
+	equal(t, "DeliveredBytes", first.DeliveredBytes, int64(1500))
+	// The peak is the highest sum of the instances' peaks in the same minute
+	equal(t, "PeakConnections", first.PeakConnections, 8)
+	equal(t, "ConnectionMinutes", first.ConnectionMinutes, int64(90))
+	if !usage[1].Day.Equal(nextDay) {
+		t.Errorf("Day is %v, want %v", usage[1].Day, nextDay)
+	}
+	equal(t, "PeakConnections of next day", usage[1].PeakConnections, 8)
+
+	usage, err = repos.AppUsage.GetByAppID(ctx, appID, nextDay, nextDay)
+	must(t, err)
+	if len(usage) != 1 || !usage[0].Day.Equal(nextDay) {
+		t.Errorf("usage of a single day is %v, want only %v", usage, nextDay)
+	}
+	usage, err = repos.AppUsage.GetByAppID(ctx, appID, day.AddDate(0, 0, -7), day.AddDate(0, 0, -1))
+	must(t, err)
+	if usage == nil || len(usage) != 0 {
+		t.Errorf("usage of days without usage is %v, want empty", usage)
+	}
+}
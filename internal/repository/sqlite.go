@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// OpenSqlite opens and migrates the sqlite database at path, which is created if it does not exist.
+// A path of :memory: gives an empty database that lives as long as the returned *sql.DB.
+func OpenSqlite(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%v?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL", path)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite has a single writer, so one connection avoids busy errors between connections.
+	// It also keeps an in-memory database, which is private to its connection.
+	db.SetMaxOpenConns(1)
+	err = MigrateSqlite(db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate: %w", err)
+	}
+	return db, nil
+}
+
+// sqliteList is a []string column, stored as a JSON array as sqlite has no arrays
+type sqliteList []string
+
+// Scan implements sql.Scanner.
+func (l *sqliteList) Scan(src any) error {
+	*l = make(sqliteList, 0)
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	case []byte:
+		return json.Unmarshal(v, l)
+	default:
+		return fmt.Errorf("cannot scan %T into a list", src)
+	}
+}
+
+// Value implements driver.Valuer.
+func (l sqliteList) Value() (driver.Value, error) {
+	data, err := json.Marshal(nonNil(l))
+	return string(data), err
+}
+
+// sqliteJSON is a JSON column, stored as TEXT
+type sqliteJSON json.RawMessage
+
+// Scan implements sql.Scanner.
+func (j *sqliteJSON) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*j = nil
+	case string:
+		*j = sqliteJSON(v)
+	case []byte:
+		*j = sqliteJSON(slices.Clone(v))
+	default:
+		return fmt.Errorf("cannot scan %T into json", src)
+	}
+	return nil
+}
+
+// sqlitePayload returns a message payload to store, where an empty payload is stored as JSON null like in postgres
+func sqlitePayload(payload json.RawMessage) string {
+	if len(payload) == 0 {
+		return "null"
+	}
+	return string(payload)
+}
+
+// sqliteIn returns placeholders and arguments for values, for use in "x IN (...)", as sqlite has no = ANY
+func sqliteIn(values []string) (string, []any) {
+	args := make([]any, 0, len(values))
+	for _, value := range values {
+		args = append(args, value)
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", "), args
+}
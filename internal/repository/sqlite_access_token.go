@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+type sqliteAccessTokenRepository struct {
+	db *sql.DB
+}
+
+func NewSqliteAccessToken(db *sql.DB) domain.AccessTokenRepository {
+	return &sqliteAccessTokenRepository{db: db}
+}
+
+// GetByID implements domain.AccessTokenRepository.
+func (s *sqliteAccessTokenRepository) GetByID(ctx context.Context, id string) (domain.AccessToken, error) {
+	var token domain.AccessToken
+	err := sqlscan.Get(ctx, s.db, &token, "SELECT * FROM access_tokens WHERE id = ?", id)
+	if err != nil {
+		if sqlscan.NotFound(err) {
+			return token, domain.ErrNotFound
+		}
+		return token, err
+	}
+	return token, nil
+}
+
+// GetByUserID implements domain.AccessTokenRepository.
+func (s *sqliteAccessTokenRepository) GetByUserID(ctx context.Context, userID string) ([]domain.AccessToken, error) {
+	tokens := make([]domain.AccessToken, 0)
+	err := sqlscan.Select(ctx, s.db, &tokens, "SELECT * FROM access_tokens WHERE owner_user_id = ? ORDER BY created_at", userID)
+	return tokens, err
+}
+
+// Create implements domain.AccessTokenRepository.
+func (s *sqliteAccessTokenRepository) Create(ctx context.Context, token *domain.AccessToken) error {
+	query := `
+		INSERT INTO access_tokens (id, owner_user_id, name, token_hash, token_preview, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, token.ID, token.OwnerUserID, token.Name, token.TokenHash, token.TokenPreview, time.Now().UTC())
+	return err
+}
+
+// UpdateTokenPreview implements domain.AccessTokenRepository.
+func (s *sqliteAccessTokenRepository) UpdateTokenPreview(ctx context.Context, id string, tokenPreview string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE access_tokens SET token_preview = ? WHERE id = ?", tokenPreview, id)
+	return err
+}
+
+// UpdateLastUsed implements domain.AccessTokenRepository.
+func (s *sqliteAccessTokenRepository) UpdateLastUsed(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE access_tokens SET last_used_at = ? WHERE id = ?", time.Now().UTC(), id)
+	return err
+}
+
+// Delete implements domain.AccessTokenRepository.
+func (s *sqliteAccessTokenRepository) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM access_tokens WHERE id = ?", id)
+	return err
+}
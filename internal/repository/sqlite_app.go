@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+type sqliteAppRepository struct {
+	db *sql.DB
+}
+
+func NewSqliteApp(db *sql.DB) domain.ApplicationRepository {
+	return &sqliteAppRepository{db: db}
+}
+
+type sqliteAppDto struct {
+	ID                  string
+	OwnerUserID         string
+	OrganizationID      string
+	Name                string
+	CreatedAt           time.Time
+	UpdatedAt           *time.Time
+	WebhookURL          string
+	WebhookSecret       string
+	WebhookEvents       sqliteList
+	PusherEnabled       bool
+	ReliableTopics      sqliteList
+	AckTimeoutSeconds   int
+	MaxDeliveryAttempts int
+	SequencedTopics     sqliteList
+}
+
+func mapSqliteApp(dto sqliteAppDto) domain.Application {
+	return domain.Application{
+		ID:                  dto.ID,
+		OwnerUserID:         dto.OwnerUserID,
+		OrganizationID:      dto.OrganizationID,
+		Name:                dto.Name,
+		CreatedAt:           dto.CreatedAt,
+		UpdatedAt:           dto.UpdatedAt,
+		WebhookURL:          dto.WebhookURL,
+		WebhookSecret:       dto.WebhookSecret,
+		WebhookEvents:       dto.WebhookEvents,
+		PusherEnabled:       dto.PusherEnabled,
+		ReliableTopics:      dto.ReliableTopics,
+		AckTimeoutSeconds:   dto.AckTimeoutSeconds,
+		MaxDeliveryAttempts: dto.MaxDeliveryAttempts,
+		SequencedTopics:     dto.SequencedTopics,
+	}
+}
+
+// GetByID implements domain.ApplicationRepository.
+func (s *sqliteAppRepository) GetByID(ctx context.Context, id string) (domain.Application, error) {
+	var dto sqliteAppDto
+	err := sqlscan.Get(ctx, s.db, &dto, "SELECT * FROM apps WHERE id = ?", id)
+	if err != nil {
+		if sqlscan.NotFound(err) {
+			return domain.Application{}, domain.ErrNotFound
+		}
+		return domain.Application{}, err
+	}
+	return mapSqliteApp(dto), nil
+}
+
+// GetByOrganizationIDs implements domain.ApplicationRepository.
+func (s *sqliteAppRepository) GetByOrganizationIDs(ctx context.Context, organizationIDs []string) ([]domain.Application, error) {
+	dtos := make([]sqliteAppDto, 0)
+	in, args := sqliteIn(organizationIDs)
+	err := sqlscan.Select(ctx, s.db, &dtos, "SELECT * FROM apps WHERE organization_id IN ("+in+") ORDER BY name", args...)
+	apps := make([]domain.Application, 0, len(dtos))
+	for _, dto := range dtos {
+		apps = append(apps, mapSqliteApp(dto))
+	}
+	return apps, err
+}
+
+// Update implements domain.ApplicationRepository.
+func (s *sqliteAppRepository) Update(ctx context.Context, app *domain.Application) error {
+	query := `
+		UPDATE apps SET name = ?, webhook_url = ?, webhook_secret = ?, webhook_events = ?, pusher_enabled = ?,
+			reliable_topics = ?, ack_timeout_seconds = ?, max_delivery_attempts = ?, sequenced_topics = ?, updated_at = ?
+		WHERE id = ?`
+	_, err := s.db.ExecContext(ctx, query, app.Name, app.WebhookURL, app.WebhookSecret, sqliteList(app.WebhookEvents), app.PusherEnabled,
+		sqliteList(app.ReliableTopics), app.AckTimeoutSeconds, app.MaxDeliveryAttempts, sqliteList(app.SequencedTopics), time.Now().UTC(), app.ID)
+	return err
+}
+
+// Create implements domain.ApplicationRepository.
+func (s *sqliteAppRepository) Create(ctx context.Context, app *domain.Application) error {
+	query := `
+		INSERT INTO apps (id, owner_user_id, organization_id, name, webhook_url, webhook_secret, webhook_events, pusher_enabled,
+			reliable_topics, ack_timeout_seconds, max_delivery_attempts, sequenced_topics, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, app.ID, app.OwnerUserID, app.OrganizationID, app.Name, app.WebhookURL, app.WebhookSecret, sqliteList(app.WebhookEvents), app.PusherEnabled,
+		sqliteList(app.ReliableTopics), app.AckTimeoutSeconds, app.MaxDeliveryAttempts, sqliteList(app.SequencedTopics), time.Now().UTC())
+	return err
+}
+
+// Delete implements domain.ApplicationRepository.
+func (s *sqliteAppRepository) Delete(ctx context.Context, appID string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM apps WHERE id = ?", appID)
+	return err
+}
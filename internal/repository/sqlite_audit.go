@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+type sqliteAuditEventRepository struct {
+	db *sql.DB
+}
+
+func NewSqliteAuditEvent(db *sql.DB) domain.AuditEventRepository {
+	return &sqliteAuditEventRepository{db: db}
+}
+
+type sqliteAuditEventDto struct {
+	ID             string
+	ActorUserID    string
+	ActorEmail     string
+	OrganizationID string
+	Action         string
+	TargetType     string
+	TargetID       string
+	Before         sqliteJSON
+	After          sqliteJSON
+	IP             string
+	UserAgent      string
+	CreatedAt      time.Time
+}
+
+// Get implements domain.AuditEventRepository.
+func (s *sqliteAuditEventRepository) Get(ctx context.Context, filter domain.AuditEventFilter) ([]domain.AuditEvent, error) {
+	conditions := make([]string, 0)
+	args := make([]any, 0)
+	if filter.OrganizationIDs != nil || filter.UserID != "" {
+		in, inArgs := sqliteIn(filter.OrganizationIDs)
+		conditions = append(conditions, "(organization_id IN ("+in+") OR actor_user_id = ?)")
+		args = append(append(args, inArgs...), filter.UserID)
+	}
+	if filter.Actor != "" {
+		conditions = append(conditions, "(actor_user_id = ? OR actor_email = ?)")
+		args = append(args, filter.Actor, filter.Actor)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.TargetID != "" {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, filter.TargetID)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.To.UTC())
+	}
+	query := "SELECT * FROM audit_events"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at DESC, rowid DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+	dtos := make([]sqliteAuditEventDto, 0)
+	err := sqlscan.Select(ctx, s.db, &dtos, query, args...)
+	events := make([]domain.AuditEvent, 0, len(dtos))
+	for _, dto := range dtos {
+		events = append(events, domain.AuditEvent{
+			ID:             dto.ID,
+			ActorUserID:    dto.ActorUserID,
+			ActorEmail:     dto.ActorEmail,
+			OrganizationID: dto.OrganizationID,
+			Action:         dto.Action,
+			TargetType:     dto.TargetType,
+			TargetID:       dto.TargetID,
+			Before:         json.RawMessage(dto.Before),
+			After:          json.RawMessage(dto.After),
+			IP:             dto.IP,
+			UserAgent:      dto.UserAgent,
+			CreatedAt:      dto.CreatedAt,
+		})
+	}
+	return events, err
+}
+
+// Create implements domain.AuditEventRepository.
+func (s *sqliteAuditEventRepository) Create(ctx context.Context, e *domain.AuditEvent) error {
+	query := `
+		INSERT INTO audit_events (id, actor_user_id, actor_email, organization_id, action, target_type, target_id, before, after, ip, user_agent, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, e.ID, e.ActorUserID, e.ActorEmail, e.OrganizationID, e.Action, e.TargetType, e.TargetID,
+		jsonOrNull(e.Before), jsonOrNull(e.After), e.IP, e.UserAgent, time.Now().UTC())
+	return err
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+type sqliteDeadLetterRepository struct {
+	db *sql.DB
+}
+
+func NewSqliteDeadLetter(db *sql.DB) domain.DeadLetterRepository {
+	return &sqliteDeadLetterRepository{db: db}
+}
+
+type sqliteDeadLetterDto struct {
+	ID        string
+	AppID     string
+	Topic     string
+	UserID    string
+	MessageID string
+	Event     string
+	Payload   sqliteJSON
+	Attempts  int
+	Reason    string
+	CreatedAt time.Time
+}
+
+// GetByAppID implements domain.DeadLetterRepository.
+func (s *sqliteDeadLetterRepository) GetByAppID(ctx context.Context, appID string, limit int) ([]domain.DeadLetter, error) {
+	dtos := make([]sqliteDeadLetterDto, 0)
+	query := "SELECT * FROM dead_letters WHERE app_id = ? ORDER BY created_at DESC, rowid DESC LIMIT ?"
+	err := sqlscan.Select(ctx, s.db, &dtos, query, appID, limit)
+	deadLetters := make([]domain.DeadLetter, 0, len(dtos))
+	for _, dto := range dtos {
+		deadLetters = append(deadLetters, domain.DeadLetter{
+			ID:        dto.ID,
+			AppID:     dto.AppID,
+			Topic:     dto.Topic,
+			UserID:    dto.UserID,
+			MessageID: dto.MessageID,
+			Event:     dto.Event,
+			Payload:   json.RawMessage(dto.Payload),
+			Attempts:  dto.Attempts,
+			Reason:    dto.Reason,
+			CreatedAt: dto.CreatedAt,
+		})
+	}
+	return deadLetters, err
+}
+
+// Create implements domain.DeadLetterRepository.
+func (s *sqliteDeadLetterRepository) Create(ctx context.Context, d *domain.DeadLetter) error {
+	query := `
+		INSERT INTO dead_letters (id, app_id, topic, user_id, message_id, event, payload, attempts, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, d.ID, d.AppID, d.Topic, d.UserID, d.MessageID, d.Event, sqlitePayload(d.Payload), d.Attempts, d.Reason, time.Now().UTC())
+	return err
+}
+
+// Delete implements domain.DeadLetterRepository.
+func (s *sqliteDeadLetterRepository) Delete(ctx context.Context, appID string, id string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM dead_letters WHERE app_id = ? AND id = ?", appID, id)
+	return err
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+type sqliteKeyRepository struct {
+	db *sql.DB
+}
+
+func NewSqliteKey(db *sql.DB) domain.ApiKeyRepository {
+	return &sqliteKeyRepository{db: db}
+}
+
+// GetByID implements domain.ApiKeyRepository.
+func (s *sqliteKeyRepository) GetByID(ctx context.Context, id string) (domain.ApiKey, error) {
+	dtoKeys := make([]apiKeyDto, 0)
+	query := `
+		SELECT k.*, a.* FROM api_keys k
+		LEFT JOIN api_key_access a ON a.api_key_id = k.id
+		WHERE k.id = ?`
+	err := sqlscan.Select(ctx, s.db, &dtoKeys, query, id)
+	if err != nil {
+		return domain.ApiKey{}, err
+	}
+	keys := mapDtoKeys(dtoKeys)
+	if len(keys) == 0 {
+		return domain.ApiKey{}, domain.ErrNotFound
+	}
+	return keys[0], nil
+}
+
+// GetByOrganizationIDs implements domain.ApiKeyRepository.
+func (s *sqliteKeyRepository) GetByOrganizationIDs(ctx context.Context, organizationIDs []string) ([]domain.ApiKey, error) {
+	dtoKeys := make([]apiKeyDto, 0)
+	in, args := sqliteIn(organizationIDs)
+	query := `
+		SELECT k.*, a.* FROM api_keys k
+		LEFT JOIN api_key_access a ON a.api_key_id = k.id
+		WHERE k.organization_id IN (` + in + `)`
+	err := sqlscan.Select(ctx, s.db, &dtoKeys, query, args...)
+	keys := mapDtoKeys(dtoKeys)
+	return keys, err
+}
+
+// GetByAppID implements domain.ApiKeyRepository.
+func (s *sqliteKeyRepository) GetByAppID(ctx context.Context, appID string) ([]domain.ApiKey, error) {
+	dtoKeys := make([]apiKeyDto, 0)
+	query := `
+		SELECT k.*, a.* FROM api_keys k
+		LEFT JOIN api_key_access a ON a.api_key_id = k.id
+		WHERE a.app_id = ?`
+	err := sqlscan.Select(ctx, s.db, &dtoKeys, query, appID)
+	keys := mapDtoKeys(dtoKeys)
+	return keys, err
+}
+
+// Create implements domain.ApiKeyRepository.
+func (s *sqliteKeyRepository) Create(ctx context.Context, key *domain.ApiKey) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `INSERT INTO api_keys (id, owner_user_id, organization_id, key_hash, key_preview, pusher_secret, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, key.ID, key.OwnerUserID, key.OrganizationID, key.KeyHash, key.KeyPreview, key.PusherSecret, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	for _, access := range key.Access {
+		_, err = tx.ExecContext(ctx, `INSERT INTO api_key_access(api_key_id, app_id) VALUES (?, ?)`, key.ID, access.AppID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Update implements domain.ApiKeyRepository.
+func (s *sqliteKeyRepository) Update(ctx context.Context, apiKeyID string, accessList []domain.ApiKeyAccess) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "DELETE FROM api_key_access WHERE api_key_id = ?", apiKeyID)
+	if err != nil {
+		return err
+	}
+	for _, access := range accessList {
+		_, err = tx.ExecContext(ctx, `INSERT INTO api_key_access(api_key_id, app_id) VALUES (?, ?)`, apiKeyID, access.AppID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UpdateKeyPreview implements domain.ApiKeyRepository.
+func (s *sqliteKeyRepository) UpdateKeyPreview(ctx context.Context, apikeyID string, keyPreview string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE api_keys SET key_preview = ? WHERE id = ?", keyPreview, apikeyID)
+	return err
+}
+
+// Delete implements domain.ApiKeyRepository.
+func (s *sqliteKeyRepository) Delete(ctx context.Context, keyID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "DELETE FROM api_key_access WHERE api_key_id = ?", keyID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM api_keys WHERE id = ?", keyID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
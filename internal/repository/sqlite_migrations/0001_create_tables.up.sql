@@ -0,0 +1,192 @@
+-- The schema of the postgres migrations up to 0012, in sqlite. Later migrations follow the postgres ones.
+-- Arrays are stored as JSON arrays and JSONB as TEXT, timestamps are UTC.
+CREATE TABLE IF NOT EXISTS organizations(
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP NULL
+);
+
+CREATE TABLE IF NOT EXISTS organization_members(
+    organization_id TEXT REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    email TEXT NOT NULL DEFAULT '',
+    role TEXT NOT NULL,
+    created_at TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS organization_members_user_id_idx ON organization_members(user_id);
+
+CREATE TABLE IF NOT EXISTS apps(
+    id TEXT PRIMARY KEY,
+    owner_user_id TEXT,
+    organization_id TEXT REFERENCES organizations(id),
+    name TEXT,
+    webhook_url TEXT NOT NULL DEFAULT '',
+    webhook_secret TEXT NOT NULL DEFAULT '',
+    webhook_events TEXT NOT NULL DEFAULT '[]',
+    pusher_secret TEXT NOT NULL DEFAULT '',
+    reliable_topics TEXT NOT NULL DEFAULT '[]',
+    ack_timeout_seconds INTEGER NOT NULL DEFAULT 30,
+    max_delivery_attempts INTEGER NOT NULL DEFAULT 5,
+    sequenced_topics TEXT NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS apps_organization_id_idx ON apps(organization_id);
+
+CREATE TABLE IF NOT EXISTS api_keys(
+    id TEXT PRIMARY KEY,
+    owner_user_id TEXT,
+    organization_id TEXT REFERENCES organizations(id),
+    key_hash TEXT,
+    key_preview TEXT,
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_organization_id_idx ON api_keys(organization_id);
+
+CREATE TABLE IF NOT EXISTS api_key_access(
+    api_key_id TEXT REFERENCES api_keys(id),
+    app_id TEXT REFERENCES apps(id)
+);
+
+CREATE INDEX IF NOT EXISTS api_key_access_api_key_id_idx ON api_key_access(api_key_id);
+CREATE INDEX IF NOT EXISTS api_key_access_app_id_idx ON api_key_access(app_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries(
+    id TEXT PRIMARY KEY,
+    app_id TEXT,
+    event TEXT,
+    url TEXT,
+    request_body TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_app_id_idx ON webhook_deliveries(app_id, created_at);
+
+CREATE TABLE IF NOT EXISTS dead_letters(
+    id TEXT PRIMARY KEY,
+    app_id TEXT,
+    topic TEXT,
+    user_id TEXT,
+    message_id TEXT,
+    event TEXT,
+    payload TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    reason TEXT,
+    created_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS dead_letters_app_id_idx ON dead_letters(app_id, created_at);
+
+CREATE TABLE IF NOT EXISTS topic_sequences(
+    app_id TEXT,
+    topic TEXT,
+    seq INTEGER NOT NULL,
+    PRIMARY KEY (app_id, topic)
+);
+
+CREATE TABLE IF NOT EXISTS topic_messages(
+    app_id TEXT,
+    topic TEXT,
+    seq INTEGER,
+    source_topic TEXT NOT NULL DEFAULT '',
+    event TEXT,
+    payload TEXT,
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP,
+    PRIMARY KEY (app_id, topic, seq)
+);
+
+CREATE INDEX IF NOT EXISTS topic_messages_created_at_idx ON topic_messages(created_at);
+
+CREATE TABLE IF NOT EXISTS scheduled_messages(
+    id TEXT PRIMARY KEY,
+    app_id TEXT,
+    topic TEXT,
+    event TEXT,
+    payload TEXT,
+    ttl_seconds INTEGER NOT NULL DEFAULT 0,
+    deliver_at TIMESTAMP,
+    created_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_messages_deliver_at_idx ON scheduled_messages(deliver_at);
+CREATE INDEX IF NOT EXISTS scheduled_messages_app_id_idx ON scheduled_messages(app_id);
+
+CREATE TABLE IF NOT EXISTS routing_rules(
+    id TEXT PRIMARY KEY,
+    app_id TEXT REFERENCES apps(id) ON DELETE CASCADE,
+    source_topic TEXT NOT NULL,
+    condition TEXT NOT NULL DEFAULT '',
+    target_topic TEXT NOT NULL,
+    transform TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS routing_rules_app_id_idx ON routing_rules(app_id);
+
+CREATE TABLE IF NOT EXISTS access_tokens(
+    id TEXT PRIMARY KEY,
+    owner_user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    token_preview TEXT NOT NULL,
+    last_used_at TIMESTAMP NULL,
+    created_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS access_tokens_owner_user_id_idx ON access_tokens(owner_user_id);
+
+CREATE TABLE IF NOT EXISTS audit_events(
+    id TEXT PRIMARY KEY,
+    actor_user_id TEXT NOT NULL DEFAULT '',
+    actor_email TEXT NOT NULL DEFAULT '',
+    organization_id TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    target_type TEXT NOT NULL DEFAULT '',
+    target_id TEXT NOT NULL DEFAULT '',
+    before TEXT,
+    after TEXT,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_created_at_idx ON audit_events(created_at);
+CREATE INDEX IF NOT EXISTS audit_events_organization_id_idx ON audit_events(organization_id, created_at);
+CREATE INDEX IF NOT EXISTS audit_events_actor_user_id_idx ON audit_events(actor_user_id, created_at);
+
+-- The audit log is append-only
+CREATE TRIGGER IF NOT EXISTS audit_events_append_only_update
+BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_events_append_only_delete
+BEFORE DELETE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+-- Usage is kept when the app is deleted, so it can still be billed
+CREATE TABLE IF NOT EXISTS app_usage(
+    app_id TEXT NOT NULL,
+    day DATE NOT NULL,
+    messages INTEGER NOT NULL DEFAULT 0,
+    delivered_bytes INTEGER NOT NULL DEFAULT 0,
+    peak_connections INTEGER NOT NULL DEFAULT 0,
+    connection_minutes INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (app_id, day)
+);
@@ -0,0 +1,7 @@
+-- Postgres migration 0013
+ALTER TABLE apps ADD COLUMN pusher_enabled BOOLEAN NOT NULL DEFAULT false;
+UPDATE apps SET pusher_enabled = true WHERE pusher_secret <> '';
+ALTER TABLE apps DROP COLUMN pusher_secret;
+
+ALTER TABLE api_keys ADD COLUMN pusher_secret TEXT NOT NULL DEFAULT '';
+UPDATE api_keys SET pusher_secret = lower(hex(randomblob(16))) WHERE pusher_secret = '';
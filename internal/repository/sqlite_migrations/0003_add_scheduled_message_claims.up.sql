@@ -0,0 +1,2 @@
+-- Postgres migration 0014
+ALTER TABLE scheduled_messages ADD COLUMN claimed_until TIMESTAMP;
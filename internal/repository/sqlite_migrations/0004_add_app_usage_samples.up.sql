@@ -0,0 +1,8 @@
+-- Postgres migration 0015
+CREATE TABLE IF NOT EXISTS app_usage_samples(
+    app_id TEXT NOT NULL,
+    minute TIMESTAMP NOT NULL,
+    instance_id TEXT NOT NULL,
+    peak_connections INTEGER NOT NULL,
+    PRIMARY KEY (app_id, minute, instance_id)
+);
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+type sqliteOrganizationRepository struct {
+	db *sql.DB
+}
+
+func NewSqliteOrganization(db *sql.DB) domain.OrganizationRepository {
+	return &sqliteOrganizationRepository{db: db}
+}
+
+// GetByID implements domain.OrganizationRepository.
+func (s *sqliteOrganizationRepository) GetByID(ctx context.Context, id string) (domain.Organization, error) {
+	var org domain.Organization
+	err := sqlscan.Get(ctx, s.db, &org, "SELECT * FROM organizations WHERE id = ?", id)
+	if err != nil {
+		if sqlscan.NotFound(err) {
+			return org, domain.ErrNotFound
+		}
+		return org, err
+	}
+	return org, nil
+}
+
+// GetByUserID implements domain.OrganizationRepository.
+func (s *sqliteOrganizationRepository) GetByUserID(ctx context.Context, userID string) ([]domain.Organization, error) {
+	orgs := make([]domain.Organization, 0)
+	query := `
+		SELECT o.* FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.user_id = ?
+		ORDER BY o.name`
+	err := sqlscan.Select(ctx, s.db, &orgs, query, userID)
+	return orgs, err
+}
+
+// Create implements domain.OrganizationRepository.
+func (s *sqliteOrganizationRepository) Create(ctx context.Context, org *domain.Organization, owner *domain.OrganizationMember) error {
+	now := time.Now().UTC()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "INSERT INTO organizations (id, name, created_at) VALUES (?, ?, ?)", org.ID, org.Name, now)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO organization_members (organization_id, user_id, email, role, created_at)
+		VALUES (?, ?, ?, ?, ?)`, org.ID, owner.UserID, owner.Email, string(owner.Role), now)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Update implements domain.OrganizationRepository.
+func (s *sqliteOrganizationRepository) Update(ctx context.Context, org *domain.Organization) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE organizations SET name = ?, updated_at = ? WHERE id = ?", org.Name, time.Now().UTC(), org.ID)
+	return err
+}
+
+// Delete implements domain.OrganizationRepository.
+func (s *sqliteOrganizationRepository) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM organizations WHERE id = ?", id)
+	return err
+}
+
+// GetMembers implements domain.OrganizationRepository.
+func (s *sqliteOrganizationRepository) GetMembers(ctx context.Context, organizationID string) ([]domain.OrganizationMember, error) {
+	members := make([]domain.OrganizationMember, 0)
+	err := sqlscan.Select(ctx, s.db, &members, "SELECT * FROM organization_members WHERE organization_id = ? ORDER BY created_at", organizationID)
+	return members, err
+}
+
+// GetMember implements domain.OrganizationRepository.
+func (s *sqliteOrganizationRepository) GetMember(ctx context.Context, organizationID string, userID string) (domain.OrganizationMember, error) {
+	var member domain.OrganizationMember
+	err := sqlscan.Get(ctx, s.db, &member, "SELECT * FROM organization_members WHERE organization_id = ? AND user_id = ?", organizationID, userID)
+	if err != nil {
+		if sqlscan.NotFound(err) {
+			return member, domain.ErrNotFound
+		}
+		return member, err
+	}
+	return member, nil
+}
+
+// GetMembershipsByUserID implements domain.OrganizationRepository.
+func (s *sqliteOrganizationRepository) GetMembershipsByUserID(ctx context.Context, userID string) ([]domain.OrganizationMember, error) {
+	members := make([]domain.OrganizationMember, 0)
+	err := sqlscan.Select(ctx, s.db, &members, "SELECT * FROM organization_members WHERE user_id = ?", userID)
+	return members, err
+}
+
+// AddMember implements domain.OrganizationRepository.
+func (s *sqliteOrganizationRepository) AddMember(ctx context.Context, member *domain.OrganizationMember) error {
+	query := `
+		INSERT INTO organization_members (organization_id, user_id, email, role, created_at)
+		VALUES (?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, member.OrganizationID, member.UserID, member.Email, string(member.Role), time.Now().UTC())
+	return err
+}
+
+// UpdateMemberRole implements domain.OrganizationRepository.
+func (s *sqliteOrganizationRepository) UpdateMemberRole(ctx context.Context, organizationID string, userID string, role domain.Role) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE organization_members SET role = ? WHERE organization_id = ? AND user_id = ?", string(role), organizationID, userID)
+	return err
+}
+
+// RemoveMember implements domain.OrganizationRepository.
+func (s *sqliteOrganizationRepository) RemoveMember(ctx context.Context, organizationID string, userID string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM organization_members WHERE organization_id = ? AND user_id = ?", organizationID, userID)
+	return err
+}
+
+// TransferOwnership implements domain.OrganizationRepository.
+func (s *sqliteOrganizationRepository) TransferOwnership(ctx context.Context, organizationID string, fromUserID string, toUserID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, "UPDATE organization_members SET role = ? WHERE organization_id = ? AND user_id = ?",
+		string(domain.RoleOwner), organizationID, toUserID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE organization_members SET role = ? WHERE organization_id = ? AND user_id = ?",
+		string(domain.RoleAdmin), organizationID, fromUserID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+type sqliteRoutingRuleRepository struct {
+	db *sql.DB
+}
+
+func NewSqliteRoutingRule(db *sql.DB) domain.RoutingRuleRepository {
+	return &sqliteRoutingRuleRepository{db: db}
+}
+
+// GetByID implements domain.RoutingRuleRepository.
+func (s *sqliteRoutingRuleRepository) GetByID(ctx context.Context, id string) (domain.RoutingRule, error) {
+	var rule domain.RoutingRule
+	err := sqlscan.Get(ctx, s.db, &rule, "SELECT * FROM routing_rules WHERE id = ?", id)
+	if err != nil {
+		if sqlscan.NotFound(err) {
+			return rule, domain.ErrNotFound
+		}
+		return rule, err
+	}
+	return rule, nil
+}
+
+// GetByAppID implements domain.RoutingRuleRepository.
+func (s *sqliteRoutingRuleRepository) GetByAppID(ctx context.Context, appID string) ([]domain.RoutingRule, error) {
+	rules := make([]domain.RoutingRule, 0)
+	err := sqlscan.Select(ctx, s.db, &rules, "SELECT * FROM routing_rules WHERE app_id = ? ORDER BY created_at", appID)
+	return rules, err
+}
+
+// Create implements domain.RoutingRuleRepository.
+func (s *sqliteRoutingRuleRepository) Create(ctx context.Context, rule *domain.RoutingRule) error {
+	query := `
+		INSERT INTO routing_rules (id, app_id, source_topic, condition, target_topic, transform, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, rule.ID, rule.AppID, rule.SourceTopic, rule.Condition, rule.TargetTopic, rule.Transform, time.Now().UTC())
+	return err
+}
+
+// Update implements domain.RoutingRuleRepository.
+func (s *sqliteRoutingRuleRepository) Update(ctx context.Context, rule *domain.RoutingRule) error {
+	query := `
+		UPDATE routing_rules SET source_topic = ?, condition = ?, target_topic = ?, transform = ?, updated_at = ?
+		WHERE id = ?`
+	_, err := s.db.ExecContext(ctx, query, rule.SourceTopic, rule.Condition, rule.TargetTopic, rule.Transform, time.Now().UTC(), rule.ID)
+	return err
+}
+
+// Delete implements domain.RoutingRuleRepository.
+func (s *sqliteRoutingRuleRepository) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM routing_rules WHERE id = ?", id)
+	return err
+}
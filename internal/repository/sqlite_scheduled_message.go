@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+type sqliteScheduledMessageRepository struct {
+	db *sql.DB
+}
+
+func NewSqliteScheduledMessage(db *sql.DB) domain.ScheduledMessageRepository {
+	return &sqliteScheduledMessageRepository{db: db}
+}
+
+type sqliteScheduledMessageDto struct {
+	ID           string
+	AppID        string
+	Topic        string
+	Event        string
+	Payload      sqliteJSON
+	TTLSeconds   int
+	DeliverAt    time.Time
+	CreatedAt    time.Time
+	ClaimedUntil *time.Time
+}
+
+func mapSqliteScheduledMessages(dtos []sqliteScheduledMessageDto) []domain.ScheduledMessage {
+	messages := make([]domain.ScheduledMessage, 0, len(dtos))
+	for _, dto := range dtos {
+		messages = append(messages, domain.ScheduledMessage{
+			ID:           dto.ID,
+			AppID:        dto.AppID,
+			Topic:        dto.Topic,
+			Event:        dto.Event,
+			Payload:      json.RawMessage(dto.Payload),
+			TTLSeconds:   dto.TTLSeconds,
+			DeliverAt:    dto.DeliverAt,
+			CreatedAt:    dto.CreatedAt,
+			ClaimedUntil: dto.ClaimedUntil,
+		})
+	}
+	return messages
+}
+
+// GetByAppID implements domain.ScheduledMessageRepository.
+func (s *sqliteScheduledMessageRepository) GetByAppID(ctx context.Context, appID string, limit int) ([]domain.ScheduledMessage, error) {
+	dtos := make([]sqliteScheduledMessageDto, 0)
+	query := "SELECT * FROM scheduled_messages WHERE app_id = ? ORDER BY deliver_at LIMIT ?"
+	err := sqlscan.Select(ctx, s.db, &dtos, query, appID, limit)
+	return mapSqliteScheduledMessages(dtos), err
+}
+
+// Create implements domain.ScheduledMessageRepository.
+func (s *sqliteScheduledMessageRepository) Create(ctx context.Context, m *domain.ScheduledMessage) error {
+	query := `
+		INSERT INTO scheduled_messages (id, app_id, topic, event, payload, ttl_seconds, deliver_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, m.ID, m.AppID, m.Topic, m.Event, sqlitePayload(m.Payload), m.TTLSeconds, m.DeliverAt.UTC(), time.Now().UTC())
+	return err
+}
+
+// Delete implements domain.ScheduledMessageRepository.
+func (s *sqliteScheduledMessageRepository) Delete(ctx context.Context, appID string, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM scheduled_messages WHERE app_id = ? AND id = ?", appID, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// ClaimDue implements domain.ScheduledMessageRepository.
+// sqlite has a single writer, so selecting and updating in one transaction claims the messages once.
+func (s *sqliteScheduledMessageRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]domain.ScheduledMessage, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	dtos := make([]sqliteScheduledMessageDto, 0)
+	query := `
+		SELECT * FROM scheduled_messages
+		WHERE deliver_at <= ? AND (claimed_until IS NULL OR claimed_until <= ?)
+		ORDER BY deliver_at LIMIT ?`
+	err = sqlscan.Select(ctx, tx, &dtos, query, now.UTC(), now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	claimedUntil := now.Add(lease).UTC()
+	for i := range dtos {
+		_, err = tx.ExecContext(ctx, "UPDATE scheduled_messages SET claimed_until = ? WHERE id = ?", claimedUntil, dtos[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		dtos[i].ClaimedUntil = &claimedUntil
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return mapSqliteScheduledMessages(dtos), nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+type sqliteTopicMessageRepository struct {
+	db *sql.DB
+}
+
+func NewSqliteTopicMessage(db *sql.DB) domain.TopicMessageRepository {
+	return &sqliteTopicMessageRepository{db: db}
+}
+
+type sqliteTopicMessageDto struct {
+	AppID       string
+	Topic       string
+	Seq         int64
+	SourceTopic string
+	Event       string
+	Payload     sqliteJSON
+	ExpiresAt   *time.Time
+	CreatedAt   time.Time
+}
+
+// Append implements domain.TopicMessageRepository.
+func (s *sqliteTopicMessageRepository) Append(ctx context.Context, msg *domain.TopicMessage) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var seq int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO topic_sequences (app_id, topic, seq) VALUES (?, ?, 1)
+		ON CONFLICT (app_id, topic) DO UPDATE SET seq = topic_sequences.seq + 1
+		RETURNING seq`, msg.AppID, msg.Topic).Scan(&seq)
+	if err != nil {
+		return err
+	}
+	var expiresAt *time.Time
+	if msg.ExpiresAt != nil {
+		t := msg.ExpiresAt.UTC()
+		expiresAt = &t
+	}
+	createdAt := time.Now().UTC()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO topic_messages (app_id, topic, seq, source_topic, event, payload, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, msg.AppID, msg.Topic, seq, msg.SourceTopic, msg.Event, sqlitePayload(msg.Payload), expiresAt, createdAt)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	msg.Seq = seq
+	msg.CreatedAt = createdAt
+	return nil
+}
+
+// GetRange implements domain.TopicMessageRepository.
+func (s *sqliteTopicMessageRepository) GetRange(ctx context.Context, appID string, topic string, from int64, to int64) ([]domain.TopicMessage, error) {
+	dtos := make([]sqliteTopicMessageDto, 0)
+	query := `
+		SELECT * FROM topic_messages
+		WHERE app_id = ? AND topic = ? AND seq >= ? AND seq <= ? AND (expires_at IS NULL OR expires_at > ?)
+		ORDER BY seq`
+	err := sqlscan.Select(ctx, s.db, &dtos, query, appID, topic, from, to, time.Now().UTC())
+	messages := make([]domain.TopicMessage, 0, len(dtos))
+	for _, dto := range dtos {
+		messages = append(messages, domain.TopicMessage{
+			AppID:       dto.AppID,
+			Topic:       dto.Topic,
+			Seq:         dto.Seq,
+			SourceTopic: dto.SourceTopic,
+			Event:       dto.Event,
+			Payload:     json.RawMessage(dto.Payload),
+			ExpiresAt:   dto.ExpiresAt,
+			CreatedAt:   dto.CreatedAt,
+		})
+	}
+	return messages, err
+}
+
+// DeleteOlderThan implements domain.TopicMessageRepository.
+func (s *sqliteTopicMessageRepository) DeleteOlderThan(ctx context.Context, t time.Time) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM topic_messages WHERE created_at < ?", t.UTC())
+	return err
+}
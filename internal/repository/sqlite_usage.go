@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+type sqliteAppUsageRepository struct {
+	db *sql.DB
+}
+
+func NewSqliteAppUsage(db *sql.DB) domain.AppUsageRepository {
+	return &sqliteAppUsageRepository{db: db}
+}
+
+// GetByAppID implements domain.AppUsageRepository.
+func (s *sqliteAppUsageRepository) GetByAppID(ctx context.Context, appID string, from time.Time, to time.Time) ([]domain.AppUsage, error) {
+	usage := make([]domain.AppUsage, 0)
+	query := "SELECT * FROM app_usage WHERE app_id = ? AND day >= ? AND day <= ? ORDER BY day"
+	err := sqlscan.Select(ctx, s.db, &usage, query, appID, from.UTC(), to.UTC())
+	return usage, err
+}
+
+// Add implements domain.AppUsageRepository.
+// Days are stored as midnight UTC, so they compare like the DATE column in postgres.
+func (s *sqliteAppUsageRepository) Add(ctx context.Context, instanceID string, minute time.Time, usage []domain.AppUsage) error {
+	usageQuery := `
+		INSERT INTO app_usage (app_id, day, messages, delivered_bytes, peak_connections, connection_minutes)
+		VALUES (?, ?, ?, ?, 0, ?)
+		ON CONFLICT (app_id, day) DO UPDATE SET
+			messages = app_usage.messages + excluded.messages,
+			delivered_bytes = app_usage.delivered_bytes + excluded.delivered_bytes,
+			connection_minutes = app_usage.connection_minutes + excluded.connection_minutes`
+	sampleQuery := `
+		INSERT INTO app_usage_samples (app_id, minute, instance_id, peak_connections)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (app_id, minute, instance_id) DO UPDATE SET
+			peak_connections = MAX(app_usage_samples.peak_connections, excluded.peak_connections)`
+	peakQuery := `
+		UPDATE app_usage SET peak_connections = MAX(peak_connections,
+			(SELECT SUM(peak_connections) FROM app_usage_samples WHERE app_id = ? AND minute = ?))
+		WHERE app_id = ? AND day = ?`
+	minute = minute.UTC()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, u := range usage {
+		day := usageDate(u.Day)
+		_, err = tx.ExecContext(ctx, usageQuery, u.AppID, day, u.Messages, u.DeliveredBytes, u.ConnectionMinutes)
+		if err != nil {
+			return err
+		}
+		if u.PeakConnections == 0 {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, sampleQuery, u.AppID, minute, instanceID, u.PeakConnections)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, peakQuery, u.AppID, minute, u.AppID, day)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM app_usage_samples WHERE minute < ?", minute.Add(-usageSampleRetention))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/georgysavva/scany/v2/sqlscan"
+)
+
+type sqliteWebhookDeliveryRepository struct {
+	db *sql.DB
+}
+
+func NewSqliteWebhookDelivery(db *sql.DB) domain.WebhookDeliveryRepository {
+	return &sqliteWebhookDeliveryRepository{db: db}
+}
+
+// GetByAppID implements domain.WebhookDeliveryRepository.
+func (s *sqliteWebhookDeliveryRepository) GetByAppID(ctx context.Context, appID string, limit int) ([]domain.WebhookDelivery, error) {
+	deliveries := make([]domain.WebhookDelivery, 0)
+	query := "SELECT * FROM webhook_deliveries WHERE app_id = ? ORDER BY created_at DESC, rowid DESC LIMIT ?"
+	err := sqlscan.Select(ctx, s.db, &deliveries, query, appID, limit)
+	return deliveries, err
+}
+
+// Create implements domain.WebhookDeliveryRepository.
+func (s *sqliteWebhookDeliveryRepository) Create(ctx context.Context, d *domain.WebhookDelivery) error {
+	query := `
+		INSERT INTO webhook_deliveries (id, app_id, event, url, request_body, attempts, status_code, error, success, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, d.ID, d.AppID, d.Event, d.URL, d.RequestBody, d.Attempts, d.StatusCode, d.Error, d.Success, time.Now().UTC())
+	return err
+}
+
+// Update implements domain.WebhookDeliveryRepository.
+func (s *sqliteWebhookDeliveryRepository) Update(ctx context.Context, d *domain.WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries SET attempts = ?, status_code = ?, error = ?, success = ?, updated_at = ?
+		WHERE id = ?`
+	_, err := s.db.ExecContext(ctx, query, d.Attempts, d.StatusCode, d.Error, d.Success, time.Now().UTC(), d.ID)
+	return err
+}
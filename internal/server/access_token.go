@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Personal access tokens have the form wsg_<token id>_<secret>, so the hash to compare against can be looked up by id.
+// Only the secret is hashed, as bcrypt does not take more than 72 bytes.
+const accessTokenPrefix = "wsg_"
+
+// accessTokenPreviewLength keeps the prefix and the start of the token id
+const accessTokenPreviewLength = len(accessTokenPrefix) + 4
+
+var errInvalidAccessToken = errors.New("invalid access token")
+
+// newAccessToken returns a token with a new secret, which is only stored hashed. The full token is returned as well.
+func newAccessToken(ownerUserId string, name string) (domain.AccessToken, string, error) {
+	id := uuid.NewString()
+	tokenSecret := uuid.NewString()
+	secret := accessTokenPrefix + id + "_" + tokenSecret
+	hash, err := bcrypt.GenerateFromPassword([]byte(tokenSecret), bcrypt.DefaultCost)
+	if err != nil {
+		return domain.AccessToken{}, "", err
+	}
+	token := domain.AccessToken{
+		ID:           id,
+		OwnerUserID:  ownerUserId,
+		Name:         name,
+		TokenHash:    string(hash),
+		TokenPreview: secret[0:accessTokenPreviewLength],
+	}
+	return token, secret, nil
+}
+
+// verifyAccessToken returns the personal access token matching secret
+func (s *server) verifyAccessToken(ctx context.Context, secret string) (*domain.AccessToken, error) {
+	rest, hasPrefix := strings.CutPrefix(secret, accessTokenPrefix)
+	id, tokenSecret, ok := strings.Cut(rest, "_")
+	if !hasPrefix || !ok {
+		return nil, errInvalidAccessToken
+	}
+	token, err := s.accessTokenRepository.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, errInvalidAccessToken
+		}
+		return nil, err
+	}
+	start := time.Now()
+	err = bcrypt.CompareHashAndPassword([]byte(token.TokenHash), []byte(tokenSecret))
+	observeBcrypt(authMethodAccessToken, start)
+	if err != nil {
+		return nil, errInvalidAccessToken
+	}
+	err = s.accessTokenRepository.UpdateLastUsed(ctx, token.ID)
+	if err != nil {
+		s.logger.Warn("failed to update access token last used", "error", err, "accessTokenId", token.ID)
+	}
+	return &token, nil
+}
+
+// accessTokenAuthToken lets handlers read the owner of a personal access token like the user of an admin session
+func accessTokenAuthToken(token domain.AccessToken) *auth.Token {
+	return &auth.Token{
+		Subject: token.OwnerUserID,
+		UID:     token.OwnerUserID,
+		Claims:  map[string]any{"access_token_id": token.ID},
+	}
+}
+
+func (s *server) truncateAccessTokenPreviews(ctx context.Context, tokens []domain.AccessToken) error {
+	for _, token := range tokens {
+		if len(token.TokenPreview) > accessTokenPreviewLength {
+			tokenPreview := token.TokenPreview[0:accessTokenPreviewLength]
+			err := s.accessTokenRepository.UpdateTokenPreview(ctx, token.ID, tokenPreview)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *server) handlePostAccessToken(w http.ResponseWriter, r *http.Request) {
+	token, _, _ := TokenFromContext(r.Context())
+	errMsg := ""
+	tokenId := chi.URLParam(r, "token-id")
+	if tokenId == "null" {
+		name := strings.TrimSpace(r.FormValue("name"))
+		if name == "" {
+			redirectToAdmin(w, r, "missing token name")
+			return
+		}
+		accessToken, secret, err := newAccessToken(token.Subject, name)
+		if err != nil {
+			s.logger.Error("error hashing access token", "error", err)
+			redirectToAdmin(w, r, "failed to hash access token")
+			return
+		}
+		// TokenPreview is truncated next time the token is fetched
+		accessToken.TokenPreview = secret
+		err = s.accessTokenRepository.Create(r.Context(), &accessToken)
+		if err != nil {
+			s.logger.Error("error creating access token", "error", err, "accessTokenId", accessToken.ID)
+			errMsg = "failed to create"
+		} else {
+			s.audit(r, domain.AuditEvent{Action: domain.AuditActionAccessTokenCreate, TargetType: auditTargetAccessToken, TargetID: accessToken.ID}, nil, newAuditAccessToken(accessToken))
+		}
+	} else if r.FormValue("delete") == "true" {
+		accessToken, err := s.accessTokenRepository.GetByID(r.Context(), tokenId)
+		if err != nil {
+			s.logger.Error("error getting access token by id", "error", err, "accessTokenId", tokenId)
+		}
+		if accessToken.OwnerUserID != token.Subject {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		err = s.accessTokenRepository.Delete(r.Context(), accessToken.ID)
+		if err != nil {
+			s.logger.Error("failed to delete access token", "error", err, "accessTokenId", accessToken.ID)
+			errMsg = "Failed to delete"
+		} else {
+			s.audit(r, domain.AuditEvent{Action: domain.AuditActionAccessTokenDelete, TargetType: auditTargetAccessToken, TargetID: accessToken.ID}, newAuditAccessToken(accessToken), nil)
+		}
+	}
+	redirectToAdmin(w, r, errMsg)
+}
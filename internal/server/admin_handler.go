@@ -2,13 +2,18 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bjarke-xyz/ws-gateway/internal/domain"
 	"github.com/bjarke-xyz/ws-gateway/internal/server/html"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/samber/lo"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -27,15 +32,20 @@ func (s *server) truncateKeyPreviews(ctx context.Context, keys []domain.ApiKey)
 
 func (s *server) handleGetAdmin(w http.ResponseWriter, r *http.Request) {
 	token, _, _ := TokenFromContext(r.Context())
-	apps, err := s.appRepository.GetByUserID(r.Context(), token.Subject)
 	errMsgs := make([]string, 0)
+	orgs, roles, err := s.organizationsForUser(r.Context(), token)
 	if err != nil {
-		s.logger.Error("error getting apps by user id", "error", err, "userId", token.Subject)
+		s.logger.Error("error getting organizations by user id", "error", err, "userId", token.Subject)
+		errMsgs = append(errMsgs, "Error getting organizations")
+	}
+	apps, err := s.appRepository.GetByOrganizationIDs(r.Context(), organizationIDs(orgs))
+	if err != nil {
+		s.logger.Error("error getting apps by organization ids", "error", err, "userId", token.Subject)
 		errMsgs = append(errMsgs, "Error getting apps")
 	}
-	keys, err := s.keyRepository.GetByUserID(r.Context(), token.Subject)
+	keys, err := s.keyRepository.GetByOrganizationIDs(r.Context(), organizationIDs(orgs))
 	if err != nil {
-		s.logger.Error("error getting keys by user id", "error", err, "userId", token.Subject)
+		s.logger.Error("error getting keys by organization ids", "error", err, "userId", token.Subject)
 		errMsgs = append(errMsgs, "Error getting keys")
 	}
 	err = s.truncateKeyPreviews(r.Context(), keys)
@@ -43,16 +53,36 @@ func (s *server) handleGetAdmin(w http.ResponseWriter, r *http.Request) {
 		s.logger.Error("error truncating key preview", "error", err)
 		errMsgs = append(errMsgs, "Error truncating key preview")
 	}
+	accessTokens, err := s.accessTokenRepository.GetByUserID(r.Context(), token.Subject)
+	if err != nil {
+		s.logger.Error("error getting access tokens by user id", "error", err, "userId", token.Subject)
+		errMsgs = append(errMsgs, "Error getting access tokens")
+	}
+	err = s.truncateAccessTokenPreviews(r.Context(), accessTokens)
+	if err != nil {
+		s.logger.Error("error truncating access token preview", "error", err)
+		errMsgs = append(errMsgs, "Error truncating access token preview")
+	}
 	appsByID := make(map[string]domain.Application)
 	for _, v := range apps {
 		appsByID[v.ID] = v
 	}
+	orgsByID := make(map[string]domain.Organization)
+	for _, v := range orgs {
+		orgsByID[v.ID] = v
+	}
 	params := html.AdminParams{
 		Title:    "ws-gateway",
 		Errors:   errMsgs,
 		Apps:     apps,
 		AppsByID: appsByID,
 		Keys:     keys,
+
+		Organizations:     orgs,
+		OrganizationsByID: orgsByID,
+		Roles:             roles,
+
+		AccessTokens: accessTokens,
 	}
 	html.AdminPage(w, params)
 }
@@ -63,21 +93,85 @@ func (s *server) handleGetApp(w http.ResponseWriter, r *http.Request) {
 	errMsg := r.URL.Query().Get("error")
 	var app domain.Application
 	var err error
-	if appId != "null" {
+	permission := domain.PermissionView
+	if appId == "null" {
+		// New apps are created in the organization given by the org query parameter
+		app.OrganizationID = r.URL.Query().Get("org")
+		permission = domain.PermissionDelete
+	} else {
 		app, err = s.appRepository.GetByID(r.Context(), appId)
 		if err != nil {
 			s.logger.Error("error getting apps by user id", "error", err)
 			errMsg = errMsg + " error getting apps"
 		}
-		if app.OwnerUserID != token.Subject {
-			w.WriteHeader(http.StatusForbidden)
-			return
+	}
+	role, err := s.memberRole(r.Context(), app.OrganizationID, token.Subject)
+	if err != nil {
+		s.logger.Error("error getting organization member", "error", err, "organizationId", app.OrganizationID)
+		errMsg = errMsg + " error getting organization member"
+	}
+	if !role.Can(permission) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	var deliveries []domain.WebhookDelivery
+	if app.ID != "" {
+		deliveries, err = s.deliveryRepository.GetByAppID(r.Context(), app.ID, 50)
+		if err != nil {
+			s.logger.Error("error getting webhook deliveries", "error", err, "appId", app.ID)
+			errMsg = errMsg + " error getting webhook deliveries"
 		}
 	}
+	var deadLetters []domain.DeadLetter
+	if app.ID != "" {
+		deadLetters, err = s.deadLetterRepository.GetByAppID(r.Context(), app.ID, 50)
+		if err != nil {
+			s.logger.Error("error getting dead letters", "error", err, "appId", app.ID)
+			errMsg = errMsg + " error getting dead letters"
+		}
+	}
+	var routingRules []domain.RoutingRule
+	if app.ID != "" {
+		routingRules, err = s.routingRuleRepository.GetByAppID(r.Context(), app.ID)
+		if err != nil {
+			s.logger.Error("error getting routing rules", "error", err, "appId", app.ID)
+			errMsg = errMsg + " error getting routing rules"
+		}
+	}
+	var usage []domain.AppUsage
+	if app.ID != "" {
+		to := usageDay(time.Now())
+		usage, err = s.appUsageRepository.GetByAppID(r.Context(), app.ID, to.AddDate(0, 0, -(usageDefaultDays-1)), to)
+		if err != nil {
+			s.logger.Error("error getting app usage", "error", err, "appId", app.ID)
+			errMsg = errMsg + " error getting app usage"
+		}
+	}
+	enabledWebhookEvents := make(map[string]bool)
+	for _, event := range app.WebhookEvents {
+		enabledWebhookEvents[event] = true
+	}
 	params := html.AppParams{
-		Title: "App",
-		Error: errMsg,
-		App:   app,
+		Title:                "App",
+		Error:                errMsg,
+		App:                  app,
+		WebhookEvents:        domain.WebhookEvents,
+		EnabledWebhookEvents: enabledWebhookEvents,
+		WebhookDeliveries:    deliveries,
+		AckTimeoutSeconds:    app.AckTimeoutSeconds,
+		MaxDeliveryAttempts:  app.MaxDeliveryAttempts,
+		DeadLetters:          deadLetters,
+		RoutingRules:         routingRules,
+		Usage:                newUsageRows(usage),
+		UsageTotal:           usageTotal(usage),
+		CanEdit:              role.Can(domain.PermissionEdit),
+		CanDelete:            role.Can(domain.PermissionDelete),
+	}
+	if params.AckTimeoutSeconds == 0 {
+		params.AckTimeoutSeconds = domain.DefaultAckTimeoutSeconds
+	}
+	if params.MaxDeliveryAttempts == 0 {
+		params.MaxDeliveryAttempts = domain.DefaultMaxDeliveryAttempts
 	}
 	html.AppPage(w, params)
 }
@@ -87,46 +181,144 @@ func (s *server) handlePostApp(w http.ResponseWriter, r *http.Request) {
 	errMsg := ""
 	appId := chi.URLParam(r, "app-id")
 	name := r.FormValue("name")
+	webhookURL := r.FormValue("webhook_url")
+	webhookSecret := r.FormValue("webhook_secret")
+	webhookEvents := lo.Intersect(domain.WebhookEvents, r.Form["webhook_events"])
+	pusherEnabled := r.FormValue("pusher_enabled") == "true"
+	reliableTopics := parseTopicList(r.FormValue("reliable_topics"))
+	ackTimeoutSeconds := formInt(r, "ack_timeout_seconds", domain.DefaultAckTimeoutSeconds)
+	maxDeliveryAttempts := formInt(r, "max_delivery_attempts", domain.DefaultMaxDeliveryAttempts)
+	sequencedTopics := parseTopicList(r.FormValue("sequenced_topics"))
+	topicsErr := validateAppTopics(reliableTopics, sequencedTopics)
 	delete := r.FormValue("delete") == "true"
 	if appId == "null" {
+		organizationId := r.FormValue("organization_id")
+		role, err := s.memberRole(r.Context(), organizationId, token.Subject)
+		if err != nil {
+			s.logger.Error("error getting organization member", "error", err, "organizationId", organizationId)
+			redirectToAdmin(w, r, "error getting organization member")
+			return
+		}
+		if !role.Can(domain.PermissionDelete) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if topicsErr != nil {
+			redirectToAdmin(w, r, topicsErr.Error())
+			return
+		}
 		appId = uuid.NewString()
 		app := domain.Application{
-			ID:          appId,
-			OwnerUserID: token.Subject,
-			Name:        name,
+			ID:             appId,
+			OwnerUserID:    token.Subject,
+			OrganizationID: organizationId,
+			Name:           name,
+			WebhookURL:     webhookURL,
+			WebhookSecret:  webhookSecret,
+			WebhookEvents:  webhookEvents,
+			PusherEnabled:  pusherEnabled,
+
+			ReliableTopics:      reliableTopics,
+			AckTimeoutSeconds:   ackTimeoutSeconds,
+			MaxDeliveryAttempts: maxDeliveryAttempts,
+			SequencedTopics:     sequencedTopics,
 		}
-		err := s.appRepository.Create(r.Context(), &app)
+		err = s.appRepository.Create(r.Context(), &app)
 		if err != nil {
 			s.logger.Error("error creating app", "error", err, "app", app)
 			errMsg = "failed to create"
+		} else {
+			s.audit(r, domain.AuditEvent{Action: domain.AuditActionAppCreate, OrganizationID: app.OrganizationID, TargetType: auditTargetApp, TargetID: app.ID}, nil, newAuditApp(app))
 		}
 	} else {
 		app, err := s.appRepository.GetByID(r.Context(), appId)
 		if err != nil {
 			s.logger.Error("error getting app by app id", "error", err)
 		}
-		if app.OwnerUserID != token.Subject {
+		role, err := s.memberRole(r.Context(), app.OrganizationID, token.Subject)
+		if err != nil {
+			s.logger.Error("error getting organization member", "error", err, "organizationId", app.OrganizationID)
+		}
+		permission := domain.PermissionEdit
+		if delete {
+			permission = domain.PermissionDelete
+		}
+		if !role.Can(permission) {
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
+		if !delete && topicsErr != nil {
+			redirectToApp(w, r, app.ID, topicsErr.Error())
+			return
+		}
+		auditEvent := domain.AuditEvent{OrganizationID: app.OrganizationID, TargetType: auditTargetApp, TargetID: app.ID}
+		before := newAuditApp(app)
 		if delete {
 			err = s.appRepository.Delete(r.Context(), app.ID)
 			if err != nil {
 				s.logger.Error("failed to delete app", "error", err)
 				errMsg = "Failed to delete"
+			} else {
+				s.sequencedTopics.invalidate(app.ID)
+				auditEvent.Action = domain.AuditActionAppDelete
+				s.audit(r, auditEvent, before, nil)
 			}
 		} else {
 			app.Name = name
+			app.WebhookURL = webhookURL
+			app.WebhookSecret = webhookSecret
+			app.WebhookEvents = webhookEvents
+			app.PusherEnabled = pusherEnabled
+			app.ReliableTopics = reliableTopics
+			app.AckTimeoutSeconds = ackTimeoutSeconds
+			app.MaxDeliveryAttempts = maxDeliveryAttempts
+			app.SequencedTopics = sequencedTopics
 			err = s.appRepository.Update(r.Context(), &app)
 			if err != nil {
 				s.logger.Error("failed to update app", "error", err)
 				errMsg = "Failed to update"
+			} else {
+				s.sequencedTopics.invalidate(app.ID)
+				auditEvent.Action = domain.AuditActionAppUpdate
+				s.audit(r, auditEvent, before, newAuditApp(app))
 			}
 		}
 	}
 	redirectToAdmin(w, r, errMsg)
 }
 
+// parseTopicList parses one topic per line
+func parseTopicList(value string) []string {
+	topics := make([]string, 0)
+	for _, line := range strings.Split(value, "\n") {
+		topic := strings.TrimSpace(line)
+		if topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// validateAppTopics returns an error naming the first invalid topic of the app's topic lists
+func validateAppTopics(reliableTopics []string, sequencedTopics []string) error {
+	if err := validateTopicList(reliableTopics); err != nil {
+		return fmt.Errorf("reliable topics: %w", err)
+	}
+	if err := validateTopicList(sequencedTopics); err != nil {
+		return fmt.Errorf("sequenced topics: %w", err)
+	}
+	return nil
+}
+
+// formInt returns fallback if the form value is missing or not a positive number
+func formInt(r *http.Request, key string, fallback int) int {
+	value, err := strconv.Atoi(r.FormValue(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
 func (s *server) handleGetKey(w http.ResponseWriter, r *http.Request) {
 	token, _, _ := TokenFromContext(r.Context())
 	keyId := chi.URLParam(r, "key-id")
@@ -137,20 +329,30 @@ func (s *server) handleGetKey(w http.ResponseWriter, r *http.Request) {
 	}
 	var key domain.ApiKey
 	var err error
-	if keyId != "null" {
+	permission := domain.PermissionView
+	if keyId == "null" {
+		// New keys are created in the organization given by the org query parameter
+		key.OrganizationID = r.URL.Query().Get("org")
+		permission = domain.PermissionEdit
+	} else {
 		key, err = s.keyRepository.GetByID(r.Context(), keyId)
 		if err != nil {
 			s.logger.Error("error getting apps by user id", "error", err)
 			errMsgs = append(errMsgs, "error getting apps")
 		}
-		if key.OwnerUserID != token.Subject {
-			w.WriteHeader(http.StatusForbidden)
-			return
-		}
 	}
-	apps, err := s.appRepository.GetByUserID(r.Context(), token.Subject)
+	role, err := s.memberRole(r.Context(), key.OrganizationID, token.Subject)
 	if err != nil {
-		s.logger.Error("error getting apps by user id", "error", err, "userId", token.Subject)
+		s.logger.Error("error getting organization member", "error", err, "organizationId", key.OrganizationID)
+		errMsgs = append(errMsgs, "Error getting organization member")
+	}
+	if !role.Can(permission) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	apps, err := s.appRepository.GetByOrganizationIDs(r.Context(), []string{key.OrganizationID})
+	if err != nil {
+		s.logger.Error("error getting apps by organization id", "error", err, "organizationId", key.OrganizationID)
 		errMsgs = append(errMsgs, "Error getting apps")
 	}
 	keyAccessByAppID := make(map[string]domain.ApiKeyAccess)
@@ -163,10 +365,32 @@ func (s *server) handleGetKey(w http.ResponseWriter, r *http.Request) {
 		Key:              key,
 		KeyAccessByAppID: keyAccessByAppID,
 		Apps:             apps,
+		CanEdit:          role.Can(domain.PermissionEdit),
+		CanDelete:        role.Can(domain.PermissionDelete),
 	}
 	html.KeyPage(w, params)
 }
 
+// newApiKey returns a key with a new secret, which is only stored hashed. The secret is returned as well.
+// The key also gets a pusher secret, see domain.ApiKey.
+func newApiKey(ownerUserId string, organizationId string, access []domain.ApiKeyAccess) (domain.ApiKey, string, error) {
+	apiKey := uuid.NewString()
+	apiKeyHashBytes, err := bcrypt.GenerateFromPassword([]byte(apiKey), bcrypt.DefaultCost)
+	if err != nil {
+		return domain.ApiKey{}, "", err
+	}
+	key := domain.ApiKey{
+		ID:             uuid.NewString(),
+		OwnerUserID:    ownerUserId,
+		OrganizationID: organizationId,
+		KeyHash:        string(apiKeyHashBytes),
+		KeyPreview:     apiKey[0:4],
+		PusherSecret:   strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Access:         access,
+	}
+	return key, apiKey, nil
+}
+
 func redirectToAdmin(w http.ResponseWriter, r *http.Request, errMsg string) {
 	http.Redirect(w, r, fmt.Sprintf("/admin/?%v", errorQuery(errMsg)), http.StatusSeeOther)
 }
@@ -176,9 +400,34 @@ func (s *server) handlePostKey(w http.ResponseWriter, r *http.Request) {
 	errMsg := ""
 	keyId := chi.URLParam(r, "key-id")
 	delete := r.FormValue("delete") == "true"
-	apps, err := s.appRepository.GetByUserID(r.Context(), token.Subject)
+	var key domain.ApiKey
+	permission := domain.PermissionEdit
+	if keyId == "null" {
+		key.OrganizationID = r.FormValue("organization_id")
+	} else {
+		var err error
+		key, err = s.keyRepository.GetByID(r.Context(), keyId)
+		if err != nil {
+			s.logger.Error("error getting key by id", "error", err, "keyId", keyId)
+		}
+		if delete {
+			permission = domain.PermissionDelete
+		}
+	}
+	role, err := s.memberRole(r.Context(), key.OrganizationID, token.Subject)
+	if err != nil {
+		s.logger.Error("error getting organization member", "error", err, "organizationId", key.OrganizationID)
+		redirectToAdmin(w, r, "error getting organization member")
+		return
+	}
+	if !role.Can(permission) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	// Keys only give access to apps in their own organization
+	apps, err := s.appRepository.GetByOrganizationIDs(r.Context(), []string{key.OrganizationID})
 	if err != nil {
-		s.logger.Error("error getting apps by user id", "error", err, "userId", token.Subject)
+		s.logger.Error("error getting apps by organization id", "error", err, "organizationId", key.OrganizationID)
 		redirectToAdmin(w, r, "error getting apps")
 		return
 	}
@@ -199,50 +448,176 @@ func (s *server) handlePostKey(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if keyId == "null" {
-		keyId = uuid.NewString()
-		apiKey := uuid.NewString()
-		apiKeyHashBytes, err := bcrypt.GenerateFromPassword([]byte(apiKey), bcrypt.DefaultCost)
+		key, apiKey, err := newApiKey(token.Subject, key.OrganizationID, apiKeyAccess)
 		if err != nil {
 			s.logger.Error("error hashing apiKey", "error", err)
 			redirectToAdmin(w, r, "failed to hash api key")
 			return
 		}
-		apiKeyHash := string(apiKeyHashBytes)
-		key := domain.ApiKey{
-			ID:          keyId,
-			OwnerUserID: token.Subject,
-			KeyHash:     apiKeyHash,
-			// KeyPreview is truncated next time the api key is fetched
-			KeyPreview: apiKey,
-			Access:     apiKeyAccess,
-		}
+		// KeyPreview is truncated next time the api key is fetched
+		key.KeyPreview = apiKey
 		err = s.keyRepository.Create(r.Context(), &key)
 		if err != nil {
 			s.logger.Error("error creating key", "error", err, "key", key)
 			errMsg = "failed to create"
+		} else {
+			s.audit(r, domain.AuditEvent{Action: domain.AuditActionKeyCreate, OrganizationID: key.OrganizationID, TargetType: auditTargetKey, TargetID: key.ID}, nil, newAuditKey(key))
+		}
+	} else if delete {
+		err = s.keyRepository.Delete(r.Context(), key.ID)
+		if err != nil {
+			s.logger.Error("failed to delete key", "error", err, "keyId", key.ID)
+			errMsg = "Failed to delete"
+		} else {
+			s.audit(r, domain.AuditEvent{Action: domain.AuditActionKeyDelete, OrganizationID: key.OrganizationID, TargetType: auditTargetKey, TargetID: key.ID}, newAuditKey(key), nil)
 		}
 	} else {
-		key, err := s.keyRepository.GetByID(r.Context(), keyId)
+		err = s.keyRepository.Update(r.Context(), key.ID, apiKeyAccess)
 		if err != nil {
-			s.logger.Error("error getting key by id", "error", err, "keyId", keyId)
+			s.logger.Error("failed to update key", "error", err)
+			errMsg = "Failed to update"
+		} else {
+			before := newAuditKey(key)
+			key.Access = apiKeyAccess
+			s.audit(r, domain.AuditEvent{Action: domain.AuditActionKeyUpdate, OrganizationID: key.OrganizationID, TargetType: auditTargetKey, TargetID: key.ID}, before, newAuditKey(key))
+		}
+	}
+	redirectToAdmin(w, r, errMsg)
+}
+
+// appForAdmin returns the app if the signed in user's role in its organization has the permission. On failure the error is written to w and false is returned.
+func (s *server) appForAdmin(w http.ResponseWriter, r *http.Request, permission domain.Permission) (domain.Application, bool) {
+	token, _, _ := TokenFromContext(r.Context())
+	appId := chi.URLParam(r, "app-id")
+	app, err := s.appRepository.GetByID(r.Context(), appId)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			http.Error(w, "app not found", http.StatusNotFound)
+			return app, false
+		}
+		s.logger.Error("error getting app by app id", "error", err, "appId", appId)
+		http.Error(w, "error getting app", http.StatusInternalServerError)
+		return app, false
+	}
+	role, err := s.memberRole(r.Context(), app.OrganizationID, token.Subject)
+	if err != nil {
+		s.logger.Error("error getting organization member", "error", err, "organizationId", app.OrganizationID)
+		http.Error(w, "error getting organization member", http.StatusInternalServerError)
+		return app, false
+	}
+	if !role.Can(permission) {
+		w.WriteHeader(http.StatusForbidden)
+		return app, false
+	}
+	return app, true
+}
+
+func (s *server) handleGetRoutingRule(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.appForAdmin(w, r, domain.PermissionView)
+	if !ok {
+		return
+	}
+	ruleId := chi.URLParam(r, "rule-id")
+	errMsg := r.URL.Query().Get("error")
+	var rule domain.RoutingRule
+	if ruleId != "null" {
+		var err error
+		rule, err = s.routingRuleRepository.GetByID(r.Context(), ruleId)
+		if err != nil {
+			s.logger.Error("error getting routing rule", "error", err, "ruleId", ruleId)
+			errMsg = errMsg + " error getting routing rule"
 		}
-		if key.OwnerUserID != token.Subject {
+		if rule.AppID != app.ID {
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
-		if delete {
-			err = s.keyRepository.Delete(r.Context(), key.ID)
-			if err != nil {
-				s.logger.Error("failed to delete key", "error", err, "keyId", key.ID)
-				errMsg = "Failed to delete"
-			}
+	}
+	html.RoutingRulePage(w, html.RoutingRuleParams{
+		Title: "Routing rule",
+		Error: errMsg,
+		App:   app,
+		Rule:  rule,
+	})
+}
+
+func (s *server) handlePostRoutingRule(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.appForAdmin(w, r, domain.PermissionEdit)
+	if !ok {
+		return
+	}
+	ruleId := chi.URLParam(r, "rule-id")
+	errMsg := ""
+	var rule domain.RoutingRule
+	if ruleId != "null" {
+		var err error
+		rule, err = s.routingRuleRepository.GetByID(r.Context(), ruleId)
+		if err != nil {
+			s.logger.Error("error getting routing rule", "error", err, "ruleId", ruleId)
+		}
+		if rule.AppID != app.ID {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+	auditEvent := domain.AuditEvent{OrganizationID: app.OrganizationID, TargetType: auditTargetRoutingRule, TargetID: rule.ID}
+	if r.FormValue("delete") == "true" {
+		err := s.routingRuleRepository.Delete(r.Context(), rule.ID)
+		if err != nil {
+			s.logger.Error("failed to delete routing rule", "error", err, "ruleId", rule.ID)
+			errMsg = "Failed to delete routing rule"
 		} else {
-			err = s.keyRepository.Update(r.Context(), key.ID, apiKeyAccess)
-			if err != nil {
-				s.logger.Error("failed to update key", "error", err)
-				errMsg = "Failed to update"
-			}
+			auditEvent.Action = domain.AuditActionRoutingRuleDelete
+			s.audit(r, auditEvent, newAuditRoutingRule(rule), nil)
 		}
+		s.routingRules.invalidate(app.ID)
+		redirectToApp(w, r, app.ID, errMsg)
+		return
 	}
-	redirectToAdmin(w, r, errMsg)
+
+	var before any
+	if rule.ID != "" {
+		before = newAuditRoutingRule(rule)
+	}
+	rule.SourceTopic = strings.TrimSpace(r.FormValue("source_topic"))
+	rule.Condition = strings.TrimSpace(r.FormValue("condition"))
+	rule.TargetTopic = strings.TrimSpace(r.FormValue("target_topic"))
+	rule.Transform = strings.TrimSpace(r.FormValue("transform"))
+	if _, err := compileRule(rule); err != nil {
+		// Shown with the submitted values, so they can be corrected
+		html.RoutingRulePage(w, html.RoutingRuleParams{
+			Title: "Routing rule",
+			Error: err.Error(),
+			App:   app,
+			Rule:  rule,
+		})
+		return
+	}
+	if rule.ID == "" {
+		rule.ID = uuid.NewString()
+		rule.AppID = app.ID
+		err := s.routingRuleRepository.Create(r.Context(), &rule)
+		if err != nil {
+			s.logger.Error("error creating routing rule", "error", err, "rule", rule)
+			errMsg = "Failed to create routing rule"
+		} else {
+			auditEvent.Action = domain.AuditActionRoutingRuleCreate
+			auditEvent.TargetID = rule.ID
+			s.audit(r, auditEvent, nil, newAuditRoutingRule(rule))
+		}
+	} else {
+		err := s.routingRuleRepository.Update(r.Context(), &rule)
+		if err != nil {
+			s.logger.Error("failed to update routing rule", "error", err, "ruleId", rule.ID)
+			errMsg = "Failed to update routing rule"
+		} else {
+			auditEvent.Action = domain.AuditActionRoutingRuleUpdate
+			s.audit(r, auditEvent, before, newAuditRoutingRule(rule))
+		}
+	}
+	s.routingRules.invalidate(app.ID)
+	redirectToApp(w, r, app.ID, errMsg)
+}
+
+func redirectToApp(w http.ResponseWriter, r *http.Request, appId string, errMsg string) {
+	http.Redirect(w, r, fmt.Sprintf("/admin/app/%v?%v", appId, errorQuery(errMsg)), http.StatusSeeOther)
 }
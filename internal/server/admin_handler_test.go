@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// addTestMember adds a user with role to the organization, and returns the id of the user
+func addTestMember(t *testing.T, s *server, organizationId string, role domain.Role) string {
+	t.Helper()
+	member := domain.OrganizationMember{OrganizationID: organizationId, UserID: uuid.NewString(), Role: role}
+	if err := s.organizationRepository.AddMember(context.Background(), &member); err != nil {
+		t.Fatal(err)
+	}
+	return member.UserID
+}
+
+// adminRequest calls the admin ui handler as signed in as userId, with the url parameters and form
+func adminRequest(handler http.HandlerFunc, userId string, method string, urlParams map[string]string, form url.Values) *httptest.ResponseRecorder {
+	routeCtx := chi.NewRouteContext()
+	for k, v := range urlParams {
+		routeCtx.URLParams.Add(k, v)
+	}
+	ctx := context.WithValue(context.Background(), chi.RouteCtxKey, routeCtx)
+	ctx = NewContext(ctx, &auth.Token{Subject: userId}, "", nil)
+	r := httptest.NewRequest(method, "/", strings.NewReader(form.Encode())).WithContext(ctx)
+	if form != nil {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestAppSecretsHiddenFromViewers(t *testing.T) {
+	s, _ := newTestServer(t)
+	app, key, _ := newTestApp(t, s, func(app *domain.Application) {
+		app.WebhookSecret = "webhook-secret"
+	})
+	viewer := addTestMember(t, s, app.OrganizationID, domain.RoleViewer)
+	developer := addTestMember(t, s, app.OrganizationID, domain.RoleDeveloper)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		params  map[string]string
+		secret  string
+	}{
+		{"webhook secret", s.handleGetApp, map[string]string{"app-id": app.ID}, app.WebhookSecret},
+		{"pusher secret", s.handleGetKey, map[string]string{"key-id": key.ID}, key.PusherSecret},
+	}
+	for _, tt := range tests {
+		w := adminRequest(tt.handler, viewer, http.MethodGet, tt.params, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%v: viewer got status %v, want %v", tt.name, w.Code, http.StatusOK)
+		}
+		if strings.Contains(w.Body.String(), tt.secret) {
+			t.Errorf("%v: page shown to viewer contains the secret", tt.name)
+		}
+		w = adminRequest(tt.handler, developer, http.MethodGet, tt.params, nil)
+		if !strings.Contains(w.Body.String(), tt.secret) {
+			t.Errorf("%v: page shown to developer does not contain the secret", tt.name)
+		}
+	}
+}
+
+func TestViewerCannotChangeAppSecret(t *testing.T) {
+	s, _ := newTestServer(t)
+	app, _, _ := newTestApp(t, s, func(app *domain.Application) {
+		app.WebhookSecret = "webhook-secret"
+	})
+	viewer := addTestMember(t, s, app.OrganizationID, domain.RoleViewer)
+
+	form := url.Values{"name": {app.Name}, "webhook_secret": {"changed"}}
+	w := adminRequest(s.handlePostApp, viewer, http.MethodPost, map[string]string{"app-id": app.ID}, form)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got status %v, want %v", w.Code, http.StatusForbidden)
+	}
+	stored, err := s.appRepository.GetByID(context.Background(), app.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.WebhookSecret != app.WebhookSecret {
+		t.Errorf("got webhook secret %v, want it unchanged", stored.WebhookSecret)
+	}
+}
+
+func TestPostAppInvalidTopics(t *testing.T) {
+	s, _ := newTestServer(t)
+	app, _, _ := newTestApp(t, s, nil)
+
+	form := url.Values{"name": {app.Name}, "reliable_topics": {"orders/+\norders/#/items"}}
+	w := adminRequest(s.handlePostApp, app.OwnerUserID, http.MethodPost, map[string]string{"app-id": app.ID}, form)
+
+	if w.Code != http.StatusSeeOther || !strings.Contains(w.Header().Get("Location"), url.QueryEscape("orders/#/items")) {
+		t.Errorf("got status %v redirecting to %v, want the invalid topic shown on the app page", w.Code, w.Header().Get("Location"))
+	}
+	stored, err := s.appRepository.GetByID(context.Background(), app.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.ReliableTopics) != 0 {
+		t.Errorf("got reliable topics %v, want none saved", stored.ReliableTopics)
+	}
+}
@@ -1,12 +1,19 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
-	"firebase.google.com/go/v4/errorutils"
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -39,44 +46,86 @@ func (s *server) handleApiCreateTicket(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "empty topic", http.StatusBadRequest)
 		return
 	}
-
-	auth, err := s.app.Auth(r.Context())
-	if err != nil {
-		s.logger.Error("error getting auth", "error", err)
-		http.Error(w, "error getting auth", http.StatusInternalServerError)
+	if err := validateTopic(input.Topic); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	user, err := auth.GetUser(r.Context(), input.UserID)
-	if err != nil && !errorutils.IsNotFound(err) {
-		s.logger.Error("error getting user", "error", err)
-		http.Error(w, "error getting user", http.StatusInternalServerError)
-		return
-	}
-	if user == nil || errorutils.IsNotFound(err) {
-		s.logger.Error("user not found", "userId", input.UserID, "appId", appId)
-		http.Error(w, "user not found", http.StatusInternalServerError)
+	customToken, err := s.createTicket(r.Context(), appId, input.UserID, input.Topic)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			s.logger.Error("user not found", "userId", input.UserID, "appId", appId)
+			http.Error(w, "user not found", http.StatusInternalServerError)
+			return
+		}
+		s.logger.Error("error creating ticket", "error", err)
+		http.Error(w, "error creating ticket", http.StatusInternalServerError)
 		return
 	}
 
-	customClaims := make(map[string]any)
-	customClaims[wsTokenAppIdClaimKey] = appId
-	customClaims[wsTokenTopicClaimKey] = input.Topic
-	customToken, err := auth.CustomTokenWithClaims(r.Context(), user.UID, customClaims)
-
 	response := createTicketResponse{
 		Token: customToken,
 	}
 	jsonResponse(w, http.StatusOK, response)
 }
 
+// createTicket creates a ticket for userId, with claims restricting it to appId and topic
+func (s *server) createTicket(ctx context.Context, appId string, userId string, topic string) (string, error) {
+	customClaims := make(map[string]any)
+	customClaims[wsTokenAppIdClaimKey] = appId
+	customClaims[wsTokenTopicClaimKey] = topic
+	return s.tickets.CreateTicket(ctx, userId, customClaims)
+}
+
 type broadcastInput struct {
-	Payload map[string]any `json:"Payload"`
+	Event string `json:"event"`
+	// Payload is sent as payload, like in batch items. Keys are matched case-insensitively,
+	// so the Payload key of earlier versions still works.
+	Payload map[string]any `json:"payload"`
+	// TTL is the number of seconds the message may wait for delivery, 0 means no ttl
+	TTL int `json:"ttl"`
+	// DeliverAt schedules the message instead of broadcasting it right away
+	DeliverAt *time.Time `json:"deliver_at"`
+	// IncludeTraceID adds the trace id of the broadcast to the envelope, so clients can report it. It is ignored for scheduled broadcasts.
+	IncludeTraceID bool `json:"include_trace_id"`
+}
+
+type scheduledBroadcastResponse struct {
+	ID        string    `json:"id"`
+	DeliverAt time.Time `json:"deliverAt"`
+}
+
+type wsEnvelope struct {
+	ID      string          `json:"id,omitempty"`
+	Seq     int64           `json:"seq,omitempty"`
+	Topic   string          `json:"topic,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	TraceID string          `json:"traceId,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// encodeBroadcast returns the frame sent to clients. Without an event name, message id, sequence number,
+// topic or trace id the frame is the bare payload, otherwise it is wrapped in an envelope.
+func encodeBroadcast(msg *WsMessage) ([]byte, error) {
+	if msg.Event == "" && msg.ID == "" && msg.Seq == 0 && msg.Topic == "" && msg.TraceID == "" {
+		return msg.Payload, nil
+	}
+	return json.Marshal(wsEnvelope{
+		ID:      msg.ID,
+		Seq:     msg.Seq,
+		Topic:   msg.Topic,
+		Event:   msg.Event,
+		TraceID: msg.TraceID,
+		Payload: msg.Payload,
+	})
 }
 
 func (s *server) handleApiBroadcast(w http.ResponseWriter, r *http.Request) {
-	_, appId := ApiKeyFromContext(r.Context())
-	topicName := chi.URLParam(r, "topic")
+	ctx, span := tracer.Start(r.Context(), "handleApiBroadcast")
+	defer span.End()
+	_, appId := ApiKeyFromContext(ctx)
+	topicName := topicParam(r)
+	span.SetAttributes(attribute.String("app.id", appId), attribute.String("topic", topicName))
 
 	input := &broadcastInput{}
 	err := json.NewDecoder(r.Body).Decode(&input)
@@ -84,17 +133,463 @@ func (s *server) handleApiBroadcast(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("failed to decode input: %v", err.Error()), http.StatusBadRequest)
 		return
 	}
+	if input.TTL < 0 {
+		http.Error(w, "ttl must not be negative", http.StatusBadRequest)
+		return
+	}
+	if isWildcardTopic(topicName) {
+		http.Error(w, errWildcardTopic.Error(), http.StatusBadRequest)
+		return
+	}
 
-	topic := s.wsTopicCollection.getTopic(appId, topicName)
-	if topic == nil {
-		http.Error(w, "topic not found", http.StatusInternalServerError)
+	if input.DeliverAt != nil && input.DeliverAt.After(time.Now()) {
+		scheduled, err := s.schedule(ctx, appId, topicName, input)
+		if err != nil {
+			s.logger.Error("error scheduling broadcast", "error", err, "appId", appId)
+			http.Error(w, "error scheduling broadcast", http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, http.StatusAccepted, scheduledBroadcastResponse{ID: scheduled.ID, DeliverAt: scheduled.DeliverAt})
 		return
 	}
-	payloadBytes, err := json.Marshal(input.Payload)
+
+	msg, err := newBroadcastMessage(ctx, input.Event, input.Payload, time.Duration(input.TTL)*time.Second, input.IncludeTraceID)
+	if err == nil {
+		err = s.publishMessage(appId, topicName, msg)
+	}
 	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, errTopicNotFound) {
+			http.Error(w, "topic not found", http.StatusInternalServerError)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	topic.Broker.Notifier <- []byte(payloadBytes)
 	w.WriteHeader(http.StatusNoContent)
 }
+
+var errTopicNotFound = errors.New("topic not found")
+
+// publish sends the event to every client on the topic. Topics only exist while clients are connected.
+// Clients that have not received the message within ttl are skipped, a ttl of 0 means no ttl.
+func (s *server) publish(ctx context.Context, appId string, topicName string, event string, payload map[string]any, ttl time.Duration) error {
+	msg, err := newBroadcastMessage(ctx, event, payload, ttl, false)
+	if err != nil {
+		return err
+	}
+	return s.publishMessage(appId, topicName, msg)
+}
+
+// newBroadcastMessage creates the message for a broadcast, in the trace of the span in ctx
+func newBroadcastMessage(ctx context.Context, event string, payload map[string]any, ttl time.Duration, includeTraceID bool) (*WsMessage, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	msg := &WsMessage{
+		Event:       event,
+		Payload:     payloadBytes,
+		SpanContext: trace.SpanContextFromContext(ctx),
+	}
+	if includeTraceID && msg.SpanContext.HasTraceID() {
+		msg.TraceID = msg.SpanContext.TraceID().String()
+	}
+	msg.Frame, err = encodeBroadcast(msg)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		msg.ExpiresAt = time.Now().Add(ttl)
+	}
+	return msg, nil
+}
+
+// publishMessage delivers msg to the topic, and to the target topics of the app's routing rules
+func (s *server) publishMessage(appId string, topicName string, msg *WsMessage) error {
+	countBroadcast(appId)
+	err := s.routeAndDeliver(appId, topicName, msg)
+	if errors.Is(err, errTopicNotFound) {
+		countDropped(appId, dropReasonNoSubscribers, 1)
+	}
+	return err
+}
+
+// routeAndDeliver is publishMessage without counting the broadcast, for messages that are published
+// again when nobody received them
+func (s *server) routeAndDeliver(appId string, topicName string, msg *WsMessage) error {
+	routed := s.route(appId, topicName, msg)
+	err := s.deliver(appId, topicName, msg)
+	if errors.Is(err, errTopicNotFound) && routed > 0 {
+		// Delivered to the target topics of routing rules, although nobody is on the topic itself
+		return nil
+	}
+	return err
+}
+
+var errWildcardTopic = errors.New("cannot broadcast to a wildcard topic")
+
+// deliver sends msg to the topic and to the wildcard topics matching it
+func (s *server) deliver(appId string, topicName string, msg *WsMessage) error {
+	if isWildcardTopic(topicName) {
+		return errWildcardTopic
+	}
+	topic := s.wsTopicCollection.getTopic(appId, topicName)
+	wildcardTopics := s.wsTopicCollection.getWildcardTopics(appId, topicName)
+	unconnected := s.unconnectedTopics(appId, topicName, topic, wildcardTopics)
+	if topic == nil && len(wildcardTopics) == 0 && len(unconnected) == 0 {
+		return errTopicNotFound
+	}
+	// Inspectors get the message, but the broadcast only counts as delivered if it reached a subscriber
+	subscribed := len(unconnected) > 0
+	for _, wildcardTopic := range wildcardTopics {
+		// Sequence numbers and ids belong to the topic subscribed to, so each wildcard topic gets its own copy
+		err := s.deliverToTopic(wildcardTopic, wildcardCopy(topicName, msg))
+		if err != nil {
+			return err
+		}
+		subscribed = subscribed || wildcardTopic.subscribers() > 0
+	}
+	for _, unconnectedTopic := range unconnected {
+		unconnectedMsg := msg
+		if unconnectedTopic.topic != topicName {
+			unconnectedMsg = wildcardCopy(topicName, msg)
+		}
+		err := s.deliverToUnconnected(appId, unconnectedTopic, unconnectedMsg)
+		if err != nil {
+			return err
+		}
+	}
+	if topic != nil {
+		err := s.deliverToTopic(topic, msg)
+		if err != nil {
+			return err
+		}
+		subscribed = subscribed || topic.subscribers() > 0
+	}
+	if !subscribed {
+		return errTopicNotFound
+	}
+	return nil
+}
+
+// wildcardCopy returns the copy of msg delivered to a wildcard topic matching topicName
+func wildcardCopy(topicName string, msg *WsMessage) *WsMessage {
+	return &WsMessage{
+		Event:       msg.Event,
+		Payload:     msg.Payload,
+		Topic:       topicName,
+		SenderID:    msg.SenderID,
+		ExpiresAt:   msg.ExpiresAt,
+		SpanContext: msg.SpanContext,
+		TraceID:     msg.TraceID,
+	}
+}
+
+// unconnectedTopic is a topic a broadcast must be stored for, although it has no clients on this instance
+type unconnectedTopic struct {
+	id    TopicID
+	topic string
+	// sequenced topics store the message, so clients can get it later by sequence number
+	sequenced bool
+	// reliable topics have subscribers that are offline, see ackTracker
+	reliable bool
+}
+
+// unconnectedTopics returns the sequenced topics and the reliable topics with offline subscribers,
+// that receive broadcasts on topicName but are not among the connected topics
+func (s *server) unconnectedTopics(appId string, topicName string, topic *WsTopic, wildcardTopics []*WsTopic) []*unconnectedTopic {
+	connected := make(map[TopicID]bool, len(wildcardTopics)+1)
+	if topic != nil {
+		connected[topic.ID] = true
+	}
+	for _, wildcardTopic := range wildcardTopics {
+		connected[wildcardTopic.ID] = true
+	}
+	unconnected := make(map[TopicID]*unconnectedTopic)
+	get := func(topicId TopicID) *unconnectedTopic {
+		u, ok := unconnected[topicId]
+		if !ok {
+			u = &unconnectedTopic{id: topicId, topic: strings.TrimPrefix(string(topicId), appId+":")}
+			unconnected[topicId] = u
+		}
+		return u
+	}
+	sequenced, err := s.sequencedTopics.get(appId)
+	if err != nil {
+		// Connected topics know whether they are sequenced, only unconnected topics miss the message
+		s.logger.Error("failed to get sequenced topics", "error", err, "appId", appId)
+	} else {
+		for _, topicId := range sequenced.match(topicName) {
+			if !connected[topicId] {
+				get(topicId).sequenced = true
+			}
+		}
+	}
+	for _, topicId := range s.ackTracker.topics(appId, topicName) {
+		if !connected[topicId] {
+			get(topicId).reliable = true
+		}
+	}
+	topics := make([]*unconnectedTopic, 0, len(unconnected))
+	for _, u := range unconnected {
+		topics = append(topics, u)
+	}
+	return topics
+}
+
+// deliverToUnconnected numbers and stores msg for a topic without clients on this instance, and tracks
+// it for the offline subscribers of the topic
+func (s *server) deliverToUnconnected(appId string, topic *unconnectedTopic, msg *WsMessage) error {
+	if topic.sequenced {
+		err := s.appendSequenced(appId, topic.topic, msg)
+		if err != nil {
+			return fmt.Errorf("failed to assign sequence number: %w", err)
+		}
+	}
+	if !topic.reliable {
+		return nil
+	}
+	msg.ID = uuid.NewString()
+	frame, err := encodeBroadcast(msg)
+	if err != nil {
+		return err
+	}
+	msg.Frame = frame
+	s.ackTracker.published(topic.id, msg)
+	return nil
+}
+
+func (s *server) deliverToTopic(topic *WsTopic, msg *WsMessage) error {
+	if topic.Sequenced {
+		// Held until the message is handed to the broker, so clients get messages in sequence order
+		topic.publishMu.Lock()
+		defer topic.publishMu.Unlock()
+		err := s.appendSequenced(topic.AppID, topic.Topic, msg)
+		if err != nil {
+			return fmt.Errorf("failed to assign sequence number: %w", err)
+		}
+	}
+	if topic.Reliability != nil {
+		// Clients acknowledge messages on reliable topics by id
+		msg.ID = uuid.NewString()
+	}
+	if msg.ID != "" || msg.Seq != 0 || msg.Topic != "" || msg.TraceID != "" {
+		frame, err := encodeBroadcast(msg)
+		if err != nil {
+			return err
+		}
+		msg.Frame = frame
+	}
+	if topic.Reliability != nil {
+		s.ackTracker.published(topic.ID, msg)
+	}
+	topic.Broker.Notifier <- msg
+	topic.delivered.Add(1)
+	return nil
+}
+
+const maxBatchBroadcastItems = 1000
+
+type batchBroadcastItem struct {
+	Topic   string         `json:"topic"`
+	Event   string         `json:"event"`
+	Payload map[string]any `json:"payload"`
+	TTL     int            `json:"ttl"`
+	// IncludeTraceID adds the trace id of the request to the envelope
+	IncludeTraceID bool `json:"include_trace_id"`
+}
+type batchBroadcastInput struct {
+	Items []batchBroadcastItem `json:"items"`
+}
+type batchBroadcastResult struct {
+	Topic     string `json:"topic"`
+	Delivered bool   `json:"delivered"`
+	Error     string `json:"error,omitempty"`
+}
+type batchBroadcastResponse struct {
+	Results []batchBroadcastResult `json:"results"`
+}
+
+// handleApiBatchBroadcast broadcasts many items in one request, so the api key
+// is only verified once. Items are processed in order and independently of each other.
+func (s *server) handleApiBatchBroadcast(w http.ResponseWriter, r *http.Request) {
+	_, appId := ApiKeyFromContext(r.Context())
+
+	input := batchBroadcastInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode input: %v", err.Error()), http.StatusBadRequest)
+		return
+	}
+	if len(input.Items) == 0 {
+		http.Error(w, "no items", http.StatusBadRequest)
+		return
+	}
+	if len(input.Items) > maxBatchBroadcastItems {
+		http.Error(w, fmt.Sprintf("too many items, max is %d", maxBatchBroadcastItems), http.StatusBadRequest)
+		return
+	}
+
+	response := batchBroadcastResponse{
+		Results: make([]batchBroadcastResult, 0, len(input.Items)),
+	}
+	for _, item := range input.Items {
+		result := batchBroadcastResult{Topic: item.Topic}
+		if len(item.Topic) == 0 {
+			result.Error = "empty topic"
+			response.Results = append(response.Results, result)
+			continue
+		}
+		if item.TTL < 0 {
+			result.Error = "ttl must not be negative"
+			response.Results = append(response.Results, result)
+			continue
+		}
+		msg, err := newBroadcastMessage(r.Context(), item.Event, item.Payload, time.Duration(item.TTL)*time.Second, item.IncludeTraceID)
+		if err == nil {
+			err = s.publishMessage(appId, item.Topic, msg)
+		}
+		if err != nil {
+			result.Error = err.Error()
+			response.Results = append(response.Results, result)
+			continue
+		}
+		result.Delivered = true
+		response.Results = append(response.Results, result)
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
+const deadLettersLimit = 100
+
+type deadLetterResponse struct {
+	ID        string          `json:"id"`
+	Topic     string          `json:"topic"`
+	UserID    string          `json:"userId"`
+	MessageID string          `json:"messageId"`
+	Event     string          `json:"event"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	Reason    string          `json:"reason"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+func (s *server) handleApiGetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	_, appId := ApiKeyFromContext(r.Context())
+	deadLetters, err := s.deadLetterRepository.GetByAppID(r.Context(), appId, deadLettersLimit)
+	if err != nil {
+		s.logger.Error("error getting dead letters", "error", err, "appId", appId)
+		http.Error(w, "error getting dead letters", http.StatusInternalServerError)
+		return
+	}
+	response := make([]deadLetterResponse, 0, len(deadLetters))
+	for _, d := range deadLetters {
+		response = append(response, deadLetterResponse{
+			ID:        d.ID,
+			Topic:     d.Topic,
+			UserID:    d.UserID,
+			MessageID: d.MessageID,
+			Event:     d.Event,
+			Payload:   d.Payload,
+			Attempts:  d.Attempts,
+			Reason:    d.Reason,
+			CreatedAt: d.CreatedAt,
+		})
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
+func (s *server) handleApiDeleteDeadLetter(w http.ResponseWriter, r *http.Request) {
+	_, appId := ApiKeyFromContext(r.Context())
+	deadLetterId := chi.URLParam(r, "dead-letter-id")
+	err := s.deadLetterRepository.Delete(r.Context(), appId, deadLetterId)
+	if err != nil {
+		s.logger.Error("error deleting dead letter", "error", err, "appId", appId)
+		http.Error(w, "error deleting dead letter", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+const scheduledMessagesLimit = 100
+
+type scheduledMessageResponse struct {
+	ID        string          `json:"id"`
+	Topic     string          `json:"topic"`
+	Event     string          `json:"event"`
+	Payload   json.RawMessage `json:"payload"`
+	TTL       int             `json:"ttl"`
+	DeliverAt time.Time       `json:"deliverAt"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+func (s *server) handleApiGetScheduled(w http.ResponseWriter, r *http.Request) {
+	_, appId := ApiKeyFromContext(r.Context())
+	messages, err := s.scheduledMessageRepository.GetByAppID(r.Context(), appId, scheduledMessagesLimit)
+	if err != nil {
+		s.logger.Error("error getting scheduled messages", "error", err, "appId", appId)
+		http.Error(w, "error getting scheduled messages", http.StatusInternalServerError)
+		return
+	}
+	response := make([]scheduledMessageResponse, 0, len(messages))
+	for _, m := range messages {
+		response = append(response, scheduledMessageResponse{
+			ID:        m.ID,
+			Topic:     m.Topic,
+			Event:     m.Event,
+			Payload:   m.Payload,
+			TTL:       m.TTLSeconds,
+			DeliverAt: m.DeliverAt,
+			CreatedAt: m.CreatedAt,
+		})
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
+// handleApiCancelScheduled cancels a scheduled message. It responds with 404 if the message has already been delivered.
+func (s *server) handleApiCancelScheduled(w http.ResponseWriter, r *http.Request) {
+	_, appId := ApiKeyFromContext(r.Context())
+	scheduledId := chi.URLParam(r, "scheduled-id")
+	err := s.scheduledMessageRepository.Delete(r.Context(), appId, scheduledId)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			http.Error(w, "scheduled message not found", http.StatusNotFound)
+			return
+		}
+		s.logger.Error("error cancelling scheduled message", "error", err, "appId", appId)
+		http.Error(w, "error cancelling scheduled message", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type topicFilterResponse struct {
+	ClientID  string `json:"clientId"`
+	UserID    string `json:"userId"`
+	Transport string `json:"transport"`
+	filterStats
+}
+
+// handleApiGetTopicFilters returns the filters of clients connected to the topic on this instance, with evaluation metrics
+func (s *server) handleApiGetTopicFilters(w http.ResponseWriter, r *http.Request) {
+	_, appId := ApiKeyFromContext(r.Context())
+	topic := s.wsTopicCollection.getTopic(appId, topicParam(r))
+	response := make([]topicFilterResponse, 0)
+	if topic != nil {
+		topic.RLock()
+		for _, client := range topic.Clients {
+			if client.Filter == nil {
+				continue
+			}
+			response = append(response, topicFilterResponse{
+				ClientID:    string(client.ID),
+				UserID:      client.userId(),
+				Transport:   client.Transport,
+				filterStats: client.Filter.stats(),
+			})
+		}
+		topic.RUnlock()
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apiRequest sends body to the path of the test server, authenticated with the api key secret
+func apiRequest(t *testing.T, ts *httptest.Server, secret string, method string, path string, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", secret)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestBroadcastInputPayloadKey(t *testing.T) {
+	for _, body := range []string{`{"payload":{"a":1}}`, `{"Payload":{"a":1}}`} {
+		input := broadcastInput{}
+		if err := json.Unmarshal([]byte(body), &input); err != nil {
+			t.Fatal(err)
+		}
+		if input.Payload["a"] != float64(1) {
+			t.Errorf("payload of %s is %v, want map[a:1]", body, input.Payload)
+		}
+	}
+}
+
+func TestBatchBroadcast(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, _, secret := newTestApp(t, s, nil)
+	messageChan := subscribeTopic(t, s, app, "news")
+
+	body := `{"items":[
+		{"topic":"","payload":{}},
+		{"topic":"empty","payload":{}},
+		{"topic":"news","event":"published","payload":{"id":1}}
+	]}`
+	resp := apiRequest(t, ts, secret, http.MethodPost, "/api/app/"+app.ID+"/broadcast", body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %v, want %v", resp.StatusCode, http.StatusOK)
+	}
+	response := batchBroadcastResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	want := []batchBroadcastResult{
+		{Topic: "", Error: "empty topic"},
+		{Topic: "empty", Error: errTopicNotFound.Error()},
+		{Topic: "news", Delivered: true},
+	}
+	if !slices.Equal(response.Results, want) {
+		t.Errorf("got results %+v, want %+v", response.Results, want)
+	}
+	select {
+	case msg := <-messageChan:
+		if msg.Event != "published" {
+			t.Errorf("got event %v, want published", msg.Event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber did not get the message")
+	}
+}
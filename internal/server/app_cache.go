@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// Cached values are per instance, edits on other instances take effect within appCacheTTL
+	appCacheTTL         = 10 * time.Second
+	appCacheLoadTimeout = 5 * time.Second
+)
+
+type appCacheEntry[T any] struct {
+	value      T
+	loadedAt   time.Time
+	refreshing bool
+}
+
+// appCache caches a value derived from the app's settings, so the publish path does not have to
+// query the database for every message. Only the first get of an app waits for the value to load,
+// after that stale values are returned while they are refreshed in the background.
+type appCache[T any] struct {
+	name    string
+	logger  *slog.Logger
+	load    func(ctx context.Context, appId string) (T, error)
+	entries map[string]*appCacheEntry[T]
+	*sync.Mutex
+}
+
+func newAppCache[T any](name string, logger *slog.Logger, load func(ctx context.Context, appId string) (T, error)) *appCache[T] {
+	return &appCache[T]{
+		name:    name,
+		logger:  logger,
+		load:    load,
+		entries: make(map[string]*appCacheEntry[T]),
+		Mutex:   &sync.Mutex{},
+	}
+}
+
+func (c *appCache[T]) get(appId string) (T, error) {
+	c.Lock()
+	entry, ok := c.entries[appId]
+	if ok {
+		if time.Since(entry.loadedAt) >= appCacheTTL && !entry.refreshing {
+			entry.refreshing = true
+			go c.refresh(appId, entry)
+		}
+		c.Unlock()
+		return entry.value, nil
+	}
+	c.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), appCacheLoadTimeout)
+	defer cancel()
+	value, err := c.load(ctx, appId)
+	if err != nil {
+		return value, err
+	}
+	c.Lock()
+	c.entries[appId] = &appCacheEntry[T]{value: value, loadedAt: time.Now()}
+	c.Unlock()
+	return value, nil
+}
+
+// refresh replaces the stale entry, unless it has been invalidated meanwhile
+func (c *appCache[T]) refresh(appId string, stale *appCacheEntry[T]) {
+	ctx, cancel := context.WithTimeout(context.Background(), appCacheLoadTimeout)
+	defer cancel()
+	value, err := c.load(ctx, appId)
+	c.Lock()
+	defer c.Unlock()
+	if err != nil {
+		// The stale value is kept, and the refresh is tried again on the next get
+		c.logger.Error("failed to refresh app cache", "error", err, "cache", c.name, "appId", appId)
+		stale.refreshing = false
+		return
+	}
+	if c.entries[appId] == stale {
+		c.entries[appId] = &appCacheEntry[T]{value: value, loadedAt: time.Now()}
+	}
+}
+
+func (c *appCache[T]) invalidate(appId string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.entries, appId)
+}
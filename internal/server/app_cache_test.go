@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAppCacheRefreshesInBackground(t *testing.T) {
+	var loads atomic.Int32
+	loaded := make(chan struct{}, 10)
+	cache := newAppCache("test", slog.New(slog.NewTextHandler(io.Discard, nil)), func(ctx context.Context, appId string) (int32, error) {
+		defer func() { loaded <- struct{}{} }()
+		return loads.Add(1), nil
+	})
+
+	if value, _ := cache.get("app"); value != 1 {
+		t.Fatalf("got %v on first get, want 1", value)
+	}
+	<-loaded
+	if value, _ := cache.get("app"); value != 1 || loads.Load() != 1 {
+		t.Fatalf("got %v after %v loads, want the cached value", value, loads.Load())
+	}
+
+	cache.Lock()
+	cache.entries["app"].loadedAt = time.Now().Add(-appCacheTTL)
+	cache.Unlock()
+	if value, _ := cache.get("app"); value != 1 {
+		t.Errorf("got %v while stale, want the stale value", value)
+	}
+	select {
+	case <-loaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stale value was not refreshed")
+	}
+	// The refresh stores its value after load returns
+	deadline := time.Now().Add(5 * time.Second)
+	for value, _ := cache.get("app"); value != 2; value, _ = cache.get("app") {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %v after refresh, want 2", value)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cache.invalidate("app")
+	if value, _ := cache.get("app"); value != 3 {
+		t.Errorf("got %v after invalidate, want a new load", value)
+	}
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/bjarke-xyz/ws-gateway/internal/server/html"
+	"github.com/google/uuid"
+)
+
+const (
+	auditTargetUser         = "user"
+	auditTargetApp          = "app"
+	auditTargetKey          = "key"
+	auditTargetRoutingRule  = "routing_rule"
+	auditTargetAccessToken  = "access_token"
+	auditTargetOrganization = "organization"
+	auditTargetMember       = "member"
+	auditTargetTopic        = "topic"
+)
+
+const auditPageLimit = 200
+
+// audit writes the event to the audit log, with before and after as snapshots of the target. A nil snapshot means the target did not exist.
+// The actor is the signed in user, unless set on the event. Failing to write the event is logged, the action has already happened.
+func (s *server) audit(r *http.Request, event domain.AuditEvent, before any, after any) {
+	event.ID = uuid.NewString()
+	if event.ActorUserID == "" && event.ActorEmail == "" {
+		if token, _, _ := TokenFromContext(r.Context()); token != nil {
+			event.ActorUserID = token.Subject
+			event.ActorEmail = tokenEmail(token)
+		}
+	}
+	event.IP = clientIP(r)
+	event.UserAgent = r.UserAgent()
+	var err error
+	event.Before, err = auditSnapshot(before)
+	if err == nil {
+		event.After, err = auditSnapshot(after)
+	}
+	if err == nil {
+		err = s.auditEventRepository.Create(r.Context(), &event)
+	}
+	if err != nil {
+		s.logger.Error("failed to write audit event", "error", err, "action", event.Action, "targetId", event.TargetID)
+	}
+}
+
+func auditSnapshot(value any) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return json.Marshal(value)
+}
+
+// clientIP prefers the header set by the fly.io proxy, which clients cannot spoof
+func clientIP(r *http.Request) string {
+	if ip := r.Header.Get("Fly-Client-IP"); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// auditApp is an app in the audit log. Secrets are replaced by a fingerprint, so changing them shows up without logging them.
+type auditApp struct {
+	appResponse
+	WebhookSecret string `json:"webhookSecret"`
+}
+
+func newAuditApp(app domain.Application) auditApp {
+	return auditApp{
+		appResponse:   newAppResponse(app),
+		WebhookSecret: secretFingerprint(app.WebhookSecret),
+	}
+}
+
+func secretFingerprint(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:])[0:8]
+}
+
+// newAuditKey truncates the preview, which holds the whole secret until the key is fetched the first time
+func newAuditKey(key domain.ApiKey) keyResponse {
+	if len(key.KeyPreview) > 4 {
+		key.KeyPreview = key.KeyPreview[0:4]
+	}
+	return newKeyResponse(key)
+}
+
+type auditRoutingRule struct {
+	ID          string `json:"id"`
+	AppID       string `json:"appId"`
+	SourceTopic string `json:"sourceTopic"`
+	Condition   string `json:"condition"`
+	TargetTopic string `json:"targetTopic"`
+	Transform   string `json:"transform"`
+}
+
+func newAuditRoutingRule(rule domain.RoutingRule) auditRoutingRule {
+	return auditRoutingRule{
+		ID:          rule.ID,
+		AppID:       rule.AppID,
+		SourceTopic: rule.SourceTopic,
+		Condition:   rule.Condition,
+		TargetTopic: rule.TargetTopic,
+		Transform:   rule.Transform,
+	}
+}
+
+type auditAccessToken struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	TokenPreview string `json:"tokenPreview"`
+}
+
+func newAuditAccessToken(token domain.AccessToken) auditAccessToken {
+	if len(token.TokenPreview) > accessTokenPreviewLength {
+		token.TokenPreview = token.TokenPreview[0:accessTokenPreviewLength]
+	}
+	return auditAccessToken{ID: token.ID, Name: token.Name, TokenPreview: token.TokenPreview}
+}
+
+type auditOrganization struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func newAuditOrganization(org domain.Organization) auditOrganization {
+	return auditOrganization{ID: org.ID, Name: org.Name}
+}
+
+type auditMember struct {
+	UserID string      `json:"userId"`
+	Email  string      `json:"email"`
+	Role   domain.Role `json:"role"`
+}
+
+type auditEventResponse struct {
+	ID             string          `json:"id"`
+	ActorUserID    string          `json:"actorUserId"`
+	ActorEmail     string          `json:"actorEmail"`
+	OrganizationID string          `json:"organizationId"`
+	Action         string          `json:"action"`
+	TargetType     string          `json:"targetType"`
+	TargetID       string          `json:"targetId"`
+	Before         json.RawMessage `json:"before"`
+	After          json.RawMessage `json:"after"`
+	IP             string          `json:"ip"`
+	UserAgent      string          `json:"userAgent"`
+	CreatedAt      time.Time       `json:"createdAt"`
+}
+
+func newAuditEventResponse(e domain.AuditEvent) auditEventResponse {
+	return auditEventResponse{
+		ID:             e.ID,
+		ActorUserID:    e.ActorUserID,
+		ActorEmail:     e.ActorEmail,
+		OrganizationID: e.OrganizationID,
+		Action:         e.Action,
+		TargetType:     e.TargetType,
+		TargetID:       e.TargetID,
+		Before:         nullIfEmpty(e.Before),
+		After:          nullIfEmpty(e.After),
+		IP:             e.IP,
+		UserAgent:      e.UserAgent,
+		CreatedAt:      e.CreatedAt,
+	}
+}
+
+func nullIfEmpty(value json.RawMessage) json.RawMessage {
+	if len(value) == 0 {
+		return json.RawMessage("null")
+	}
+	return value
+}
+
+// auditFilterFromRequest reads the filter from the query. Users see the events of the organizations they manage members of, and their own events.
+// An org query parameter limits the events to that organization. On failure the error is written to w and false is returned.
+func (s *server) auditFilterFromRequest(w http.ResponseWriter, r *http.Request) (domain.AuditEventFilter, []domain.Organization, bool) {
+	token, _, _ := TokenFromContext(r.Context())
+	query := r.URL.Query()
+	filter := domain.AuditEventFilter{
+		Actor:    strings.TrimSpace(query.Get("actor")),
+		Action:   query.Get("action"),
+		TargetID: strings.TrimSpace(query.Get("target")),
+	}
+	if filter.Action != "" && !slices.Contains(domain.AuditActions, filter.Action) {
+		http.Error(w, fmt.Sprintf("unknown action %v", filter.Action), http.StatusBadRequest)
+		return filter, nil, false
+	}
+	var err error
+	if from := query.Get("from"); from != "" {
+		filter.From, err = time.Parse(time.DateOnly, from)
+		if err != nil {
+			http.Error(w, "from must be a date like 2006-01-02", http.StatusBadRequest)
+			return filter, nil, false
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		filter.To, err = time.Parse(time.DateOnly, to)
+		if err != nil {
+			http.Error(w, "to must be a date like 2006-01-02", http.StatusBadRequest)
+			return filter, nil, false
+		}
+		// to is inclusive
+		filter.To = filter.To.Add(24 * time.Hour)
+	}
+
+	orgs, roles, err := s.organizationsForUser(r.Context(), token)
+	if err != nil {
+		s.logger.Error("error getting organizations by user id", "error", err, "userId", token.Subject)
+		http.Error(w, "error getting organizations", http.StatusInternalServerError)
+		return filter, nil, false
+	}
+	managed := make([]domain.Organization, 0, len(orgs))
+	for _, org := range orgs {
+		if roles[org.ID].Can(domain.PermissionManageMembers) {
+			managed = append(managed, org)
+		}
+	}
+	if orgId := query.Get("org"); orgId != "" {
+		if !slices.Contains(organizationIDs(managed), orgId) {
+			w.WriteHeader(http.StatusForbidden)
+			return filter, nil, false
+		}
+		filter.OrganizationIDs = []string{orgId}
+	} else {
+		filter.OrganizationIDs = organizationIDs(managed)
+		filter.UserID = token.Subject
+	}
+	return filter, managed, true
+}
+
+func (s *server) handleGetAudit(w http.ResponseWriter, r *http.Request) {
+	filter, orgs, ok := s.auditFilterFromRequest(w, r)
+	if !ok {
+		return
+	}
+	filter.Limit = auditPageLimit
+	errMsgs := make([]string, 0)
+	events, err := s.auditEventRepository.Get(r.Context(), filter)
+	if err != nil {
+		s.logger.Error("error getting audit events", "error", err)
+		errMsgs = append(errMsgs, "Error getting audit events")
+	}
+	html.AuditPage(w, html.AuditParams{
+		Title:         "Audit log",
+		Errors:        errMsgs,
+		Events:        events,
+		Limit:         auditPageLimit,
+		Organizations: orgs,
+		Actions:       domain.AuditActions,
+		Query:         r.URL.Query(),
+	})
+}
+
+// handleGetAuditExport writes every event matching the filter as JSON lines
+func (s *server) handleGetAuditExport(w http.ResponseWriter, r *http.Request) {
+	filter, _, ok := s.auditFilterFromRequest(w, r)
+	if !ok {
+		return
+	}
+	events, err := s.auditEventRepository.Get(r.Context(), filter)
+	if err != nil {
+		s.logger.Error("error getting audit events", "error", err)
+		http.Error(w, "error getting audit events", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"audit-%v.jsonl\"", time.Now().UTC().Format(time.DateOnly)))
+	encoder := json.NewEncoder(w)
+	for _, event := range events {
+		err = encoder.Encode(newAuditEventResponse(event))
+		if err != nil {
+			s.logger.Error("failed to write audit event", "error", err)
+			return
+		}
+	}
+}
@@ -2,15 +2,19 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"slices"
+	"strings"
 	"time"
 
 	"firebase.google.com/go/v4/auth"
 	"github.com/bjarke-xyz/ws-gateway/internal/domain"
 	"github.com/go-chi/chi/v5"
 	"github.com/samber/lo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -54,6 +58,7 @@ func (s *server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if resp.Error != nil {
+		s.audit(r, domain.AuditEvent{Action: domain.AuditActionLoginFailed, ActorEmail: email, TargetType: auditTargetUser}, nil, nil)
 		http.Redirect(w, r, fmt.Sprintf("/login?error=%v", resp.Error.Error()), http.StatusSeeOther)
 		return
 	}
@@ -71,11 +76,14 @@ func (s *server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !hasProduct(token, "ws-gateway") {
+		s.audit(r, domain.AuditEvent{Action: domain.AuditActionLoginFailed, ActorUserID: token.UID, ActorEmail: email, TargetType: auditTargetUser, TargetID: token.UID}, nil, nil)
 		s.logger.Error("'ws-gateway' not found in products claim", "where", "handleLogin")
 		http.Redirect(w, r, "/login?"+errorQuery("'ws-gateway' not found in products claim"), http.StatusSeeOther)
 		return
 	}
 
+	s.audit(r, domain.AuditEvent{Action: domain.AuditActionLogin, ActorUserID: token.UID, ActorEmail: email, TargetType: auditTargetUser, TargetID: token.UID}, nil, nil)
+
 	// 5 days
 	cookieExpires := time.Now().Add(5 * 24 * time.Hour)
 
@@ -100,16 +108,19 @@ func (s *server) firebaseJwtVerifier(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		idTokenCookie, ok := lo.Find(r.Cookies(), func(c *http.Cookie) bool { return c.Name == idTokenCookieKey })
 		if !ok {
+			countAuthFailure(authMethodSession, "missing")
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 		refreshTokenCookie, ok := lo.Find(r.Cookies(), func(c *http.Cookie) bool { return c.Name == refreshTokenCookieKey })
 		if !ok {
+			countAuthFailure(authMethodSession, "missing")
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
 		if len(idTokenCookie.Value) == 0 || len(refreshTokenCookie.Value) == 0 {
+			countAuthFailure(authMethodSession, "missing")
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
@@ -124,10 +135,12 @@ func (s *server) firebaseJwtVerifier(next http.Handler) http.Handler {
 
 		token, err := auth.VerifyIDToken(ctx, idTokenCookie.Value)
 		if err != nil {
+			countAuthFailure(authMethodSession, "invalid")
 			http.Redirect(w, r, "/login?"+errorQuery(err.Error()), http.StatusSeeOther)
 			return
 		}
 		if !hasProduct(token, "ws-gateway") {
+			countAuthFailure(authMethodSession, "missing_product")
 			s.logger.Error("'ws-gateway' not found in products claim", "where", "firebaseJwtVerifier")
 			http.Redirect(w, r, "/login?"+errorQuery("'ws-gateway' not found in products claim"), http.StatusSeeOther)
 			return
@@ -137,6 +150,32 @@ func (s *server) firebaseJwtVerifier(next http.Handler) http.Handler {
 	})
 }
 
+// accessTokenVerifier authenticates the management api with a personal access token, sent as a bearer token
+func (s *server) accessTokenVerifier(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || secret == "" {
+			countAuthFailure(authMethodAccessToken, "missing")
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
+		ctx := r.Context()
+		accessToken, err := s.verifyAccessToken(ctx, secret)
+		if err != nil {
+			if errors.Is(err, errInvalidAccessToken) {
+				countAuthFailure(authMethodAccessToken, "invalid")
+				http.Error(w, "invalid access token", http.StatusUnauthorized)
+				return
+			}
+			s.logger.Error("error getting access token from db", "error", err)
+			http.Error(w, "error getting access token from db", http.StatusInternalServerError)
+			return
+		}
+		ctx = NewContext(ctx, accessTokenAuthToken(*accessToken), "", nil)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func hasProduct(token *auth.Token, product any) bool {
 	products, ok := (token.Claims["products"]).([]any)
 	return ok && slices.Contains(products, product)
@@ -165,6 +204,7 @@ func (s *server) apiKeyVerifier(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authorizationHeader := r.Header.Get("Authorization")
 		if authorizationHeader == "" {
+			countAuthFailure(authMethodApiKey, "missing")
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
@@ -174,33 +214,44 @@ func (s *server) apiKeyVerifier(next http.Handler) http.Handler {
 			http.Error(w, "no app-id specified", http.StatusBadRequest)
 			return
 		}
-		ctx := r.Context()
-
-		apiKeys, err := s.keyRepository.GetByAppID(ctx, appId)
+		ctx, span := tracer.Start(r.Context(), "apiKeyVerifier", trace.WithAttributes(attribute.String("app.id", appId)))
+		apiKey, err := s.verifyApiKey(ctx, appId, authorizationHeader)
+		endSpan(span, err)
 		if err != nil {
+			if errors.Is(err, errInvalidApiKey) {
+				countAuthFailure(authMethodApiKey, "invalid")
+				http.Error(w, "invalid api key", http.StatusUnauthorized)
+				return
+			}
 			s.logger.Error("error getting api keys from db", "error", err, "appId", appId)
 			http.Error(w, "error getting api keys from db", http.StatusInternalServerError)
 			return
 		}
 
-		var apiKey *domain.ApiKey = nil
-		for _, v := range apiKeys {
-			err = bcrypt.CompareHashAndPassword([]byte(v.KeyHash), []byte(authorizationHeader))
-			if err == nil {
-				apiKey = &v
-				break
-			}
-		}
-
-		if apiKey == nil {
-			http.Error(w, "invalid api key", http.StatusUnauthorized)
-			return
-		}
-
 		ctx = NewApiKeyContext(ctx, *apiKey, appId)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+var errInvalidApiKey = errors.New("invalid api key")
+
+// verifyApiKey returns the api key matching key, if it gives access to appId
+func (s *server) verifyApiKey(ctx context.Context, appId string, key string) (*domain.ApiKey, error) {
+	apiKeys, err := s.keyRepository.GetByAppID(ctx, appId)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range apiKeys {
+		start := time.Now()
+		err = bcrypt.CompareHashAndPassword([]byte(v.KeyHash), []byte(key))
+		observeBcrypt(authMethodApiKey, start)
+		if err == nil {
+			return &v, nil
+		}
+	}
+	return nil, errInvalidApiKey
+}
+
 func NewApiKeyContext(ctx context.Context, apiKey domain.ApiKey, appId string) context.Context {
 	ctx = context.WithValue(ctx, ApiKeyCtxCkey, apiKey)
 	ctx = context.WithValue(ctx, ApiAppIdCtxKey, appId)
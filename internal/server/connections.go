@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/bjarke-xyz/ws-gateway/internal/server/html"
+)
+
+// The connections dashboard shows the topics and clients of an app on this instance, refreshed over SSE
+
+const connectionsRefreshInterval = 2 * time.Second
+
+type connectionsSnapshot struct {
+	Topics  []topicSnapshot `json:"topics"`
+	Clients int             `json:"clients"`
+	TakenAt time.Time       `json:"takenAt"`
+}
+
+type topicSnapshot struct {
+	Topic     string    `json:"topic"`
+	Sequenced bool      `json:"sequenced"`
+	Reliable  bool      `json:"reliable"`
+	CreatedAt time.Time `json:"createdAt"`
+	Delivered int64     `json:"delivered"`
+	// MessageRate is messages per second since the previous snapshot
+	MessageRate float64          `json:"messageRate"`
+	Clients     []clientSnapshot `json:"clients"`
+}
+
+type clientSnapshot struct {
+	ID          ClientID  `json:"id"`
+	UserID      string    `json:"userId"`
+	Transport   string    `json:"transport"`
+	Filter      string    `json:"filter"`
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+// appTopics returns the topics of the app
+func (tc *WsTopicCollection) appTopics(appId string) []*WsTopic {
+	tc.RLock()
+	defer tc.RUnlock()
+	topics := make([]*WsTopic, 0)
+	for _, tp := range tc.Topics {
+		if tp.AppID == appId {
+			topics = append(topics, tp)
+		}
+	}
+	return topics
+}
+
+func (tp *WsTopic) snapshot() topicSnapshot {
+	tp.RLock()
+	defer tp.RUnlock()
+	snapshot := topicSnapshot{
+		Topic:     tp.Topic,
+		Sequenced: tp.Sequenced,
+		Reliable:  tp.Reliability != nil,
+		CreatedAt: tp.CreatedAt,
+		Delivered: tp.delivered.Load(),
+		Clients:   make([]clientSnapshot, 0, len(tp.Clients)),
+	}
+	for _, client := range tp.Clients {
+		filter := ""
+		if client.Filter != nil {
+			filter = client.Filter.Expression
+		}
+		snapshot.Clients = append(snapshot.Clients, clientSnapshot{
+			ID:          client.ID,
+			UserID:      client.userId(),
+			Transport:   client.Transport,
+			Filter:      filter,
+			ConnectedAt: client.ConnectedAt,
+		})
+	}
+	slices.SortFunc(snapshot.Clients, func(a, b clientSnapshot) int {
+		return a.ConnectedAt.Compare(b.ConnectedAt)
+	})
+	return snapshot
+}
+
+// snapshotConnections returns the topics of the app. Message rates are computed from the delivered counts of the previous snapshot,
+// or over the lifetime of the topic for topics not in it.
+func (s *server) snapshotConnections(appId string, previous *connectionsSnapshot) connectionsSnapshot {
+	now := time.Now()
+	previousDelivered := make(map[string]int64)
+	if previous != nil {
+		for _, topic := range previous.Topics {
+			previousDelivered[topic.Topic] = topic.Delivered
+		}
+	}
+	snapshot := connectionsSnapshot{
+		Topics:  make([]topicSnapshot, 0),
+		TakenAt: now,
+	}
+	for _, tp := range s.wsTopicCollection.appTopics(appId) {
+		topic := tp.snapshot()
+		delivered, ok := previousDelivered[topic.Topic]
+		since := topic.CreatedAt
+		if ok {
+			since = previous.TakenAt
+		}
+		if elapsed := now.Sub(since).Seconds(); elapsed > 0 {
+			topic.MessageRate = float64(topic.Delivered-delivered) / elapsed
+		}
+		snapshot.Clients += len(topic.Clients)
+		snapshot.Topics = append(snapshot.Topics, topic)
+	}
+	slices.SortFunc(snapshot.Topics, func(a, b topicSnapshot) int {
+		return strings.Compare(a.Topic, b.Topic)
+	})
+	return snapshot
+}
+
+func (s *server) handleGetConnections(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.appForAdmin(w, r, domain.PermissionView)
+	if !ok {
+		return
+	}
+	html.ConnectionsPage(w, html.ConnectionsParams{
+		Title: "Connections",
+		App:   app,
+		User:  r.URL.Query().Get("user"),
+	})
+}
+
+// handleGetConnectionsStream sends a snapshot of the connections as an SSE event every connectionsRefreshInterval
+func (s *server) handleGetConnectionsStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	app, ok := s.appForAdmin(w, r, domain.PermissionView)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(connectionsRefreshInterval)
+	defer ticker.Stop()
+	var previous *connectionsSnapshot
+	for {
+		snapshot := s.snapshotConnections(app.ID, previous)
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			s.logger.Error("failed to encode connections snapshot", "error", err, "appId", app.ID)
+			return
+		}
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+		previous = &snapshot
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
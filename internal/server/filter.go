@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// Subscriber filters. A client can attach a CEL expression when subscribing, and the broker only
+// forwards messages for which it evaluates to true. The expression can use the variables event,
+// the event name, and payload, the decoded JSON payload. For example:
+//
+//	event == "order.created" && payload.amount > 100
+//
+// Messages are skipped if evaluation fails, e.g. on a missing payload field. Use has(payload.field)
+// to test for optional fields. Filters run in the broker of the topic, so evaluation is limited by
+// maxFilterCost and maxFilterEvalDuration, and a filter that exceeds them skips the message.
+
+const (
+	filterQueryParam = "filter"
+	maxFilterLength  = 1024
+	// maxFilterCost is the cel runtime cost a filter can use per message, which is roughly the number
+	// of operations, counting operations on strings and lists by their size
+	maxFilterCost = 10000
+	// maxFilterEvalDuration interrupts comprehensions, checked every filterInterruptCheckFrequency iterations
+	maxFilterEvalDuration         = 10 * time.Millisecond
+	filterInterruptCheckFrequency = 100
+)
+
+var filterEnv = func() *cel.Env {
+	env, err := cel.NewEnv(
+		cel.Variable("event", cel.StringType),
+		cel.Variable("payload", cel.DynType),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return env
+}()
+
+type messageFilter struct {
+	Expression string
+	program    cel.Program
+
+	evaluated    atomic.Int64
+	matched      atomic.Int64
+	failed       atomic.Int64
+	evalDuration atomic.Int64
+}
+
+// compileFilter returns nil if expression is empty. The error is meant to be shown to the client.
+func compileFilter(expression string) (*messageFilter, error) {
+	if expression == "" {
+		return nil, nil
+	}
+	if len(expression) > maxFilterLength {
+		return nil, fmt.Errorf("filter is longer than %d characters", maxFilterLength)
+	}
+	ast, issues := filterEnv.Compile(expression)
+	if issues.Err() != nil {
+		return nil, fmt.Errorf("invalid filter: %w", issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("invalid filter: must evaluate to bool, not %v", ast.OutputType())
+	}
+	program, err := newFilterProgram(ast)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	return &messageFilter{Expression: expression, program: program}, nil
+}
+
+// newFilterProgram plans an expression of filterEnv with the limits of filters. Evaluate it with evalFilterProgram.
+func newFilterProgram(ast *cel.Ast) (cel.Program, error) {
+	return filterEnv.Program(ast,
+		cel.EvalOptions(cel.OptOptimize),
+		cel.CostLimit(maxFilterCost),
+		cel.InterruptCheckFrequency(filterInterruptCheckFrequency),
+	)
+}
+
+func evalFilterProgram(program cel.Program, vars map[string]any) (ref.Val, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), maxFilterEvalDuration)
+	defer cancel()
+	out, _, err := program.ContextEval(ctx, vars)
+	return out, err
+}
+
+// filterInput decodes the payload of a message once, for all filters on the topic
+type filterInput struct {
+	msg  *WsMessage
+	vars map[string]any
+}
+
+func (in *filterInput) get() map[string]any {
+	if in.vars == nil {
+		var payload any
+		// A payload that is not JSON is passed as a string
+		if err := json.Unmarshal(in.msg.Payload, &payload); err != nil {
+			payload = string(in.msg.Payload)
+		}
+		in.vars = map[string]any{
+			"event":   in.msg.Event,
+			"payload": payload,
+		}
+	}
+	return in.vars
+}
+
+// matches reports whether the message should be sent to the subscriber. A nil filter matches everything.
+func (f *messageFilter) matches(in *filterInput) bool {
+	if f == nil {
+		return true
+	}
+	start := time.Now()
+	out, err := evalFilterProgram(f.program, in.get())
+	f.evalDuration.Add(int64(time.Since(start)))
+	f.evaluated.Add(1)
+	if err != nil {
+		f.failed.Add(1)
+		return false
+	}
+	match, ok := out.Value().(bool)
+	if !ok {
+		f.failed.Add(1)
+		return false
+	}
+	if match {
+		f.matched.Add(1)
+	}
+	return match
+}
+
+type filterStats struct {
+	Expression string `json:"expression"`
+	Evaluated  int64  `json:"evaluated"`
+	Matched    int64  `json:"matched"`
+	Failed     int64  `json:"failed"`
+	// AvgEvalMicros is the average evaluation time in microseconds
+	AvgEvalMicros float64 `json:"avgEvalMicros"`
+}
+
+func (f *messageFilter) stats() filterStats {
+	stats := filterStats{
+		Expression: f.Expression,
+		Evaluated:  f.evaluated.Load(),
+		Matched:    f.matched.Load(),
+		Failed:     f.failed.Load(),
+	}
+	if stats.Evaluated > 0 {
+		stats.AvgEvalMicros = float64(f.evalDuration.Load()) / float64(stats.Evaluated) / float64(time.Microsecond)
+	}
+	return stats
+}
+
+// filterFromRequest compiles the filter query parameter. On failure the error is written to w and false is returned.
+func filterFromRequest(w http.ResponseWriter, r *http.Request) (*messageFilter, bool) {
+	filter, err := compileFilter(r.URL.Query().Get(filterQueryParam))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return filter, true
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCompileFilter(t *testing.T) {
+	tests := []struct {
+		expression string
+		wantErr    string
+	}{
+		{"", ""},
+		{`event == "order.created"`, ""},
+		{`payload.amount > 100`, ""},
+		{`event ==`, "invalid filter"},
+		{`event`, "must evaluate to bool"},
+		{`unknown == 1`, "invalid filter"},
+		{strings.Repeat(" ", maxFilterLength) + "true", "longer than"},
+	}
+	for _, tt := range tests {
+		filter, err := compileFilter(tt.expression)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%q: got error %v", tt.expression, err)
+			}
+			if (filter == nil) != (tt.expression == "") {
+				t.Errorf("%q: got filter %v", tt.expression, filter)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%q: got error %v, want %q", tt.expression, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	items := make([]int, 1000)
+	manyItems, _ := json.Marshal(map[string]any{"items": items})
+	tests := []struct {
+		expression string
+		event      string
+		payload    string
+		want       bool
+	}{
+		{"", "any", `{}`, true},
+		{`event == "order.created"`, "order.created", `{}`, true},
+		{`event == "order.created"`, "order.deleted", `{}`, false},
+		{`payload.amount > 100`, "", `{"amount": 150}`, true},
+		{`payload.amount > 100`, "", `{"amount": 50}`, false},
+		// A missing field fails evaluation, which skips the message
+		{`payload.amount > 100`, "", `{}`, false},
+		{`has(payload.amount) && payload.amount > 100`, "", `{}`, false},
+		{`payload == "plain text"`, "", `plain text`, true},
+		{`payload.items.exists(x, x == 0)`, "", string(manyItems), true},
+		// Exceeds maxFilterCost, so it is stopped instead of holding up the broker
+		{`payload.items.all(x, payload.items.all(y, x == y))`, "", string(manyItems), false},
+	}
+	for _, tt := range tests {
+		filter, err := compileFilter(tt.expression)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.expression, err)
+		}
+		msg := &WsMessage{Event: tt.event, Payload: json.RawMessage(tt.payload)}
+		if got := filter.matches(&filterInput{msg: msg}); got != tt.want {
+			t.Errorf("%q on %v %s: got %v, want %v", tt.expression, tt.event, tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestFilterStats(t *testing.T) {
+	filter, err := compileFilter(`payload.amount > 100`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, payload := range []string{`{"amount": 150}`, `{"amount": 50}`, `{}`} {
+		filter.matches(&filterInput{msg: &WsMessage{Payload: json.RawMessage(payload)}})
+	}
+	stats := filter.stats()
+	if stats.Evaluated != 3 || stats.Matched != 1 || stats.Failed != 1 {
+		t.Errorf("got %+v, want 3 evaluated, 1 matched and 1 failed", stats)
+	}
+}
@@ -0,0 +1,343 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// GraphQL subscriptions over the graphql-transport-ws protocol, so Apollo and similar clients can
+// subscribe to topics. See https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+
+const (
+	graphqlSubprotocol         = "graphql-transport-ws"
+	graphqlInitTimeout         = 10 * time.Second
+	graphqlWriteTimeout        = 10 * time.Second
+	graphqlCloseUnauthorized   = 4401
+	graphqlCloseForbidden      = 4403
+	graphqlCloseInitTimeout    = 4408
+	graphqlCloseDuplicateSubId = 4409
+	graphqlCloseTooManyInits   = 4429
+	graphqlCloseBadRequest     = 4400
+)
+
+var graphqlSchema = gqlparser.MustLoadSchema(&ast.Source{
+	Name: "ws-gateway.graphql",
+	Input: `
+scalar JSON
+
+type Query {
+	_empty: Boolean
+}
+
+type Subscription {
+	"""
+	Messages broadcast to the topic, as objects with event and payload.
+	The topic must match the topic of the ticket used in connection_init.
+	The optional filter is a CEL expression on event and payload, only matching messages are sent.
+	"""
+	topic(name: String!, filter: String): JSON!
+}
+`,
+})
+
+func newGraphqlUpgrader(cfg config.WebsocketConfig) *websocket.Upgrader {
+	upgrader := newUpgrader(cfg)
+	upgrader.Subprotocols = []string{graphqlSubprotocol}
+	return upgrader
+}
+
+type graphqlMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type graphqlInitPayload struct {
+	Token string `json:"token"`
+}
+
+type graphqlSubscribePayload struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+type graphqlConn struct {
+	s      *server
+	conn   *websocket.Conn
+	ticket verifiedTicket
+	mu     sync.Mutex
+	// subscriptions is only accessed from the read loop
+	subscriptions map[string]*graphqlSubscription
+}
+
+type graphqlSubscription struct {
+	id          string
+	field       *ast.Field
+	client      *WsClient
+	messageChan chan *WsMessage
+	leave       func()
+	stop        chan struct{}
+	stopped     chan struct{}
+}
+
+func (s *server) graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	if !slices.Contains(websocket.Subprotocols(r), graphqlSubprotocol) {
+		countUpgradeFailure(transportGraphql, "missing_subprotocol")
+		http.Error(w, "subprotocol "+graphqlSubprotocol+" is required", http.StatusBadRequest)
+		return
+	}
+	conn, err := s.graphqlUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logger.Error("Error while upgrading graphql connection", "error", err)
+		countUpgradeFailure(transportGraphql, "upgrade")
+		return
+	}
+	defer conn.Close()
+	gc := &graphqlConn{
+		s:             s,
+		conn:          conn,
+		subscriptions: make(map[string]*graphqlSubscription),
+	}
+	defer gc.completeAll()
+
+	// connection_init must be the first message
+	conn.SetReadDeadline(time.Now().Add(graphqlInitTimeout))
+	msg, err := gc.read()
+	if errors.Is(err, errGraphqlInvalidMessage) {
+		countUpgradeFailure(transportGraphql, "invalid_message")
+		gc.close(graphqlCloseBadRequest, "Invalid message received")
+		return
+	}
+	if err != nil {
+		countUpgradeFailure(transportGraphql, "init_timeout")
+		gc.close(graphqlCloseInitTimeout, "Connection initialisation timeout")
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	if msg.Type != "connection_init" {
+		countUpgradeFailure(transportGraphql, "missing_init")
+		gc.close(graphqlCloseUnauthorized, "Unauthorized")
+		return
+	}
+	initPayload := graphqlInitPayload{}
+	_ = json.Unmarshal(msg.Payload, &initPayload)
+	ticket, ticketErr := s.verifyTicket(r.Context(), initPayload.Token, chi.URLParam(r, "app-id"))
+	if ticketErr != nil {
+		countUpgradeFailure(transportGraphql, ticketErr.reason)
+		gc.close(graphqlCloseForbidden, "Forbidden: "+ticketErr.msg)
+		return
+	}
+	gc.ticket = ticket
+	defer trackConnection(ticket.App.ID, transportGraphql)()
+	gc.write(graphqlMessage{Type: "connection_ack"})
+
+	for {
+		msg, err := gc.read()
+		if err != nil {
+			if errors.Is(err, errGraphqlInvalidMessage) {
+				gc.close(graphqlCloseBadRequest, "Invalid message received")
+			}
+			return
+		}
+		switch msg.Type {
+		case "connection_init":
+			gc.close(graphqlCloseTooManyInits, "Too many initialisation requests")
+			return
+		case "ping":
+			gc.write(graphqlMessage{Type: "pong"})
+		case "pong":
+		case "subscribe":
+			if _, ok := gc.subscriptions[msg.ID]; ok {
+				gc.close(graphqlCloseDuplicateSubId, fmt.Sprintf("Subscriber for %v already exists", msg.ID))
+				return
+			}
+			gc.subscribe(msg)
+		case "complete":
+			gc.complete(msg.ID)
+		default:
+			gc.close(graphqlCloseBadRequest, "Invalid message type "+msg.Type)
+			return
+		}
+	}
+}
+
+var errGraphqlInvalidMessage = errors.New("invalid graphql message")
+
+// read returns the next message. Messages that cannot be decoded return errGraphqlInvalidMessage.
+func (gc *graphqlConn) read() (graphqlMessage, error) {
+	msg := graphqlMessage{}
+	_, msgBytes, err := gc.conn.ReadMessage()
+	if err != nil {
+		return msg, err
+	}
+	// Only counted once authenticated, as the app is unknown before
+	if gc.ticket.App.ID != "" {
+		countReceived(gc.ticket.App.ID, transportGraphql, len(msgBytes))
+	}
+	err = json.Unmarshal(msgBytes, &msg)
+	if err != nil {
+		return msg, fmt.Errorf("%w: %w", errGraphqlInvalidMessage, err)
+	}
+	return msg, nil
+}
+
+func (gc *graphqlConn) write(msg graphqlMessage) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	frame, err := json.Marshal(msg)
+	if err != nil {
+		gc.s.logger.Error("failed to marshal graphql msg", "error", err)
+		return
+	}
+	gc.conn.SetWriteDeadline(time.Now().Add(graphqlWriteTimeout))
+	err = gc.conn.WriteMessage(websocket.TextMessage, frame)
+	if err != nil {
+		gc.s.logger.Error("failed to write graphql msg", "error", err)
+		return
+	}
+	countSent(gc.ticket.App.ID, transportGraphql, len(frame))
+}
+
+func (gc *graphqlConn) close(code int, reason string) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	_ = gc.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(graphqlWriteTimeout))
+}
+
+func (gc *graphqlConn) writeErrors(id string, errs ...*gqlerror.Error) {
+	payload, _ := json.Marshal(errs)
+	gc.write(graphqlMessage{ID: id, Type: "error", Payload: payload})
+}
+
+func (gc *graphqlConn) subscribe(msg graphqlMessage) {
+	payload := graphqlSubscribePayload{}
+	err := json.Unmarshal(msg.Payload, &payload)
+	if err != nil {
+		gc.writeErrors(msg.ID, gqlerror.Errorf("invalid subscribe payload: %v", err))
+		return
+	}
+	query, errs := gqlparser.LoadQuery(graphqlSchema, payload.Query)
+	if len(errs) > 0 {
+		gc.writeErrors(msg.ID, errs...)
+		return
+	}
+	op := query.Operations.ForName(payload.OperationName)
+	if op == nil {
+		gc.writeErrors(msg.ID, gqlerror.Errorf("operation %q not found", payload.OperationName))
+		return
+	}
+	if op.Operation != ast.Subscription {
+		gc.writeErrors(msg.ID, gqlerror.Errorf("only subscription operations are supported"))
+		return
+	}
+	if len(op.SelectionSet) != 1 {
+		gc.writeErrors(msg.ID, gqlerror.Errorf("subscriptions must select exactly one field"))
+		return
+	}
+	field, ok := op.SelectionSet[0].(*ast.Field)
+	if !ok || field.Name != "topic" {
+		gc.writeErrors(msg.ID, gqlerror.Errorf("subscriptions must select the topic field"))
+		return
+	}
+	args := field.ArgumentMap(payload.Variables)
+	topic, _ := args["name"].(string)
+	if topic != gc.ticket.Topic {
+		gc.writeErrors(msg.ID, gqlerror.Errorf("ticket does not give access to topic %q", topic))
+		return
+	}
+	filterExpr, _ := args["filter"].(string)
+	filter, err := compileFilter(filterExpr)
+	if err != nil {
+		gc.writeErrors(msg.ID, gqlerror.Errorf("%v", err))
+		return
+	}
+
+	client := &WsClient{
+		ID:        ClientID(uuid.NewString()),
+		Token:     gc.ticket.Token,
+		App:       gc.ticket.App,
+		Transport: transportGraphql,
+		Filter:    filter,
+	}
+	sub := &graphqlSubscription{
+		id:          msg.ID,
+		field:       field,
+		client:      client,
+		messageChan: make(chan *WsMessage),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	sub.leave = gc.s.joinTopic(client, topic)
+	client.Topic.Broker.subscribe(sub.messageChan, client.Filter)
+	gc.subscriptions[msg.ID] = sub
+	go gc.forward(sub)
+}
+
+// forward sends broadcasts on the topic as next messages until the subscription is completed
+func (gc *graphqlConn) forward(sub *graphqlSubscription) {
+	defer close(sub.stopped)
+	defer sub.client.Topic.Broker.unsubscribe(sub.messageChan)
+	for {
+		select {
+		case <-sub.stop:
+			return
+		case msg := <-sub.messageChan:
+			if msg.expired(time.Now()) {
+				// The client was too slow to receive it in time
+				countDropped(gc.ticket.App.ID, dropReasonExpired, 1)
+				continue
+			}
+			payload, err := json.Marshal(map[string]any{
+				"data": map[string]any{
+					sub.field.Alias: graphqlTopicMessage{Topic: msg.Topic, Event: msg.Event, Payload: msg.Payload},
+				},
+			})
+			if err != nil {
+				gc.s.logger.Error("failed to marshal graphql payload", "error", err)
+				continue
+			}
+			span := startMessageSpan(msg, "graphql.write", attribute.String("app.id", gc.ticket.App.ID), attribute.String("subscription.id", sub.id))
+			gc.write(graphqlMessage{ID: sub.id, Type: "next", Payload: payload})
+			span.End()
+		}
+	}
+}
+
+type graphqlTopicMessage struct {
+	Topic   string          `json:"topic,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// complete stops the subscription, without sending complete as the client initiated it
+func (gc *graphqlConn) complete(id string) {
+	sub, ok := gc.subscriptions[id]
+	if !ok {
+		return
+	}
+	delete(gc.subscriptions, id)
+	close(sub.stop)
+	<-sub.stopped
+	sub.leave()
+}
+
+func (gc *graphqlConn) completeAll() {
+	for id := range gc.subscriptions {
+		gc.complete(id)
+	}
+}
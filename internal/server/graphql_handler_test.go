@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialGraphql connects to the graphql endpoint of the app, and sends connection_init with the ticket
+func dialGraphql(t *testing.T, ts *httptest.Server, appId string, ticket string) *websocket.Conn {
+	t.Helper()
+	dialer := websocket.Dialer{Subprotocols: []string{graphqlSubprotocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/graphql/app/"+appId, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	payload, _ := json.Marshal(graphqlInitPayload{Token: ticket})
+	writeGraphql(t, conn, graphqlMessage{Type: "connection_init", Payload: payload})
+	return conn
+}
+
+func writeGraphql(t *testing.T, conn *websocket.Conn, msg graphqlMessage) {
+	t.Helper()
+	if err := conn.WriteJSON(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readGraphql(t *testing.T, conn *websocket.Conn) graphqlMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msg := graphqlMessage{}
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// readGraphqlClose returns the code the server closed the connection with
+func readGraphqlClose(t *testing.T, conn *websocket.Conn) int {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		closeErr := &websocket.CloseError{}
+		if errors.As(err, &closeErr) {
+			return closeErr.Code
+		}
+		if err != nil {
+			t.Fatalf("got %v, want a close frame", err)
+		}
+	}
+}
+
+func subscribeGraphql(t *testing.T, conn *websocket.Conn, id string, query string) {
+	t.Helper()
+	payload, _ := json.Marshal(graphqlSubscribePayload{Query: query})
+	writeGraphql(t, conn, graphqlMessage{ID: id, Type: "subscribe", Payload: payload})
+}
+
+func TestGraphqlSubscribe(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, _, _ := newTestApp(t, s, nil)
+	conn := dialGraphql(t, ts, app.ID, newTestTicket(t, s, app.ID, "user", "news"))
+	if msg := readGraphql(t, conn); msg.Type != "connection_ack" {
+		t.Fatalf("got %v, want connection_ack", msg.Type)
+	}
+
+	subscribeGraphql(t, conn, "other", `subscription { topic(name: "sports") }`)
+	msg := readGraphql(t, conn)
+	if msg.ID != "other" || msg.Type != "error" || !strings.Contains(string(msg.Payload), "sports") {
+		t.Errorf("got %v %v %s subscribing to another topic, want an error", msg.ID, msg.Type, msg.Payload)
+	}
+
+	subscribeGraphql(t, conn, "news", `subscription { topic(name: "news") }`)
+	// The subscription is made in the background, so publish until it is delivered
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for s.publish(ctx, app.ID, "news", "published", map[string]any{"n": 1}, 0) != nil {
+		if ctx.Err() != nil {
+			t.Fatal("subscription was not made")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	msg = readGraphql(t, conn)
+	if msg.ID != "news" || msg.Type != "next" {
+		t.Fatalf("got %v %v, want next for the subscription", msg.ID, msg.Type)
+	}
+	if got, want := string(msg.Payload), `{"data":{"topic":{"event":"published","payload":{"n":1}}}}`; got != want {
+		t.Errorf("got payload %v, want %v", got, want)
+	}
+}
+
+func TestGraphqlInvalidTicket(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, _, _ := newTestApp(t, s, nil)
+	conn := dialGraphql(t, ts, app.ID, "unknown")
+	if code := readGraphqlClose(t, conn); code != graphqlCloseForbidden {
+		t.Errorf("got close code %v, want %v", code, graphqlCloseForbidden)
+	}
+}
+
+func TestGraphqlInvalidMessage(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, _, _ := newTestApp(t, s, nil)
+	messages := []string{`not json`, `{"type":1}`, `["subscribe"]`, `{"type":"unknown"}`}
+	for _, message := range messages {
+		conn := dialGraphql(t, ts, app.ID, newTestTicket(t, s, app.ID, "user", "news"))
+		readGraphql(t, conn)
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+		if code := readGraphqlClose(t, conn); code != graphqlCloseBadRequest {
+			t.Errorf("%v: got close code %v, want %v", message, code, graphqlCloseBadRequest)
+		}
+	}
+
+	// Before connection_init as well
+	dialer := websocket.Dialer{Subprotocols: []string{graphqlSubprotocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/graphql/app/"+app.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if code := readGraphqlClose(t, conn); code != graphqlCloseBadRequest {
+		t.Errorf("first message: got close code %v, want %v", code, graphqlCloseBadRequest)
+	}
+}
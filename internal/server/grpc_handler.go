@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/bjarke-xyz/ws-gateway/pkg/gatewaypb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const grpcAuthorizationMetadataKey = "authorization"
+
+// grpcGateway implements gatewaypb.GatewayServer on top of the same topics and api keys as the HTTP api
+type grpcGateway struct {
+	gatewaypb.UnimplementedGatewayServer
+	s *server
+}
+
+// GrpcServer returns a grpc server with the Gateway service registered
+func (s *server) GrpcServer() *grpc.Server {
+	grpcServer := grpc.NewServer()
+	gatewaypb.RegisterGatewayServer(grpcServer, &grpcGateway{s: s})
+	return grpcServer
+}
+
+// authenticate checks the api key in the incoming metadata against appId
+func (g *grpcGateway) authenticate(ctx context.Context, appId string) error {
+	if appId == "" {
+		return status.Error(codes.InvalidArgument, "no app_id specified")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	keys := md.Get(grpcAuthorizationMetadataKey)
+	if len(keys) == 0 || keys[0] == "" {
+		countAuthFailure(authMethodApiKey, "missing")
+		return status.Error(codes.Unauthenticated, "missing api key")
+	}
+	_, err := g.s.verifyApiKey(ctx, appId, keys[0])
+	if err != nil {
+		if errors.Is(err, errInvalidApiKey) {
+			countAuthFailure(authMethodApiKey, "invalid")
+			return status.Error(codes.Unauthenticated, "invalid api key")
+		}
+		g.s.logger.Error("error getting api keys from db", "error", err, "appId", appId)
+		return status.Error(codes.Internal, "error getting api keys from db")
+	}
+	return nil
+}
+
+func (g *grpcGateway) CreateTicket(ctx context.Context, req *gatewaypb.CreateTicketRequest) (*gatewaypb.CreateTicketResponse, error) {
+	err := g.authenticate(ctx, req.AppId)
+	if err != nil {
+		return nil, err
+	}
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty user id")
+	}
+	if req.Topic == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty topic")
+	}
+	if err := validateTopic(req.Topic); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	token, err := g.s.createTicket(ctx, req.AppId, req.UserId, req.Topic)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		g.s.logger.Error("error creating ticket", "error", err)
+		return nil, status.Error(codes.Internal, "error creating ticket")
+	}
+	return &gatewaypb.CreateTicketResponse{Token: token}, nil
+}
+
+func (g *grpcGateway) Publish(ctx context.Context, req *gatewaypb.PublishRequest) (*gatewaypb.PublishResponse, error) {
+	err := g.authenticate(ctx, req.AppId)
+	if err != nil {
+		return nil, err
+	}
+	delivered, err := g.publish(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &gatewaypb.PublishResponse{Delivered: delivered}, nil
+}
+
+func (g *grpcGateway) PublishStream(stream grpc.ClientStreamingServer[gatewaypb.PublishRequest, gatewaypb.PublishStreamResponse]) error {
+	ctx := stream.Context()
+	// The api key is only verified once per app on a stream
+	authenticated := make(map[string]bool)
+	response := &gatewaypb.PublishStreamResponse{}
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(response)
+		}
+		if err != nil {
+			return err
+		}
+		if !authenticated[req.AppId] {
+			err = g.authenticate(ctx, req.AppId)
+			if err != nil {
+				return err
+			}
+			authenticated[req.AppId] = true
+		}
+		delivered, err := g.publish(ctx, req)
+		if err != nil {
+			return err
+		}
+		response.Published++
+		if delivered {
+			response.Delivered++
+		}
+	}
+}
+
+// publish returns false if there is nobody connected to the topic
+func (g *grpcGateway) publish(ctx context.Context, req *gatewaypb.PublishRequest) (bool, error) {
+	if req.Topic == "" {
+		return false, status.Error(codes.InvalidArgument, "empty topic")
+	}
+	err := g.s.publish(ctx, req.AppId, req.Topic, req.Event, req.Payload.AsMap(), 0)
+	if err != nil {
+		if errors.Is(err, errTopicNotFound) {
+			return false, nil
+		}
+		return false, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return true, nil
+}
+
+func (g *grpcGateway) Subscribe(req *gatewaypb.SubscribeRequest, stream grpc.ServerStreamingServer[gatewaypb.Message]) error {
+	ctx := stream.Context()
+	err := g.authenticate(ctx, req.AppId)
+	if err != nil {
+		return err
+	}
+	if req.Topic == "" {
+		return status.Error(codes.InvalidArgument, "empty topic")
+	}
+	if err := validateTopic(req.Topic); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	filter, err := compileFilter(req.Filter)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	app, err := g.s.appRepository.GetByID(ctx, req.AppId)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return status.Error(codes.NotFound, "app not found")
+		}
+		g.s.logger.Error("error getting app", "error", err, "appId", req.AppId)
+		return status.Error(codes.Internal, "error getting app")
+	}
+
+	client := &WsClient{
+		ID:        ClientID(uuid.NewString()),
+		App:       app,
+		Transport: transportGrpc,
+		Filter:    filter,
+	}
+	leave := g.s.joinTopic(client, req.Topic)
+	defer leave()
+	defer trackConnection(app.ID, transportGrpc)()
+
+	messageChan := make(chan *WsMessage)
+	client.Topic.Broker.subscribe(messageChan, client.Filter)
+	defer client.Topic.Broker.unsubscribe(messageChan)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-messageChan:
+			if msg.expired(time.Now()) {
+				// The client was too slow to receive it in time
+				countDropped(app.ID, dropReasonExpired, 1)
+				continue
+			}
+			err := stream.Send(&gatewaypb.Message{Data: msg.Frame})
+			if err != nil {
+				g.s.logger.Error("failed to send grpc msg", "error", err)
+				return err
+			}
+			countSent(app.ID, transportGrpc, len(msg.Frame))
+		}
+	}
+}
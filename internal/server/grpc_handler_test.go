@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/pkg/gatewaypb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// newTestGrpcClient serves the grpc service of s over an in-memory connection
+func newTestGrpcClient(t *testing.T, s *server) gatewaypb.GatewayClient {
+	t.Helper()
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := s.GrpcServer()
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return gatewaypb.NewGatewayClient(conn)
+}
+
+func withApiKey(ctx context.Context, secret string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, grpcAuthorizationMetadataKey, secret)
+}
+
+func TestGrpcAuthentication(t *testing.T) {
+	s, _ := newTestServer(t)
+	app, _, secret := newTestApp(t, s, nil)
+	otherApp, _, otherSecret := newTestApp(t, s, nil)
+	client := newTestGrpcClient(t, s)
+
+	tests := []struct {
+		name   string
+		appId  string
+		secret string
+		code   codes.Code
+	}{
+		{"no app id", "", secret, codes.InvalidArgument},
+		{"no api key", app.ID, "", codes.Unauthenticated},
+		{"invalid api key", app.ID, "invalid", codes.Unauthenticated},
+		{"api key of another app", app.ID, otherSecret, codes.Unauthenticated},
+		{"api key of the app", otherApp.ID, otherSecret, codes.OK},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.secret != "" {
+			ctx = withApiKey(ctx, tt.secret)
+		}
+		_, err := client.Publish(ctx, &gatewaypb.PublishRequest{AppId: tt.appId, Topic: "news"})
+		if got := status.Code(err); got != tt.code {
+			t.Errorf("publish with %v: got %v, want %v", tt.name, got, tt.code)
+		}
+
+		stream, err := client.Subscribe(ctx, &gatewaypb.SubscribeRequest{AppId: tt.appId, Topic: "news"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.code != codes.OK {
+			// Subscribe fails on the first receive
+			_, err = stream.Recv()
+			if got := status.Code(err); got != tt.code {
+				t.Errorf("subscribe with %v: got %v, want %v", tt.name, got, tt.code)
+			}
+		}
+	}
+}
+
+func TestGrpcPublishSubscribe(t *testing.T) {
+	s, _ := newTestServer(t)
+	app, _, secret := newTestApp(t, s, nil)
+	client := newTestGrpcClient(t, s)
+	ctx, cancel := context.WithTimeout(withApiKey(context.Background(), secret), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Subscribe(ctx, &gatewaypb.SubscribeRequest{AppId: app.ID, Topic: "news"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := structpb.NewStruct(map[string]any{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The subscription is made in the background, so publish until it is delivered
+	for {
+		resp, err := client.Publish(ctx, &gatewaypb.PublishRequest{AppId: app.ID, Topic: "news", Event: "published", Payload: payload})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Delivered {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	msg, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := string(msg.Data); !strings.Contains(data, `"event":"published"`) || !strings.Contains(data, `"n":1`) {
+		t.Errorf("got message %s, want the published message", data)
+	}
+}
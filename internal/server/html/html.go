@@ -3,6 +3,7 @@ package html
 import (
 	"embed"
 	"io"
+	"net/url"
 	"text/template"
 
 	"github.com/bjarke-xyz/ws-gateway/internal/domain"
@@ -12,10 +13,15 @@ import (
 var files embed.FS
 
 var (
-	adminTemplate = parse("pages/admin.html")
-	appTemplate   = parse("pages/app.html")
-	keyTemplate   = parse("pages/key.html")
-	loginTemplate = parse("pages/login.html")
+	adminTemplate       = parse("pages/admin.html")
+	appTemplate         = parse("pages/app.html")
+	keyTemplate         = parse("pages/key.html")
+	ruleTemplate        = parse("pages/rule.html")
+	connectionsTemplate = parse("pages/connections.html")
+	inspectorTemplate   = parse("pages/inspector.html")
+	orgTemplate         = parse("pages/org.html")
+	auditTemplate       = parse("pages/audit.html")
+	loginTemplate       = parse("pages/login.html")
 )
 
 type AdminParams struct {
@@ -24,6 +30,13 @@ type AdminParams struct {
 	Apps     []domain.Application
 	AppsByID map[string]domain.Application
 	Keys     []domain.ApiKey
+
+	Organizations     []domain.Organization
+	OrganizationsByID map[string]domain.Organization
+	// Roles is the user's role in each organization, by organization id
+	Roles map[string]domain.Role
+
+	AccessTokens []domain.AccessToken
 }
 
 func AdminPage(w io.Writer, p AdminParams) error {
@@ -31,9 +44,27 @@ func AdminPage(w io.Writer, p AdminParams) error {
 }
 
 type AppParams struct {
-	Title string
-	Error string
-	App   domain.Application
+	Title                string
+	Error                string
+	App                  domain.Application
+	WebhookEvents        []string
+	EnabledWebhookEvents map[string]bool
+	WebhookDeliveries    []domain.WebhookDelivery
+	AckTimeoutSeconds    int
+	MaxDeliveryAttempts  int
+	DeadLetters          []domain.DeadLetter
+	RoutingRules         []domain.RoutingRule
+	Usage                []UsageRow
+	UsageTotal           domain.AppUsage
+	CanEdit              bool
+	CanDelete            bool
+}
+
+// UsageRow is a day in the usage chart, with the widths of its bars in percent of the busiest day
+type UsageRow struct {
+	domain.AppUsage
+	MessagesPercent          int
+	ConnectionMinutesPercent int
 }
 
 func AppPage(w io.Writer, p AppParams) error {
@@ -46,12 +77,86 @@ type KeyParams struct {
 	Key              domain.ApiKey
 	KeyAccessByAppID map[string]domain.ApiKeyAccess
 	Apps             []domain.Application
+	CanEdit          bool
+	CanDelete        bool
 }
 
 func KeyPage(w io.Writer, p KeyParams) error {
 	return keyTemplate.Execute(w, p)
 }
 
+type RoutingRuleParams struct {
+	Title string
+	Error string
+	App   domain.Application
+	Rule  domain.RoutingRule
+}
+
+func RoutingRulePage(w io.Writer, p RoutingRuleParams) error {
+	return ruleTemplate.Execute(w, p)
+}
+
+type ConnectionsParams struct {
+	Title string
+	App   domain.Application
+	// User prefills the user id search
+	User string
+}
+
+func ConnectionsPage(w io.Writer, p ConnectionsParams) error {
+	return connectionsTemplate.Execute(w, p)
+}
+
+type InspectorParams struct {
+	Title  string
+	App    domain.Application
+	Topic  string
+	Filter string
+}
+
+func InspectorPage(w io.Writer, p InspectorParams) error {
+	return inspectorTemplate.Execute(w, p)
+}
+
+type OrganizationParams struct {
+	Title        string
+	Errors       []string
+	Organization domain.Organization
+	// Role is the signed in user's role
+	Role            domain.Role
+	UserID          string
+	Members         []domain.OrganizationMember
+	AssignableRoles []domain.Role
+	Apps            []domain.Application
+	Keys            []domain.ApiKey
+
+	CanEdit               bool
+	CanDelete             bool
+	CanManageMembers      bool
+	CanManageOrganization bool
+}
+
+func OrganizationPage(w io.Writer, p OrganizationParams) error {
+	return orgTemplate.Execute(w, p)
+}
+
+type AuditParams struct {
+	Title  string
+	Errors []string
+	Events []domain.AuditEvent
+	// Limit is the most events shown, the export has every event
+	Limit int
+	// Organizations are the organizations the user can see the events of
+	Organizations []domain.Organization
+	Actions       []string
+	// Query is the current filter
+	Query url.Values
+}
+
+func AuditPage(w io.Writer, p AuditParams) error {
+	return auditTemplate.Execute(w, p)
+}
+
 type LoginParams struct {
 	Title string
 	Error string
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/bjarke-xyz/ws-gateway/internal/server/html"
+	"github.com/google/uuid"
+)
+
+// The topic inspector lets app owners watch a topic and send test broadcasts from the admin ui,
+// authenticated by the admin session instead of tickets and api keys.
+
+type inspectedMessage struct {
+	ID         string          `json:"id,omitempty"`
+	Seq        int64           `json:"seq,omitempty"`
+	Topic      string          `json:"topic"`
+	Event      string          `json:"event"`
+	Payload    json.RawMessage `json:"payload"`
+	ReceivedAt time.Time       `json:"receivedAt"`
+}
+
+type inspectorPublishInput struct {
+	Topic string `json:"topic"`
+	broadcastInput
+}
+
+func (s *server) handleGetInspector(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.appForAdmin(w, r, domain.PermissionView)
+	if !ok {
+		return
+	}
+	html.InspectorPage(w, html.InspectorParams{
+		Title:  "Topic inspector",
+		App:    app,
+		Topic:  r.URL.Query().Get("topic"),
+		Filter: r.URL.Query().Get(filterQueryParam),
+	})
+}
+
+// handleGetInspectorStream joins the topic and sends every message on it as an SSE event
+func (s *server) handleGetInspectorStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	app, ok := s.appForAdmin(w, r, domain.PermissionView)
+	if !ok {
+		return
+	}
+	topicName := r.URL.Query().Get("topic")
+	if topicName == "" {
+		http.Error(w, "missing topic", http.StatusBadRequest)
+		return
+	}
+	if err := validateTopic(topicName); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, ok := filterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	client := &WsClient{
+		ID:        ClientID(uuid.NewString()),
+		App:       app,
+		Transport: transportInspector,
+		Filter:    filter,
+	}
+	leave := s.joinTopic(client, topicName)
+	defer leave()
+
+	messageChan := make(chan *WsMessage)
+	topic := client.Topic
+	topic.Broker.subscribe(messageChan, client.Filter)
+	defer topic.Broker.unsubscribe(messageChan)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case msg := <-messageChan:
+			msgTopic := msg.Topic
+			if msgTopic == "" {
+				msgTopic = topic.Topic
+			}
+			data, err := json.Marshal(inspectedMessage{
+				ID:         msg.ID,
+				Seq:        msg.Seq,
+				Topic:      msgTopic,
+				Event:      msg.Event,
+				Payload:    msg.Payload,
+				ReceivedAt: time.Now(),
+			})
+			if err != nil {
+				s.logger.Error("failed to encode inspected message", "error", err, "appId", app.ID)
+				return
+			}
+			_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// handlePostInspectorPublish broadcasts like handleApiBroadcast, with the topic in the body
+func (s *server) handlePostInspectorPublish(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.appForAdmin(w, r, domain.PermissionEdit)
+	if !ok {
+		return
+	}
+	input := &inspectorPublishInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode input: %v", err.Error()), http.StatusBadRequest)
+		return
+	}
+	if input.Topic == "" {
+		http.Error(w, "missing topic", http.StatusBadRequest)
+		return
+	}
+	if input.TTL < 0 {
+		http.Error(w, "ttl must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	auditEvent := domain.AuditEvent{Action: domain.AuditActionTopicPublish, OrganizationID: app.OrganizationID, TargetType: auditTargetTopic, TargetID: string(CreateTopicID(app.ID, input.Topic))}
+	if input.DeliverAt != nil && input.DeliverAt.After(time.Now()) {
+		scheduled, err := s.schedule(r.Context(), app.ID, input.Topic, &input.broadcastInput)
+		if err != nil {
+			s.logger.Error("error scheduling broadcast", "error", err, "appId", app.ID)
+			http.Error(w, "error scheduling broadcast", http.StatusInternalServerError)
+			return
+		}
+		s.audit(r, auditEvent, nil, input.broadcastInput)
+		jsonResponse(w, http.StatusAccepted, scheduledBroadcastResponse{ID: scheduled.ID, DeliverAt: scheduled.DeliverAt})
+		return
+	}
+
+	err = s.publish(r.Context(), app.ID, input.Topic, input.Event, input.Payload, time.Duration(input.TTL)*time.Second)
+	if err != nil {
+		if errors.Is(err, errTopicNotFound) {
+			http.Error(w, "topic not found, no clients are subscribed to it", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.audit(r, auditEvent, nil, input.broadcastInput)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/google/uuid"
+)
+
+func TestInspectorIsNotSubscriber(t *testing.T) {
+	s, _ := newTestServer(t)
+	events := make(chan string, 10)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := struct {
+			Event string `json:"event"`
+		}{}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		events <- payload.Event
+	}))
+	defer endpoint.Close()
+	app, _, _ := newTestApp(t, s, func(app *domain.Application) {
+		app.WebhookURL = endpoint.URL
+		app.WebhookEvents = []string{domain.WebhookEventTopicOccupied, domain.WebhookEventTopicVacated}
+	})
+	ctx := context.Background()
+
+	inspector := &WsClient{ID: ClientID(uuid.NewString()), App: app, Transport: transportInspector}
+	leaveInspector := s.joinTopic(inspector, "orders")
+	defer leaveInspector()
+	inspected := make(chan *WsMessage, 1)
+	inspector.Topic.Broker.subscribe(inspected, nil)
+	defer inspector.Topic.Broker.unsubscribe(inspected)
+
+	if err := s.publish(ctx, app.ID, "orders", "created", nil, 0); err != errTopicNotFound {
+		t.Errorf("got %v with only an inspector, want errTopicNotFound", err)
+	}
+	select {
+	case <-inspected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("inspector did not get the message")
+	}
+
+	subscriber := &WsClient{ID: ClientID(uuid.NewString()), App: app, Transport: transportSSE}
+	leaveSubscriber := s.joinTopic(subscriber, "orders")
+	if err := s.publish(ctx, app.ID, "orders", "created", nil, 0); err != nil {
+		t.Errorf("got %v with a subscriber, want nil", err)
+	}
+	leaveSubscriber()
+
+	// The topic is vacated when the subscriber leaves, although the inspector is still watching
+	got := make([]string, 0)
+	for len(got) < 2 {
+		select {
+		case event := <-events:
+			got = append(got, event)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got webhooks %v, want occupied and vacated", got)
+		}
+	}
+	slices.Sort(got)
+	if want := []string{domain.WebhookEventTopicOccupied, domain.WebhookEventTopicVacated}; !slices.Equal(got, want) {
+		t.Errorf("got webhooks %v, want %v", got, want)
+	}
+	if s.wsTopicCollection.getTopic(app.ID, "orders") == nil {
+		t.Error("topic was deleted while the inspector is on it")
+	}
+}
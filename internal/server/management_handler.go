@@ -0,0 +1,545 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// The management api is a JSON version of the admin ui, used by wsctl and for provisioning from CI.
+// It is authenticated with personal access tokens, see accessTokenVerifier.
+
+type appResponse struct {
+	ID                  string     `json:"id"`
+	OrganizationID      string     `json:"organizationId"`
+	Name                string     `json:"name"`
+	WebhookURL          string     `json:"webhookUrl"`
+	WebhookEvents       []string   `json:"webhookEvents"`
+	PusherEnabled       bool       `json:"pusherEnabled"`
+	ReliableTopics      []string   `json:"reliableTopics"`
+	AckTimeoutSeconds   int        `json:"ackTimeoutSeconds"`
+	MaxDeliveryAttempts int        `json:"maxDeliveryAttempts"`
+	SequencedTopics     []string   `json:"sequencedTopics"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	UpdatedAt           *time.Time `json:"updatedAt"`
+}
+
+// newAppResponse leaves out the webhook secret
+func newAppResponse(app domain.Application) appResponse {
+	return appResponse{
+		ID:                  app.ID,
+		OrganizationID:      app.OrganizationID,
+		Name:                app.Name,
+		WebhookURL:          app.WebhookURL,
+		WebhookEvents:       nonNilStrings(app.WebhookEvents),
+		PusherEnabled:       app.PusherEnabled,
+		ReliableTopics:      nonNilStrings(app.ReliableTopics),
+		AckTimeoutSeconds:   app.AckTimeoutSeconds,
+		MaxDeliveryAttempts: app.MaxDeliveryAttempts,
+		SequencedTopics:     nonNilStrings(app.SequencedTopics),
+		CreatedAt:           app.CreatedAt,
+		UpdatedAt:           app.UpdatedAt,
+	}
+}
+
+// nonNilStrings makes empty lists encode as [] rather than null
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+type keyResponse struct {
+	ID             string     `json:"id"`
+	OrganizationID string     `json:"organizationId"`
+	KeyPreview     string     `json:"keyPreview"`
+	Apps           []string   `json:"apps"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      *time.Time `json:"updatedAt"`
+}
+
+func newKeyResponse(key domain.ApiKey) keyResponse {
+	apps := make([]string, 0, len(key.Access))
+	for _, access := range key.Access {
+		apps = append(apps, access.AppID)
+	}
+	return keyResponse{
+		ID:             key.ID,
+		OrganizationID: key.OrganizationID,
+		KeyPreview:     key.KeyPreview,
+		Apps:           apps,
+		CreatedAt:      key.CreatedAt,
+		UpdatedAt:      key.UpdatedAt,
+	}
+}
+
+type createKeyResponse struct {
+	keyResponse
+	// Key is the secret, it is only returned when the key is created
+	Key string `json:"key"`
+	// PusherSecret signs Pusher requests made with the key, with the key id as the Pusher key
+	PusherSecret string `json:"pusherSecret"`
+}
+
+type organizationResponse struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	Role      domain.Role `json:"role"`
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+// createAppInput and createKeyInput can leave out OrganizationID if the user is a member of a single organization
+type createAppInput struct {
+	OrganizationID string `json:"organizationId"`
+	Name           string `json:"name"`
+}
+
+type createKeyInput struct {
+	OrganizationID string   `json:"organizationId"`
+	Apps           []string `json:"apps"`
+}
+
+type updateKeyAccessInput struct {
+	Apps []string `json:"apps"`
+}
+
+// updateAppInput only changes the fields that are set
+type updateAppInput struct {
+	Name                *string   `json:"name"`
+	WebhookURL          *string   `json:"webhookUrl"`
+	WebhookSecret       *string   `json:"webhookSecret"`
+	WebhookEvents       *[]string `json:"webhookEvents"`
+	PusherEnabled       *bool     `json:"pusherEnabled"`
+	ReliableTopics      *[]string `json:"reliableTopics"`
+	AckTimeoutSeconds   *int      `json:"ackTimeoutSeconds"`
+	MaxDeliveryAttempts *int      `json:"maxDeliveryAttempts"`
+	SequencedTopics     *[]string `json:"sequencedTopics"`
+}
+
+// apply validates the input and updates app
+func (input updateAppInput) apply(app *domain.Application) error {
+	if input.Name != nil {
+		if *input.Name == "" {
+			return errors.New("empty name")
+		}
+		app.Name = *input.Name
+	}
+	if input.WebhookURL != nil {
+		app.WebhookURL = *input.WebhookURL
+	}
+	if input.WebhookSecret != nil {
+		app.WebhookSecret = *input.WebhookSecret
+	}
+	if input.WebhookEvents != nil {
+		for _, event := range *input.WebhookEvents {
+			if !slices.Contains(domain.WebhookEvents, event) {
+				return fmt.Errorf("unknown webhook event %v", event)
+			}
+		}
+		app.WebhookEvents = *input.WebhookEvents
+	}
+	if input.PusherEnabled != nil {
+		app.PusherEnabled = *input.PusherEnabled
+	}
+	if input.ReliableTopics != nil {
+		if err := validateTopicList(*input.ReliableTopics); err != nil {
+			return fmt.Errorf("reliableTopics: %w", err)
+		}
+		app.ReliableTopics = *input.ReliableTopics
+	}
+	if input.AckTimeoutSeconds != nil {
+		if *input.AckTimeoutSeconds <= 0 {
+			return errors.New("ackTimeoutSeconds must be positive")
+		}
+		app.AckTimeoutSeconds = *input.AckTimeoutSeconds
+	}
+	if input.MaxDeliveryAttempts != nil {
+		if *input.MaxDeliveryAttempts <= 0 {
+			return errors.New("maxDeliveryAttempts must be positive")
+		}
+		app.MaxDeliveryAttempts = *input.MaxDeliveryAttempts
+	}
+	if input.SequencedTopics != nil {
+		if err := validateTopicList(*input.SequencedTopics); err != nil {
+			return fmt.Errorf("sequencedTopics: %w", err)
+		}
+		app.SequencedTopics = *input.SequencedTopics
+	}
+	return nil
+}
+
+func (s *server) handleApiListOrganizations(w http.ResponseWriter, r *http.Request) {
+	token, _, _ := TokenFromContext(r.Context())
+	orgs, roles, err := s.organizationsForUser(r.Context(), token)
+	if err != nil {
+		s.logger.Error("error getting organizations by user id", "error", err, "userId", token.Subject)
+		http.Error(w, "error getting organizations", http.StatusInternalServerError)
+		return
+	}
+	response := make([]organizationResponse, 0, len(orgs))
+	for _, org := range orgs {
+		response = append(response, organizationResponse{ID: org.ID, Name: org.Name, Role: roles[org.ID], CreatedAt: org.CreatedAt})
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
+func (s *server) handleApiListApps(w http.ResponseWriter, r *http.Request) {
+	token, _, _ := TokenFromContext(r.Context())
+	orgs, _, err := s.organizationsForUser(r.Context(), token)
+	if err != nil {
+		s.logger.Error("error getting organizations by user id", "error", err, "userId", token.Subject)
+		http.Error(w, "error getting organizations", http.StatusInternalServerError)
+		return
+	}
+	apps, err := s.appRepository.GetByOrganizationIDs(r.Context(), organizationIDs(orgs))
+	if err != nil {
+		s.logger.Error("error getting apps by organization ids", "error", err, "userId", token.Subject)
+		http.Error(w, "error getting apps", http.StatusInternalServerError)
+		return
+	}
+	response := make([]appResponse, 0, len(apps))
+	for _, app := range apps {
+		response = append(response, newAppResponse(app))
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
+// organizationForApi returns the id of the organization to create something in, if the signed in user's role in it has the permission.
+// On failure the error is written to w and false is returned.
+func (s *server) organizationForApi(w http.ResponseWriter, r *http.Request, organizationId string, permission domain.Permission) (string, bool) {
+	token, _, _ := TokenFromContext(r.Context())
+	if organizationId == "" {
+		var err error
+		organizationId, err = s.defaultOrganization(r.Context(), token)
+		if err != nil {
+			s.logger.Error("error getting organizations by user id", "error", err, "userId", token.Subject)
+			http.Error(w, "error getting organizations", http.StatusInternalServerError)
+			return "", false
+		}
+		if organizationId == "" {
+			http.Error(w, "organizationId is required when you are a member of several organizations", http.StatusBadRequest)
+			return "", false
+		}
+	}
+	role, err := s.memberRole(r.Context(), organizationId, token.Subject)
+	if err != nil {
+		s.logger.Error("error getting organization member", "error", err, "organizationId", organizationId)
+		http.Error(w, "error getting organization member", http.StatusInternalServerError)
+		return "", false
+	}
+	if role == "" {
+		http.Error(w, "organization not found", http.StatusNotFound)
+		return "", false
+	}
+	if !role.Can(permission) {
+		http.Error(w, fmt.Sprintf("the %v role is not allowed to do this", role), http.StatusForbidden)
+		return "", false
+	}
+	return organizationId, true
+}
+
+func (s *server) handleApiCreateApp(w http.ResponseWriter, r *http.Request) {
+	token, _, _ := TokenFromContext(r.Context())
+	input := createAppInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode input: %v", err.Error()), http.StatusBadRequest)
+		return
+	}
+	if input.Name == "" {
+		http.Error(w, "empty name", http.StatusBadRequest)
+		return
+	}
+	organizationId, ok := s.organizationForApi(w, r, input.OrganizationID, domain.PermissionDelete)
+	if !ok {
+		return
+	}
+	app := domain.Application{
+		ID:                  uuid.NewString(),
+		OwnerUserID:         token.Subject,
+		OrganizationID:      organizationId,
+		Name:                input.Name,
+		AckTimeoutSeconds:   domain.DefaultAckTimeoutSeconds,
+		MaxDeliveryAttempts: domain.DefaultMaxDeliveryAttempts,
+	}
+	err = s.appRepository.Create(r.Context(), &app)
+	if err != nil {
+		s.logger.Error("error creating app", "error", err, "app", app)
+		http.Error(w, "error creating app", http.StatusInternalServerError)
+		return
+	}
+	app.CreatedAt = time.Now()
+	s.audit(r, domain.AuditEvent{Action: domain.AuditActionAppCreate, OrganizationID: app.OrganizationID, TargetType: auditTargetApp, TargetID: app.ID}, nil, newAuditApp(app))
+	jsonResponse(w, http.StatusCreated, newAppResponse(app))
+}
+
+// ownedApp returns the app if the signed in user's role in its organization has the permission. On failure the error is written to w and false is returned.
+func (s *server) ownedApp(w http.ResponseWriter, r *http.Request, permission domain.Permission) (domain.Application, bool) {
+	token, _, _ := TokenFromContext(r.Context())
+	appId := chi.URLParam(r, "app-id")
+	app, err := s.appRepository.GetByID(r.Context(), appId)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			http.Error(w, "app not found", http.StatusNotFound)
+			return app, false
+		}
+		s.logger.Error("error getting app by app id", "error", err, "appId", appId)
+		http.Error(w, "error getting app", http.StatusInternalServerError)
+		return app, false
+	}
+	role, err := s.memberRole(r.Context(), app.OrganizationID, token.Subject)
+	if err != nil {
+		s.logger.Error("error getting organization member", "error", err, "organizationId", app.OrganizationID)
+		http.Error(w, "error getting organization member", http.StatusInternalServerError)
+		return app, false
+	}
+	if role == "" {
+		http.Error(w, "app not found", http.StatusNotFound)
+		return app, false
+	}
+	if !role.Can(permission) {
+		http.Error(w, fmt.Sprintf("the %v role is not allowed to do this", role), http.StatusForbidden)
+		return app, false
+	}
+	return app, true
+}
+
+func (s *server) handleApiGetApp(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.ownedApp(w, r, domain.PermissionView)
+	if !ok {
+		return
+	}
+	jsonResponse(w, http.StatusOK, newAppResponse(app))
+}
+
+func (s *server) handleApiUpdateApp(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.ownedApp(w, r, domain.PermissionEdit)
+	if !ok {
+		return
+	}
+	input := updateAppInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode input: %v", err.Error()), http.StatusBadRequest)
+		return
+	}
+	before := newAuditApp(app)
+	err = input.apply(&app)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = s.appRepository.Update(r.Context(), &app)
+	if err != nil {
+		s.logger.Error("failed to update app", "error", err, "appId", app.ID)
+		http.Error(w, "failed to update app", http.StatusInternalServerError)
+		return
+	}
+	s.sequencedTopics.invalidate(app.ID)
+	now := time.Now()
+	app.UpdatedAt = &now
+	s.audit(r, domain.AuditEvent{Action: domain.AuditActionAppUpdate, OrganizationID: app.OrganizationID, TargetType: auditTargetApp, TargetID: app.ID}, before, newAuditApp(app))
+	jsonResponse(w, http.StatusOK, newAppResponse(app))
+}
+
+func (s *server) handleApiDeleteApp(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.ownedApp(w, r, domain.PermissionDelete)
+	if !ok {
+		return
+	}
+	err := s.appRepository.Delete(r.Context(), app.ID)
+	if err != nil {
+		s.logger.Error("failed to delete app", "error", err, "appId", app.ID)
+		http.Error(w, "failed to delete app", http.StatusInternalServerError)
+		return
+	}
+	s.sequencedTopics.invalidate(app.ID)
+	s.audit(r, domain.AuditEvent{Action: domain.AuditActionAppDelete, OrganizationID: app.OrganizationID, TargetType: auditTargetApp, TargetID: app.ID}, newAuditApp(app), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) handleApiListKeys(w http.ResponseWriter, r *http.Request) {
+	token, _, _ := TokenFromContext(r.Context())
+	orgs, _, err := s.organizationsForUser(r.Context(), token)
+	if err != nil {
+		s.logger.Error("error getting organizations by user id", "error", err, "userId", token.Subject)
+		http.Error(w, "error getting organizations", http.StatusInternalServerError)
+		return
+	}
+	keys, err := s.keyRepository.GetByOrganizationIDs(r.Context(), organizationIDs(orgs))
+	if err != nil {
+		s.logger.Error("error getting keys by organization ids", "error", err, "userId", token.Subject)
+		http.Error(w, "error getting keys", http.StatusInternalServerError)
+		return
+	}
+	err = s.truncateKeyPreviews(r.Context(), keys)
+	if err != nil {
+		s.logger.Error("error truncating key preview", "error", err)
+		http.Error(w, "error truncating key preview", http.StatusInternalServerError)
+		return
+	}
+	response := make([]keyResponse, 0, len(keys))
+	for _, key := range keys {
+		if len(key.KeyPreview) > 4 {
+			key.KeyPreview = key.KeyPreview[0:4]
+		}
+		response = append(response, newKeyResponse(key))
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
+// handleApiCreateKey creates a key with access to the given apps. The secret is only returned here.
+func (s *server) handleApiCreateKey(w http.ResponseWriter, r *http.Request) {
+	token, _, _ := TokenFromContext(r.Context())
+	input := createKeyInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode input: %v", err.Error()), http.StatusBadRequest)
+		return
+	}
+	organizationId, ok := s.organizationForApi(w, r, input.OrganizationID, domain.PermissionEdit)
+	if !ok {
+		return
+	}
+	access, ok := s.organizationAppsAccess(w, r, organizationId, input.Apps)
+	if !ok {
+		return
+	}
+	key, apiKey, err := newApiKey(token.Subject, organizationId, access)
+	if err != nil {
+		s.logger.Error("error hashing apiKey", "error", err)
+		http.Error(w, "failed to hash api key", http.StatusInternalServerError)
+		return
+	}
+	err = s.keyRepository.Create(r.Context(), &key)
+	if err != nil {
+		s.logger.Error("error creating key", "error", err, "keyId", key.ID)
+		http.Error(w, "error creating key", http.StatusInternalServerError)
+		return
+	}
+	key.CreatedAt = time.Now()
+	s.audit(r, domain.AuditEvent{Action: domain.AuditActionKeyCreate, OrganizationID: key.OrganizationID, TargetType: auditTargetKey, TargetID: key.ID}, nil, newAuditKey(key))
+	jsonResponse(w, http.StatusCreated, createKeyResponse{keyResponse: newKeyResponse(key), Key: apiKey, PusherSecret: key.PusherSecret})
+}
+
+// organizationAppsAccess returns access to the apps, if they all belong to the organization. On failure the error is written to w and false is returned.
+func (s *server) organizationAppsAccess(w http.ResponseWriter, r *http.Request, organizationId string, appIds []string) ([]domain.ApiKeyAccess, bool) {
+	apps, err := s.appRepository.GetByOrganizationIDs(r.Context(), []string{organizationId})
+	if err != nil {
+		s.logger.Error("error getting apps by organization id", "error", err, "organizationId", organizationId)
+		http.Error(w, "error getting apps", http.StatusInternalServerError)
+		return nil, false
+	}
+	appsByID := make(map[string]bool)
+	for _, app := range apps {
+		appsByID[app.ID] = true
+	}
+	access := make([]domain.ApiKeyAccess, 0, len(appIds))
+	for _, appId := range appIds {
+		if !appsByID[appId] {
+			http.Error(w, fmt.Sprintf("app %v not found", appId), http.StatusBadRequest)
+			return nil, false
+		}
+		access = append(access, domain.ApiKeyAccess{AppID: appId})
+	}
+	return access, true
+}
+
+// ownedKey returns the key if the signed in user's role in its organization has the permission. On failure the error is written to w and false is returned.
+func (s *server) ownedKey(w http.ResponseWriter, r *http.Request, permission domain.Permission) (domain.ApiKey, bool) {
+	token, _, _ := TokenFromContext(r.Context())
+	keyId := chi.URLParam(r, "key-id")
+	key, err := s.keyRepository.GetByID(r.Context(), keyId)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		s.logger.Error("error getting key by id", "error", err, "keyId", keyId)
+		http.Error(w, "error getting key", http.StatusInternalServerError)
+		return key, false
+	}
+	if err != nil {
+		http.Error(w, "key not found", http.StatusNotFound)
+		return key, false
+	}
+	role, err := s.memberRole(r.Context(), key.OrganizationID, token.Subject)
+	if err != nil {
+		s.logger.Error("error getting organization member", "error", err, "organizationId", key.OrganizationID)
+		http.Error(w, "error getting organization member", http.StatusInternalServerError)
+		return key, false
+	}
+	if role == "" {
+		http.Error(w, "key not found", http.StatusNotFound)
+		return key, false
+	}
+	if !role.Can(permission) {
+		http.Error(w, fmt.Sprintf("the %v role is not allowed to do this", role), http.StatusForbidden)
+		return key, false
+	}
+	err = s.truncateKeyPreviews(r.Context(), []domain.ApiKey{key})
+	if err != nil {
+		s.logger.Error("error truncating key preview", "error", err)
+		http.Error(w, "error truncating key preview", http.StatusInternalServerError)
+		return key, false
+	}
+	if len(key.KeyPreview) > 4 {
+		key.KeyPreview = key.KeyPreview[0:4]
+	}
+	return key, true
+}
+
+func (s *server) handleApiGetKey(w http.ResponseWriter, r *http.Request) {
+	key, ok := s.ownedKey(w, r, domain.PermissionView)
+	if !ok {
+		return
+	}
+	jsonResponse(w, http.StatusOK, newKeyResponse(key))
+}
+
+// handleApiUpdateKeyAccess replaces the apps the key gives access to
+func (s *server) handleApiUpdateKeyAccess(w http.ResponseWriter, r *http.Request) {
+	key, ok := s.ownedKey(w, r, domain.PermissionEdit)
+	if !ok {
+		return
+	}
+	input := updateKeyAccessInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode input: %v", err.Error()), http.StatusBadRequest)
+		return
+	}
+	access, ok := s.organizationAppsAccess(w, r, key.OrganizationID, input.Apps)
+	if !ok {
+		return
+	}
+	err = s.keyRepository.Update(r.Context(), key.ID, access)
+	if err != nil {
+		s.logger.Error("failed to update key", "error", err, "keyId", key.ID)
+		http.Error(w, "failed to update key", http.StatusInternalServerError)
+		return
+	}
+	before := newAuditKey(key)
+	key.Access = access
+	s.audit(r, domain.AuditEvent{Action: domain.AuditActionKeyUpdate, OrganizationID: key.OrganizationID, TargetType: auditTargetKey, TargetID: key.ID}, before, newAuditKey(key))
+	jsonResponse(w, http.StatusOK, newKeyResponse(key))
+}
+
+func (s *server) handleApiDeleteKey(w http.ResponseWriter, r *http.Request) {
+	key, ok := s.ownedKey(w, r, domain.PermissionDelete)
+	if !ok {
+		return
+	}
+	err := s.keyRepository.Delete(r.Context(), key.ID)
+	if err != nil {
+		s.logger.Error("failed to delete key", "error", err, "keyId", key.ID)
+		http.Error(w, "failed to delete key", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, domain.AuditEvent{Action: domain.AuditActionKeyDelete, OrganizationID: key.OrganizationID, TargetType: auditTargetKey, TargetID: key.ID}, newAuditKey(key), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+)
+
+// newTestAccessToken returns the authorization header of a personal access token of the user
+func newTestAccessToken(t *testing.T, s *server, userId string) string {
+	t.Helper()
+	accessToken, secret, err := newAccessToken(userId, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.accessTokenRepository.Create(context.Background(), &accessToken); err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + secret
+}
+
+// managementRequest sends body to the management api, and decodes the response into out if it is not nil
+func managementRequest(t *testing.T, ts *httptest.Server, authorization string, method string, path string, body string, out any) int {
+	t.Helper()
+	resp := apiRequest(t, ts, authorization, method, "/api/v1"+path, body)
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestManagementApps(t *testing.T) {
+	s, ts := newTestServer(t)
+	org, _, _ := newTestApp(t, s, nil)
+	owner := newTestAccessToken(t, s, org.OwnerUserID)
+
+	created := appResponse{}
+	status := managementRequest(t, ts, owner, http.MethodPost, "/apps", `{"name":"created"}`, &created)
+	if status != http.StatusCreated || created.ID == "" || created.OrganizationID != org.OrganizationID {
+		t.Fatalf("creating app got status %v and %+v, want the app in the owner's organization", status, created)
+	}
+
+	updated := appResponse{}
+	status = managementRequest(t, ts, owner, http.MethodPut, "/apps/"+created.ID, `{"name":"updated","reliableTopics":["orders/+"],"sequencedTopics":["news"]}`, &updated)
+	if status != http.StatusOK || updated.Name != "updated" || len(updated.ReliableTopics) != 1 || len(updated.SequencedTopics) != 1 {
+		t.Errorf("updating app got status %v and %+v", status, updated)
+	}
+
+	got := appResponse{}
+	status = managementRequest(t, ts, owner, http.MethodGet, "/apps/"+created.ID, "", &got)
+	if status != http.StatusOK || got.Name != "updated" {
+		t.Errorf("getting app got status %v and %+v, want the updated app", status, got)
+	}
+
+	status = managementRequest(t, ts, owner, http.MethodDelete, "/apps/"+created.ID, "", nil)
+	if status != http.StatusNoContent {
+		t.Errorf("deleting app got status %v, want %v", status, http.StatusNoContent)
+	}
+	status = managementRequest(t, ts, owner, http.MethodGet, "/apps/"+created.ID, "", nil)
+	if status != http.StatusNotFound {
+		t.Errorf("getting deleted app got status %v, want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestManagementAppInvalidTopics(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, _, _ := newTestApp(t, s, nil)
+	owner := newTestAccessToken(t, s, app.OwnerUserID)
+	tests := []struct {
+		body  string
+		topic string
+	}{
+		{`{"reliableTopics":["orders/#/items"]}`, "orders/#/items"},
+		{`{"sequencedTopics":["news","news+"]}`, "news+"},
+		{`{"sequencedTopics":[""]}`, "empty topic"},
+	}
+	for _, tt := range tests {
+		resp := apiRequest(t, ts, owner, http.MethodPut, "/api/v1/apps/"+app.ID, tt.body)
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), tt.topic) {
+			t.Errorf("%v: got status %v and %q, want %v naming %v", tt.body, resp.StatusCode, body, http.StatusBadRequest, tt.topic)
+		}
+	}
+	stored, err := s.appRepository.GetByID(context.Background(), app.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.ReliableTopics) != 0 || len(stored.SequencedTopics) != 0 {
+		t.Errorf("got reliable topics %v and sequenced topics %v, want none saved", stored.ReliableTopics, stored.SequencedTopics)
+	}
+}
+
+func TestManagementAppRoles(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, _, _ := newTestApp(t, s, nil)
+	viewer := newTestAccessToken(t, s, addTestMember(t, s, app.OrganizationID, domain.RoleViewer))
+	developer := newTestAccessToken(t, s, addTestMember(t, s, app.OrganizationID, domain.RoleDeveloper))
+	outsider := newTestAccessToken(t, s, "outsider")
+
+	tests := []struct {
+		name          string
+		authorization string
+		method        string
+		path          string
+		body          string
+		status        int
+	}{
+		{"viewer gets app", viewer, http.MethodGet, "/apps/" + app.ID, "", http.StatusOK},
+		{"viewer creates app", viewer, http.MethodPost, "/apps", `{"name":"new"}`, http.StatusForbidden},
+		{"viewer updates app", viewer, http.MethodPut, "/apps/" + app.ID, `{"name":"new"}`, http.StatusForbidden},
+		{"viewer deletes app", viewer, http.MethodDelete, "/apps/" + app.ID, "", http.StatusForbidden},
+		{"developer creates app", developer, http.MethodPost, "/apps", `{"name":"new"}`, http.StatusForbidden},
+		{"developer updates app", developer, http.MethodPut, "/apps/" + app.ID, `{"name":"new"}`, http.StatusOK},
+		{"developer deletes app", developer, http.MethodDelete, "/apps/" + app.ID, "", http.StatusForbidden},
+		{"outsider gets app", outsider, http.MethodGet, "/apps/" + app.ID, "", http.StatusNotFound},
+		{"outsider updates app", outsider, http.MethodPut, "/apps/" + app.ID, `{"name":"new"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if status := managementRequest(t, ts, tt.authorization, tt.method, tt.path, tt.body, nil); status != tt.status {
+			t.Errorf("%v: got status %v, want %v", tt.name, status, tt.status)
+		}
+	}
+}
+
+func TestManagementKeys(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, _, _ := newTestApp(t, s, nil)
+	otherApp, _, _ := newTestApp(t, s, nil)
+	owner := newTestAccessToken(t, s, app.OwnerUserID)
+
+	created := createKeyResponse{}
+	status := managementRequest(t, ts, owner, http.MethodPost, "/keys", `{"apps":["`+app.ID+`"]}`, &created)
+	if status != http.StatusCreated || created.Key == "" || created.PusherSecret == "" {
+		t.Fatalf("creating key got status %v and %+v, want the key with its secrets", status, created)
+	}
+	if _, err := s.verifyApiKey(context.Background(), app.ID, created.Key); err != nil {
+		t.Errorf("created key does not give access to the app: %v", err)
+	}
+
+	// The secrets are only returned when the key is created
+	for _, path := range []string{"/keys", "/keys/" + created.ID} {
+		resp := apiRequest(t, ts, owner, http.MethodGet, "/api/v1"+path, "")
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%v: got status %v, want %v", path, resp.StatusCode, http.StatusOK)
+		}
+		if strings.Contains(string(body), created.Key) || strings.Contains(string(body), created.PusherSecret) {
+			t.Errorf("%v: response contains a secret of the key", path)
+		}
+	}
+
+	status = managementRequest(t, ts, owner, http.MethodPut, "/keys/"+created.ID+"/apps", `{"apps":["`+otherApp.ID+`"]}`, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("giving access to an app of another organization got status %v, want %v", status, http.StatusBadRequest)
+	}
+	updated := keyResponse{}
+	status = managementRequest(t, ts, owner, http.MethodPut, "/keys/"+created.ID+"/apps", `{"apps":[]}`, &updated)
+	if status != http.StatusOK || len(updated.Apps) != 0 {
+		t.Errorf("removing access got status %v and %+v", status, updated)
+	}
+
+	status = managementRequest(t, ts, owner, http.MethodDelete, "/keys/"+created.ID, "", nil)
+	if status != http.StatusNoContent {
+		t.Errorf("deleting key got status %v, want %v", status, http.StatusNoContent)
+	}
+	status = managementRequest(t, ts, owner, http.MethodGet, "/keys/"+created.ID, "", nil)
+	if status != http.StatusNotFound {
+		t.Errorf("getting deleted key got status %v, want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestManagementKeyRoles(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, key, _ := newTestApp(t, s, nil)
+	viewer := newTestAccessToken(t, s, addTestMember(t, s, app.OrganizationID, domain.RoleViewer))
+	developer := newTestAccessToken(t, s, addTestMember(t, s, app.OrganizationID, domain.RoleDeveloper))
+	outsider := newTestAccessToken(t, s, "outsider")
+	createBody := `{"apps":["` + app.ID + `"]}`
+
+	tests := []struct {
+		name          string
+		authorization string
+		method        string
+		path          string
+		body          string
+		status        int
+	}{
+		{"viewer gets key", viewer, http.MethodGet, "/keys/" + key.ID, "", http.StatusOK},
+		{"viewer creates key", viewer, http.MethodPost, "/keys", createBody, http.StatusForbidden},
+		{"viewer updates key", viewer, http.MethodPut, "/keys/" + key.ID + "/apps", createBody, http.StatusForbidden},
+		{"viewer deletes key", viewer, http.MethodDelete, "/keys/" + key.ID, "", http.StatusForbidden},
+		{"developer creates key", developer, http.MethodPost, "/keys", createBody, http.StatusCreated},
+		{"developer deletes key", developer, http.MethodDelete, "/keys/" + key.ID, "", http.StatusForbidden},
+		{"outsider gets key", outsider, http.MethodGet, "/keys/" + key.ID, "", http.StatusNotFound},
+		{"outsider deletes key", outsider, http.MethodDelete, "/keys/" + key.ID, "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if status := managementRequest(t, ts, tt.authorization, tt.method, tt.path, tt.body, nil); status != tt.status {
+			t.Errorf("%v: got status %v, want %v", tt.name, status, tt.status)
+		}
+	}
+}
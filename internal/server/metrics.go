@@ -0,0 +1,168 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics are registered with the default registry, which ServerCmd serves on :9091/metrics
+
+const (
+	dropReasonNoSubscribers = "no_subscribers"
+	dropReasonExpired       = "expired"
+	dropReasonDeadLettered  = "dead_lettered"
+	dropReasonSlowClient    = "slow_client"
+)
+
+const (
+	authMethodApiKey      = "api_key"
+	authMethodAccessToken = "access_token"
+	authMethodSession     = "session"
+	authMethodPusher      = "pusher"
+)
+
+var (
+	connectionsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ws_gateway_connections",
+		Help: "Open client connections, by app and transport",
+	}, []string{"app", "transport"})
+	topicsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ws_gateway_topics",
+		Help: "Topics with at least one client, by app",
+	}, []string{"app"})
+	messagesBroadcastCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ws_gateway_messages_broadcast_total",
+		Help: "Messages broadcast to a topic, by app",
+	}, []string{"app"})
+	messagesDeliveredCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ws_gateway_messages_delivered_total",
+		Help: "Messages handed to clients, by app. A message broadcast to a topic with several clients is counted once per client.",
+	}, []string{"app"})
+	messagesDroppedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ws_gateway_messages_dropped_total",
+		Help: "Messages that were not delivered, by app and reason",
+	}, []string{"app", "reason"})
+	bytesReceivedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ws_gateway_received_bytes_total",
+		Help: "Bytes of messages received from clients, by app and transport",
+	}, []string{"app", "transport"})
+	bytesSentCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ws_gateway_sent_bytes_total",
+		Help: "Bytes of messages sent to clients, by app and transport",
+	}, []string{"app", "transport"})
+	upgradeFailuresCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ws_gateway_upgrade_failures_total",
+		Help: "Client connections that were refused, by transport and reason",
+	}, []string{"transport", "reason"})
+	authFailuresCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ws_gateway_auth_failures_total",
+		Help: "Failed authentications of api and admin requests, by method and reason",
+	}, []string{"method", "reason"})
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ws_gateway_http_request_duration_seconds",
+		Help:    "Latency of api requests, by route, method and status code",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	bcryptDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ws_gateway_bcrypt_verify_duration_seconds",
+		Help:    "Time spent comparing a secret with a bcrypt hash, by kind of secret",
+		Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+	}, []string{"kind"})
+)
+
+// maxAppLabels caps the number of app label values, so a gateway with many apps does not create unbounded series.
+// Apps seen after the cap is reached are counted as otherAppLabel.
+const maxAppLabels = 200
+
+const otherAppLabel = "other"
+
+var metricApps = &appLabels{seen: make(map[string]struct{}), Mutex: &sync.Mutex{}}
+
+type appLabels struct {
+	seen map[string]struct{}
+	*sync.Mutex
+}
+
+func (l *appLabels) get(appId string) string {
+	l.Lock()
+	defer l.Unlock()
+	if _, ok := l.seen[appId]; ok {
+		return appId
+	}
+	if len(l.seen) >= maxAppLabels {
+		return otherAppLabel
+	}
+	l.seen[appId] = struct{}{}
+	return appId
+}
+
+func appLabel(appId string) string {
+	return metricApps.get(appId)
+}
+
+// trackConnection counts an open connection, also in the usage of the app. The returned func counts it as closed again.
+func trackConnection(appId string, transport string) func() {
+	gauge := connectionsGauge.WithLabelValues(appLabel(appId), transport)
+	gauge.Inc()
+	appUsage.connected(appId, time.Now())
+	return func() {
+		gauge.Dec()
+		appUsage.disconnected(appId, time.Now())
+	}
+}
+
+func countDropped(appId string, reason string, n int) {
+	messagesDroppedCounter.WithLabelValues(appLabel(appId), reason).Add(float64(n))
+}
+
+func countSent(appId string, transport string, n int) {
+	bytesSentCounter.WithLabelValues(appLabel(appId), transport).Add(float64(n))
+	appUsage.sent(appId, n)
+}
+
+func countBroadcast(appId string) {
+	messagesBroadcastCounter.WithLabelValues(appLabel(appId)).Inc()
+	appUsage.message(appId)
+}
+
+func countReceived(appId string, transport string, n int) {
+	bytesReceivedCounter.WithLabelValues(appLabel(appId), transport).Add(float64(n))
+}
+
+func countUpgradeFailure(transport string, reason string) {
+	upgradeFailuresCounter.WithLabelValues(transport, reason).Inc()
+}
+
+func countAuthFailure(method string, reason string) {
+	authFailuresCounter.WithLabelValues(method, reason).Inc()
+}
+
+// observeBcrypt times a bcrypt comparison, see bcryptDuration
+func observeBcrypt(kind string, start time.Time) {
+	bcryptDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+}
+
+// requestDuration records the latency of requests by route pattern, so path parameters do not create new series
+func requestDuration(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		httpRequestDuration.WithLabelValues(route, r.Method, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,377 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/bjarke-xyz/ws-gateway/internal/server/html"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// memberRole returns the role of the user in the organization, or the empty role if they are not a member
+func (s *server) memberRole(ctx context.Context, organizationId string, userId string) (domain.Role, error) {
+	member, err := s.organizationRepository.GetMember(ctx, organizationId, userId)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return member.Role, nil
+}
+
+// organizationsForUser returns the organizations the user is a member of, and the user's role in each.
+// Users that are not a member of any organization get a personal organization.
+func (s *server) organizationsForUser(ctx context.Context, token *auth.Token) ([]domain.Organization, map[string]domain.Role, error) {
+	memberships, err := s.organizationRepository.GetMembershipsByUserID(ctx, token.Subject)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(memberships) == 0 {
+		org := domain.Organization{ID: uuid.NewString(), Name: "Personal"}
+		owner := domain.OrganizationMember{OrganizationID: org.ID, UserID: token.Subject, Email: tokenEmail(token), Role: domain.RoleOwner}
+		err = s.organizationRepository.Create(ctx, &org, &owner)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create personal organization: %w", err)
+		}
+		memberships = append(memberships, owner)
+	}
+	roles := make(map[string]domain.Role)
+	for _, membership := range memberships {
+		roles[membership.OrganizationID] = membership.Role
+	}
+	orgs, err := s.organizationRepository.GetByUserID(ctx, token.Subject)
+	if err != nil {
+		return nil, nil, err
+	}
+	return orgs, roles, nil
+}
+
+// defaultOrganization returns the organization to create apps and keys in when none is given,
+// which is only possible when the user is a member of a single organization
+func (s *server) defaultOrganization(ctx context.Context, token *auth.Token) (string, error) {
+	orgs, _, err := s.organizationsForUser(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	if len(orgs) != 1 {
+		return "", nil
+	}
+	return orgs[0].ID, nil
+}
+
+func organizationIDs(orgs []domain.Organization) []string {
+	ids := make([]string, 0, len(orgs))
+	for _, org := range orgs {
+		ids = append(ids, org.ID)
+	}
+	return ids
+}
+
+func tokenEmail(token *auth.Token) string {
+	email, _ := token.Claims["email"].(string)
+	return email
+}
+
+// assignableRoles can be given to members directly, the owner role is only given by transferring ownership
+var assignableRoles = []domain.Role{domain.RoleAdmin, domain.RoleDeveloper, domain.RoleViewer}
+
+// organizationForAdmin returns the organization and the signed in user's role in it, if the role has the permission.
+// On failure the error is written to w and false is returned.
+func (s *server) organizationForAdmin(w http.ResponseWriter, r *http.Request, permission domain.Permission) (domain.Organization, domain.Role, bool) {
+	token, _, _ := TokenFromContext(r.Context())
+	orgId := chi.URLParam(r, "org-id")
+	org, err := s.organizationRepository.GetByID(r.Context(), orgId)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			w.WriteHeader(http.StatusForbidden)
+			return org, "", false
+		}
+		s.logger.Error("error getting organization", "error", err, "organizationId", orgId)
+		http.Error(w, "error getting organization", http.StatusInternalServerError)
+		return org, "", false
+	}
+	role, err := s.memberRole(r.Context(), org.ID, token.Subject)
+	if err != nil {
+		s.logger.Error("error getting organization member", "error", err, "organizationId", orgId)
+		http.Error(w, "error getting organization member", http.StatusInternalServerError)
+		return org, "", false
+	}
+	if !role.Can(permission) {
+		w.WriteHeader(http.StatusForbidden)
+		return org, role, false
+	}
+	return org, role, true
+}
+
+func redirectToOrganization(w http.ResponseWriter, r *http.Request, orgId string, errMsg string) {
+	http.Redirect(w, r, fmt.Sprintf("/admin/org/%v?%v", orgId, errorQuery(errMsg)), http.StatusSeeOther)
+}
+
+func (s *server) handleGetOrganization(w http.ResponseWriter, r *http.Request) {
+	token, _, _ := TokenFromContext(r.Context())
+	errMsgs := make([]string, 0)
+	if errMsg := r.URL.Query().Get("error"); errMsg != "" {
+		errMsgs = append(errMsgs, errMsg)
+	}
+	if chi.URLParam(r, "org-id") == "null" {
+		html.OrganizationPage(w, html.OrganizationParams{Title: "New organization", Errors: errMsgs})
+		return
+	}
+	org, role, ok := s.organizationForAdmin(w, r, domain.PermissionView)
+	if !ok {
+		return
+	}
+	members, err := s.organizationRepository.GetMembers(r.Context(), org.ID)
+	if err != nil {
+		s.logger.Error("error getting organization members", "error", err, "organizationId", org.ID)
+		errMsgs = append(errMsgs, "Error getting members")
+	}
+	apps, err := s.appRepository.GetByOrganizationIDs(r.Context(), []string{org.ID})
+	if err != nil {
+		s.logger.Error("error getting apps by organization id", "error", err, "organizationId", org.ID)
+		errMsgs = append(errMsgs, "Error getting apps")
+	}
+	keys, err := s.keyRepository.GetByOrganizationIDs(r.Context(), []string{org.ID})
+	if err != nil {
+		s.logger.Error("error getting keys by organization id", "error", err, "organizationId", org.ID)
+		errMsgs = append(errMsgs, "Error getting keys")
+	}
+	err = s.truncateKeyPreviews(r.Context(), keys)
+	if err != nil {
+		s.logger.Error("error truncating key preview", "error", err)
+		errMsgs = append(errMsgs, "Error truncating key preview")
+	}
+	html.OrganizationPage(w, html.OrganizationParams{
+		Title:           org.Name,
+		Errors:          errMsgs,
+		Organization:    org,
+		Role:            role,
+		UserID:          token.Subject,
+		Members:         members,
+		AssignableRoles: assignableRoles,
+		Apps:            apps,
+		Keys:            keys,
+
+		CanEdit:               role.Can(domain.PermissionEdit),
+		CanDelete:             role.Can(domain.PermissionDelete),
+		CanManageMembers:      role.Can(domain.PermissionManageMembers),
+		CanManageOrganization: role.Can(domain.PermissionManageOrganization),
+	})
+}
+
+// handlePostOrganization creates, renames or deletes an organization
+func (s *server) handlePostOrganization(w http.ResponseWriter, r *http.Request) {
+	token, _, _ := TokenFromContext(r.Context())
+	name := strings.TrimSpace(r.FormValue("name"))
+	if chi.URLParam(r, "org-id") == "null" {
+		if name == "" {
+			http.Redirect(w, r, "/admin/org/null?"+errorQuery("missing name"), http.StatusSeeOther)
+			return
+		}
+		org := domain.Organization{ID: uuid.NewString(), Name: name}
+		owner := domain.OrganizationMember{OrganizationID: org.ID, UserID: token.Subject, Email: tokenEmail(token), Role: domain.RoleOwner}
+		err := s.organizationRepository.Create(r.Context(), &org, &owner)
+		if err != nil {
+			s.logger.Error("error creating organization", "error", err)
+			redirectToAdmin(w, r, "failed to create organization")
+			return
+		}
+		s.audit(r, domain.AuditEvent{Action: domain.AuditActionOrganizationCreate, OrganizationID: org.ID, TargetType: auditTargetOrganization, TargetID: org.ID}, nil, newAuditOrganization(org))
+		redirectToOrganization(w, r, org.ID, "")
+		return
+	}
+
+	if r.FormValue("delete") == "true" {
+		org, _, ok := s.organizationForAdmin(w, r, domain.PermissionManageOrganization)
+		if !ok {
+			return
+		}
+		apps, err := s.appRepository.GetByOrganizationIDs(r.Context(), []string{org.ID})
+		if err != nil {
+			s.logger.Error("error getting apps by organization id", "error", err, "organizationId", org.ID)
+			redirectToOrganization(w, r, org.ID, "error getting apps")
+			return
+		}
+		keys, err := s.keyRepository.GetByOrganizationIDs(r.Context(), []string{org.ID})
+		if err != nil {
+			s.logger.Error("error getting keys by organization id", "error", err, "organizationId", org.ID)
+			redirectToOrganization(w, r, org.ID, "error getting keys")
+			return
+		}
+		if len(apps) > 0 || len(keys) > 0 {
+			redirectToOrganization(w, r, org.ID, "delete the apps and keys of the organization first")
+			return
+		}
+		err = s.organizationRepository.Delete(r.Context(), org.ID)
+		if err != nil {
+			s.logger.Error("failed to delete organization", "error", err, "organizationId", org.ID)
+			redirectToOrganization(w, r, org.ID, "failed to delete")
+			return
+		}
+		s.audit(r, domain.AuditEvent{Action: domain.AuditActionOrganizationDelete, OrganizationID: org.ID, TargetType: auditTargetOrganization, TargetID: org.ID}, newAuditOrganization(org), nil)
+		redirectToAdmin(w, r, "")
+		return
+	}
+
+	org, _, ok := s.organizationForAdmin(w, r, domain.PermissionManageMembers)
+	if !ok {
+		return
+	}
+	if name == "" {
+		redirectToOrganization(w, r, org.ID, "missing name")
+		return
+	}
+	before := newAuditOrganization(org)
+	org.Name = name
+	err := s.organizationRepository.Update(r.Context(), &org)
+	if err != nil {
+		s.logger.Error("failed to update organization", "error", err, "organizationId", org.ID)
+		redirectToOrganization(w, r, org.ID, "failed to update")
+		return
+	}
+	s.audit(r, domain.AuditEvent{Action: domain.AuditActionOrganizationUpdate, OrganizationID: org.ID, TargetType: auditTargetOrganization, TargetID: org.ID}, before, newAuditOrganization(org))
+	redirectToOrganization(w, r, org.ID, "")
+}
+
+// handlePostOrganizationMember adds a member by email, changes the role of a member, or removes a member.
+// Members can always leave, except the owner who must transfer ownership first.
+func (s *server) handlePostOrganizationMember(w http.ResponseWriter, r *http.Request) {
+	token, _, _ := TokenFromContext(r.Context())
+	action := r.FormValue("action")
+	userId := r.FormValue("user_id")
+	leaving := action == "remove" && userId == token.Subject
+	permission := domain.PermissionManageMembers
+	if leaving {
+		permission = domain.PermissionView
+	}
+	org, _, ok := s.organizationForAdmin(w, r, permission)
+	if !ok {
+		return
+	}
+
+	role := domain.Role(r.FormValue("role"))
+	if action != "remove" && !slices.Contains(assignableRoles, role) {
+		redirectToOrganization(w, r, org.ID, "invalid role, ownership is given by transferring it")
+		return
+	}
+
+	if action == "add" {
+		email := strings.TrimSpace(r.FormValue("email"))
+		firebaseAuth, err := s.app.Auth(r.Context())
+		if err != nil {
+			s.logger.Error("failed to get firebase auth", "error", err)
+			redirectToOrganization(w, r, org.ID, "internal error")
+			return
+		}
+		user, err := firebaseAuth.GetUserByEmail(r.Context(), email)
+		if err != nil {
+			if auth.IsUserNotFound(err) {
+				redirectToOrganization(w, r, org.ID, fmt.Sprintf("no user with email %v, they must sign up first", email))
+				return
+			}
+			s.logger.Error("failed to get user by email", "error", err)
+			redirectToOrganization(w, r, org.ID, "failed to get user")
+			return
+		}
+		existing, err := s.memberRole(r.Context(), org.ID, user.UID)
+		if err != nil {
+			s.logger.Error("error getting organization member", "error", err, "organizationId", org.ID)
+			redirectToOrganization(w, r, org.ID, "error getting member")
+			return
+		}
+		if existing != "" {
+			redirectToOrganization(w, r, org.ID, fmt.Sprintf("%v is already a member", email))
+			return
+		}
+		member := domain.OrganizationMember{OrganizationID: org.ID, UserID: user.UID, Email: email, Role: role}
+		err = s.organizationRepository.AddMember(r.Context(), &member)
+		if err != nil {
+			s.logger.Error("failed to add organization member", "error", err, "organizationId", org.ID)
+			redirectToOrganization(w, r, org.ID, "failed to add member")
+			return
+		}
+		s.audit(r, domain.AuditEvent{Action: domain.AuditActionMemberAdd, OrganizationID: org.ID, TargetType: auditTargetMember, TargetID: member.UserID}, nil, auditMember{UserID: member.UserID, Email: member.Email, Role: member.Role})
+		redirectToOrganization(w, r, org.ID, "")
+		return
+	}
+
+	member, err := s.organizationRepository.GetMember(r.Context(), org.ID, userId)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			redirectToOrganization(w, r, org.ID, "member not found")
+			return
+		}
+		s.logger.Error("error getting organization member", "error", err, "organizationId", org.ID)
+		redirectToOrganization(w, r, org.ID, "error getting member")
+		return
+	}
+	if member.Role == domain.RoleOwner {
+		redirectToOrganization(w, r, org.ID, "the owner must transfer ownership first")
+		return
+	}
+	before := auditMember{UserID: member.UserID, Email: member.Email, Role: member.Role}
+	var after any
+	auditEvent := domain.AuditEvent{OrganizationID: org.ID, TargetType: auditTargetMember, TargetID: member.UserID}
+	switch action {
+	case "role":
+		err = s.organizationRepository.UpdateMemberRole(r.Context(), org.ID, userId, role)
+		after = auditMember{UserID: member.UserID, Email: member.Email, Role: role}
+		auditEvent.Action = domain.AuditActionMemberUpdate
+	case "remove":
+		err = s.organizationRepository.RemoveMember(r.Context(), org.ID, userId)
+		auditEvent.Action = domain.AuditActionMemberRemove
+	default:
+		redirectToOrganization(w, r, org.ID, "unknown action")
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed to update organization member", "error", err, "organizationId", org.ID, "action", action)
+		redirectToOrganization(w, r, org.ID, "failed to update member")
+		return
+	}
+	s.audit(r, auditEvent, before, after)
+	if leaving {
+		redirectToAdmin(w, r, "")
+		return
+	}
+	redirectToOrganization(w, r, org.ID, "")
+}
+
+// handlePostOrganizationTransfer makes another member the owner. The current owner becomes an admin.
+func (s *server) handlePostOrganizationTransfer(w http.ResponseWriter, r *http.Request) {
+	token, _, _ := TokenFromContext(r.Context())
+	org, _, ok := s.organizationForAdmin(w, r, domain.PermissionManageOrganization)
+	if !ok {
+		return
+	}
+	userId := r.FormValue("user_id")
+	if userId == token.Subject {
+		redirectToOrganization(w, r, org.ID, "you are already the owner")
+		return
+	}
+	member, err := s.organizationRepository.GetMember(r.Context(), org.ID, userId)
+	if err == nil {
+		err = s.organizationRepository.TransferOwnership(r.Context(), org.ID, token.Subject, userId)
+	}
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			redirectToOrganization(w, r, org.ID, "member not found")
+			return
+		}
+		s.logger.Error("failed to transfer ownership", "error", err, "organizationId", org.ID)
+		redirectToOrganization(w, r, org.ID, "failed to transfer ownership")
+		return
+	}
+	// The target is the new owner, the previous owner is the actor
+	s.audit(r, domain.AuditEvent{Action: domain.AuditActionOrganizationTransfer, OrganizationID: org.ID, TargetType: auditTargetMember, TargetID: userId},
+		auditMember{UserID: member.UserID, Email: member.Email, Role: member.Role}, auditMember{UserID: member.UserID, Email: member.Email, Role: domain.RoleOwner})
+	redirectToOrganization(w, r, org.ID, "")
+}
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	pollDefaultTimeout  = 30 * time.Second
+	pollMaxTimeout      = 60 * time.Second
+	pollSessionTTL      = 60 * time.Second
+	pollJanitorInterval = 10 * time.Second
+	pollMaxBuffered     = 1000
+)
+
+type polledMessage struct {
+	cursor    int64
+	data      []byte
+	expiresAt time.Time
+}
+
+// pollSession is a long-polling client. It stays subscribed to the topic between polls
+// and buffers messages until a poll with a cursor past them acknowledges them.
+type pollSession struct {
+	ID     string
+	client *WsClient
+	// ticketHash is the sha256 of the ticket the session was last polled with
+	ticketHash [32]byte
+	leave      func()
+	cancel     context.CancelFunc
+	// done is closed when the session has unsubscribed from the broker
+	done chan struct{}
+
+	mu         sync.Mutex
+	messages   []polledMessage
+	lastCursor int64
+	// wake is closed and replaced when a message is buffered
+	wake     chan struct{}
+	polling  int
+	lastPoll time.Time
+}
+
+func (ps *pollSession) listen(ctx context.Context, messageChan chan *WsMessage) {
+	broker := ps.client.Topic.Broker
+	defer close(ps.done)
+	defer broker.unsubscribe(messageChan)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-messageChan:
+			ps.mu.Lock()
+			ps.lastCursor++
+			ps.messages = append(ps.messages, polledMessage{cursor: ps.lastCursor, data: msg.Frame, expiresAt: msg.ExpiresAt})
+			if len(ps.messages) > pollMaxBuffered {
+				countDropped(ps.client.App.ID, dropReasonSlowClient, len(ps.messages)-pollMaxBuffered)
+				ps.messages = ps.messages[len(ps.messages)-pollMaxBuffered:]
+			}
+			close(ps.wake)
+			ps.wake = make(chan struct{})
+			ps.mu.Unlock()
+		}
+	}
+}
+
+// take acknowledges messages up to and including cursor, drops expired messages and returns the rest.
+// If nothing is buffered, the returned channel is closed when something is.
+func (ps *pollSession) take(cursor int64) ([]polledMessage, int64, chan struct{}) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	i := 0
+	for i < len(ps.messages) && ps.messages[i].cursor <= cursor {
+		i++
+	}
+	now := time.Now()
+	ps.messages = slices.DeleteFunc(ps.messages[i:], func(m polledMessage) bool {
+		return !m.expiresAt.IsZero() && now.After(m.expiresAt)
+	})
+	if cursor > ps.lastCursor {
+		cursor = ps.lastCursor
+	}
+	return ps.messages, cursor, ps.wake
+}
+
+func (ps *pollSession) startPoll() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.polling++
+}
+
+func (ps *pollSession) endPoll() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.polling--
+	ps.lastPoll = time.Now()
+}
+
+func (ps *pollSession) expired(now time.Time) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.polling == 0 && now.Sub(ps.lastPoll) > pollSessionTTL
+}
+
+type pollSessions struct {
+	sessions map[string]*pollSession
+	*sync.RWMutex
+}
+
+func (p *pollSessions) get(id string) *pollSession {
+	p.RLock()
+	defer p.RUnlock()
+	return p.sessions[id]
+}
+
+func (p *pollSessions) add(ps *pollSession) {
+	p.Lock()
+	defer p.Unlock()
+	p.sessions[ps.ID] = ps
+}
+
+// expire closes sessions that have not been polled for pollSessionTTL, until ctx is done
+func (p *pollSessions) expire(ctx context.Context) {
+	ticker := time.NewTicker(pollJanitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expired := make([]*pollSession, 0)
+			p.Lock()
+			for id, ps := range p.sessions {
+				if ps.expired(now) {
+					expired = append(expired, ps)
+					delete(p.sessions, id)
+				}
+			}
+			p.Unlock()
+			for _, ps := range expired {
+				ps.cancel()
+				<-ps.done
+				ps.leave()
+			}
+		}
+	}
+}
+
+type pollResponse struct {
+	Session  string            `json:"session"`
+	Cursor   int64             `json:"cursor"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// handlePoll is a long-polling fallback for clients that can use neither websockets nor SSE.
+// The first poll authenticates with a ticket and creates a session. Following polls pass the ticket, the session
+// and the cursor from the previous response, and are held until a message arrives or the timeout elapses.
+func (s *server) handlePoll(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	timeout := pollDefaultTimeout
+	if timeoutStr := query.Get("timeout"); timeoutStr != "" {
+		seconds, err := strconv.Atoi(timeoutStr)
+		if err != nil || seconds < 0 {
+			http.Error(w, "invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = min(time.Duration(seconds)*time.Second, pollMaxTimeout)
+	}
+	var cursor int64
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		var err error
+		cursor, err = strconv.ParseInt(cursorStr, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var ps *pollSession
+	if sessionId := query.Get("session"); sessionId != "" {
+		ps = s.pollSessions.get(sessionId)
+		if ps == nil {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		if ps.client.App.ID != chi.URLParam(r, "app-id") || ps.client.Topic.Topic != topicParam(r) {
+			http.Error(w, "session does not belong to topic", http.StatusBadRequest)
+			return
+		}
+		if !s.authorizePoll(w, r, ps) {
+			return
+		}
+	} else {
+		ticket, ok := s.ticketFromRequest(w, r, transportLongPoll)
+		if !ok {
+			return
+		}
+		filter, ok := filterFromRequest(w, r)
+		if !ok {
+			countUpgradeFailure(transportLongPoll, "invalid_filter")
+			return
+		}
+		ps = s.newPollSession(ticket, query.Get("token"), filter)
+	}
+
+	ps.startPoll()
+	defer ps.endPoll()
+	messages, cursor, wake := ps.take(cursor)
+	if len(messages) == 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timer.C:
+		case <-wake:
+			messages, cursor, _ = ps.take(cursor)
+		}
+	}
+
+	response := pollResponse{
+		Session:  ps.ID,
+		Cursor:   cursor,
+		Messages: make([]json.RawMessage, 0, len(messages)),
+	}
+	for _, msg := range messages {
+		response.Messages = append(response.Messages, msg.data)
+		response.Cursor = msg.cursor
+		countSent(ps.client.App.ID, transportLongPoll, len(msg.data))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	jsonResponse(w, http.StatusOK, response)
+}
+
+// authorizePoll checks that a poll of an existing session is made with the ticket of the session.
+// A new ticket is accepted if it is for the same user, so clients can replace expired tickets.
+// On failure the error is written to w and false is returned.
+func (s *server) authorizePoll(w http.ResponseWriter, r *http.Request, ps *pollSession) bool {
+	tokenStr := r.URL.Query().Get("token")
+	if tokenStr == "" {
+		countUpgradeFailure(transportLongPoll, "missing_ticket")
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return false
+	}
+	ticketHash := sha256.Sum256([]byte(tokenStr))
+	ps.mu.Lock()
+	sameTicket := subtle.ConstantTimeCompare(ticketHash[:], ps.ticketHash[:]) == 1
+	ps.mu.Unlock()
+	if sameTicket {
+		return true
+	}
+	ticket, ok := s.ticketFromRequest(w, r, transportLongPoll)
+	if !ok {
+		return false
+	}
+	if ticket.Token.UID != ps.client.userId() {
+		countUpgradeFailure(transportLongPoll, "session_user_mismatch")
+		http.Error(w, "session belongs to another user", http.StatusForbidden)
+		return false
+	}
+	ps.mu.Lock()
+	ps.ticketHash = ticketHash
+	ps.mu.Unlock()
+	return true
+}
+
+func (s *server) newPollSession(ticket verifiedTicket, ticketStr string, filter *messageFilter) *pollSession {
+	clientId := uuid.NewString()
+	client := &WsClient{
+		ID:        ClientID(clientId),
+		Token:     ticket.Token,
+		App:       ticket.App,
+		Transport: transportLongPoll,
+		Filter:    filter,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	// The session id is not the client id, as client ids are shown to admins
+	ps := &pollSession{
+		ID:         uuid.NewString(),
+		client:     client,
+		ticketHash: sha256.Sum256([]byte(ticketStr)),
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		wake:       make(chan struct{}),
+		lastPoll:   time.Now(),
+	}
+	leave := s.joinTopic(client, ticket.Topic)
+	untrack := trackConnection(ticket.App.ID, transportLongPoll)
+	ps.leave = func() {
+		untrack()
+		leave()
+	}
+	messageChan := make(chan *WsMessage)
+	client.Topic.Broker.subscribe(messageChan, client.Filter)
+	go ps.listen(ctx, messageChan)
+	s.pollSessions.add(ps)
+	return ps
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// poll sends a long poll for the topic with the query, and returns the status and the decoded response
+func poll(t *testing.T, ts *httptest.Server, appId string, topic string, query url.Values) (int, pollResponse) {
+	t.Helper()
+	resp, err := http.Get(ts.URL + "/poll/app/" + appId + "/topic/" + topic + "?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	response := pollResponse{}
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, response
+}
+
+func TestPollSession(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, _, _ := newTestApp(t, s, nil)
+	ticket := newTestTicket(t, s, app.ID, "user", "news")
+
+	status, created := poll(t, ts, app.ID, "news", url.Values{"token": {ticket}, "timeout": {"0"}})
+	if status != http.StatusOK {
+		t.Fatalf("creating session got status %v, want %v", status, http.StatusOK)
+	}
+	if created.Session == "" || created.Cursor != 0 || len(created.Messages) != 0 {
+		t.Fatalf("got %+v, want a new session without messages", created)
+	}
+
+	if err := s.publish(context.Background(), app.ID, "news", "published", map[string]any{"n": 1}, 0); err != nil {
+		t.Fatal(err)
+	}
+	query := url.Values{"token": {ticket}, "session": {created.Session}, "cursor": {"0"}, "timeout": {"5"}}
+	_, polled := poll(t, ts, app.ID, "news", query)
+	if polled.Cursor != 1 || len(polled.Messages) != 1 || !strings.Contains(string(polled.Messages[0]), `"event":"published"`) {
+		t.Fatalf("got %+v, want the published message at cursor 1", polled)
+	}
+	// Messages are kept until a poll with a cursor past them
+	query.Set("timeout", "0")
+	_, polled = poll(t, ts, app.ID, "news", query)
+	if polled.Cursor != 1 || len(polled.Messages) != 1 {
+		t.Errorf("got %+v polling from cursor 0 again, want the message again", polled)
+	}
+	query.Set("cursor", "1")
+	_, polled = poll(t, ts, app.ID, "news", query)
+	if polled.Cursor != 1 || len(polled.Messages) != 0 {
+		t.Errorf("got %+v polling from cursor 1, want no messages", polled)
+	}
+}
+
+func TestPollSessionTicket(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, _, _ := newTestApp(t, s, nil)
+	ticket := newTestTicket(t, s, app.ID, "user", "news")
+	_, created := poll(t, ts, app.ID, "news", url.Values{"token": {ticket}, "timeout": {"0"}})
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"no ticket", "", http.StatusUnauthorized},
+		{"unknown ticket", "unknown", http.StatusBadRequest},
+		{"ticket of another user", newTestTicket(t, s, app.ID, "other", "news"), http.StatusForbidden},
+		{"ticket for another topic", newTestTicket(t, s, app.ID, "user", "sports"), http.StatusBadRequest},
+		{"session ticket", ticket, http.StatusOK},
+		{"new ticket of the same user", newTestTicket(t, s, app.ID, "user", "news"), http.StatusOK},
+		// Replaced by the new ticket, and tickets can only be verified once
+		{"previous session ticket", ticket, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		status, _ := poll(t, ts, app.ID, "news", url.Values{"token": {tt.token}, "session": {created.Session}, "timeout": {"0"}})
+		if status != tt.status {
+			t.Errorf("%v: got status %v, want %v", tt.name, status, tt.status)
+		}
+	}
+}
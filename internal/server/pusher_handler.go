@@ -0,0 +1,657 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+)
+
+// Implementation of the Pusher channels protocol, so pusher-js clients and Pusher server libraries
+// can be pointed at the gateway. pusher-js uses the app id as the Pusher key, while server libraries
+// sign with the id and pusher secret of an api key with access to the app. Channels map to topics.
+// Only public- channels can be subscribed to without auth, so the app's other topics are not exposed.
+// Channel names are limited to the characters Pusher allows, which rules out wildcard topics.
+// See https://pusher.com/docs/channels/library_auth_reference/pusher-websockets-protocol/
+
+const (
+	pusherActivityTimeout  = 120
+	pusherSendBufferSize   = 64
+	pusherMaxTriggerBody   = 10 << 10
+	pusherMaxTriggerTopics = 100
+	pusherTimestampGrace   = 600
+	pusherDefaultEvent     = "message"
+	pusherKeyLookupTimeout = 5 * time.Second
+
+	pusherErrAppNotFound = 4001
+	pusherErrAppDisabled = 4003
+	pusherErrGeneric     = 4009
+)
+
+type pusherIncomingEvent struct {
+	Event   string          `json:"event"`
+	Channel string          `json:"channel"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type pusherOutgoingEvent struct {
+	Event   string `json:"event"`
+	Channel string `json:"channel,omitempty"`
+	Data    any    `json:"data"`
+	UserID  string `json:"user_id,omitempty"`
+}
+
+type pusherSubscribeData struct {
+	Channel     string `json:"channel"`
+	Auth        string `json:"auth"`
+	ChannelData string `json:"channel_data"`
+}
+
+type pusherChannelData struct {
+	UserID   string          `json:"user_id"`
+	UserInfo json.RawMessage `json:"user_info"`
+}
+
+var pusherChannelRegex = regexp.MustCompile(`^[A-Za-z0-9_\-=@,.;]{1,164}$`)
+
+// isValidPusherChannel reports whether channel is a valid Pusher channel name. Topic levels and
+// wildcards are not allowed, so a channel can not subscribe to other topics than its own.
+func isValidPusherChannel(channel string) bool {
+	return pusherChannelRegex.MatchString(channel)
+}
+
+func isPusherPublicChannel(channel string) bool {
+	return strings.HasPrefix(channel, "public-")
+}
+
+func isPusherPrivateChannel(channel string) bool {
+	return strings.HasPrefix(channel, "private-") || isPusherPresenceChannel(channel)
+}
+
+func isPusherPresenceChannel(channel string) bool {
+	return strings.HasPrefix(channel, "presence-")
+}
+
+var errInvalidPusherKey = errors.New("invalid pusher key")
+
+// pusherSecret returns the pusher secret of the api key, if the key gives access to the app
+func (s *server) pusherSecret(ctx context.Context, appId string, keyId string) (string, error) {
+	if keyId == "" {
+		return "", errInvalidPusherKey
+	}
+	key, err := s.keyRepository.GetByID(ctx, keyId)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return "", errInvalidPusherKey
+		}
+		return "", err
+	}
+	hasAccess := slices.ContainsFunc(key.Access, func(access domain.ApiKeyAccess) bool { return access.AppID == appId })
+	if !hasAccess || key.PusherSecret == "" {
+		return "", errInvalidPusherKey
+	}
+	return key.PusherSecret, nil
+}
+
+// pusherSign returns the hex encoded HMAC-SHA256 used for both channel auth and trigger signatures
+func pusherSign(secret string, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newPusherSocketId() string {
+	return fmt.Sprintf("%d.%d", rand.IntN(1_000_000_000), rand.IntN(1_000_000_000))
+}
+
+// pusherConn is a single pusher-js connection, which can be subscribed to many channels
+type pusherConn struct {
+	s        *server
+	conn     *websocket.Conn
+	app      domain.Application
+	socketId string
+	send     chan []byte
+	done     chan struct{}
+	// subscriptions is only accessed from the read loop
+	subscriptions map[string]*pusherSubscription
+}
+
+type pusherSubscription struct {
+	client      *WsClient
+	messageChan chan *WsMessage
+	leave       func()
+	stop        chan struct{}
+	stopped     chan struct{}
+	presence    *pusherChannelData
+}
+
+func (s *server) pusherHandler(w http.ResponseWriter, r *http.Request) {
+	socketId := newPusherSocketId()
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logger.Error("Error while upgrading pusher connection", "error", err)
+		countUpgradeFailure(transportPusher, "upgrade")
+		return
+	}
+	defer conn.Close()
+
+	pc := &pusherConn{
+		s:             s,
+		conn:          conn,
+		socketId:      socketId,
+		send:          make(chan []byte, pusherSendBufferSize),
+		done:          make(chan struct{}),
+		subscriptions: make(map[string]*pusherSubscription),
+	}
+
+	app, err := s.appRepository.GetByID(r.Context(), chi.URLParam(r, "key"))
+	if err != nil {
+		if !errors.Is(err, domain.ErrNotFound) {
+			s.logger.Error("error getting app", "error", err)
+		}
+		countUpgradeFailure(transportPusher, "app_not_found")
+		pc.writeError(pusherErrAppNotFound, "App not found")
+		return
+	}
+	if !app.PusherEnabled {
+		countUpgradeFailure(transportPusher, "app_disabled")
+		pc.writeError(pusherErrAppDisabled, "Pusher compatibility is not enabled for app")
+		return
+	}
+	pc.app = app
+	defer trackConnection(app.ID, transportPusher)()
+
+	go pc.writePump()
+	defer close(pc.done)
+	defer pc.unsubscribeAll()
+
+	connectionData, _ := json.Marshal(map[string]any{
+		"socket_id":        socketId,
+		"activity_timeout": pusherActivityTimeout,
+	})
+	pc.emit(pusherOutgoingEvent{Event: "pusher:connection_established", Data: string(connectionData)})
+
+	for {
+		_, msgBytes, err := conn.ReadMessage()
+		if err != nil {
+			s.logger.Info("pusher connection closed", "error", err, "socketId", socketId)
+			return
+		}
+		countReceived(app.ID, transportPusher, len(msgBytes))
+		event := pusherIncomingEvent{}
+		err = json.Unmarshal(msgBytes, &event)
+		if err != nil {
+			pc.emitError(pusherErrGeneric, "invalid event")
+			continue
+		}
+		switch {
+		case event.Event == "pusher:ping":
+			pc.emit(pusherOutgoingEvent{Event: "pusher:pong", Data: map[string]any{}})
+		case event.Event == "pusher:subscribe":
+			pc.subscribe(event.Data)
+		case event.Event == "pusher:unsubscribe":
+			data := pusherSubscribeData{}
+			_ = json.Unmarshal(event.Data, &data)
+			pc.unsubscribe(data.Channel)
+		case strings.HasPrefix(event.Event, "client-"):
+			pc.clientEvent(event)
+		}
+	}
+}
+
+func (pc *pusherConn) writePump() {
+	for {
+		select {
+		case <-pc.done:
+			return
+		case frame := <-pc.send:
+			err := pc.conn.WriteMessage(websocket.TextMessage, frame)
+			if err != nil {
+				pc.s.logger.Error("failed to write pusher msg", "error", err)
+				pc.conn.Close()
+				return
+			}
+			countSent(pc.app.ID, transportPusher, len(frame))
+		}
+	}
+}
+
+// emit queues the event, dropping it if the connection is too far behind
+func (pc *pusherConn) emit(event pusherOutgoingEvent) {
+	frame, err := json.Marshal(event)
+	if err != nil {
+		pc.s.logger.Error("failed to marshal pusher event", "error", err)
+		return
+	}
+	select {
+	case pc.send <- frame:
+	case <-pc.done:
+	default:
+		pc.s.logger.Warn("pusher send buffer full, dropping event", "socketId", pc.socketId)
+		countDropped(pc.app.ID, dropReasonSlowClient, 1)
+	}
+}
+
+func (pc *pusherConn) emitError(code int, message string) {
+	pc.emit(pusherOutgoingEvent{Event: "pusher:error", Data: map[string]any{"code": code, "message": message}})
+}
+
+// writeError is used before the write pump has started
+func (pc *pusherConn) writeError(code int, message string) {
+	_ = pc.conn.WriteJSON(pusherOutgoingEvent{Event: "pusher:error", Data: map[string]any{"code": code, "message": message}})
+}
+
+func (pc *pusherConn) subscriptionError(channel string, status int, message string) {
+	pc.emit(pusherOutgoingEvent{
+		Event:   "pusher:subscription_error",
+		Channel: channel,
+		Data:    map[string]any{"type": "AuthError", "error": message, "status": status},
+	})
+}
+
+func (pc *pusherConn) subscribe(rawData json.RawMessage) {
+	data := pusherSubscribeData{}
+	err := json.Unmarshal(rawData, &data)
+	if err != nil || data.Channel == "" {
+		pc.emitError(pusherErrGeneric, "invalid subscribe data")
+		return
+	}
+	if _, ok := pc.subscriptions[data.Channel]; ok {
+		return
+	}
+	var presence *pusherChannelData
+	switch {
+	case !isValidPusherChannel(data.Channel):
+		pc.subscriptionError(data.Channel, http.StatusBadRequest, "invalid channel name")
+		return
+	case isPusherPrivateChannel(data.Channel):
+		status, err := pc.verifyChannelAuth(data)
+		if err != nil {
+			pc.subscriptionError(data.Channel, status, err.Error())
+			return
+		}
+	case !isPusherPublicChannel(data.Channel):
+		pc.subscriptionError(data.Channel, http.StatusForbidden, "channels must start with public-, private- or presence-")
+		return
+	}
+	if isPusherPresenceChannel(data.Channel) {
+		presence = &pusherChannelData{}
+		err = json.Unmarshal([]byte(data.ChannelData), presence)
+		if err != nil || presence.UserID == "" {
+			pc.subscriptionError(data.Channel, http.StatusBadRequest, "invalid channel_data")
+			return
+		}
+	}
+
+	client := &WsClient{
+		ID:        ClientID(pc.socketId),
+		App:       pc.app,
+		Transport: transportPusher,
+	}
+	sub := &pusherSubscription{
+		client:      client,
+		messageChan: make(chan *WsMessage),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+		presence:    presence,
+	}
+	sub.leave = pc.s.joinTopic(client, data.Channel)
+	client.Topic.Broker.subscribe(sub.messageChan, nil)
+	pc.subscriptions[data.Channel] = sub
+	go pc.forward(data.Channel, sub)
+
+	succeededData := "{}"
+	if presence != nil {
+		members := pc.s.pusherPresence.add(client.Topic.ID, *presence, pc)
+		succeededData = members.subscriptionData()
+	}
+	pc.emit(pusherOutgoingEvent{Event: "pusher_internal:subscription_succeeded", Channel: data.Channel, Data: succeededData})
+}
+
+// verifyChannelAuth checks the auth of a private or presence channel subscription, which is
+// the id of an api key and the signature made with its pusher secret. On failure it returns the status to send.
+func (pc *pusherConn) verifyChannelAuth(data pusherSubscribeData) (int, error) {
+	keyId, signature, _ := strings.Cut(data.Auth, ":")
+	ctx, cancel := context.WithTimeout(context.Background(), pusherKeyLookupTimeout)
+	defer cancel()
+	secret, err := pc.s.pusherSecret(ctx, pc.app.ID, keyId)
+	if err != nil {
+		if errors.Is(err, errInvalidPusherKey) {
+			countAuthFailure(authMethodPusher, "invalid_channel_key")
+			return http.StatusUnauthorized, errors.New("invalid auth key")
+		}
+		pc.s.logger.Error("error getting pusher key", "error", err, "keyId", keyId)
+		return http.StatusInternalServerError, errors.New("error getting auth key")
+	}
+	stringToSign := pc.socketId + ":" + data.Channel
+	if isPusherPresenceChannel(data.Channel) {
+		stringToSign += ":" + data.ChannelData
+	}
+	if !hmac.Equal([]byte(pusherSign(secret, stringToSign)), []byte(signature)) {
+		countAuthFailure(authMethodPusher, "invalid_channel_signature")
+		return http.StatusUnauthorized, errors.New("invalid auth signature")
+	}
+	return 0, nil
+}
+
+// forward sends broadcasts on the channel to the connection until the subscription is stopped
+func (pc *pusherConn) forward(channel string, sub *pusherSubscription) {
+	defer close(sub.stopped)
+	defer sub.client.Topic.Broker.unsubscribe(sub.messageChan)
+	for {
+		select {
+		case <-sub.stop:
+			return
+		case msg := <-sub.messageChan:
+			if msg.SenderID == ClientID(pc.socketId) {
+				// Client events are not echoed back to the sender
+				continue
+			}
+			if msg.expired(time.Now()) {
+				// The client was too slow to receive it in time
+				countDropped(pc.app.ID, dropReasonExpired, 1)
+				continue
+			}
+			event := msg.Event
+			if event == "" {
+				event = pusherDefaultEvent
+			}
+			pc.emit(pusherOutgoingEvent{Event: event, Channel: channel, Data: pusherData(msg.Payload)})
+		}
+	}
+}
+
+// pusherData converts a payload to the string data pusher clients expect.
+// JSON strings are unquoted, anything else is sent as JSON text.
+func pusherData(payload json.RawMessage) string {
+	var str string
+	if json.Unmarshal(payload, &str) == nil {
+		return str
+	}
+	return string(payload)
+}
+
+func (pc *pusherConn) unsubscribe(channel string) {
+	sub, ok := pc.subscriptions[channel]
+	if !ok {
+		return
+	}
+	delete(pc.subscriptions, channel)
+	close(sub.stop)
+	<-sub.stopped
+	if sub.presence != nil {
+		pc.s.pusherPresence.remove(sub.client.Topic.ID, sub.presence.UserID, pc)
+	}
+	sub.leave()
+}
+
+func (pc *pusherConn) unsubscribeAll() {
+	for channel := range pc.subscriptions {
+		pc.unsubscribe(channel)
+	}
+}
+
+// clientEvent broadcasts a client-* event to the other subscribers of a private or presence channel
+func (pc *pusherConn) clientEvent(event pusherIncomingEvent) {
+	sub, ok := pc.subscriptions[event.Channel]
+	if !ok || !isPusherPrivateChannel(event.Channel) {
+		pc.emitError(pusherErrGeneric, "client events require a subscribed private or presence channel")
+		return
+	}
+	msg, err := newWsMessage(event.Event, event.Data)
+	if err != nil {
+		pc.emitError(pusherErrGeneric, "invalid client event data")
+		return
+	}
+	msg.SenderID = ClientID(pc.socketId)
+	// Delivered like broadcasts, so reliable and sequenced channels and wildcard subscribers get it too
+	err = pc.s.publishMessage(sub.client.App.ID, event.Channel, msg)
+	if err != nil && !errors.Is(err, errTopicNotFound) {
+		pc.s.logger.Error("failed to publish pusher client event", "error", err, "appId", sub.client.App.ID, "channel", event.Channel)
+		pc.emitError(pusherErrGeneric, "failed to publish client event")
+		return
+	}
+	pc.s.clientWebhook(sub.client, domain.WebhookEventClientMessage, clientMessageData(event.Data))
+}
+
+type pusherPresenceMember struct {
+	info  json.RawMessage
+	conns map[*pusherConn]bool
+}
+
+type pusherPresenceMembers map[string]*pusherPresenceMember
+
+func (m pusherPresenceMembers) subscriptionData() string {
+	ids := make([]string, 0, len(m))
+	hash := make(map[string]json.RawMessage, len(m))
+	for userId, member := range m {
+		ids = append(ids, userId)
+		hash[userId] = member.info
+	}
+	slices.Sort(ids)
+	data, _ := json.Marshal(map[string]any{
+		"presence": map[string]any{
+			"ids":   ids,
+			"hash":  hash,
+			"count": len(ids),
+		},
+	})
+	return string(data)
+}
+
+// pusherPresence tracks the members of presence channels. A user is a member as long as
+// at least one of their connections is subscribed.
+type pusherPresence struct {
+	channels map[TopicID]pusherPresenceMembers
+	*sync.Mutex
+}
+
+// add returns a snapshot of the members, including the added one
+func (p *pusherPresence) add(topicId TopicID, member pusherChannelData, pc *pusherConn) pusherPresenceMembers {
+	p.Lock()
+	defer p.Unlock()
+	members, ok := p.channels[topicId]
+	if !ok {
+		members = make(pusherPresenceMembers)
+		p.channels[topicId] = members
+	}
+	existing, ok := members[member.UserID]
+	if !ok {
+		existing = &pusherPresenceMember{info: member.UserInfo, conns: make(map[*pusherConn]bool)}
+		members[member.UserID] = existing
+		data, _ := json.Marshal(map[string]any{"user_id": member.UserID, "user_info": member.UserInfo})
+		p.notify(members, pc, "pusher_internal:member_added", topicId, string(data))
+	}
+	existing.conns[pc] = true
+	snapshot := make(pusherPresenceMembers, len(members))
+	for userId, m := range members {
+		snapshot[userId] = &pusherPresenceMember{info: m.info}
+	}
+	return snapshot
+}
+
+func (p *pusherPresence) remove(topicId TopicID, userId string, pc *pusherConn) {
+	p.Lock()
+	defer p.Unlock()
+	members, ok := p.channels[topicId]
+	if !ok {
+		return
+	}
+	member, ok := members[userId]
+	if !ok {
+		return
+	}
+	delete(member.conns, pc)
+	if len(member.conns) > 0 {
+		return
+	}
+	delete(members, userId)
+	if len(members) == 0 {
+		delete(p.channels, topicId)
+	}
+	data, _ := json.Marshal(map[string]any{"user_id": userId})
+	p.notify(members, pc, "pusher_internal:member_removed", topicId, string(data))
+}
+
+func (p *pusherPresence) notify(members pusherPresenceMembers, except *pusherConn, event string, topicId TopicID, data string) {
+	_, channel, _ := strings.Cut(string(topicId), ":")
+	for _, member := range members {
+		for conn := range member.conns {
+			if conn != except {
+				conn.emit(pusherOutgoingEvent{Event: event, Channel: channel, Data: data})
+			}
+		}
+	}
+}
+
+type pusherTriggerInput struct {
+	Name     string   `json:"name"`
+	Data     string   `json:"data"`
+	Channel  string   `json:"channel"`
+	Channels []string `json:"channels"`
+	SocketID string   `json:"socket_id"`
+}
+
+// handlePusherTrigger implements the Pusher HTTP api for triggering events, authenticated with a
+// request signature made with the pusher secret of the api key given as auth_key
+func (s *server) handlePusherTrigger(w http.ResponseWriter, r *http.Request) {
+	appId := chi.URLParam(r, "app-id")
+	app, err := s.appRepository.GetByID(r.Context(), appId)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			http.Error(w, "app not found", http.StatusNotFound)
+			return
+		}
+		s.logger.Error("error getting app", "error", err, "appId", appId)
+		http.Error(w, "error getting app", http.StatusInternalServerError)
+		return
+	}
+	if !app.PusherEnabled {
+		http.Error(w, "pusher compatibility is not enabled for app", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, pusherMaxTriggerBody+1))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > pusherMaxTriggerBody {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	secret, err := s.pusherSecret(r.Context(), app.ID, r.URL.Query().Get("auth_key"))
+	if err != nil {
+		if errors.Is(err, errInvalidPusherKey) {
+			countAuthFailure(authMethodPusher, "invalid_key")
+			http.Error(w, "invalid auth_key", http.StatusUnauthorized)
+			return
+		}
+		s.logger.Error("error getting pusher key", "error", err, "appId", appId)
+		http.Error(w, "error getting auth_key", http.StatusInternalServerError)
+		return
+	}
+	err = verifyPusherRequest(secret, r, body)
+	if err != nil {
+		countAuthFailure(authMethodPusher, "invalid_signature")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	input := pusherTriggerInput{}
+	err = json.Unmarshal(body, &input)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode input: %v", err.Error()), http.StatusBadRequest)
+		return
+	}
+	channels := input.Channels
+	if input.Channel != "" {
+		channels = append(channels, input.Channel)
+	}
+	if input.Name == "" || len(channels) == 0 {
+		http.Error(w, "name and channels are required", http.StatusBadRequest)
+		return
+	}
+	if len(channels) > pusherMaxTriggerTopics {
+		http.Error(w, fmt.Sprintf("too many channels, max is %d", pusherMaxTriggerTopics), http.StatusBadRequest)
+		return
+	}
+	for _, channel := range channels {
+		if !isValidPusherChannel(channel) {
+			http.Error(w, fmt.Sprintf("invalid channel name: %v", channel), http.StatusBadRequest)
+			return
+		}
+	}
+
+	payload := json.RawMessage(input.Data)
+	if !json.Valid(payload) {
+		payload, _ = json.Marshal(input.Data)
+	}
+	for _, channel := range channels {
+		msg, err := newWsMessage(input.Name, payload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		msg.SenderID = ClientID(input.SocketID)
+		err = s.publishMessage(app.ID, channel, msg)
+		if err != nil && !errors.Is(err, errTopicNotFound) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{})
+}
+
+// verifyPusherRequest checks the auth_* query parameters of a Pusher HTTP api request, signed with secret
+func verifyPusherRequest(secret string, r *http.Request, body []byte) error {
+	query := r.URL.Query()
+	timestamp, err := strconv.ParseInt(query.Get("auth_timestamp"), 10, 64)
+	if err != nil {
+		return errors.New("invalid auth_timestamp")
+	}
+	if diff := time.Now().Unix() - timestamp; diff > pusherTimestampGrace || diff < -pusherTimestampGrace {
+		return errors.New("auth_timestamp expired")
+	}
+	if len(body) > 0 {
+		bodyMd5 := md5.Sum(body)
+		if query.Get("body_md5") != hex.EncodeToString(bodyMd5[:]) {
+			return errors.New("invalid body_md5")
+		}
+	}
+
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		if key != "auth_signature" {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		params = append(params, strings.ToLower(key)+"="+query.Get(key))
+	}
+	stringToSign := r.Method + "\n" + r.URL.Path + "\n" + strings.Join(params, "&")
+	expected := pusherSign(secret, stringToSign)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("auth_signature"))) {
+		return errors.New("invalid auth_signature")
+	}
+	return nil
+}
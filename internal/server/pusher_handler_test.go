@@ -0,0 +1,236 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/gorilla/websocket"
+)
+
+type pusherTestConn struct {
+	t        *testing.T
+	conn     *websocket.Conn
+	socketId string
+}
+
+func dialPusher(t *testing.T, serverURL string, appId string) *pusherTestConn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(serverURL, "http")+"/app/"+appId, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	pc := &pusherTestConn{t: t, conn: conn}
+	event := pc.read()
+	if event.Event != "pusher:connection_established" {
+		t.Fatalf("got event %v, want pusher:connection_established", event.Event)
+	}
+	var data struct {
+		SocketID string `json:"socket_id"`
+	}
+	var dataStr string
+	if err := json.Unmarshal(event.Data, &dataStr); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(dataStr), &data); err != nil {
+		t.Fatal(err)
+	}
+	pc.socketId = data.SocketID
+	return pc
+}
+
+type pusherTestEvent struct {
+	Event   string          `json:"event"`
+	Channel string          `json:"channel"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func (pc *pusherTestConn) read() pusherTestEvent {
+	pc.t.Helper()
+	pc.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	event := pusherTestEvent{}
+	if err := pc.conn.ReadJSON(&event); err != nil {
+		pc.t.Fatal(err)
+	}
+	return event
+}
+
+// subscribe returns the event answering the subscription
+func (pc *pusherTestConn) subscribe(channel string, auth string) pusherTestEvent {
+	pc.t.Helper()
+	data, _ := json.Marshal(pusherSubscribeData{Channel: channel, Auth: auth})
+	err := pc.conn.WriteJSON(pusherIncomingEvent{Event: "pusher:subscribe", Data: data})
+	if err != nil {
+		pc.t.Fatal(err)
+	}
+	return pc.read()
+}
+
+func TestPusherSubscribe(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, key, _ := newTestApp(t, s, func(app *domain.Application) { app.PusherEnabled = true })
+	_, otherKey, _ := newTestApp(t, s, func(app *domain.Application) { app.PusherEnabled = true })
+	pc := dialPusher(t, ts.URL, app.ID)
+
+	sign := func(key domain.ApiKey, channel string) string {
+		return key.ID + ":" + pusherSign(key.PusherSecret, pc.socketId+":"+channel)
+	}
+	tests := []struct {
+		name    string
+		channel string
+		auth    string
+		want    string
+	}{
+		{"public channel", "public-news", "", "pusher_internal:subscription_succeeded"},
+		{"channel without prefix", "orders", "", "pusher:subscription_error"},
+		{"private channel", "private-orders", sign(key, "private-orders"), "pusher_internal:subscription_succeeded"},
+		{"private channel without auth", "private-a", "", "pusher:subscription_error"},
+		{"private channel signed for another channel", "private-b", sign(key, "private-c"), "pusher:subscription_error"},
+		{"private channel signed by key of other app", "private-d", sign(otherKey, "private-d"), "pusher:subscription_error"},
+		// Wildcards would subscribe to every topic of the app, including private and presence channels
+		{"wildcard channel", "#", "", "pusher:subscription_error"},
+		{"public wildcard channel", "public-news/#", "", "pusher:subscription_error"},
+		{"single level wildcard channel", "public-+", "", "pusher:subscription_error"},
+		{"signed private wildcard channel", "private-#", sign(key, "private-#"), "pusher:subscription_error"},
+	}
+	for _, tt := range tests {
+		event := pc.subscribe(tt.channel, tt.auth)
+		if event.Event != tt.want || event.Channel != tt.channel {
+			t.Errorf("%v: got %v on %q, want %v", tt.name, event.Event, event.Channel, tt.want)
+		}
+	}
+}
+
+func TestPusherDisabled(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, _, _ := newTestApp(t, s, nil)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/app/"+app.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	event := pusherTestEvent{}
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Event != "pusher:error" {
+		t.Errorf("got event %v, want pusher:error", event.Event)
+	}
+}
+
+// signedTrigger returns a trigger request signed like the Pusher server libraries do
+func signedTrigger(t *testing.T, serverURL string, appId string, keyId string, secret string, body []byte) *http.Request {
+	t.Helper()
+	path := "/apps/" + appId + "/events"
+	bodyMd5 := md5.Sum(body)
+	query := url.Values{}
+	query.Set("auth_key", keyId)
+	query.Set("auth_timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	query.Set("auth_version", "1.0")
+	query.Set("body_md5", hex.EncodeToString(bodyMd5[:]))
+	// Encode sorts by key, as the signature requires
+	query.Set("auth_signature", pusherSign(secret, "POST\n"+path+"\n"+strings.ReplaceAll(query.Encode(), "%2F", "/")))
+	req, err := http.NewRequest(http.MethodPost, serverURL+path+"?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestPusherTrigger(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, key, _ := newTestApp(t, s, func(app *domain.Application) { app.PusherEnabled = true })
+	_, otherKey, _ := newTestApp(t, s, func(app *domain.Application) { app.PusherEnabled = true })
+	pc := dialPusher(t, ts.URL, app.ID)
+	pc.subscribe("public-news", "")
+
+	body := []byte(`{"name":"greeting","channel":"public-news","data":"{\"text\":\"hi\"}"}`)
+	tests := []struct {
+		name   string
+		keyId  string
+		secret string
+		want   int
+	}{
+		{"key of app", key.ID, key.PusherSecret, http.StatusOK},
+		{"wrong secret", key.ID, "wrong", http.StatusUnauthorized},
+		{"key of other app", otherKey.ID, otherKey.PusherSecret, http.StatusUnauthorized},
+		{"app id as key", app.ID, key.PusherSecret, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		resp, err := http.DefaultClient.Do(signedTrigger(t, ts.URL, app.ID, tt.keyId, tt.secret, body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%v: got status %v, want %v", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+
+	event := pc.read()
+	if event.Event != "greeting" || event.Channel != "public-news" {
+		t.Errorf("got %v on %v, want greeting on public-news", event.Event, event.Channel)
+	}
+
+	wildcardBody := []byte(`{"name":"greeting","channels":["public-news","public-#"],"data":"{}"}`)
+	resp, err := http.DefaultClient.Do(signedTrigger(t, ts.URL, app.ID, key.ID, key.PusherSecret, wildcardBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %v for a wildcard channel, want %v", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestPusherClientEvent(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, key, _ := newTestApp(t, s, func(app *domain.Application) {
+		app.PusherEnabled = true
+		app.SequencedTopics = []string{"private-chat"}
+	})
+	wildcardChan := subscribeTopic(t, s, app, "#")
+	sender := dialPusher(t, ts.URL, app.ID)
+	receiver := dialPusher(t, ts.URL, app.ID)
+	for _, pc := range []*pusherTestConn{sender, receiver} {
+		auth := key.ID + ":" + pusherSign(key.PusherSecret, pc.socketId+":private-chat")
+		if event := pc.subscribe("private-chat", auth); event.Event != "pusher_internal:subscription_succeeded" {
+			t.Fatalf("got %v subscribing, want pusher_internal:subscription_succeeded", event.Event)
+		}
+	}
+
+	err := sender.conn.WriteJSON(pusherIncomingEvent{Event: "client-typing", Channel: "private-chat", Data: json.RawMessage(`{"user":"a"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := receiver.read()
+	if event.Event != "client-typing" || event.Channel != "private-chat" {
+		t.Errorf("got %v on %v, want client-typing on private-chat", event.Event, event.Channel)
+	}
+	select {
+	case msg := <-wildcardChan:
+		if msg.Event != "client-typing" || msg.Topic != "private-chat" {
+			t.Errorf("wildcard subscriber got %v on %v, want client-typing on private-chat", msg.Event, msg.Topic)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wildcard subscriber did not get the client event")
+	}
+	messages, err := s.topicMessageRepository.GetRange(context.Background(), app.ID, "private-chat", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Event != "client-typing" {
+		t.Errorf("got %v stored messages, want the client event with a sequence number", len(messages))
+	}
+}
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/google/uuid"
+)
+
+// At-least-once delivery for reliable topics. A user subscribes to a reliable topic by connecting to it
+// by websocket, and the subscription outlives the connection. Every message published to the topic is
+// tracked per subscription until one of the user's connections acknowledges it, also while the user is
+// offline. Unacknowledged messages are resent after the ack timeout, and when the user connects again.
+// Messages that exceed the max attempts, or are not acknowledged within ackRetention, are moved to the
+// dead letters. Subscriptions without pending messages are forgotten ackRetention after the user left.
+
+const (
+	ackTrackerInterval = 1 * time.Second
+	ackRetention       = 24 * time.Hour
+	deadLetterTimeout  = 5 * time.Second
+
+	deadLetterReasonMaxAttempts = "max delivery attempts exceeded"
+	deadLetterReasonExpired     = "not acknowledged within retention"
+)
+
+type topicReliability struct {
+	AckTimeout  time.Duration
+	MaxAttempts int
+}
+
+func newTopicReliability(app domain.Application, topic string) *topicReliability {
+	if !app.IsReliableTopic(topic) {
+		return nil
+	}
+	reliability := &topicReliability{
+		AckTimeout:  time.Duration(app.AckTimeoutSeconds) * time.Second,
+		MaxAttempts: app.MaxDeliveryAttempts,
+	}
+	if reliability.AckTimeout <= 0 {
+		reliability.AckTimeout = domain.DefaultAckTimeoutSeconds * time.Second
+	}
+	if reliability.MaxAttempts <= 0 {
+		reliability.MaxAttempts = domain.DefaultMaxDeliveryAttempts
+	}
+	return reliability
+}
+
+// wsAck is sent by clients to acknowledge a message
+type wsAck struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// parseAck returns the acknowledged message id, if msgBytes is an ack
+func parseAck(msgBytes []byte) (string, bool) {
+	ack := wsAck{}
+	err := json.Unmarshal(msgBytes, &ack)
+	if err != nil || ack.Type != "ack" || ack.ID == "" {
+		return "", false
+	}
+	return ack.ID, true
+}
+
+type pendingDelivery struct {
+	msg *WsMessage
+	// attempts counts the times the message was sent to the user, once for all of the user's connections
+	attempts    int
+	firstSent   time.Time
+	nextAttempt time.Time
+}
+
+type subscriptionKey struct {
+	topicId TopicID
+	userId  string
+}
+
+// topicSubscriptions holds the subscriptions of a reliable topic, keyed by user id
+type topicSubscriptions struct {
+	appId       string
+	topic       string
+	reliability topicReliability
+	users       map[string]*subscription
+}
+
+type subscription struct {
+	// connections counts the user's websocket connections to the topic
+	connections int
+	// filter is the filter of the user's latest connection. Messages it does not match are not tracked.
+	filter *messageFilter
+	// disconnectedAt is when the user's last connection closed
+	disconnectedAt time.Time
+	messages       map[string]*pendingDelivery
+}
+
+// ackTracker outlives topics, so messages can be redelivered when a user reconnects
+type ackTracker struct {
+	logger        *slog.Logger
+	deadLetters   domain.DeadLetterRepository
+	subscriptions map[TopicID]*topicSubscriptions
+	// wildcards holds the wildcard topics with subscriptions of each app, keyed by app id
+	wildcards map[string]*topicTrie
+	*sync.Mutex
+}
+
+func newAckTracker(logger *slog.Logger, deadLetters domain.DeadLetterRepository) *ackTracker {
+	return &ackTracker{
+		logger:        logger,
+		deadLetters:   deadLetters,
+		subscriptions: make(map[TopicID]*topicSubscriptions),
+		wildcards:     make(map[string]*topicTrie),
+		Mutex:         &sync.Mutex{},
+	}
+}
+
+// subscribed is called when a websocket client connects to a reliable topic. Pending messages of the
+// user are made due, so they are resent to the new connection.
+func (t *ackTracker) subscribed(client *WsClient) {
+	tp := client.Topic
+	t.Lock()
+	defer t.Unlock()
+	ts, ok := t.subscriptions[tp.ID]
+	if !ok {
+		ts = &topicSubscriptions{
+			appId:       tp.AppID,
+			topic:       tp.Topic,
+			reliability: *tp.Reliability,
+			users:       make(map[string]*subscription),
+		}
+		t.subscriptions[tp.ID] = ts
+		if isWildcardTopic(tp.Topic) {
+			trie, ok := t.wildcards[tp.AppID]
+			if !ok {
+				trie = newTopicTrie()
+				t.wildcards[tp.AppID] = trie
+			}
+			trie.insert(tp.Topic, tp.ID)
+		}
+	}
+	sub, ok := ts.users[client.userId()]
+	if !ok {
+		sub = &subscription{messages: make(map[string]*pendingDelivery)}
+		ts.users[client.userId()] = sub
+	}
+	sub.connections++
+	sub.filter = client.Filter
+	now := time.Now()
+	for _, delivery := range sub.messages {
+		delivery.nextAttempt = now
+	}
+}
+
+// unsubscribed is called when a websocket client on a reliable topic disconnects
+func (t *ackTracker) unsubscribed(client *WsClient) {
+	t.Lock()
+	defer t.Unlock()
+	sub, ok := t.subscription(client.Topic.ID, client.userId())
+	if !ok {
+		return
+	}
+	sub.connections--
+	if sub.connections == 0 {
+		sub.disconnectedAt = time.Now()
+	}
+}
+
+// topics returns the topics with subscriptions that messages published to topic are delivered to,
+// including wildcard topics
+func (t *ackTracker) topics(appId string, topic string) []TopicID {
+	t.Lock()
+	defer t.Unlock()
+	topicIds := make([]TopicID, 0)
+	if topicId := CreateTopicID(appId, topic); t.subscriptions[topicId] != nil {
+		topicIds = append(topicIds, topicId)
+	}
+	if trie, ok := t.wildcards[appId]; ok {
+		topicIds = append(topicIds, trie.match(topic)...)
+	}
+	return topicIds
+}
+
+// published tracks msg for every subscription of the topic, before it is handed to the broker.
+// Users that are connected get the message from the broker, which counts as the first attempt.
+func (t *ackTracker) published(topicId TopicID, msg *WsMessage) {
+	if msg.ID == "" {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	now := time.Now()
+	in := &filterInput{msg: msg}
+	ts, ok := t.subscriptions[topicId]
+	if !ok {
+		return
+	}
+	for _, sub := range ts.users {
+		if !sub.filter.matches(in) {
+			continue
+		}
+		delivery := &pendingDelivery{msg: msg, firstSent: now, nextAttempt: now.Add(ts.reliability.AckTimeout)}
+		if sub.connections > 0 {
+			delivery.attempts = 1
+		}
+		sub.messages[msg.ID] = delivery
+	}
+}
+
+func (t *ackTracker) ack(client *WsClient, msgId string) {
+	t.Lock()
+	defer t.Unlock()
+	sub, ok := t.subscription(client.Topic.ID, client.userId())
+	if !ok {
+		return
+	}
+	delete(sub.messages, msgId)
+}
+
+// subscription returns the subscription of the user to the topic. The caller must hold the lock.
+func (t *ackTracker) subscription(topicId TopicID, userId string) (*subscription, bool) {
+	ts, ok := t.subscriptions[topicId]
+	if !ok {
+		return nil, false
+	}
+	sub, ok := ts.users[userId]
+	return sub, ok
+}
+
+type dueDelivery struct {
+	key subscriptionKey
+	msg *WsMessage
+}
+
+// run redelivers due messages and dead-letters exhausted ones until ctx is done.
+// redeliver returns false if the user has no connection to resend to.
+func (t *ackTracker) run(ctx context.Context, redeliver func(topicId TopicID, userId string, msg *WsMessage) bool) {
+	ticker := time.NewTicker(ackTrackerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			due, deadLetters := t.collect(now)
+			for _, d := range due {
+				if !redeliver(d.key.topicId, d.key.userId, d.msg) {
+					t.postpone(d.key, d.msg.ID)
+				}
+			}
+			for _, deadLetter := range deadLetters {
+				t.saveDeadLetter(deadLetter)
+			}
+		}
+	}
+}
+
+func (t *ackTracker) collect(now time.Time) ([]dueDelivery, []*domain.DeadLetter) {
+	t.Lock()
+	defer t.Unlock()
+	due := make([]dueDelivery, 0)
+	deadLetters := make([]*domain.DeadLetter, 0)
+	for topicId, ts := range t.subscriptions {
+		for userId, sub := range ts.users {
+			key := subscriptionKey{topicId: topicId, userId: userId}
+			for msgId, delivery := range sub.messages {
+				if now.Before(delivery.nextAttempt) {
+					continue
+				}
+				if delivery.msg.expired(now) {
+					// Past its ttl the message is dropped rather than dead-lettered
+					delete(sub.messages, msgId)
+					countDropped(ts.appId, dropReasonExpired, 1)
+					continue
+				}
+				reason := ""
+				if delivery.attempts >= ts.reliability.MaxAttempts {
+					reason = deadLetterReasonMaxAttempts
+				} else if now.Sub(delivery.firstSent) > ackRetention {
+					reason = deadLetterReasonExpired
+				}
+				if reason == "" {
+					delivery.nextAttempt = now.Add(ts.reliability.AckTimeout)
+					// Offline users get the message when they connect again, see subscribed
+					if sub.connections > 0 {
+						delivery.attempts++
+						due = append(due, dueDelivery{key: key, msg: delivery.msg})
+					}
+					continue
+				}
+				delete(sub.messages, msgId)
+				countDropped(ts.appId, dropReasonDeadLettered, 1)
+				deadLetters = append(deadLetters, &domain.DeadLetter{
+					ID:        uuid.NewString(),
+					AppID:     ts.appId,
+					Topic:     ts.topic,
+					UserID:    userId,
+					MessageID: msgId,
+					Event:     delivery.msg.Event,
+					Payload:   delivery.msg.Payload,
+					Attempts:  delivery.attempts,
+					Reason:    reason,
+				})
+			}
+			if sub.connections == 0 && len(sub.messages) == 0 && now.Sub(sub.disconnectedAt) > ackRetention {
+				delete(ts.users, userId)
+			}
+		}
+		if len(ts.users) == 0 {
+			t.deleteTopic(topicId, ts)
+		}
+	}
+	return due, deadLetters
+}
+
+// deleteTopic forgets a topic without subscriptions. The caller must hold the lock.
+func (t *ackTracker) deleteTopic(topicId TopicID, ts *topicSubscriptions) {
+	delete(t.subscriptions, topicId)
+	if trie, ok := t.wildcards[ts.appId]; ok && isWildcardTopic(ts.topic) {
+		trie.remove(ts.topic)
+		if trie.empty() {
+			delete(t.wildcards, ts.appId)
+		}
+	}
+}
+
+// postpone is used when the user had no connection to resend to. It does not count as an attempt.
+func (t *ackTracker) postpone(key subscriptionKey, msgId string) {
+	t.Lock()
+	defer t.Unlock()
+	sub, ok := t.subscription(key.topicId, key.userId)
+	if !ok {
+		return
+	}
+	delivery, ok := sub.messages[msgId]
+	if !ok {
+		return
+	}
+	delivery.attempts--
+}
+
+func (t *ackTracker) saveDeadLetter(deadLetter *domain.DeadLetter) {
+	ctx, cancel := context.WithTimeout(context.Background(), deadLetterTimeout)
+	defer cancel()
+	err := t.deadLetters.Create(ctx, deadLetter)
+	if err != nil {
+		t.logger.Error("failed to save dead letter", "error", err, "appId", deadLetter.AppID, "messageId", deadLetter.MessageID)
+	}
+}
+
+// redeliver resends msg to the user's websocket connections on the topic
+func (s *server) redeliver(topicId TopicID, userId string, msg *WsMessage) bool {
+	tp := s.wsTopicCollection.getTopicByID(topicId)
+	if tp == nil {
+		return false
+	}
+	tp.RLock()
+	defer tp.RUnlock()
+	redelivered := false
+	for _, client := range tp.Clients {
+		if client.redeliver == nil || client.userId() != userId {
+			continue
+		}
+		select {
+		case client.redeliver <- msg:
+			redelivered = true
+		default:
+		}
+	}
+	return redelivered
+}
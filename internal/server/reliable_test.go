@@ -0,0 +1,122 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/bjarke-xyz/ws-gateway/internal/repository"
+)
+
+func newTestAckTracker() *ackTracker {
+	return newAckTracker(slog.New(slog.NewTextHandler(io.Discard, nil)), repository.NewMemoryDeadLetter())
+}
+
+func reliableClient(topic *WsTopic, userId string) *WsClient {
+	return &WsClient{ID: ClientID(userId + "-" + time.Now().String()), Token: &auth.Token{UID: userId}, Topic: topic}
+}
+
+func reliableTopic(topic string) *WsTopic {
+	return &WsTopic{
+		AppID:       "app",
+		Topic:       topic,
+		ID:          CreateTopicID("app", topic),
+		Reliability: &topicReliability{AckTimeout: time.Second, MaxAttempts: 3},
+	}
+}
+
+func pending(t *testing.T, tracker *ackTracker, topic *WsTopic, userId string, msgId string) *pendingDelivery {
+	t.Helper()
+	tracker.Lock()
+	defer tracker.Unlock()
+	sub, ok := tracker.subscription(topic.ID, userId)
+	if !ok {
+		return nil
+	}
+	return sub.messages[msgId]
+}
+
+func TestAckTrackerCountsAttemptsPerSubscription(t *testing.T) {
+	tracker := newTestAckTracker()
+	topic := reliableTopic("orders")
+	tabs := []*WsClient{reliableClient(topic, "user"), reliableClient(topic, "user"), reliableClient(topic, "user")}
+	for _, tab := range tabs {
+		tracker.subscribed(tab)
+	}
+
+	tracker.published(topic.ID, &WsMessage{ID: "1"})
+	due, _ := tracker.collect(time.Now().Add(2 * time.Second))
+
+	if len(due) != 1 {
+		t.Errorf("got %v due deliveries, want 1 for all tabs of the user", len(due))
+	}
+	if attempts := pending(t, tracker, topic, "user", "1").attempts; attempts != 2 {
+		t.Errorf("got %v attempts, want 2", attempts)
+	}
+}
+
+func TestAckTrackerAckIsNotTrackedAgain(t *testing.T) {
+	tracker := newTestAckTracker()
+	topic := reliableTopic("orders")
+	first, second := reliableClient(topic, "user"), reliableClient(topic, "user")
+	tracker.subscribed(first)
+	tracker.subscribed(second)
+
+	tracker.published(topic.ID, &WsMessage{ID: "1"})
+	tracker.ack(first, "1")
+	due, _ := tracker.collect(time.Now().Add(2 * time.Second))
+
+	if len(due) != 0 || pending(t, tracker, topic, "user", "1") != nil {
+		t.Error("acknowledged message is still tracked")
+	}
+}
+
+func TestAckTrackerTracksOfflineSubscribers(t *testing.T) {
+	tracker := newTestAckTracker()
+	topic := reliableTopic("orders/#")
+	client := reliableClient(topic, "user")
+	tracker.subscribed(client)
+	tracker.unsubscribed(client)
+
+	topicIds := tracker.topics("app", "orders/1")
+	if len(topicIds) != 1 || topicIds[0] != topic.ID {
+		t.Fatalf("got topics %v, want %v", topicIds, topic.ID)
+	}
+	tracker.published(topic.ID, &WsMessage{ID: "1"})
+	due, _ := tracker.collect(time.Now().Add(2 * time.Second))
+	if len(due) != 0 {
+		t.Errorf("got %v due deliveries while offline, want 0", len(due))
+	}
+	delivery := pending(t, tracker, topic, "user", "1")
+	if delivery == nil || delivery.attempts != 0 {
+		t.Fatalf("got delivery %+v, want it tracked without attempts", delivery)
+	}
+
+	tracker.subscribed(reliableClient(topic, "user"))
+	due, _ = tracker.collect(time.Now())
+	if len(due) != 1 || due[0].msg.ID != "1" {
+		t.Errorf("got due deliveries %+v after reconnecting, want message 1", due)
+	}
+}
+
+func TestAckTrackerDeadLettersAfterMaxAttempts(t *testing.T) {
+	tracker := newTestAckTracker()
+	topic := reliableTopic("orders")
+	tracker.subscribed(reliableClient(topic, "user"))
+
+	tracker.published(topic.ID, &WsMessage{ID: "1"})
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		now = now.Add(2 * time.Second)
+		due, deadLetters := tracker.collect(now)
+		if len(due) != 1 || len(deadLetters) != 0 {
+			t.Fatalf("attempt %v: got %v due and %v dead letters, want a redelivery", i+2, len(due), len(deadLetters))
+		}
+	}
+	_, deadLetters := tracker.collect(now.Add(2 * time.Second))
+	if len(deadLetters) != 1 || deadLetters[0].Attempts != 3 {
+		t.Errorf("got dead letters %+v, want one after 3 attempts", deadLetters)
+	}
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/google/cel-go/cel"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Content-based routing. Messages broadcast to a topic are also delivered to the target topics of
+// the app's routing rules whose source pattern and condition match. Routed messages are not routed
+// again, so rules cannot loop. Rules are cached per instance, see appCache.
+
+var targetPlaceholderRegex = regexp.MustCompile(`\{([^{}]+)\}`)
+
+type compiledRule struct {
+	rule      domain.RoutingRule
+	condition *messageFilter
+	transform cel.Program
+}
+
+// compileRule validates the rule. The error is meant to be shown in the admin ui.
+func compileRule(rule domain.RoutingRule) (*compiledRule, error) {
+	if rule.SourceTopic == "" {
+		return nil, fmt.Errorf("empty source topic")
+	}
+	if err := validateTopic(rule.SourceTopic); err != nil {
+		return nil, fmt.Errorf("source topic: %w", err)
+	}
+	if rule.TargetTopic == "" {
+		return nil, fmt.Errorf("empty target topic")
+	}
+	if strings.Count(rule.TargetTopic, "{") != strings.Count(rule.TargetTopic, "}") {
+		return nil, fmt.Errorf("unbalanced braces in target topic")
+	}
+	compiled := &compiledRule{rule: rule}
+	condition, err := compileFilter(rule.Condition)
+	if err != nil {
+		return nil, fmt.Errorf("condition: %w", err)
+	}
+	compiled.condition = condition
+	if rule.Transform != "" {
+		ast, issues := filterEnv.Compile(rule.Transform)
+		if issues.Err() != nil {
+			return nil, fmt.Errorf("invalid transform: %w", issues.Err())
+		}
+		compiled.transform, err = newFilterProgram(ast)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transform: %w", err)
+		}
+	}
+	return compiled, nil
+}
+
+// targetTopic replaces placeholders in the target topic. It returns false if a placeholder has no value.
+func (c *compiledRule) targetTopic(in *filterInput) (string, bool) {
+	ok := true
+	topic := targetPlaceholderRegex.ReplaceAllStringFunc(c.rule.TargetTopic, func(placeholder string) string {
+		value, found := lookupField(in.get()["payload"], placeholder[1:len(placeholder)-1])
+		if !found {
+			ok = false
+		}
+		return value
+	})
+	return topic, ok && topic != ""
+}
+
+// lookupField returns a scalar payload field, fieldPath is dot separated
+func lookupField(payload any, fieldPath string) (string, bool) {
+	value := payload
+	for _, key := range strings.Split(fieldPath, ".") {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		value, ok = obj[key]
+		if !ok {
+			return "", false
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return v, v != ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		return "", false
+	}
+}
+
+// apply returns the message to deliver to the target topic
+func (c *compiledRule) apply(msg *WsMessage, in *filterInput) (*WsMessage, error) {
+	payload := msg.Payload
+	if c.transform != nil {
+		out, err := evalFilterProgram(c.transform, in.get())
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate transform: %w", err)
+		}
+		value, err := out.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert transform result: %w", err)
+		}
+		payload, err = protojson.Marshal(value.(*structpb.Value))
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal transform result: %w", err)
+		}
+	}
+	routed, err := newWsMessage(msg.Event, payload)
+	if err != nil {
+		return nil, err
+	}
+	routed.ExpiresAt = msg.ExpiresAt
+	routed.SpanContext = msg.SpanContext
+	routed.TraceID = msg.TraceID
+	return routed, nil
+}
+
+// loadRoutingRules returns the compiled rules of the app. Rules that fail to compile are left out.
+func (s *server) loadRoutingRules(ctx context.Context, appId string) ([]*compiledRule, error) {
+	rules, err := s.routingRuleRepository.GetByAppID(ctx, appId)
+	if err != nil {
+		return nil, err
+	}
+	compiled := make([]*compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		c, err := compileRule(rule)
+		if err != nil {
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// route delivers msg to the target topics of matching rules, and returns the number of target topics it was delivered to
+func (s *server) route(appId string, topicName string, msg *WsMessage) int {
+	rules, err := s.routingRules.get(appId)
+	if err != nil {
+		s.logger.Error("failed to get routing rules", "error", err, "appId", appId)
+		return 0
+	}
+	routed := 0
+	in := &filterInput{msg: msg}
+	for _, rule := range rules {
+		if !matchTopic(rule.rule.SourceTopic, topicName) {
+			continue
+		}
+		if !rule.condition.matches(in) {
+			continue
+		}
+		target, ok := rule.targetTopic(in)
+		if !ok || target == topicName {
+			continue
+		}
+		routedMsg, err := rule.apply(msg, in)
+		if err != nil {
+			s.logger.Error("failed to apply routing rule", "error", err, "ruleId", rule.rule.ID)
+			continue
+		}
+		err = s.deliver(appId, target, routedMsg)
+		if err == nil {
+			routed++
+		} else if !errors.Is(err, errTopicNotFound) {
+			s.logger.Error("failed to deliver routed message", "error", err, "ruleId", rule.rule.ID, "topic", target)
+		}
+	}
+	return routed
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func TestPublishRoutedWithoutSourceSubscribers(t *testing.T) {
+	s, _ := newTestServer(t)
+	app, _, _ := newTestApp(t, s, nil)
+	rule := &domain.RoutingRule{ID: uuid.NewString(), AppID: app.ID, SourceTopic: "orders", TargetTopic: "audit"}
+	if err := s.routingRuleRepository.Create(context.Background(), rule); err != nil {
+		t.Fatal(err)
+	}
+	messageChan := subscribeTopic(t, s, app, "audit")
+
+	err := s.publish(context.Background(), app.ID, "orders", "created", map[string]any{"id": 1}, 0)
+	if err != nil {
+		t.Fatalf("got %v, want the routed broadcast to succeed", err)
+	}
+	select {
+	case msg := <-messageChan:
+		if msg.Event != "created" {
+			t.Errorf("got event %v, want created", msg.Event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("target topic did not get the routed message")
+	}
+
+	err = s.publish(context.Background(), app.ID, "invoices", "created", nil, 0)
+	if err != errTopicNotFound {
+		t.Errorf("got %v for a broadcast that was not routed, want errTopicNotFound", err)
+	}
+}
+
+func TestRouteSourceTopicWildcards(t *testing.T) {
+	s, _ := newTestServer(t)
+	app, _, _ := newTestApp(t, s, nil)
+	rules := map[string]string{"orders/#": "all-orders", "orders/+/items": "order-items"}
+	for source, target := range rules {
+		rule := &domain.RoutingRule{ID: uuid.NewString(), AppID: app.ID, SourceTopic: source, TargetTopic: target}
+		if err := s.routingRuleRepository.Create(context.Background(), rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	allOrders := subscribeTopic(t, s, app, "all-orders")
+	orderItems := subscribeTopic(t, s, app, "order-items")
+
+	tests := []struct {
+		topic   string
+		targets []chan *WsMessage
+	}{
+		{"orders", []chan *WsMessage{allOrders}},
+		{"orders/1/items", []chan *WsMessage{allOrders, orderItems}},
+		{"orders/1/items/2", []chan *WsMessage{allOrders}},
+		{"invoices/1/items", nil},
+	}
+	for _, tt := range tests {
+		if got := s.route(app.ID, tt.topic, &WsMessage{Payload: []byte(`{}`)}); got != len(tt.targets) {
+			t.Errorf("%v: routed to %v topics, want %v", tt.topic, got, len(tt.targets))
+		}
+		for _, target := range tt.targets {
+			select {
+			case <-target:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%v: target topic did not get the routed message", tt.topic)
+			}
+		}
+	}
+}
+
+func TestCompileRuleSourceTopic(t *testing.T) {
+	tests := []struct {
+		source string
+		valid  bool
+	}{
+		{"orders", true},
+		{"orders/+", true},
+		{"orders/#", true},
+		{"", false},
+		{"orders/#/items", false},
+		{"orders*", true},
+		{"orders+", false},
+	}
+	for _, tt := range tests {
+		_, err := compileRule(domain.RoutingRule{SourceTopic: tt.source, TargetTopic: "audit"})
+		if (err == nil) != tt.valid {
+			t.Errorf("%q: got %v, want valid %v", tt.source, err, tt.valid)
+		}
+	}
+}
+
+func TestAppForAdminNotFound(t *testing.T) {
+	s, _ := newTestServer(t)
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("app-id", uuid.NewString())
+	ctx := context.WithValue(context.Background(), chi.RouteCtxKey, routeCtx)
+	ctx = NewContext(ctx, &auth.Token{Subject: uuid.NewString()}, "", nil)
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	_, ok := s.appForAdmin(w, r, domain.PermissionView)
+
+	if ok || w.Code != http.StatusNotFound {
+		t.Errorf("got %v and status %v, want status %v", ok, w.Code, http.StatusNotFound)
+	}
+}
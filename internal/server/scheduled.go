@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/google/uuid"
+)
+
+// Scheduled broadcasts are kept in postgres until they are delivered, so they survive restarts.
+// Every instance polls for due messages, and the repository hands each message to one of them at a time.
+// A message is deleted once it is published. If the claiming instance has no clients on the topic, the
+// claim lapses so the message is tried again, possibly by an instance that has, until its ttl or
+// scheduledRetention has passed. Messages that fail to publish for other reasons are retried the same way.
+
+const (
+	scheduledPollInterval  = 1 * time.Second
+	scheduledClaimLimit    = 100
+	scheduledClaimLease    = 5 * time.Second
+	scheduledRetention     = 24 * time.Hour
+	scheduledDeleteTimeout = 5 * time.Second
+)
+
+func (s *server) schedule(ctx context.Context, appId string, topicName string, input *broadcastInput) (*domain.ScheduledMessage, error) {
+	payload, err := json.Marshal(input.Payload)
+	if err != nil {
+		return nil, err
+	}
+	scheduled := &domain.ScheduledMessage{
+		ID:         uuid.NewString(),
+		AppID:      appId,
+		Topic:      topicName,
+		Event:      input.Event,
+		Payload:    payload,
+		TTLSeconds: input.TTL,
+		DeliverAt:  input.DeliverAt.UTC(),
+	}
+	err = s.scheduledMessageRepository.Create(ctx, scheduled)
+	if err != nil {
+		return nil, err
+	}
+	return scheduled, nil
+}
+
+// deliverScheduled publishes due scheduled messages until ctx is done
+func (s *server) deliverScheduled(ctx context.Context) {
+	ticker := time.NewTicker(scheduledPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			messages, err := s.scheduledMessageRepository.ClaimDue(ctx, now.UTC(), scheduledClaimLease, scheduledClaimLimit)
+			if err != nil {
+				s.logger.Error("failed to claim scheduled messages", "error", err)
+				continue
+			}
+			for _, m := range messages {
+				if s.publishScheduled(m, now) {
+					s.deleteScheduled(m)
+				}
+			}
+		}
+	}
+}
+
+// publishScheduled returns true when the message is done with, and false if it must be tried again
+func (s *server) publishScheduled(m domain.ScheduledMessage, now time.Time) bool {
+	msg, err := newWsMessage(m.Event, m.Payload)
+	if err != nil {
+		s.logger.Error("failed to encode scheduled message", "error", err, "id", m.ID)
+		return true
+	}
+	if m.TTLSeconds > 0 {
+		msg.ExpiresAt = m.DeliverAt.Add(time.Duration(m.TTLSeconds) * time.Second)
+	}
+	if msg.expired(now) {
+		countBroadcast(m.AppID)
+		countDropped(m.AppID, dropReasonExpired, 1)
+		return true
+	}
+	// The broadcast is counted once, not for every time it is tried
+	err = s.routeAndDeliver(m.AppID, m.Topic, msg)
+	if err == nil {
+		countBroadcast(m.AppID)
+		return true
+	}
+	if errors.Is(err, errWildcardTopic) {
+		// Scheduled before wildcard topics were rejected, it can never be delivered
+		s.logger.Error("failed to publish scheduled message", "error", err, "id", m.ID)
+		countBroadcast(m.AppID)
+		return true
+	}
+	if now.Sub(m.DeliverAt) > scheduledRetention {
+		s.logger.Info("scheduled message not delivered within retention", "error", err, "id", m.ID, "appId", m.AppID, "topic", m.Topic)
+		countBroadcast(m.AppID)
+		if errors.Is(err, errTopicNotFound) {
+			countDropped(m.AppID, dropReasonNoSubscribers, 1)
+		}
+		return true
+	}
+	if !errors.Is(err, errTopicNotFound) {
+		s.logger.Error("failed to publish scheduled message", "error", err, "id", m.ID)
+	}
+	return false
+}
+
+func (s *server) deleteScheduled(m domain.ScheduledMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), scheduledDeleteTimeout)
+	defer cancel()
+	err := s.scheduledMessageRepository.Delete(ctx, m.AppID, m.ID)
+	// Not found if the message was cancelled while it was published
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		s.logger.Error("failed to delete delivered scheduled message", "error", err, "id", m.ID)
+	}
+}
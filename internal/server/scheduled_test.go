@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/google/uuid"
+)
+
+// subscribeTopic subscribes to the topic like a connected client would, and returns the messages it gets
+func subscribeTopic(t *testing.T, s *server, app domain.Application, topic string) chan *WsMessage {
+	t.Helper()
+	tp := s.wsTopicCollection.createTopicIfNotExists(app, topic, s.logger)
+	client := &WsClient{ID: ClientID(uuid.NewString()), App: app, Transport: transportSSE, Topic: tp}
+	tp.add(client)
+	messageChan := make(chan *WsMessage, 1)
+	tp.Broker.subscribe(messageChan, nil)
+	t.Cleanup(func() {
+		tp.Broker.unsubscribe(messageChan)
+		tp.del(client.ID)
+	})
+	return messageChan
+}
+
+func TestScheduledMessageKeptUntilDelivered(t *testing.T) {
+	s, _ := newTestServer(t)
+	app, _, _ := newTestApp(t, s, nil)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	m := &domain.ScheduledMessage{ID: uuid.NewString(), AppID: app.ID, Topic: "news", Event: "later", Payload: []byte(`{}`), DeliverAt: now}
+	if err := s.scheduledMessageRepository.Create(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.publishScheduled(*m, now) {
+		t.Fatal("message without subscribers is done with")
+	}
+	messages, err := s.scheduledMessageRepository.GetByAppID(ctx, app.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("got %v scheduled messages, want the undelivered one", len(messages))
+	}
+
+	messageChan := subscribeTopic(t, s, app, "news")
+	if !s.publishScheduled(*m, now.Add(scheduledClaimLease)) {
+		t.Fatal("message with a subscriber is not done with")
+	}
+	select {
+	case msg := <-messageChan:
+		if msg.Event != "later" {
+			t.Errorf("got event %v, want later", msg.Event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber did not get the message")
+	}
+}
+
+func TestScheduledMessageDoneWith(t *testing.T) {
+	s, _ := newTestServer(t)
+	app, _, _ := newTestApp(t, s, nil)
+	deliverAt := time.Now().UTC()
+	tests := []struct {
+		name  string
+		topic string
+		ttl   int
+		now   time.Time
+	}{
+		{"past ttl", "news", 10, deliverAt.Add(11 * time.Second)},
+		{"past retention", "news", 0, deliverAt.Add(scheduledRetention + time.Second)},
+		{"wildcard topic", "news/+", 0, deliverAt},
+	}
+	for _, tt := range tests {
+		m := domain.ScheduledMessage{ID: uuid.NewString(), AppID: app.ID, Topic: tt.topic, Payload: []byte(`{}`), TTLSeconds: tt.ttl, DeliverAt: deliverAt}
+		if !s.publishScheduled(m, tt.now) {
+			t.Errorf("%v: message is not done with", tt.name)
+		}
+	}
+}
+
+func TestScheduleWildcardTopic(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, _, secret := newTestApp(t, s, nil)
+	deliverAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	for _, topic := range []string{"news%2F%2B", "news%2F%23"} {
+		resp := apiRequest(t, ts, secret, http.MethodPost, "/api/app/"+app.ID+"/topic/"+topic+"/broadcast", `{"payload":{},"deliver_at":"`+deliverAt+`"}`)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("scheduling to %v got status %v, want %v", topic, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+	messages, err := s.scheduledMessageRepository.GetByAppID(context.Background(), app.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 0 {
+		t.Errorf("got %v scheduled messages, want none", len(messages))
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+)
+
+// Sequenced topics. Every broadcast on a sequenced topic gets the next sequence number of the topic,
+// assigned in postgres so numbers are consistent across gateway instances. This happens whether or not
+// the topic has clients on the instance the broadcast is made on. Messages are kept for sequenceRetention,
+// and websocket clients that detect a gap can ask for the missing range again.
+
+const (
+	sequenceRetention       = 24 * time.Hour
+	sequenceJanitorInterval = 10 * time.Minute
+	sequenceAppendTimeout   = 5 * time.Second
+	maxResendMessages       = 1000
+)
+
+// wsResendRequest is sent by clients to get messages from and to, both inclusive, again
+type wsResendRequest struct {
+	Type string `json:"type"`
+	From int64  `json:"from"`
+	To   int64  `json:"to"`
+}
+
+// wsResendComplete is sent after the resent messages. Count is lower than the requested range if
+// some messages are no longer retained.
+type wsResendComplete struct {
+	Type  string `json:"type"`
+	From  int64  `json:"from"`
+	To    int64  `json:"to"`
+	Count int    `json:"count"`
+}
+
+// wsResendError is sent instead of the messages when a resend request fails
+type wsResendError struct {
+	Type  string `json:"type"`
+	From  int64  `json:"from"`
+	To    int64  `json:"to"`
+	Error string `json:"error"`
+}
+
+var errInvalidResendRange = errors.New("invalid resend range")
+
+// resendErrorFrame tells the client why its resend request failed. Only the invalid range is
+// explained, other errors are internal.
+func resendErrorFrame(req wsResendRequest, err error) ([]byte, error) {
+	message := "failed to get messages"
+	if errors.Is(err, errInvalidResendRange) {
+		message = err.Error()
+	}
+	return json.Marshal(wsResendError{Type: "resend_error", From: req.From, To: req.To, Error: message})
+}
+
+// parseResendRequest returns the request, if msgBytes is a resend request
+func parseResendRequest(msgBytes []byte) (wsResendRequest, bool) {
+	req := wsResendRequest{}
+	err := json.Unmarshal(msgBytes, &req)
+	if err != nil || req.Type != "resend" {
+		return req, false
+	}
+	return req, true
+}
+
+// loadSequencedTopics returns the sequenced topics of the app, so the topics a broadcast must be
+// numbered on can be matched like wildcard topics. The trie is not changed after it is loaded.
+func (s *server) loadSequencedTopics(ctx context.Context, appId string) (*topicTrie, error) {
+	app, err := s.appRepository.GetByID(ctx, appId)
+	if err != nil {
+		return nil, err
+	}
+	trie := newTopicTrie()
+	for _, topic := range app.SequencedTopics {
+		trie.insert(topic, CreateTopicID(appId, topic))
+	}
+	return trie, nil
+}
+
+// appendSequenced stores msg and sets its sequence number
+func (s *server) appendSequenced(appId string, topicName string, msg *WsMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sequenceAppendTimeout)
+	defer cancel()
+	topicMsg := &domain.TopicMessage{
+		AppID:       appId,
+		Topic:       topicName,
+		Event:       msg.Event,
+		Payload:     msg.Payload,
+		SourceTopic: msg.Topic,
+	}
+	if !msg.ExpiresAt.IsZero() {
+		topicMsg.ExpiresAt = &msg.ExpiresAt
+	}
+	err := s.topicMessageRepository.Append(ctx, topicMsg)
+	if err != nil {
+		return err
+	}
+	msg.Seq = topicMsg.Seq
+	return nil
+}
+
+// resend returns the retained messages in the requested range, followed by a resend_complete frame
+func (s *server) resend(ctx context.Context, client *WsClient, req wsResendRequest) ([][]byte, error) {
+	if req.From <= 0 || req.To < req.From {
+		return nil, errInvalidResendRange
+	}
+	if req.To-req.From >= maxResendMessages {
+		req.To = req.From + maxResendMessages - 1
+	}
+	messages, retained, err := s.retainedMessages(ctx, client, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	frames := make([][]byte, 0, len(messages)+1)
+	for _, msg := range messages {
+		frames = append(frames, msg.Frame)
+	}
+	complete, err := json.Marshal(wsResendComplete{Type: "resend_complete", From: req.From, To: req.To, Count: retained})
+	if err != nil {
+		return nil, err
+	}
+	return append(frames, complete), nil
+}
+
+// retainedMessages returns the retained messages of the client's topic from from to to, both inclusive,
+// that match the client's filter. retained is the number of messages in the range, matching or not.
+func (s *server) retainedMessages(ctx context.Context, client *WsClient, from int64, to int64) ([]*WsMessage, int, error) {
+	topicMessages, err := s.topicMessageRepository.GetRange(ctx, client.App.ID, client.Topic.Topic, from, to)
+	if err != nil {
+		return nil, 0, err
+	}
+	messages := make([]*WsMessage, 0, len(topicMessages))
+	for _, m := range topicMessages {
+		msg := &WsMessage{Seq: m.Seq, Topic: m.SourceTopic, Event: m.Event, Payload: m.Payload}
+		if m.ExpiresAt != nil {
+			msg.ExpiresAt = *m.ExpiresAt
+		}
+		if !client.Filter.matches(&filterInput{msg: msg}) {
+			continue
+		}
+		msg.Frame, err = encodeBroadcast(msg)
+		if err != nil {
+			return nil, 0, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, len(topicMessages), nil
+}
+
+// expireTopicMessages deletes messages older than sequenceRetention until ctx is done
+func (s *server) expireTopicMessages(ctx context.Context) {
+	ticker := time.NewTicker(sequenceJanitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			err := s.topicMessageRepository.DeleteOlderThan(ctx, now.Add(-sequenceRetention))
+			if err != nil {
+				s.logger.Error("failed to delete expired topic messages", "error", err)
+			}
+		}
+	}
+}
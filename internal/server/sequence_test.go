@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+)
+
+func TestPublishNumbersTopicsWithoutClients(t *testing.T) {
+	s, _ := newTestServer(t)
+	app, _, _ := newTestApp(t, s, func(app *domain.Application) {
+		app.SequencedTopics = []string{"orders", "orders/#"}
+	})
+
+	for _, topic := range []string{"orders", "orders/1"} {
+		err := s.publish(context.Background(), app.ID, topic, "created", map[string]any{"topic": topic}, 0)
+		if err != nil {
+			t.Fatalf("publish to %v: %v", topic, err)
+		}
+	}
+
+	tests := []struct {
+		topic        string
+		sourceTopics []string
+	}{
+		{"orders", []string{""}},
+		// orders/# also matches orders
+		{"orders/#", []string{"orders", "orders/1"}},
+	}
+	for _, tt := range tests {
+		messages, err := s.topicMessageRepository.GetRange(context.Background(), app.ID, tt.topic, 1, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(messages) != len(tt.sourceTopics) {
+			t.Fatalf("%v: got %v messages, want %v", tt.topic, len(messages), len(tt.sourceTopics))
+		}
+		for i, msg := range messages {
+			if msg.Seq != int64(i+1) || msg.SourceTopic != tt.sourceTopics[i] {
+				t.Errorf("%v: got seq %v from %q, want seq %v from %q", tt.topic, msg.Seq, msg.SourceTopic, i+1, tt.sourceTopics[i])
+			}
+		}
+	}
+}
+
+func TestPublishWithoutClientsOrSequencing(t *testing.T) {
+	s, _ := newTestServer(t)
+	app, _, _ := newTestApp(t, s, nil)
+
+	err := s.publish(context.Background(), app.ID, "orders", "created", nil, 0)
+	if err != errTopicNotFound {
+		t.Errorf("got %v, want errTopicNotFound", err)
+	}
+}
+
+func TestResendErrorFrame(t *testing.T) {
+	s, _ := newTestServer(t)
+	app, _, _ := newTestApp(t, s, func(app *domain.Application) { app.SequencedTopics = []string{"orders"} })
+	client := &WsClient{App: app, Topic: &WsTopic{AppID: app.ID, Topic: "orders"}}
+
+	for _, req := range []wsResendRequest{{From: 0, To: 5}, {From: 5, To: 4}} {
+		_, err := s.resend(context.Background(), client, req)
+		if err != errInvalidResendRange {
+			t.Fatalf("resend %+v: got %v, want errInvalidResendRange", req, err)
+		}
+		frame, err := resendErrorFrame(req, err)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := wsResendError{}
+		if err := json.Unmarshal(frame, &got); err != nil {
+			t.Fatal(err)
+		}
+		want := wsResendError{Type: "resend_error", From: req.From, To: req.To, Error: "invalid resend range"}
+		if got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	}
+}
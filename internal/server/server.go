@@ -8,16 +8,19 @@ import (
 	"io/fs"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"sync"
 
 	firebase "firebase.google.com/go/v4"
+	"github.com/bjarke-xyz/ws-gateway/internal/config"
 	"github.com/bjarke-xyz/ws-gateway/internal/domain"
 	"github.com/bjarke-xyz/ws-gateway/internal/repository"
 	"github.com/bjarke-xyz/ws-gateway/internal/server/html"
 	"github.com/bjarke-xyz/ws-gateway/internal/service"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 )
 
 //go:embed static
@@ -25,39 +28,97 @@ var staticFiles embed.FS
 
 type server struct {
 	logger *slog.Logger
+	// instanceId tells the usage of this instance apart from the usage of other instances
+	instanceId string
 
 	app        *firebase.App
 	authClient *service.FirebaseAuthRestClient
+	tickets    TicketIssuer
 
-	appRepository domain.ApplicationRepository
-	keyRepository domain.ApiKeyRepository
+	appRepository              domain.ApplicationRepository
+	keyRepository              domain.ApiKeyRepository
+	deliveryRepository         domain.WebhookDeliveryRepository
+	deadLetterRepository       domain.DeadLetterRepository
+	topicMessageRepository     domain.TopicMessageRepository
+	scheduledMessageRepository domain.ScheduledMessageRepository
+	routingRuleRepository      domain.RoutingRuleRepository
+	accessTokenRepository      domain.AccessTokenRepository
+	organizationRepository     domain.OrganizationRepository
+	auditEventRepository       domain.AuditEventRepository
+	appUsageRepository         domain.AppUsageRepository
+
+	webhookDispatcher *service.WebhookDispatcher
+	ackTracker        *ackTracker
+	// routingRules holds the compiled rules of each app, see loadRoutingRules
+	routingRules *appCache[[]*compiledRule]
+	// sequencedTopics holds the sequenced topics of each app, see loadSequencedTopics
+	sequencedTopics *appCache[*topicTrie]
 
 	wsTopicCollection *WsTopicCollection
+	pollSessions      *pollSessions
+	pusherPresence    *pusherPresence
+
+	upgrader        *websocket.Upgrader
+	graphqlUpgrader *websocket.Upgrader
 
 	staticFilesFs fs.FS
 }
 
-func NewServer(ctx context.Context, logger *slog.Logger, app *firebase.App, authClient *service.FirebaseAuthRestClient, pool *pgxpool.Pool) (*server, error) {
+func NewServer(ctx context.Context, logger *slog.Logger, cfg config.Config, app *firebase.App, authClient *service.FirebaseAuthRestClient, tickets TicketIssuer, repos repository.Repositories) (*server, error) {
 	staticFilesFs, err := fs.Sub(staticFiles, "static")
 	if err != nil {
 		return nil, err
 	}
-	appRepo := repository.NewPostgresApp(pool)
-	keyRepo := repository.NewPostgresKey(pool)
+	webhookDispatcher := service.NewWebhookDispatcher(logger, repos.WebhookDeliveries)
+	webhookDispatcher.Start(ctx)
 	wsTopicCollection := &WsTopicCollection{
-		Topics:  make(map[TopicID]*WsTopic),
-		Cancels: make(map[TopicID]context.CancelFunc),
-		RWMutex: &sync.RWMutex{},
+		Topics:    make(map[TopicID]*WsTopic),
+		Cancels:   make(map[TopicID]context.CancelFunc),
+		Wildcards: make(map[string]*topicTrie),
+		RWMutex:   &sync.RWMutex{},
+	}
+	pollSessions := &pollSessions{
+		sessions: make(map[string]*pollSession),
+		RWMutex:  &sync.RWMutex{},
 	}
-	return &server{
-		logger:            logger,
-		app:               app,
-		authClient:        authClient,
-		appRepository:     appRepo,
-		keyRepository:     keyRepo,
-		wsTopicCollection: wsTopicCollection,
-		staticFilesFs:     staticFilesFs,
-	}, nil
+	go pollSessions.expire(ctx)
+	pusherPresence := &pusherPresence{
+		channels: make(map[TopicID]pusherPresenceMembers),
+		Mutex:    &sync.Mutex{},
+	}
+	srv := &server{
+		logger:                     logger,
+		instanceId:                 uuid.NewString(),
+		app:                        app,
+		authClient:                 authClient,
+		tickets:                    tickets,
+		appRepository:              repos.Apps,
+		keyRepository:              repos.Keys,
+		deliveryRepository:         repos.WebhookDeliveries,
+		deadLetterRepository:       repos.DeadLetters,
+		topicMessageRepository:     repos.TopicMessages,
+		scheduledMessageRepository: repos.ScheduledMessages,
+		routingRuleRepository:      repos.RoutingRules,
+		accessTokenRepository:      repos.AccessTokens,
+		organizationRepository:     repos.Organizations,
+		auditEventRepository:       repos.AuditEvents,
+		appUsageRepository:         repos.AppUsage,
+		webhookDispatcher:          webhookDispatcher,
+		ackTracker:                 newAckTracker(logger, repos.DeadLetters),
+		wsTopicCollection:          wsTopicCollection,
+		pollSessions:               pollSessions,
+		pusherPresence:             pusherPresence,
+		upgrader:                   newUpgrader(cfg.Websocket),
+		graphqlUpgrader:            newGraphqlUpgrader(cfg.Websocket),
+		staticFilesFs:              staticFilesFs,
+	}
+	srv.routingRules = newAppCache("routing_rules", logger, srv.loadRoutingRules)
+	srv.sequencedTopics = newAppCache("sequenced_topics", logger, srv.loadSequencedTopics)
+	go srv.ackTracker.run(ctx, srv.redeliver)
+	go srv.expireTopicMessages(ctx)
+	go srv.deliverScheduled(ctx)
+	go srv.flushUsage(ctx)
+	return srv, nil
 }
 func (s *server) Server(port int) *http.Server {
 	return &http.Server{
@@ -65,11 +126,13 @@ func (s *server) Server(port int) *http.Server {
 		Handler: s.routes(),
 	}
 }
+
+// errorQuery is escaped, as error messages can contain topics with # and +
 func errorQuery(errMsg string) string {
 	if errMsg == "" {
 		return ""
 	}
-	return fmt.Sprintf("error=%v", errMsg)
+	return "error=" + url.QueryEscape(errMsg)
 }
 func jsonResponse(w http.ResponseWriter, status int, data any) {
 	w.WriteHeader(status)
@@ -99,20 +162,69 @@ func (s *server) routes() *chi.Mux {
 
 		r.Get("/app/{app-id}", s.handleGetApp)
 		r.Post("/app/{app-id}", s.handlePostApp)
+		r.Get("/app/{app-id}/usage/export", s.handleGetUsageExport)
+		r.Get("/app/{app-id}/connections", s.handleGetConnections)
+		r.Get("/app/{app-id}/connections/stream", s.handleGetConnectionsStream)
+		r.Get("/app/{app-id}/inspect", s.handleGetInspector)
+		r.Get("/app/{app-id}/inspect/stream", s.handleGetInspectorStream)
+		r.Post("/app/{app-id}/inspect/publish", s.handlePostInspectorPublish)
+
+		r.Get("/app/{app-id}/rule/{rule-id}", s.handleGetRoutingRule)
+		r.Post("/app/{app-id}/rule/{rule-id}", s.handlePostRoutingRule)
 
 		r.Get("/key/{key-id}", s.handleGetKey)
 		r.Post("/key/{key-id}", s.handlePostKey)
+
+		r.Post("/token/{token-id}", s.handlePostAccessToken)
+
+		r.Get("/org/{org-id}", s.handleGetOrganization)
+		r.Post("/org/{org-id}", s.handlePostOrganization)
+		r.Post("/org/{org-id}/member", s.handlePostOrganizationMember)
+		r.Post("/org/{org-id}/transfer", s.handlePostOrganizationTransfer)
+
+		r.Get("/audit", s.handleGetAudit)
+		r.Get("/audit/export", s.handleGetAuditExport)
 	})
 
 	r.Route("/api", func(r chi.Router) {
+		r.Use(requestDuration, traceRequest)
+		r.Route("/v1", func(r chi.Router) {
+			r.Use(s.accessTokenVerifier)
+			r.Get("/organizations", s.handleApiListOrganizations)
+			r.Get("/apps", s.handleApiListApps)
+			r.Post("/apps", s.handleApiCreateApp)
+			r.Get("/apps/{app-id}", s.handleApiGetApp)
+			r.Put("/apps/{app-id}", s.handleApiUpdateApp)
+			r.Delete("/apps/{app-id}", s.handleApiDeleteApp)
+			r.Get("/apps/{app-id}/usage", s.handleApiGetUsage)
+			r.Get("/keys", s.handleApiListKeys)
+			r.Post("/keys", s.handleApiCreateKey)
+			r.Get("/keys/{key-id}", s.handleApiGetKey)
+			r.Put("/keys/{key-id}/apps", s.handleApiUpdateKeyAccess)
+			r.Delete("/keys/{key-id}", s.handleApiDeleteKey)
+			r.Get("/audit-events", s.handleGetAuditExport)
+		})
 		r.Route("/app/{app-id}", func(r chi.Router) {
 			r.Use(s.apiKeyVerifier)
 			r.Post("/ticket", s.handleApiCreateTicket)
 			r.Post("/topic/{topic}/broadcast", s.handleApiBroadcast)
+			r.Get("/topic/{topic}/filters", s.handleApiGetTopicFilters)
+			r.Post("/broadcast", s.handleApiBatchBroadcast)
+			r.Get("/dead-letters", s.handleApiGetDeadLetters)
+			r.Delete("/dead-letters/{dead-letter-id}", s.handleApiDeleteDeadLetter)
+			r.Get("/scheduled", s.handleApiGetScheduled)
+			r.Delete("/scheduled/{scheduled-id}", s.handleApiCancelScheduled)
 		})
 	})
 
 	r.Get("/ws/app/{app-id}/topic/{topic}", s.wsClientMiddleware(s.wsTopicHandler))
+	r.Get("/sse/app/{app-id}/topic/{topic}", s.sseTopicHandler)
+	r.Get("/poll/app/{app-id}/topic/{topic}", s.handlePoll)
+	r.Get("/graphql/app/{app-id}", s.graphqlHandler)
+
+	// Pusher compatible endpoints
+	r.Get("/app/{key}", s.pusherHandler)
+	r.With(requestDuration, traceRequest).Post("/apps/{app-id}/events", s.handlePusherTrigger)
 
 	return r
 }
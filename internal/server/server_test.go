@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/bjarke-xyz/ws-gateway/internal/config"
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/bjarke-xyz/ws-gateway/internal/repository"
+	"github.com/google/uuid"
+)
+
+// testTickets issues tickets without firebase. Like firebase custom tokens, tickets can be used once.
+type testTickets struct {
+	mu      sync.Mutex
+	tickets map[string]*auth.Token
+}
+
+func (t *testTickets) CreateTicket(ctx context.Context, userId string, claims map[string]any) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	token := uuid.NewString()
+	t.tickets[token] = &auth.Token{UID: userId, Subject: userId, Claims: claims}
+	return token, nil
+}
+
+func (t *testTickets) VerifyTicket(ctx context.Context, tokenStr string) (*auth.Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	token, ok := t.tickets[tokenStr]
+	if !ok {
+		return nil, ErrInvalidTicket
+	}
+	delete(t.tickets, tokenStr)
+	return token, nil
+}
+
+// newTestServer returns a server with in-memory repositories, serving its routes on an httptest server.
+// Tickets are issued by testTickets. Endpoints that need firebase, like the admin ui, are not usable.
+func newTestServer(t *testing.T) (*server, *httptest.Server) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	tickets := &testTickets{tickets: make(map[string]*auth.Token)}
+	s, err := NewServer(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)), config.Default(), nil, nil, tickets, repository.NewMemoryRepositories())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.routes())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// newTestTicket returns a ticket for userId to subscribe to the topic of the app
+func newTestTicket(t *testing.T, s *server, appId string, userId string, topic string) string {
+	t.Helper()
+	ticket, err := s.createTicket(context.Background(), appId, userId, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ticket
+}
+
+// newTestApp creates an app with an api key that gives access to it. The secret of the key is returned as well.
+func newTestApp(t *testing.T, s *server, configure func(app *domain.Application)) (domain.Application, domain.ApiKey, string) {
+	t.Helper()
+	ctx := context.Background()
+	org := domain.Organization{ID: uuid.NewString(), Name: "test"}
+	owner := domain.OrganizationMember{OrganizationID: org.ID, UserID: uuid.NewString(), Role: domain.RoleOwner}
+	if err := s.organizationRepository.Create(ctx, &org, &owner); err != nil {
+		t.Fatal(err)
+	}
+	app := domain.Application{
+		ID:                  uuid.NewString(),
+		OwnerUserID:         owner.UserID,
+		OrganizationID:      org.ID,
+		Name:                "test",
+		AckTimeoutSeconds:   domain.DefaultAckTimeoutSeconds,
+		MaxDeliveryAttempts: domain.DefaultMaxDeliveryAttempts,
+	}
+	if configure != nil {
+		configure(&app)
+	}
+	if err := s.appRepository.Create(ctx, &app); err != nil {
+		t.Fatal(err)
+	}
+	key, secret, err := newApiKey(owner.UserID, org.ID, []domain.ApiKeyAccess{{AppID: app.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.keyRepository.Create(ctx, &key); err != nil {
+		t.Fatal(err)
+	}
+	return app, key, secret
+}
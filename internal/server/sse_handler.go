@@ -0,0 +1,128 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	sseKeepAliveInterval = 15 * time.Second
+	// sseBufferSize is room for live messages while missed messages are read from the database
+	sseBufferSize = 64
+)
+
+// sseTopicHandler streams broadcasts on a topic as text/event-stream, for clients that cannot use websockets.
+// It uses the same tickets as the websocket endpoint.
+// Messages on sequenced topics have their sequence number as event id. When EventSource reconnects with
+// a Last-Event-ID, the messages broadcast since are sent first. Other messages have no event id.
+func (s *server) sseTopicHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ticket, ok := s.ticketFromRequest(w, r, transportSSE)
+	if !ok {
+		return
+	}
+	filter, ok := filterFromRequest(w, r)
+	if !ok {
+		countUpgradeFailure(transportSSE, "invalid_filter")
+		return
+	}
+	defer trackConnection(ticket.App.ID, transportSSE)()
+
+	clientId := uuid.NewString()
+	client := &WsClient{
+		ID:        ClientID(clientId),
+		Token:     ticket.Token,
+		App:       ticket.App,
+		Transport: transportSSE,
+		Filter:    filter,
+	}
+	leave := s.joinTopic(client, ticket.Topic)
+	defer leave()
+
+	messageChan := make(chan *WsMessage, sseBufferSize)
+	topic := client.Topic
+	topic.Broker.subscribe(messageChan, client.Filter)
+	defer topic.Broker.unsubscribe(messageChan)
+
+	// Subscribed before reading the missed messages, so nothing is lost in between. Live messages
+	// also read from the database are skipped by their sequence number.
+	var missed []*WsMessage
+	lastSeq, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+	if topic.Sequenced && lastSeq > 0 {
+		var err error
+		missed, _, err = s.retainedMessages(r.Context(), client, lastSeq+1, lastSeq+maxResendMessages)
+		if err != nil {
+			s.logger.Error("failed to get missed sse messages", "error", err, "lastEventId", lastSeq)
+			http.Error(w, "failed to get missed messages", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Stops nginx and similar proxies from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	// Same as the websocket upgrader, any origin is allowed
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set(wsIdHeader, clientId)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	write := func(msg *WsMessage) error {
+		if msg.expired(time.Now()) {
+			countDropped(client.App.ID, dropReasonExpired, 1)
+			return nil
+		}
+		if msg.Seq != 0 {
+			if msg.Seq <= lastSeq {
+				return nil
+			}
+			lastSeq = msg.Seq
+			if _, err := fmt.Fprintf(w, "id: %d\n", msg.Seq); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", msg.Frame); err != nil {
+			return err
+		}
+		countSent(client.App.ID, transportSSE, len(msg.Frame))
+		flusher.Flush()
+		return nil
+	}
+	for _, msg := range missed {
+		if err := write(msg); err != nil {
+			s.logger.Error("failed to write sse msg", "error", err)
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				s.logger.Error("failed to write sse keep-alive", "error", err)
+				return
+			}
+			flusher.Flush()
+		case msg := <-messageChan:
+			if err := write(msg); err != nil {
+				s.logger.Error("failed to write sse msg", "error", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+)
+
+type sseEvent struct {
+	id   string
+	data string
+}
+
+// dialSSE subscribes to the topic over sse, and returns the events it gets. lastEventId is sent if not empty.
+func dialSSE(t *testing.T, ctx context.Context, url string, lastEventId string) <-chan sseEvent {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		t.Fatalf("got status %v, want %v", resp.StatusCode, http.StatusOK)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("got content type %v, want text/event-stream", got)
+	}
+	events := make(chan sseEvent, 10)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		event := sseEvent{}
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				events <- event
+				event = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				event.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return events
+}
+
+func receiveSSE(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("sse stream closed")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not get an sse event")
+	}
+	return sseEvent{}
+}
+
+func TestSSEResumeFromLastEventID(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, _, _ := newTestApp(t, s, func(app *domain.Application) {
+		app.SequencedTopics = []string{"news"}
+	})
+	url := func() string {
+		return ts.URL + "/sse/app/" + app.ID + "/topic/news?token=" + newTestTicket(t, s, app.ID, "user", "news")
+	}
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	events := dialSSE(t, ctx, url(), "")
+	if err := s.publish(context.Background(), app.ID, "news", "first", map[string]any{"n": 1}, 0); err != nil {
+		t.Fatal(err)
+	}
+	event := receiveSSE(t, events)
+	if event.id != "1" || !strings.Contains(event.data, `"event":"first"`) {
+		t.Errorf("got event %+v, want the first message with id 1", event)
+	}
+	disconnect()
+
+	// Stored with its sequence number, whether or not the server has noticed the disconnect yet
+	if err := s.publish(context.Background(), app.ID, "news", "second", map[string]any{"n": 2}, 0); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	events = dialSSE(t, ctx, url(), event.id)
+	event = receiveSSE(t, events)
+	if event.id != "2" || !strings.Contains(event.data, `"event":"second"`) {
+		t.Errorf("got event %+v after reconnecting, want the missed message with id 2", event)
+	}
+}
+
+func TestSSEInvalidTicket(t *testing.T) {
+	s, ts := newTestServer(t)
+	app, _, _ := newTestApp(t, s, nil)
+	tests := []struct {
+		name  string
+		topic string
+		token string
+	}{
+		{"no ticket", "news", ""},
+		{"unknown ticket", "news", "unknown"},
+		{"ticket for another topic", "sports", newTestTicket(t, s, app.ID, "user", "news")},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(ts.URL + "/sse/app/" + app.ID + "/topic/" + tt.topic + "?token=" + tt.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%v: got status %v, want %v", tt.name, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Renders the connections dashboard from the snapshots sent by handleGetConnectionsStream
+(function () {
+  const topicsEl = document.getElementById("topics");
+  const statusEl = document.getElementById("status");
+  const summaryEl = document.getElementById("summary");
+  const userEl = document.getElementById("user");
+  const userResultEl = document.getElementById("user-result");
+  let snapshot = null;
+
+  function el(tag, text) {
+    const e = document.createElement(tag);
+    if (text !== undefined) {
+      e.textContent = text;
+    }
+    return e;
+  }
+
+  function age(since) {
+    const seconds = Math.max(0, Math.floor((Date.now() - new Date(since)) / 1000));
+    if (seconds < 60) return seconds + "s";
+    if (seconds < 3600) return Math.floor(seconds / 60) + "m " + (seconds % 60) + "s";
+    return Math.floor(seconds / 3600) + "h " + Math.floor((seconds % 3600) / 60) + "m";
+  }
+
+  function row(cells, tag = "td") {
+    const tr = el("tr");
+    for (const cell of cells) {
+      tr.appendChild(el(tag, cell));
+    }
+    return tr;
+  }
+
+  function render() {
+    if (!snapshot) return;
+    const user = userEl.value.trim();
+    summaryEl.textContent =
+      snapshot.topics.length + " topics, " + snapshot.clients + " clients";
+
+    if (user) {
+      const topics = snapshot.topics
+        .filter((t) => t.clients.some((c) => c.userId === user))
+        .map((t) => t.topic);
+      userResultEl.textContent = topics.length
+        ? user + " is connected to " + topics.join(", ")
+        : user + " is not connected";
+    } else {
+      userResultEl.textContent = "";
+    }
+
+    topicsEl.replaceChildren();
+    for (const topic of snapshot.topics) {
+      const clients = user
+        ? topic.clients.filter((c) => c.userId === user)
+        : topic.clients;
+      if (user && clients.length === 0) continue;
+
+      const flags = [];
+      if (topic.sequenced) flags.push("sequenced");
+      if (topic.reliable) flags.push("reliable");
+      topicsEl.appendChild(el("h3", topic.topic));
+      topicsEl.appendChild(
+        el(
+          "p",
+          topic.clients.length +
+            " subscribers, " +
+            topic.messageRate.toFixed(2) +
+            " msg/s, " +
+            topic.delivered +
+            " messages in " +
+            age(topic.createdAt) +
+            (flags.length ? ", " + flags.join(", ") : "")
+        )
+      );
+      const table = el("table");
+      const head = row(
+        ["User", "Transport", "Connected for", "Filter", "Client id"],
+        "th"
+      );
+      const thead = el("thead");
+      thead.appendChild(head);
+      table.appendChild(thead);
+      const tbody = el("tbody");
+      for (const client of clients) {
+        tbody.appendChild(
+          row([
+            client.userId,
+            client.transport,
+            age(client.connectedAt),
+            client.filter,
+            client.id,
+          ])
+        );
+      }
+      table.appendChild(tbody);
+      topicsEl.appendChild(table);
+    }
+  }
+
+  const source = new EventSource(topicsEl.dataset.stream);
+  source.onopen = () => {
+    statusEl.textContent = "Live";
+  };
+  source.onerror = () => {
+    statusEl.textContent = "Disconnected, retrying...";
+  };
+  source.onmessage = (e) => {
+    snapshot = JSON.parse(e.data);
+    statusEl.textContent = "Live, updated " + new Date(snapshot.takenAt).toLocaleTimeString();
+    render();
+  };
+  userEl.addEventListener("input", render);
+})();
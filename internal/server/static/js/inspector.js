@@ -0,0 +1,127 @@
+// Watches a topic through handleGetInspectorStream and sends test broadcasts to handlePostInspectorPublish
+(function () {
+  const watchEl = document.getElementById("watch");
+  const topicEl = document.getElementById("topic");
+  const filterEl = document.getElementById("filter");
+  const stopEl = document.getElementById("stop");
+  const statusEl = document.getElementById("status");
+  const messagesEl = document.getElementById("messages");
+  const publishEl = document.getElementById("publish");
+  const payloadEl = document.getElementById("payload");
+  const publishResultEl = document.getElementById("publish_result");
+  const base = "/admin/app/" + watchEl.dataset.app + "/inspect";
+  const maxMessages = 500;
+  let source = null;
+
+  function cell(text, code) {
+    const td = document.createElement("td");
+    if (code) {
+      const pre = document.createElement("pre");
+      pre.textContent = text;
+      td.appendChild(pre);
+    } else {
+      td.textContent = text;
+    }
+    return td;
+  }
+
+  function stop() {
+    if (source) {
+      source.close();
+      source = null;
+    }
+    stopEl.disabled = true;
+  }
+
+  function watch() {
+    stop();
+    const topic = topicEl.value.trim();
+    if (!topic) return;
+    const params = new URLSearchParams({ topic: topic });
+    if (filterEl.value.trim()) {
+      params.set("filter", filterEl.value.trim());
+    }
+    history.replaceState(null, "", "?" + params.toString());
+    source = new EventSource(base + "/stream?" + params.toString());
+    stopEl.disabled = false;
+    statusEl.textContent = "Connecting to " + topic + "...";
+    source.onopen = () => {
+      statusEl.textContent = "Watching " + topic;
+    };
+    source.onerror = () => {
+      statusEl.textContent =
+        "Disconnected from " + topic + ", retrying... Check the topic and filter if this persists.";
+    };
+    source.onmessage = (e) => {
+      const msg = JSON.parse(e.data);
+      const tr = document.createElement("tr");
+      tr.appendChild(cell(new Date(msg.receivedAt).toLocaleTimeString()));
+      tr.appendChild(cell(msg.topic));
+      tr.appendChild(cell(msg.event || ""));
+      tr.appendChild(cell(msg.seq ? String(msg.seq) : ""));
+      tr.appendChild(cell(JSON.stringify(msg.payload, null, 2), true));
+      messagesEl.prepend(tr);
+      while (messagesEl.children.length > maxMessages) {
+        messagesEl.lastChild.remove();
+      }
+    };
+  }
+
+  function parsePayload() {
+    try {
+      const payload = JSON.parse(payloadEl.value);
+      if (payload === null || typeof payload !== "object" || Array.isArray(payload)) {
+        publishResultEl.textContent = "The payload must be a JSON object";
+        return null;
+      }
+      return payload;
+    } catch (err) {
+      publishResultEl.textContent = "Invalid JSON: " + err.message;
+      return null;
+    }
+  }
+
+  watchEl.addEventListener("submit", (e) => {
+    e.preventDefault();
+    watch();
+  });
+  stopEl.addEventListener("click", () => {
+    stop();
+    statusEl.textContent = "Stopped";
+  });
+  document.getElementById("clear").addEventListener("click", () => {
+    messagesEl.replaceChildren();
+  });
+  document.getElementById("format").addEventListener("click", () => {
+    const payload = parsePayload();
+    if (payload) {
+      payloadEl.value = JSON.stringify(payload, null, 2);
+      publishResultEl.textContent = "";
+    }
+  });
+  publishEl.addEventListener("submit", async (e) => {
+    e.preventDefault();
+    const payload = parsePayload();
+    if (!payload) return;
+    const input = {
+      topic: publishEl.topic.value.trim(),
+      event: publishEl.event.value.trim(),
+      ttl: parseInt(publishEl.ttl.value, 10) || 0,
+      payload: payload,
+    };
+    const resp = await fetch(base + "/publish", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(input),
+    });
+    if (resp.ok) {
+      publishResultEl.textContent = "Sent at " + new Date().toLocaleTimeString();
+    } else {
+      publishResultEl.textContent = "Failed: " + (await resp.text());
+    }
+  });
+
+  if (topicEl.value.trim()) {
+    watch();
+  }
+})();
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	firebase "firebase.google.com/go/v4"
+	"firebase.google.com/go/v4/auth"
+	"firebase.google.com/go/v4/errorutils"
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/bjarke-xyz/ws-gateway/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	// ErrUserNotFound is returned by TicketIssuer.CreateTicket for users that do not exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrInvalidTicket is returned by TicketIssuer.VerifyTicket for tokens that are not valid tickets
+	ErrInvalidTicket = errors.New("invalid ticket")
+)
+
+// TicketIssuer creates and verifies the tokens of tickets. Claims set on creation are returned on verification.
+type TicketIssuer interface {
+	CreateTicket(ctx context.Context, userId string, claims map[string]any) (string, error)
+	VerifyTicket(ctx context.Context, tokenStr string) (*auth.Token, error)
+}
+
+// firebaseTicketIssuer issues firebase custom tokens, which are verified by signing in with them
+type firebaseTicketIssuer struct {
+	app        *firebase.App
+	authClient *service.FirebaseAuthRestClient
+}
+
+func NewFirebaseTicketIssuer(app *firebase.App, authClient *service.FirebaseAuthRestClient) TicketIssuer {
+	return &firebaseTicketIssuer{app: app, authClient: authClient}
+}
+
+func (f *firebaseTicketIssuer) CreateTicket(ctx context.Context, userId string, claims map[string]any) (string, error) {
+	auth, err := f.app.Auth(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error getting auth: %w", err)
+	}
+
+	user, err := auth.GetUser(ctx, userId)
+	if err != nil && !errorutils.IsNotFound(err) {
+		return "", fmt.Errorf("error getting user: %w", err)
+	}
+	if user == nil || errorutils.IsNotFound(err) {
+		return "", ErrUserNotFound
+	}
+	return auth.CustomTokenWithClaims(ctx, user.UID, claims)
+}
+
+func (f *firebaseTicketIssuer) VerifyTicket(ctx context.Context, tokenStr string) (*auth.Token, error) {
+	auth, err := f.app.Auth(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting auth: %w", err)
+	}
+	customToken, err := f.authClient.SignInWithCustomToken(ctx, tokenStr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to sign in with custom token: %w", ErrInvalidTicket, err)
+	}
+	if customToken.Error != nil {
+		return nil, fmt.Errorf("%w: custom token returned error: %v", ErrInvalidTicket, customToken.Error)
+	}
+	verifiedToken, err := auth.VerifyIDToken(ctx, customToken.IdToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to verify token: %w", ErrInvalidTicket, err)
+	}
+	return verifiedToken, nil
+}
+
+// verifiedTicket is the result of exchanging a ticket created by handleApiCreateTicket
+type verifiedTicket struct {
+	Token *auth.Token
+	App   domain.Application
+	Topic string
+}
+
+type ticketError struct {
+	status int
+	msg    string
+	// reason labels the failure in metrics
+	reason string
+}
+
+func (e *ticketError) Error() string {
+	return e.msg
+}
+
+// ticketFromRequest verifies the token query parameter against the app-id and topic url parameters.
+// On failure the error is written to w and false is returned.
+func (s *server) ticketFromRequest(w http.ResponseWriter, r *http.Request, transport string) (verifiedTicket, bool) {
+	tokenStr := r.URL.Query().Get("token")
+	ticket, err := s.verifyTicket(r.Context(), tokenStr, chi.URLParam(r, "app-id"))
+	if err != nil {
+		countUpgradeFailure(transport, err.reason)
+		http.Error(w, err.msg, err.status)
+		return ticket, false
+	}
+	topic := topicParam(r)
+	if ticket.Topic != topic {
+		s.logger.Error("invalid topic claim", "topic", topic, "topicClaim", ticket.Topic)
+		countUpgradeFailure(transport, "invalid_topic_claim")
+		http.Error(w, "invalid topic claim", http.StatusBadRequest)
+		return ticket, false
+	}
+	return ticket, true
+}
+
+// verifyTicket signs in with the ticket and checks that its app claim matches appId.
+// The topic of the returned ticket is taken from the topic claim.
+func (s *server) verifyTicket(ctx context.Context, tokenStr string, appId string) (verifiedTicket, *ticketError) {
+	ticket := verifiedTicket{}
+	verifiedToken, err := s.tickets.VerifyTicket(ctx, tokenStr)
+	if err != nil {
+		s.logger.Error("failed to verify ticket", "error", err)
+		if errors.Is(err, ErrInvalidTicket) {
+			return ticket, &ticketError{http.StatusBadRequest, "invalid ticket", "invalid_ticket"}
+		}
+		return ticket, &ticketError{http.StatusInternalServerError, "failed to verify ticket", "internal"}
+	}
+
+	appIdClaim := getClaim(verifiedToken, wsTokenAppIdClaimKey)
+	if appIdClaim == "" {
+		s.logger.Error("missing appId claim")
+		return ticket, &ticketError{http.StatusBadRequest, "missing appId claim", "missing_app_claim"}
+	}
+	if appIdClaim != appId {
+		s.logger.Error("invalid app id claim", "appId", appId, "appIdClaim", appIdClaim)
+		return ticket, &ticketError{http.StatusBadRequest, "invalid appId claim", "invalid_app_claim"}
+	}
+
+	topicClaim := getClaim(verifiedToken, wsTokenTopicClaimKey)
+	if topicClaim == "" {
+		s.logger.Error("missing topic claim")
+		return ticket, &ticketError{http.StatusBadRequest, "missing topic claim", "missing_topic_claim"}
+	}
+
+	app, err := s.appRepository.GetByID(ctx, appId)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return ticket, &ticketError{http.StatusNotFound, "app not found", "app_not_found"}
+		}
+		s.logger.Error("error getting app", "error", err, "appId", appId)
+		return ticket, &ticketError{http.StatusInternalServerError, "error getting app", "internal"}
+	}
+
+	ticket.Token = verifiedToken
+	ticket.App = app
+	ticket.Topic = topicClaim
+	return ticket, nil
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Hierarchical topics. Topic names are split into levels by /, and subscriptions can use + to match
+// exactly one level and # as the last level to match any number of levels, e.g. orders/+/123 and orders/#.
+// Wildcard topics are kept in a trie per app, so a broadcast finds the matching wildcard topics
+// without comparing against every one of them.
+
+const (
+	topicLevelSeparator = "/"
+	singleLevelWildcard = "+"
+	multiLevelWildcard  = "#"
+)
+
+var errInvalidTopic = errors.New("invalid topic: wildcards must be a whole level, and # must be the last level")
+
+func isWildcardTopic(topic string) bool {
+	return strings.Contains(topic, singleLevelWildcard) || strings.Contains(topic, multiLevelWildcard)
+}
+
+// validateTopic checks the placement of wildcards
+func validateTopic(topic string) error {
+	levels := strings.Split(topic, topicLevelSeparator)
+	for i, level := range levels {
+		if level == singleLevelWildcard {
+			continue
+		}
+		if level == multiLevelWildcard {
+			if i != len(levels)-1 {
+				return errInvalidTopic
+			}
+			continue
+		}
+		if isWildcardTopic(level) {
+			return errInvalidTopic
+		}
+	}
+	return nil
+}
+
+// validateTopicList checks the topics of an app setting, like its reliable or sequenced topics
+func validateTopicList(topics []string) error {
+	for _, topic := range topics {
+		if topic == "" {
+			return errors.New("empty topic")
+		}
+		if err := validateTopic(topic); err != nil {
+			return fmt.Errorf("topic %q: %w", topic, err)
+		}
+	}
+	return nil
+}
+
+type topicTrieNode struct {
+	children map[string]*topicTrieNode
+	// topicId is set if a wildcard topic ends at this node
+	topicId TopicID
+}
+
+func newTopicTrieNode() *topicTrieNode {
+	return &topicTrieNode{children: make(map[string]*topicTrieNode)}
+}
+
+// topicTrie is not safe for concurrent use, it is guarded by WsTopicCollection
+type topicTrie struct {
+	root *topicTrieNode
+}
+
+func newTopicTrie() *topicTrie {
+	return &topicTrie{root: newTopicTrieNode()}
+}
+
+func (t *topicTrie) insert(pattern string, topicId TopicID) {
+	node := t.root
+	for _, level := range strings.Split(pattern, topicLevelSeparator) {
+		child, ok := node.children[level]
+		if !ok {
+			child = newTopicTrieNode()
+			node.children[level] = child
+		}
+		node = child
+	}
+	node.topicId = topicId
+}
+
+// remove deletes the pattern and prunes nodes that no longer lead to a topic
+func (t *topicTrie) remove(pattern string) {
+	removeLevels(t.root, strings.Split(pattern, topicLevelSeparator))
+}
+
+func removeLevels(node *topicTrieNode, levels []string) {
+	if len(levels) == 0 {
+		node.topicId = ""
+		return
+	}
+	child, ok := node.children[levels[0]]
+	if !ok {
+		return
+	}
+	removeLevels(child, levels[1:])
+	if child.topicId == "" && len(child.children) == 0 {
+		delete(node.children, levels[0])
+	}
+}
+
+func (t *topicTrie) empty() bool {
+	return len(t.root.children) == 0
+}
+
+// match returns the wildcard topics matching topic
+func (t *topicTrie) match(topic string) []TopicID {
+	matches := make([]TopicID, 0)
+	matchLevels(t.root, strings.Split(topic, topicLevelSeparator), &matches)
+	return matches
+}
+
+func matchLevels(node *topicTrieNode, levels []string, matches *[]TopicID) {
+	// # also matches the parent level, so orders/# matches orders
+	if multi, ok := node.children[multiLevelWildcard]; ok && multi.topicId != "" {
+		*matches = append(*matches, multi.topicId)
+	}
+	if len(levels) == 0 {
+		if node.topicId != "" {
+			*matches = append(*matches, node.topicId)
+		}
+		return
+	}
+	if child, ok := node.children[levels[0]]; ok {
+		matchLevels(child, levels[1:], matches)
+	}
+	if single, ok := node.children[singleLevelWildcard]; ok {
+		matchLevels(single, levels[1:], matches)
+	}
+}
+
+// matchTopic reports whether topic matches pattern, with the same wildcards as topicTrie
+func matchTopic(pattern string, topic string) bool {
+	patternLevels := strings.Split(pattern, topicLevelSeparator)
+	levels := strings.Split(topic, topicLevelSeparator)
+	for i, patternLevel := range patternLevels {
+		if patternLevel == multiLevelWildcard {
+			return true
+		}
+		if i >= len(levels) || (patternLevel != singleLevelWildcard && patternLevel != levels[i]) {
+			return false
+		}
+	}
+	return len(patternLevels) == len(levels)
+}
+
+// topicParam returns the topic url parameter. Hierarchical topics are sent with the separator
+// escaped as %2F, which the router leaves as is.
+func topicParam(r *http.Request) string {
+	topic := chi.URLParam(r, "topic")
+	if unescaped, err := url.PathUnescape(topic); err == nil {
+		return unescaped
+	}
+	return topic
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestValidateTopic(t *testing.T) {
+	tests := []struct {
+		topic string
+		valid bool
+	}{
+		{"orders", true},
+		{"orders/123", true},
+		{"orders/+", true},
+		{"orders/+/items", true},
+		{"orders/#", true},
+		{"#", true},
+		{"+", true},
+		{"+/+", true},
+		{"orders/#/items", false},
+		{"#/orders", false},
+		{"orders/1+", false},
+		{"orders/a#", false},
+		{"orders+", false},
+	}
+	for _, tt := range tests {
+		err := validateTopic(tt.topic)
+		if (err == nil) != tt.valid {
+			t.Errorf("%q: got %v, want valid %v", tt.topic, err, tt.valid)
+		}
+	}
+}
+
+func TestTopicTrieMatch(t *testing.T) {
+	patterns := []string{"orders/#", "orders/+", "orders/+/items", "+/123", "#", "invoices/+/lines/#"}
+	trie := newTopicTrie()
+	for _, pattern := range patterns {
+		trie.insert(pattern, TopicID(pattern))
+	}
+	tests := []struct {
+		topic string
+		want  []string
+	}{
+		// # also matches the parent level
+		{"orders", []string{"orders/#", "#"}},
+		{"orders/123", []string{"orders/#", "orders/+", "+/123", "#"}},
+		{"orders/123/items", []string{"orders/#", "orders/+/items", "#"}},
+		{"orders/123/items/4", []string{"orders/#", "#"}},
+		{"customers/123", []string{"+/123", "#"}},
+		{"invoices/1/lines", []string{"invoices/+/lines/#", "#"}},
+		{"invoices/1/lines/2/3", []string{"invoices/+/lines/#", "#"}},
+		{"invoices/1", []string{"#"}},
+		{"", []string{"#"}},
+	}
+	for _, tt := range tests {
+		got := make([]string, 0)
+		for _, topicId := range trie.match(tt.topic) {
+			got = append(got, string(topicId))
+		}
+		slices.Sort(got)
+		want := slices.Clone(tt.want)
+		slices.Sort(want)
+		if !slices.Equal(got, want) {
+			t.Errorf("%q: got %v, want %v", tt.topic, got, want)
+		}
+		for _, pattern := range patterns {
+			if matchTopic(pattern, tt.topic) != slices.Contains(want, pattern) {
+				t.Errorf("%q: matchTopic(%q) does not agree with the trie", tt.topic, pattern)
+			}
+		}
+	}
+}
+
+func TestMatchTopicWithoutWildcards(t *testing.T) {
+	if !matchTopic("orders/123", "orders/123") {
+		t.Error("topic does not match itself")
+	}
+	for _, topic := range []string{"orders", "orders/1234", "orders/123/items"} {
+		if matchTopic("orders/123", topic) {
+			t.Errorf("orders/123 matches %q", topic)
+		}
+	}
+}
+
+func TestTopicTrieRemove(t *testing.T) {
+	trie := newTopicTrie()
+	trie.insert("orders/#", "orders/#")
+	trie.insert("orders/+/items", "orders/+/items")
+
+	trie.remove("orders/#")
+	if got := trie.match("orders/1/items"); len(got) != 1 || got[0] != "orders/+/items" {
+		t.Errorf("got %v after removing orders/#, want orders/+/items", got)
+	}
+	trie.remove("orders/+/items")
+	if !trie.empty() {
+		t.Error("trie is not empty after removing every pattern")
+	}
+	// Removing a pattern that is not there is a no-op
+	trie.remove("orders/+")
+}
+
+func TestTopicParam(t *testing.T) {
+	tests := []struct {
+		param string
+		want  string
+	}{
+		{"orders", "orders"},
+		{"orders%2F123", "orders/123"},
+		{"orders%2f123", "orders/123"},
+		{"100%25", "100%"},
+		{"a%2Fb%252F", "a/b%2F"},
+		{"orders%2F%2B", "orders/+"},
+		{"orders%2F%23", "orders/#"},
+		// Invalid escapes are kept as they are
+		{"100%", "100%"},
+		{"orders%zz", "orders%zz"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		routeCtx := chi.NewRouteContext()
+		routeCtx.URLParams.Add("topic", tt.param)
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeCtx))
+		if got := topicParam(r); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.param, got, tt.want)
+		}
+	}
+}
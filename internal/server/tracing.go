@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Spans are sent to the global tracer provider, which ServerCmd sets up when an OTLP endpoint is configured.
+// Without one the spans are no-ops.
+
+var tracer = otel.Tracer("github.com/bjarke-xyz/ws-gateway/internal/server")
+
+// traceRequest starts a span for the request, continuing the trace of the caller if the request has a W3C traceparent header
+func traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route != "" {
+			span.SetName(r.Method + " " + route)
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", route),
+			attribute.Int("http.response.status_code", status),
+		)
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// startMessageSpan starts a span in the trace of the broadcast that sent msg.
+// Messages without a trace, like those sent by pusher clients, get a no-op span, so they do not each start a new trace.
+func startMessageSpan(msg *WsMessage, name string, attrs ...attribute.KeyValue) trace.Span {
+	if !msg.SpanContext.IsValid() {
+		return trace.SpanFromContext(context.Background())
+	}
+	ctx := trace.ContextWithSpanContext(context.Background(), msg.SpanContext)
+	_, span := tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+	return span
+}
+
+// endSpan records err on the span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,326 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/bjarke-xyz/ws-gateway/internal/server/html"
+)
+
+// Usage is counted in memory by the helpers in metrics.go, and added to the usage in the database every usageFlushInterval.
+// Instances report their peak connections per minute, so usageFlushInterval must stay one minute.
+const usageFlushInterval = time.Minute
+
+// usageDefaultDays is the number of days shown when no range is given
+const usageDefaultDays = 30
+
+// maxUsageDays limits the range of a usage request
+const maxUsageDays = 366
+
+var appUsage = &usageCounter{apps: make(map[string]*appUsageCount), Mutex: &sync.Mutex{}}
+
+type usageCounter struct {
+	apps map[string]*appUsageCount
+	*sync.Mutex
+}
+
+// appUsageCount is the usage of an app since the last flush
+type appUsageCount struct {
+	messages        int64
+	deliveredBytes  int64
+	connections     int
+	peakConnections int
+	// connectionTime is the time connections have been open. Less than a minute is carried over to the next flush.
+	connectionTime time.Duration
+	// countedAt is when connectionTime was last brought up to date
+	countedAt time.Time
+}
+
+// countConnectionTime adds the time the open connections have been open since the last count
+func (c *appUsageCount) countConnectionTime(now time.Time) {
+	if c.connections > 0 && now.After(c.countedAt) {
+		c.connectionTime += time.Duration(c.connections) * now.Sub(c.countedAt)
+	}
+	c.countedAt = now
+}
+
+// get must be called with the lock held
+func (u *usageCounter) get(appId string) *appUsageCount {
+	count, ok := u.apps[appId]
+	if !ok {
+		count = &appUsageCount{}
+		u.apps[appId] = count
+	}
+	return count
+}
+
+func (u *usageCounter) connected(appId string, now time.Time) {
+	u.Lock()
+	defer u.Unlock()
+	count := u.get(appId)
+	count.countConnectionTime(now)
+	count.connections++
+	count.peakConnections = max(count.peakConnections, count.connections)
+}
+
+func (u *usageCounter) disconnected(appId string, now time.Time) {
+	u.Lock()
+	defer u.Unlock()
+	count := u.get(appId)
+	count.countConnectionTime(now)
+	count.connections--
+}
+
+func (u *usageCounter) message(appId string) {
+	u.Lock()
+	defer u.Unlock()
+	u.get(appId).messages++
+}
+
+func (u *usageCounter) sent(appId string, n int) {
+	u.Lock()
+	defer u.Unlock()
+	u.get(appId).deliveredBytes += int64(n)
+}
+
+// take returns the usage since the last call as usage on the day of now. Connection time is counted in whole minutes,
+// the rest is carried over. The counts are reset, and apps without open connections or time to carry over are forgotten.
+func (u *usageCounter) take(now time.Time) []domain.AppUsage {
+	u.Lock()
+	defer u.Unlock()
+	day := usageDay(now)
+	usage := make([]domain.AppUsage, 0, len(u.apps))
+	for appId, count := range u.apps {
+		count.countConnectionTime(now)
+		connectionMinutes := int64(count.connectionTime / time.Minute)
+		if count.messages != 0 || count.deliveredBytes != 0 || count.peakConnections != 0 || connectionMinutes != 0 {
+			usage = append(usage, domain.AppUsage{
+				AppID:             appId,
+				Day:               day,
+				Messages:          count.messages,
+				DeliveredBytes:    count.deliveredBytes,
+				PeakConnections:   count.peakConnections,
+				ConnectionMinutes: connectionMinutes,
+			})
+		}
+		carried := count.connectionTime % time.Minute
+		if count.connections <= 0 && carried == 0 {
+			delete(u.apps, appId)
+			continue
+		}
+		*count = appUsageCount{
+			connections:     count.connections,
+			peakConnections: count.connections,
+			connectionTime:  carried,
+			countedAt:       now,
+		}
+	}
+	return usage
+}
+
+// restore adds usage that could not be saved back, so it is saved on the next flush
+func (u *usageCounter) restore(usage []domain.AppUsage) {
+	u.Lock()
+	defer u.Unlock()
+	for _, usg := range usage {
+		count := u.get(usg.AppID)
+		count.messages += usg.Messages
+		count.deliveredBytes += usg.DeliveredBytes
+		count.peakConnections = max(count.peakConnections, usg.PeakConnections)
+		count.connectionTime += time.Duration(usg.ConnectionMinutes) * time.Minute
+	}
+}
+
+func (s *server) flushUsage(ctx context.Context) {
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// The usage since the last tick would be lost otherwise
+			s.saveUsage(context.Background(), time.Now())
+			return
+		case now := <-ticker.C:
+			s.saveUsage(ctx, now)
+		}
+	}
+}
+
+func (s *server) saveUsage(ctx context.Context, now time.Time) {
+	usage := appUsage.take(now)
+	if len(usage) == 0 {
+		return
+	}
+	err := s.appUsageRepository.Add(ctx, s.instanceId, now.UTC().Truncate(time.Minute), usage)
+	if err != nil {
+		s.logger.Error("failed to save app usage", "error", err)
+		appUsage.restore(usage)
+	}
+}
+
+// usageDay is the UTC day of t, which usage is counted by
+func usageDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// usageRangeFromRequest reads the from and to query parameters, both inclusive. The default range is the last usageDefaultDays days.
+func usageRangeFromRequest(r *http.Request) (time.Time, time.Time, error) {
+	to := usageDay(time.Now())
+	from := to.AddDate(0, 0, -(usageDefaultDays - 1))
+	var err error
+	query := r.URL.Query()
+	if value := query.Get("to"); value != "" {
+		to, err = time.Parse(time.DateOnly, value)
+		if err != nil {
+			return from, to, fmt.Errorf("to must be a date like 2006-01-02")
+		}
+		from = to.AddDate(0, 0, -(usageDefaultDays - 1))
+	}
+	if value := query.Get("from"); value != "" {
+		from, err = time.Parse(time.DateOnly, value)
+		if err != nil {
+			return from, to, fmt.Errorf("from must be a date like 2006-01-02")
+		}
+	}
+	if from.After(to) {
+		return from, to, fmt.Errorf("from must not be after to")
+	}
+	if to.Sub(from) >= maxUsageDays*24*time.Hour {
+		return from, to, fmt.Errorf("the range must not be longer than %v days", maxUsageDays)
+	}
+	return from, to, nil
+}
+
+type usageDayResponse struct {
+	Day               string `json:"day,omitempty"`
+	Messages          int64  `json:"messages"`
+	DeliveredBytes    int64  `json:"deliveredBytes"`
+	PeakConnections   int    `json:"peakConnections"`
+	ConnectionMinutes int64  `json:"connectionMinutes"`
+}
+
+func newUsageDayResponse(usage domain.AppUsage) usageDayResponse {
+	return usageDayResponse{
+		Day:               usage.Day.Format(time.DateOnly),
+		Messages:          usage.Messages,
+		DeliveredBytes:    usage.DeliveredBytes,
+		PeakConnections:   usage.PeakConnections,
+		ConnectionMinutes: usage.ConnectionMinutes,
+	}
+}
+
+type usageResponse struct {
+	AppID string             `json:"appId"`
+	From  string             `json:"from"`
+	To    string             `json:"to"`
+	Days  []usageDayResponse `json:"days"`
+	// Total has the sum of the days, except for PeakConnections which is the highest peak
+	Total usageDayResponse `json:"total"`
+}
+
+// usageTotal sums the usage, except for the peak which is the highest of the days. Day is left empty.
+func usageTotal(usage []domain.AppUsage) domain.AppUsage {
+	total := domain.AppUsage{}
+	for _, u := range usage {
+		total.Messages += u.Messages
+		total.DeliveredBytes += u.DeliveredBytes
+		total.PeakConnections = max(total.PeakConnections, u.PeakConnections)
+		total.ConnectionMinutes += u.ConnectionMinutes
+	}
+	return total
+}
+
+// newUsageRows returns the rows of the usage chart, with bar widths relative to the busiest day
+func newUsageRows(usage []domain.AppUsage) []html.UsageRow {
+	var maxMessages, maxMinutes int64
+	for _, u := range usage {
+		maxMessages = max(maxMessages, u.Messages)
+		maxMinutes = max(maxMinutes, u.ConnectionMinutes)
+	}
+	rows := make([]html.UsageRow, 0, len(usage))
+	for _, u := range usage {
+		row := html.UsageRow{AppUsage: u}
+		if maxMessages > 0 {
+			row.MessagesPercent = int(u.Messages * 100 / maxMessages)
+		}
+		if maxMinutes > 0 {
+			row.ConnectionMinutesPercent = int(u.ConnectionMinutes * 100 / maxMinutes)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func (s *server) handleApiGetUsage(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.ownedApp(w, r, domain.PermissionView)
+	if !ok {
+		return
+	}
+	from, to, err := usageRangeFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	usage, err := s.appUsageRepository.GetByAppID(r.Context(), app.ID, from, to)
+	if err != nil {
+		s.logger.Error("error getting app usage", "error", err, "appId", app.ID)
+		http.Error(w, "error getting app usage", http.StatusInternalServerError)
+		return
+	}
+	response := usageResponse{
+		AppID: app.ID,
+		From:  from.Format(time.DateOnly),
+		To:    to.Format(time.DateOnly),
+		Days:  make([]usageDayResponse, 0, len(usage)),
+		Total: newUsageDayResponse(usageTotal(usage)),
+	}
+	response.Total.Day = ""
+	for _, u := range usage {
+		response.Days = append(response.Days, newUsageDayResponse(u))
+	}
+	jsonResponse(w, http.StatusOK, response)
+}
+
+// handleGetUsageExport writes the usage of the app as CSV, one row per day with usage
+func (s *server) handleGetUsageExport(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.appForAdmin(w, r, domain.PermissionView)
+	if !ok {
+		return
+	}
+	from, to, err := usageRangeFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	usage, err := s.appUsageRepository.GetByAppID(r.Context(), app.ID, from, to)
+	if err != nil {
+		s.logger.Error("error getting app usage", "error", err, "appId", app.ID)
+		http.Error(w, "error getting app usage", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"usage-%v-%v-%v.csv\"", app.ID, from.Format(time.DateOnly), to.Format(time.DateOnly)))
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"app_id", "day", "messages", "delivered_bytes", "peak_connections", "connection_minutes"})
+	for _, u := range usage {
+		_ = writer.Write([]string{
+			u.AppID,
+			u.Day.Format(time.DateOnly),
+			strconv.FormatInt(u.Messages, 10),
+			strconv.FormatInt(u.DeliveredBytes, 10),
+			strconv.Itoa(u.PeakConnections),
+			strconv.FormatInt(u.ConnectionMinutes, 10),
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		s.logger.Error("failed to write usage csv", "error", err, "appId", app.ID)
+	}
+}
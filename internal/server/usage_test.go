@@ -0,0 +1,39 @@
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUsageCountsConnectionTime(t *testing.T) {
+	u := &usageCounter{apps: make(map[string]*appUsageCount), Mutex: &sync.Mutex{}}
+	start := time.Date(2025, 3, 10, 10, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	u.connected("app", at(0))
+	u.connected("app", at(30*time.Second))
+	u.disconnected("app", at(90*time.Second))
+	// 30s of one connection, 60s of two and 30s of one
+	usage := u.take(at(2 * time.Minute))
+	if len(usage) != 1 || usage[0].ConnectionMinutes != 3 || usage[0].PeakConnections != 2 {
+		t.Fatalf("got %+v, want 3 connection minutes and a peak of 2", usage)
+	}
+
+	// Less than a minute is carried over, also after the last connection closes
+	u.take(at(2*time.Minute + 30*time.Second))
+	u.disconnected("app", at(2*time.Minute+45*time.Second))
+	usage = u.take(at(3 * time.Minute))
+	if len(usage) != 1 || usage[0].ConnectionMinutes != 0 {
+		t.Fatalf("got %+v, want no connection minutes for 45s", usage)
+	}
+	u.connected("app", at(4*time.Minute))
+	u.disconnected("app", at(4*time.Minute+15*time.Second))
+	usage = u.take(at(4*time.Minute + 15*time.Second))
+	if len(usage) != 1 || usage[0].ConnectionMinutes != 1 || usage[0].PeakConnections != 1 {
+		t.Errorf("got %+v, want 1 connection minute and a peak of 1", usage)
+	}
+	if _, ok := u.apps["app"]; ok {
+		t.Error("app without connections or time to carry over is not forgotten")
+	}
+}
@@ -2,17 +2,26 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"log/slog"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"firebase.google.com/go/v4/auth"
+	"github.com/bjarke-xyz/ws-gateway/internal/config"
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type WsTopicCollection struct {
 	Topics  map[TopicID]*WsTopic
 	Cancels map[TopicID]context.CancelFunc
+	// Wildcards holds the wildcard topics of each app, keyed by app id
+	Wildcards map[string]*topicTrie
 	*sync.RWMutex
 }
 
@@ -27,8 +36,32 @@ func (tc *WsTopicCollection) getTopic(appId string, topic string) *WsTopic {
 	return tp
 }
 
-func (tc *WsTopicCollection) createTopicIfNotExists(appId string, topic string, logger *slog.Logger) *WsTopic {
-	topicId := CreateTopicID(appId, topic)
+// getWildcardTopics returns the wildcard topics matching topic
+func (tc *WsTopicCollection) getWildcardTopics(appId string, topic string) []*WsTopic {
+	tc.RLock()
+	defer tc.RUnlock()
+	trie, ok := tc.Wildcards[appId]
+	if !ok {
+		return nil
+	}
+	topicIds := trie.match(topic)
+	topics := make([]*WsTopic, 0, len(topicIds))
+	for _, topicId := range topicIds {
+		if tp, ok := tc.Topics[topicId]; ok {
+			topics = append(topics, tp)
+		}
+	}
+	return topics
+}
+
+func (tc *WsTopicCollection) getTopicByID(topicId TopicID) *WsTopic {
+	tc.RLock()
+	defer tc.RUnlock()
+	return tc.Topics[topicId]
+}
+
+func (tc *WsTopicCollection) createTopicIfNotExists(app domain.Application, topic string, logger *slog.Logger) *WsTopic {
+	topicId := CreateTopicID(app.ID, topic)
 	tc.Lock()
 	defer tc.Unlock()
 	tp, ok := tc.Topics[topicId]
@@ -36,24 +69,38 @@ func (tc *WsTopicCollection) createTopicIfNotExists(appId string, topic string,
 		return tp
 	} else {
 		broker := &WsBroker{
-			Notifier:       make(chan []byte, 1),
-			newClients:     make(chan chan []byte),
-			closingClients: make(chan chan []byte),
-			clients:        make(map[chan []byte]bool),
+			Notifier:       make(chan *WsMessage, 1),
+			newClients:     make(chan brokerClient),
+			closingClients: make(chan chan *WsMessage),
+			clients:        make(map[chan *WsMessage]*messageFilter),
 			RWMutex:        &sync.RWMutex{},
 		}
 		ctx, cancel := context.WithCancel(context.Background())
 		tp = &WsTopic{
 			Clients:         make(map[ClientID]*WsClient),
+			AppID:           app.ID,
 			Topic:           topic,
 			ID:              topicId,
 			Broker:          broker,
 			TopicCollection: tc,
+			Reliability:     newTopicReliability(app, topic),
+			Sequenced:       app.IsSequencedTopic(topic),
+			publishMu:       &sync.Mutex{},
+			CreatedAt:       time.Now(),
 			ctx:             ctx,
 			RWMutex:         &sync.RWMutex{},
 		}
 		tc.Topics[topicId] = tp
 		tc.Cancels[topicId] = cancel
+		topicsGauge.WithLabelValues(appLabel(app.ID)).Inc()
+		if isWildcardTopic(topic) {
+			trie, ok := tc.Wildcards[app.ID]
+			if !ok {
+				trie = newTopicTrie()
+				tc.Wildcards[app.ID] = trie
+			}
+			trie.insert(topic, topicId)
+		}
 		go tp.Listen(logger)
 		return tp
 	}
@@ -67,33 +114,73 @@ func (tc *WsTopicCollection) deleteTopic(topicId TopicID) {
 		return
 	}
 	cancel()
+	if tp, ok := tc.Topics[topicId]; ok {
+		topicsGauge.WithLabelValues(appLabel(tp.AppID)).Dec()
+		if trie, ok := tc.Wildcards[tp.AppID]; ok && isWildcardTopic(tp.Topic) {
+			trie.remove(tp.Topic)
+			if trie.empty() {
+				delete(tc.Wildcards, tp.AppID)
+			}
+		}
+	}
 	delete(tc.Topics, topicId)
 	delete(tc.Cancels, topicId)
 }
 
 type WsTopic struct {
-	Clients         map[ClientID]*WsClient
+	Clients map[ClientID]*WsClient
+	// inspectors counts the clients in Clients that are topic inspectors, which are not subscribers
+	inspectors int
+	AppID      string
+	// Topic can contain wildcards, see topic_trie.go
 	Topic           string
 	ID              TopicID
 	Broker          *WsBroker
 	TopicCollection *WsTopicCollection
-	ctx             context.Context
+	// Reliability is nil unless messages on the topic must be acknowledged
+	Reliability *topicReliability
+	// Sequenced topics number their messages, see appendSequenced
+	Sequenced bool
+	// publishMu keeps messages on sequenced topics in sequence number order
+	publishMu *sync.Mutex
+	// delivered counts the messages handed to the broker, for the connections dashboard
+	delivered atomic.Int64
+	CreatedAt time.Time
+	ctx       context.Context
 	*sync.RWMutex
 }
 
-func (tp *WsTopic) add(client *WsClient) {
+// add registers the client and returns the number of subscribers on the topic
+func (tp *WsTopic) add(client *WsClient) int {
 	tp.Lock()
 	defer tp.Unlock()
 	tp.Clients[client.ID] = client
+	if client.Transport == transportInspector {
+		tp.inspectors++
+	}
+	return len(tp.Clients) - tp.inspectors
 }
 
-func (tp *WsTopic) del(clientId ClientID) {
+// del removes the client and returns the number of subscribers left on the topic.
+// The topic is deleted once inspectors have left as well.
+func (tp *WsTopic) del(clientId ClientID) int {
 	tp.Lock()
 	defer tp.Unlock()
+	if client, ok := tp.Clients[clientId]; ok && client.Transport == transportInspector {
+		tp.inspectors--
+	}
 	delete(tp.Clients, clientId)
 	if len(tp.Clients) == 0 {
 		tp.TopicCollection.deleteTopic(tp.ID)
 	}
+	return len(tp.Clients) - tp.inspectors
+}
+
+// subscribers returns the number of clients on the topic, not counting inspectors
+func (tp *WsTopic) subscribers() int {
+	tp.RLock()
+	defer tp.RUnlock()
+	return len(tp.Clients) - tp.inspectors
 }
 
 type TopicID string
@@ -104,11 +191,38 @@ func CreateTopicID(appId string, topic string) TopicID {
 
 type ClientID string // UUID
 
+const (
+	transportWebsocket = "websocket"
+	transportSSE       = "sse"
+	transportLongPoll  = "long-poll"
+	transportGrpc      = "grpc"
+	transportPusher    = "pusher"
+	transportGraphql   = "graphql"
+	transportInspector = "inspector"
+)
+
 type WsClient struct {
+	// Conn is nil for clients not connected by websocket
 	Conn  *websocket.Conn
 	ID    ClientID
 	Token *auth.Token
 	Topic *WsTopic
+	// App is loaded when the client connects
+	App       domain.Application
+	Transport string
+	// Filter is nil unless the client only wants some of the messages on the topic
+	Filter      *messageFilter
+	ConnectedAt time.Time
+	// redeliver is used to resend unacknowledged messages. Only websocket clients can acknowledge messages.
+	redeliver chan *WsMessage
+}
+
+// userId is empty for clients authenticated by api key instead of a ticket
+func (c *WsClient) userId() string {
+	if c.Token == nil {
+		return ""
+	}
+	return c.Token.UID
 }
 
 func (c *WsClient) appId() string {
@@ -118,33 +232,95 @@ func (c *WsClient) topic() string {
 	return getClaim(c.Token, wsTokenTopicClaimKey)
 }
 
+// WsMessage is a message broadcast on a topic
+type WsMessage struct {
+	// ID is only set on reliable topics
+	ID string
+	// Seq is only set on sequenced topics
+	Seq int64
+	// Topic is the topic the message was broadcast to. It is only set when delivered to a wildcard topic.
+	Topic   string
+	Event   string
+	Payload json.RawMessage
+	// Frame is the message as sent to websocket clients, see encodeBroadcast
+	Frame []byte
+	// SenderID is set when the message was sent by a client on the topic
+	SenderID ClientID
+	// ExpiresAt is zero for messages without a ttl
+	ExpiresAt time.Time
+	// SpanContext is the span of the broadcast that sent the message, see startMessageSpan
+	SpanContext trace.SpanContext
+	// TraceID is only set when the broadcast asked for the trace id to be included in the envelope
+	TraceID string
+}
+
+// expired reports whether the ttl of the message has passed, so it should no longer be delivered
+func (m *WsMessage) expired(now time.Time) bool {
+	return !m.ExpiresAt.IsZero() && now.After(m.ExpiresAt)
+}
+
+func newWsMessage(event string, payload json.RawMessage) (*WsMessage, error) {
+	msg := &WsMessage{
+		Event:   event,
+		Payload: payload,
+	}
+	frame, err := encodeBroadcast(msg)
+	if err != nil {
+		return nil, err
+	}
+	msg.Frame = frame
+	return msg, nil
+}
+
 type WsBroker struct {
 	// Events are pushed to this channel by the main events-gathering routine
-	Notifier chan []byte
+	Notifier chan *WsMessage
 
 	// New client connections
-	newClients chan chan []byte
+	newClients chan brokerClient
 
 	// Closed client connections
-	closingClients chan chan []byte
+	closingClients chan chan *WsMessage
 
-	// Client connections registry
-	clients map[chan []byte]bool
+	// Client connections registry, with the filter of each client
+	clients map[chan *WsMessage]*messageFilter
 
 	*sync.RWMutex
 }
 
-func (b *WsBroker) registerClient(s chan []byte) {
+type brokerClient struct {
+	messageChan chan *WsMessage
+	filter      *messageFilter
+}
+
+// subscribe registers s with the listener. Only messages matching filter are sent to s, a nil filter matches everything.
+func (b *WsBroker) subscribe(s chan *WsMessage, filter *messageFilter) {
+	b.newClients <- brokerClient{messageChan: s, filter: filter}
+}
+
+func (b *WsBroker) registerClient(c brokerClient) {
 	b.Lock()
 	defer b.Unlock()
-	b.clients[s] = true
+	b.clients[c.messageChan] = c.filter
 }
-func (b *WsBroker) delClient(s chan []byte) {
+func (b *WsBroker) delClient(s chan *WsMessage) {
 	b.Lock()
 	defer b.Unlock()
 	delete(b.clients, s)
 }
 
+// unsubscribe hands the client channel to the listener for removal. The channel
+// is drained meanwhile, so a listener blocked on sending to it can make progress.
+func (b *WsBroker) unsubscribe(s chan *WsMessage) {
+	for {
+		select {
+		case b.closingClients <- s:
+			return
+		case <-s:
+		}
+	}
+}
+
 func (tp *WsTopic) Listen(logger *slog.Logger) {
 	for {
 		select {
@@ -164,9 +340,23 @@ func (tp *WsTopic) Listen(logger *slog.Logger) {
 		case event := <-tp.Broker.Notifier:
 			// We got a new event from the outside!
 			// Send event to all connected clients
-			for clientMessageChan := range tp.Broker.clients {
+			if event.expired(time.Now()) {
+				countDropped(tp.AppID, dropReasonExpired, 1)
+				continue
+			}
+			span := startMessageSpan(event, "broker.fanout", attribute.String("app.id", tp.AppID), attribute.String("topic", tp.Topic))
+			in := &filterInput{msg: event}
+			delivered := 0
+			for clientMessageChan, filter := range tp.Broker.clients {
+				if !filter.matches(in) {
+					continue
+				}
 				clientMessageChan <- event
+				delivered++
 			}
+			span.SetAttributes(attribute.Int("clients", delivered))
+			span.End()
+			messagesDeliveredCounter.WithLabelValues(appLabel(tp.AppID)).Add(float64(delivered))
 		}
 	}
 
@@ -177,15 +367,15 @@ const (
 	wsIdHeader   = "WS-ID"
 )
 
-const (
-	readBuffSize = 2 << 10
-	writeBuffSize
-)
+const wsRedeliverBufferSize = 16
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  readBuffSize,
-	WriteBufferSize: writeBuffSize,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+// newUpgrader returns the upgrader of websocket and pusher connections. Any origin is allowed.
+func newUpgrader(cfg config.WebsocketConfig) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  cfg.ReadBufferSize,
+		WriteBufferSize: cfg.WriteBufferSize,
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+	}
 }
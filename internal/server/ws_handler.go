@@ -1,125 +1,206 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
 	"firebase.google.com/go/v4/auth"
-	"github.com/go-chi/chi/v5"
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func (s *server) wsTopicHandler(client *WsClient, w http.ResponseWriter, r *http.Request) {
 	defer client.Conn.Close()
 
 	// Each connection registers its own message channel with the Broker's connections registry
-	messageChan := make(chan []byte)
+	messageChan := make(chan *WsMessage)
 	topic := client.Topic
-	topic.Broker.newClients <- messageChan
+	topic.Broker.subscribe(messageChan, client.Filter)
 	// Remove this client from the map of connected clients
 	// when this handler exits.
-	defer func() {
-		topic.Broker.closingClients <- messageChan
-	}()
+	defer topic.Broker.unsubscribe(messageChan)
 
+	done := make(chan struct{})
+	defer close(done)
+	// resent carries frames requested again by the client on sequenced topics
+	resent := make(chan []byte)
+	writerDone := make(chan struct{})
 	go func() {
-		for msgBytes := range messageChan {
-			err := client.Conn.WriteMessage(websocket.TextMessage, msgBytes)
+		defer close(writerDone)
+		for {
+			var msg *WsMessage
+			select {
+			case <-done:
+				return
+			case msg = <-messageChan:
+			case msg = <-client.redeliver:
+			case frame := <-resent:
+				err := client.Conn.WriteMessage(websocket.TextMessage, frame)
+				if err != nil {
+					s.logger.Error("failed to write ws msg", "error", err)
+					return
+				}
+				countSent(client.App.ID, transportWebsocket, len(frame))
+				continue
+			}
+			if msg.expired(time.Now()) {
+				// The client was too slow to receive it in time
+				countDropped(client.App.ID, dropReasonExpired, 1)
+				continue
+			}
+			span := startMessageSpan(msg, "websocket.write", attribute.String("app.id", client.App.ID), attribute.String("client.id", string(client.ID)))
+			err := client.Conn.WriteMessage(websocket.TextMessage, msg.Frame)
+			endSpan(span, err)
 			if err != nil {
 				s.logger.Error("failed to write ws msg", "error", err)
-				break
+				return
 			}
+			countSent(client.App.ID, transportWebsocket, len(msg.Frame))
 		}
 	}()
+	if topic.Reliability != nil {
+		s.ackTracker.subscribed(client)
+		defer s.ackTracker.unsubscribed(client)
+	}
 
 	for {
-		_, _, err := client.Conn.ReadMessage()
+		_, msgBytes, err := client.Conn.ReadMessage()
 		if err != nil {
 			s.logger.Error("error reading ws msg", "error", err)
 			break
 		}
+		countReceived(client.App.ID, transportWebsocket, len(msgBytes))
+		if msgId, ok := parseAck(msgBytes); ok && topic.Reliability != nil {
+			s.ackTracker.ack(client, msgId)
+			continue
+		}
+		if req, ok := parseResendRequest(msgBytes); ok && topic.Sequenced {
+			frames, err := s.resend(r.Context(), client, req)
+			if err != nil {
+				if !errors.Is(err, errInvalidResendRange) {
+					s.logger.Error("failed to resend messages", "error", err, "from", req.From, "to", req.To)
+				}
+				frame, err := resendErrorFrame(req, err)
+				if err != nil {
+					s.logger.Error("failed to encode resend error", "error", err)
+					continue
+				}
+				frames = [][]byte{frame}
+			}
+			for _, frame := range frames {
+				select {
+				case resent <- frame:
+				case <-writerDone:
+					return
+				}
+			}
+			continue
+		}
+		s.clientWebhook(client, domain.WebhookEventClientMessage, clientMessageData(msgBytes))
 	}
 }
 
-func (s *server) wsClientMiddleware(next func(cl *WsClient, w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		query := r.URL.Query()
-		tokenStr := query.Get("token")
+type clientWebhookData struct {
+	ClientID string `json:"clientId"`
+	UserID   string `json:"userId"`
+	Topic    string `json:"topic"`
+	Message  any    `json:"message,omitempty"`
+}
 
-		auth, err := s.app.Auth(r.Context())
-		if err != nil {
-			s.logger.Error("error getting firebase auth", "error", err)
-			http.Error(w, "failed to get firebase auth", http.StatusInternalServerError)
-			return
-		}
+func (s *server) clientWebhook(client *WsClient, event string, message any) {
+	data := clientWebhookData{
+		ClientID: string(client.ID),
+		UserID:   client.userId(),
+		Topic:    client.Topic.Topic,
+		Message:  message,
+	}
+	s.webhookDispatcher.Dispatch(client.App, event, data)
+}
 
-		customToken, err := s.authClient.SignInWithCustomToken(r.Context(), tokenStr)
-		if err != nil {
-			s.logger.Error("failed to sign in with custom token", "error", err)
-			http.Error(w, "failed to sign in with custom token", http.StatusBadRequest)
-			return
-		}
-		if customToken.Error != nil {
-			s.logger.Error("custom token returned error", "error", customToken.Error)
-			http.Error(w, "custom token returned error", http.StatusBadRequest)
-			return
-		}
-		verifiedToken, err := auth.VerifyIDToken(r.Context(), customToken.IdToken)
-		if err != nil {
-			s.logger.Error("failed to verify ws token", "error", err)
-			http.Error(w, "failed to verify token", http.StatusBadRequest)
-			return
-		}
+type topicWebhookData struct {
+	Topic string `json:"topic"`
+}
 
-		appIdClaim := getClaim(verifiedToken, wsTokenAppIdClaimKey)
-		if appIdClaim == "" {
-			s.logger.Error("missing appId claim")
-			http.Error(w, "missing appId claim", http.StatusBadRequest)
-			return
-		}
-		appId := chi.URLParam(r, "app-id")
-		if appIdClaim != appId {
-			s.logger.Error("invalid app id claim", "appId", appId, "appIdClaim", appIdClaim)
-			http.Error(w, "invalid appId claim", http.StatusBadRequest)
-			return
-		}
+func (s *server) topicWebhook(client *WsClient, event string) {
+	s.webhookDispatcher.Dispatch(client.App, event, topicWebhookData{Topic: client.Topic.Topic})
+}
+
+// clientMessageData embeds JSON messages as-is, anything else is sent as a string
+func clientMessageData(msgBytes []byte) any {
+	if json.Valid(msgBytes) {
+		return json.RawMessage(msgBytes)
+	}
+	return string(msgBytes)
+}
 
-		topicClaim := getClaim(verifiedToken, wsTokenTopicClaimKey)
-		if topicClaim == "" {
-			s.logger.Error("missing topic claim")
-			http.Error(w, "missing topic claim", http.StatusBadRequest)
+func (s *server) wsClientMiddleware(next func(cl *WsClient, w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticket, ok := s.ticketFromRequest(w, r, transportWebsocket)
+		if !ok {
 			return
 		}
-		topic := chi.URLParam(r, "topic")
-		if topicClaim != topic {
-			s.logger.Error("invalid topic claim", "topic", topic, "topicClaim", topicClaim)
-			http.Error(w, "invalid topic claim", http.StatusBadRequest)
+		filter, ok := filterFromRequest(w, r)
+		if !ok {
+			countUpgradeFailure(transportWebsocket, "invalid_filter")
 			return
 		}
 
 		clientId := uuid.NewString()
 		h := http.Header{}
 		h.Add(wsIdHeader, clientId)
-		conn, err := upgrader.Upgrade(w, r, h)
+		conn, err := s.upgrader.Upgrade(w, r, h)
 		if err != nil {
-			s.logger.Error("Error while upgrading connection", "error", err, "token", tokenStr)
+			s.logger.Error("Error while upgrading connection", "error", err)
+			countUpgradeFailure(transportWebsocket, "upgrade")
 			return
 		}
+		defer trackConnection(ticket.App.ID, transportWebsocket)()
 
 		client := &WsClient{
-			Conn:  conn,
-			ID:    ClientID(clientId),
-			Token: verifiedToken,
+			Conn:      conn,
+			ID:        ClientID(clientId),
+			Token:     ticket.Token,
+			App:       ticket.App,
+			Transport: transportWebsocket,
+			Filter:    filter,
+			redeliver: make(chan *WsMessage, wsRedeliverBufferSize),
 		}
-
-		tp := s.wsTopicCollection.createTopicIfNotExists(appId, topic, s.logger)
-		client.Topic = tp
-		tp.add(client)
-		defer tp.del(client.ID)
+		leave := s.joinTopic(client, ticket.Topic)
+		defer leave()
 		next(client, w, r)
 	}
 }
 
+// joinTopic adds the client to the topic, creating the topic if needed.
+// The returned func removes the client again.
+func (s *server) joinTopic(client *WsClient, topic string) func() {
+	tp := s.wsTopicCollection.createTopicIfNotExists(client.App, topic, s.logger)
+	client.Topic = tp
+	client.ConnectedAt = time.Now()
+	// Inspectors in the admin ui only observe the topic, so they do not trigger webhooks
+	notify := client.Transport != transportInspector
+	if tp.add(client) == 1 && notify {
+		s.topicWebhook(client, domain.WebhookEventTopicOccupied)
+	}
+	if notify {
+		s.clientWebhook(client, domain.WebhookEventClientConnected, nil)
+	}
+	return func() {
+		remaining := tp.del(client.ID)
+		if !notify {
+			return
+		}
+		s.clientWebhook(client, domain.WebhookEventClientDisconnected, nil)
+		if remaining == 0 {
+			s.topicWebhook(client, domain.WebhookEventTopicVacated)
+		}
+	}
+}
+
 func getClaim(token *auth.Token, key string) string {
 	val, ok := token.Claims[key]
 	if !ok {
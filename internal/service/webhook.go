@@ -0,0 +1,201 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/google/uuid"
+)
+
+const (
+	WebhookSignatureHeader = "X-WS-Gateway-Signature"
+	WebhookEventHeader     = "X-WS-Gateway-Event"
+	WebhookDeliveryHeader  = "X-WS-Gateway-Delivery"
+
+	webhookMaxAttempts  = 5
+	webhookBaseBackoff  = 1 * time.Second
+	webhookQueueSize    = 1024
+	webhookWorkerCount  = 4
+	webhookPostTimeout  = 10 * time.Second
+	webhookLogSaveLimit = 5 * time.Second
+)
+
+// WebhookPayload is the JSON body POSTed to the app's webhook url
+type WebhookPayload struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	AppID     string    `json:"appId"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      any       `json:"data"`
+}
+
+type webhookJob struct {
+	app     domain.Application
+	payload WebhookPayload
+	// delivery is nil until the first attempt
+	delivery *domain.WebhookDelivery
+	body     []byte
+	backoff  time.Duration
+}
+
+// WebhookDispatcher delivers lifecycle events to the apps' backends.
+// Deliveries are queued and sent by a pool of workers. Failed attempts are queued again after an
+// exponential backoff, so workers are not held up by a broken endpoint while waiting to retry.
+type WebhookDispatcher struct {
+	logger       *slog.Logger
+	deliveryRepo domain.WebhookDeliveryRepository
+	httpClient   *http.Client
+	queue        chan webhookJob
+	baseBackoff  time.Duration
+}
+
+func NewWebhookDispatcher(logger *slog.Logger, deliveryRepo domain.WebhookDeliveryRepository) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		logger:       logger,
+		deliveryRepo: deliveryRepo,
+		httpClient: &http.Client{
+			Timeout: webhookPostTimeout,
+		},
+		queue:       make(chan webhookJob, webhookQueueSize),
+		baseBackoff: webhookBaseBackoff,
+	}
+}
+
+// Start runs the delivery workers until ctx is done
+func (d *WebhookDispatcher) Start(ctx context.Context) {
+	for i := 0; i < webhookWorkerCount; i++ {
+		go d.work(ctx)
+	}
+}
+
+// Dispatch queues the event if the app has subscribed to it. It never blocks;
+// events are dropped if the queue is full.
+func (d *WebhookDispatcher) Dispatch(app domain.Application, event string, data any) {
+	if !app.WantsWebhook(event) {
+		return
+	}
+	job := webhookJob{
+		app: app,
+		payload: WebhookPayload{
+			ID:        uuid.NewString(),
+			Event:     event,
+			AppID:     app.ID,
+			Timestamp: time.Now().UTC(),
+			Data:      data,
+		},
+	}
+	select {
+	case d.queue <- job:
+	default:
+		d.logger.Error("webhook queue full, dropping event", "appId", app.ID, "event", event)
+	}
+}
+
+func (d *WebhookDispatcher) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-d.queue:
+			d.deliver(ctx, job)
+		}
+	}
+}
+
+// deliver makes one attempt, and schedules the next attempt if it failed
+func (d *WebhookDispatcher) deliver(ctx context.Context, job webhookJob) {
+	if job.delivery == nil {
+		body, err := json.Marshal(job.payload)
+		if err != nil {
+			d.logger.Error("failed to marshal webhook payload", "error", err, "appId", job.app.ID)
+			return
+		}
+		job.body = body
+		job.backoff = d.baseBackoff
+		job.delivery = &domain.WebhookDelivery{
+			ID:          job.payload.ID,
+			AppID:       job.app.ID,
+			Event:       job.payload.Event,
+			URL:         job.app.WebhookURL,
+			RequestBody: string(body),
+		}
+		d.saveDelivery(job.delivery, d.deliveryRepo.Create)
+	}
+
+	delivery := job.delivery
+	delivery.Attempts++
+	statusCode, err := d.post(ctx, job.app, delivery.ID, delivery.Event, job.body)
+	delivery.StatusCode = statusCode
+	if err == nil {
+		delivery.Success = true
+		delivery.Error = ""
+		d.saveDelivery(delivery, d.deliveryRepo.Update)
+		return
+	}
+	delivery.Error = err.Error()
+	d.saveDelivery(delivery, d.deliveryRepo.Update)
+	d.logger.Warn("webhook delivery failed", "error", err, "appId", job.app.ID, "event", delivery.Event, "attempt", delivery.Attempts)
+	if delivery.Attempts >= webhookMaxAttempts {
+		return
+	}
+	d.retry(ctx, job)
+}
+
+// retry queues the job again once its backoff has passed. Retries wait for room in the queue
+// instead of being dropped, as the delivery has already been logged.
+func (d *WebhookDispatcher) retry(ctx context.Context, job webhookJob) {
+	backoff := job.backoff
+	job.backoff *= 2
+	time.AfterFunc(backoff, func() {
+		select {
+		case <-ctx.Done():
+		case d.queue <- job:
+		}
+	})
+}
+
+func (d *WebhookDispatcher) post(ctx context.Context, app domain.Application, deliveryID string, event string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, app.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, event)
+	req.Header.Set(WebhookDeliveryHeader, deliveryID)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookBody(app.WebhookSecret, body))
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *WebhookDispatcher) saveDelivery(delivery *domain.WebhookDelivery, save func(context.Context, *domain.WebhookDelivery) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookLogSaveLimit)
+	defer cancel()
+	err := save(ctx, delivery)
+	if err != nil {
+		d.logger.Error("failed to save webhook delivery", "error", err, "deliveryId", delivery.ID)
+	}
+}
+
+// SignWebhookBody returns the hex encoded HMAC-SHA256 of body, keyed with secret.
+// Receivers should compare it to the signature header with hmac.Equal.
+func SignWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
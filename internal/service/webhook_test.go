@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/bjarke-xyz/ws-gateway/internal/repository"
+)
+
+func newTestDispatcher(t *testing.T, baseBackoff time.Duration) (*WebhookDispatcher, domain.WebhookDeliveryRepository) {
+	t.Helper()
+	repo := repository.NewMemoryWebhookDelivery()
+	d := NewWebhookDispatcher(slog.New(slog.NewTextHandler(io.Discard, nil)), repo)
+	d.baseBackoff = baseBackoff
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	d.Start(ctx)
+	return d, repo
+}
+
+func webhookApp(url string) domain.Application {
+	return domain.Application{ID: "app", WebhookURL: url, WebhookSecret: "secret", WebhookEvents: []string{domain.WebhookEventClientConnected}}
+}
+
+func TestWebhookRetriesUntilDelivered(t *testing.T) {
+	var requests atomic.Int32
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer endpoint.Close()
+	d, repo := newTestDispatcher(t, 10*time.Millisecond)
+
+	d.Dispatch(webhookApp(endpoint.URL), domain.WebhookEventClientConnected, nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		deliveries, err := repo.GetByAppID(context.Background(), "app", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) == 1 && deliveries[0].Success {
+			if deliveries[0].Attempts != 3 {
+				t.Errorf("delivered after %v attempts, want 3", deliveries[0].Attempts)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("webhook was not delivered")
+}
+
+func TestWebhookRetriesDoNotBlockWorkers(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	delivered := make(chan struct{}, 1)
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer healthy.Close()
+	// The retries of the broken endpoint are waiting for far longer than the test
+	d, _ := newTestDispatcher(t, time.Hour)
+
+	for i := 0; i < webhookWorkerCount*2; i++ {
+		d.Dispatch(webhookApp(broken.URL), domain.WebhookEventClientConnected, nil)
+	}
+	d.Dispatch(webhookApp(healthy.URL), domain.WebhookEventClientConnected, nil)
+
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook to healthy endpoint was held up by retries to a broken endpoint")
+	}
+}
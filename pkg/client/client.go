@@ -0,0 +1,230 @@
+// Package client is a Go client for ws-gateway.
+//
+// Backends use Client to create tickets and broadcast messages with an api key.
+// Frontends, or other services that want to receive messages, use Subscribe with a
+// ticket created by their backend.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const maxErrorBodySize = 4 << 10
+
+// ErrTopicNotFound is returned when broadcasting to a topic nobody is connected to.
+// Use errors.Is to check for it.
+var ErrTopicNotFound = errors.New("topic not found")
+
+// APIError is returned when the gateway responds with an error status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("ws-gateway: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func (e *APIError) Is(target error) bool {
+	return target == ErrTopicNotFound && e.Message == "topic not found"
+}
+
+func decodeError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(body)),
+	}
+}
+
+// Client calls the api of an app, authenticated with an api key
+type Client struct {
+	baseURL    string
+	appID      string
+	apiKey     string
+	httpClient *http.Client
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the client used for requests, http.DefaultClient is used by default
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// New returns a client for the app. baseURL is the address of the gateway, e.g. https://ws.example.org
+func New(baseURL string, appID string, apiKey string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		appID:      appID,
+		apiKey:     apiKey,
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// do sends input as JSON and decodes the response into output, if output is not nil
+func (c *Client) do(ctx context.Context, method string, path string, input any, output any) error {
+	var body io.Reader
+	if input != nil {
+		inputBytes, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(inputBytes)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/api/app/"+url.PathEscape(c.appID)+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", c.apiKey)
+	// Continues the trace of the caller on the gateway, if the caller uses OpenTelemetry
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return decodeError(resp)
+	}
+	if output == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(output)
+}
+
+// CreateTicket returns a ticket that lets userID subscribe to topic
+func (c *Client) CreateTicket(ctx context.Context, userID string, topic string) (string, error) {
+	input := map[string]string{"userId": userID, "topic": topic}
+	output := struct {
+		Token string `json:"token"`
+	}{}
+	err := c.do(ctx, http.MethodPost, "/ticket", input, &output)
+	return output.Token, err
+}
+
+// Broadcast is a message to broadcast
+type Broadcast struct {
+	// Event is optional. Without an event the payload is sent to clients as is.
+	Event string
+	// Payload must encode to a JSON object
+	Payload any
+	// TTL is optional. Clients that have not received the message within TTL are skipped.
+	TTL time.Duration
+	// IncludeTraceID sends the trace id of the broadcast to clients, see Message.TraceID.
+	// The trace is continued from the span in the context passed to Broadcast.
+	IncludeTraceID bool
+}
+
+type broadcastInput struct {
+	Event          string     `json:"event,omitempty"`
+	Payload        any        `json:"payload"`
+	TTL            int        `json:"ttl,omitempty"`
+	DeliverAt      *time.Time `json:"deliver_at,omitempty"`
+	IncludeTraceID bool       `json:"include_trace_id,omitempty"`
+}
+
+func (b Broadcast) input() broadcastInput {
+	return broadcastInput{Event: b.Event, Payload: b.Payload, TTL: ttlSeconds(b.TTL), IncludeTraceID: b.IncludeTraceID}
+}
+
+// ttlSeconds rounds up, so a short ttl does not become no ttl
+func ttlSeconds(ttl time.Duration) int {
+	if ttl <= 0 {
+		return 0
+	}
+	return int((ttl + time.Second - 1) / time.Second)
+}
+
+// Broadcast sends the message to everyone subscribed to topic.
+// It returns ErrTopicNotFound if nobody is subscribed.
+func (c *Client) Broadcast(ctx context.Context, topic string, b Broadcast) error {
+	return c.do(ctx, http.MethodPost, "/topic/"+url.PathEscape(topic)+"/broadcast", b.input(), nil)
+}
+
+// BatchItem is a message to broadcast with BroadcastBatch
+type BatchItem struct {
+	Topic string
+	Broadcast
+}
+
+type BatchResult struct {
+	Topic     string `json:"topic"`
+	Delivered bool   `json:"delivered"`
+	Error     string `json:"error,omitempty"`
+}
+
+// BroadcastBatch sends many messages in one request. Items are sent independently of each other,
+// the results are in the same order as items.
+func (c *Client) BroadcastBatch(ctx context.Context, items []BatchItem) ([]BatchResult, error) {
+	type batchItemInput struct {
+		Topic string `json:"topic"`
+		broadcastInput
+	}
+	input := struct {
+		Items []batchItemInput `json:"items"`
+	}{Items: make([]batchItemInput, 0, len(items))}
+	for _, item := range items {
+		input.Items = append(input.Items, batchItemInput{Topic: item.Topic, broadcastInput: item.input()})
+	}
+	output := struct {
+		Results []BatchResult `json:"results"`
+	}{}
+	err := c.do(ctx, http.MethodPost, "/broadcast", input, &output)
+	return output.Results, err
+}
+
+// ScheduledMessage is a broadcast that the gateway sends at DeliverAt
+type ScheduledMessage struct {
+	ID        string          `json:"id"`
+	Topic     string          `json:"topic"`
+	Event     string          `json:"event"`
+	Payload   json.RawMessage `json:"payload"`
+	TTL       int             `json:"ttl"`
+	DeliverAt time.Time       `json:"deliverAt"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// Schedule broadcasts the message at deliverAt. Scheduled messages survive restarts of the gateway.
+// Only ID and DeliverAt are set on the returned message. If deliverAt has passed, the message is
+// broadcast right away and the returned message is empty.
+func (c *Client) Schedule(ctx context.Context, topic string, b Broadcast, deliverAt time.Time) (ScheduledMessage, error) {
+	input := b.input()
+	input.DeliverAt = &deliverAt
+	output := ScheduledMessage{}
+	err := c.do(ctx, http.MethodPost, "/topic/"+url.PathEscape(topic)+"/broadcast", input, &output)
+	return output, err
+}
+
+// ListScheduled returns the scheduled messages that have not been delivered yet
+func (c *Client) ListScheduled(ctx context.Context) ([]ScheduledMessage, error) {
+	output := make([]ScheduledMessage, 0)
+	err := c.do(ctx, http.MethodGet, "/scheduled", nil, &output)
+	return output, err
+}
+
+// CancelScheduled cancels a scheduled message. It returns an APIError with status 404 if the message has already been delivered.
+func (c *Client) CancelScheduled(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/scheduled/"+url.PathEscape(id), nil, nil)
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/bjarke-xyz/ws-gateway/internal/config"
+	"github.com/bjarke-xyz/ws-gateway/internal/domain"
+	"github.com/bjarke-xyz/ws-gateway/internal/repository"
+	"github.com/bjarke-xyz/ws-gateway/internal/server"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testTickets issues tickets without firebase. Like firebase custom tokens, tickets can be used once.
+type testTickets struct {
+	mu      sync.Mutex
+	tickets map[string]*auth.Token
+}
+
+func (t *testTickets) CreateTicket(ctx context.Context, userId string, claims map[string]any) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	token := uuid.NewString()
+	t.tickets[token] = &auth.Token{UID: userId, Claims: claims}
+	return token, nil
+}
+
+func (t *testTickets) VerifyTicket(ctx context.Context, tokenStr string) (*auth.Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	token, ok := t.tickets[tokenStr]
+	if !ok {
+		return nil, server.ErrInvalidTicket
+	}
+	delete(t.tickets, tokenStr)
+	return token, nil
+}
+
+type testGateway struct {
+	URL    string
+	AppID  string
+	APIKey string
+}
+
+// newTestGateway serves the routes of the gateway with in-memory repositories, and creates an app with an api key
+func newTestGateway(t *testing.T) testGateway {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	repos := repository.NewMemoryRepositories()
+	tickets := &testTickets{tickets: make(map[string]*auth.Token)}
+	s, err := server.NewServer(ctx, logger, config.Default(), nil, nil, tickets, repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.Server(0).Handler)
+	t.Cleanup(ts.Close)
+
+	org := domain.Organization{ID: uuid.NewString(), Name: "test"}
+	owner := domain.OrganizationMember{OrganizationID: org.ID, UserID: uuid.NewString(), Role: domain.RoleOwner}
+	if err := repos.Organizations.Create(ctx, &org, &owner); err != nil {
+		t.Fatal(err)
+	}
+	app := domain.Application{ID: uuid.NewString(), OwnerUserID: owner.UserID, OrganizationID: org.ID, Name: "test"}
+	if err := repos.Apps.Create(ctx, &app); err != nil {
+		t.Fatal(err)
+	}
+	apiKey := uuid.NewString()
+	keyHash, err := bcrypt.GenerateFromPassword([]byte(apiKey), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := domain.ApiKey{
+		ID:             uuid.NewString(),
+		OwnerUserID:    owner.UserID,
+		OrganizationID: org.ID,
+		KeyHash:        string(keyHash),
+		KeyPreview:     apiKey[0:4],
+		Access:         []domain.ApiKeyAccess{{AppID: app.ID}},
+	}
+	if err := repos.Keys.Create(ctx, &key); err != nil {
+		t.Fatal(err)
+	}
+	return testGateway{URL: ts.URL, AppID: app.ID, APIKey: apiKey}
+}
+
+func TestCreateTicket(t *testing.T) {
+	gw := newTestGateway(t)
+	c := New(gw.URL, gw.AppID, gw.APIKey)
+
+	ticket, err := c.CreateTicket(context.Background(), "user", "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket == "" {
+		t.Error("got empty ticket")
+	}
+}
+
+func TestBroadcastWithoutSubscribers(t *testing.T) {
+	gw := newTestGateway(t)
+	c := New(gw.URL, gw.AppID, gw.APIKey)
+
+	err := c.Broadcast(context.Background(), "orders", Broadcast{Event: "created", Payload: map[string]any{}})
+	if !errors.Is(err, ErrTopicNotFound) {
+		t.Errorf("got %v, want ErrTopicNotFound", err)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	gw := newTestGateway(t)
+	tests := []struct {
+		name       string
+		client     *Client
+		topic      string
+		statusCode int
+	}{
+		{"wrong api key", New(gw.URL, gw.AppID, "wrong"), "orders", http.StatusUnauthorized},
+		{"other app", New(gw.URL, uuid.NewString(), gw.APIKey), "orders", http.StatusUnauthorized},
+		{"invalid topic", New(gw.URL, gw.AppID, gw.APIKey), "orders/#/items", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		_, err := tt.client.CreateTicket(context.Background(), "user", tt.topic)
+		apiErr := &APIError{}
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%v: got %v, want an APIError", tt.name, err)
+			continue
+		}
+		if apiErr.StatusCode != tt.statusCode {
+			t.Errorf("%v: got status %v, want %v", tt.name, apiErr.StatusCode, tt.statusCode)
+		}
+		if errors.Is(err, ErrTopicNotFound) {
+			t.Errorf("%v: %v is ErrTopicNotFound", tt.name, err)
+		}
+	}
+}
+
+func TestAPIErrorIs(t *testing.T) {
+	tests := []struct {
+		err  *APIError
+		want bool
+	}{
+		{&APIError{StatusCode: http.StatusInternalServerError, Message: "topic not found"}, true},
+		{&APIError{StatusCode: http.StatusInternalServerError, Message: "error creating ticket"}, false},
+		{&APIError{StatusCode: http.StatusNotFound, Message: "not found"}, false},
+	}
+	for _, tt := range tests {
+		if got := errors.Is(tt.err, ErrTopicNotFound); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
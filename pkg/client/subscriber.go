@@ -0,0 +1,297 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultMinBackoff = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+	defaultBufferSize = 64
+	writeTimeout      = 10 * time.Second
+)
+
+// TicketFunc returns a ticket for the topic. It is called before every connection attempt,
+// as tickets can only be used once.
+type TicketFunc func(ctx context.Context) (string, error)
+
+// Message is a message received on the topic
+type Message struct {
+	// ID is set on reliable topics. Acknowledge the message with Subscription.Ack.
+	ID string
+	// Seq is set on sequenced topics
+	Seq int64
+	// Topic is set when subscribed to a wildcard topic, and is the topic the message was broadcast to
+	Topic string
+	Event string
+	// TraceID is set when the message was broadcast with IncludeTraceID
+	TraceID string
+	Payload json.RawMessage
+}
+
+// envelope is the frame of messages with an id, sequence number, topic, event or trace id
+type envelope struct {
+	Type    string           `json:"type"`
+	ID      string           `json:"id"`
+	Seq     int64            `json:"seq"`
+	Topic   string           `json:"topic"`
+	Event   string           `json:"event"`
+	TraceID string           `json:"traceId"`
+	Payload *json.RawMessage `json:"payload"`
+}
+
+// decodeFrame returns false for control frames. Frames without a payload field are bare payloads,
+// so a bare payload with a payload field of its own is mistaken for an envelope.
+func decodeFrame(data []byte) (Message, bool) {
+	env := envelope{}
+	err := json.Unmarshal(data, &env)
+	if err != nil || env.Payload == nil {
+		if err == nil && (env.Type == "resend_complete" || env.Type == "resend_error") {
+			return Message{}, false
+		}
+		return Message{Payload: data}, true
+	}
+	return Message{ID: env.ID, Seq: env.Seq, Topic: env.Topic, Event: env.Event, TraceID: env.TraceID, Payload: *env.Payload}, true
+}
+
+type subscribeOptions struct {
+	filter       string
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	bufferSize   int
+	autoAck      bool
+	dialer       *websocket.Dialer
+	onConnect    func()
+	onDisconnect func(error)
+}
+
+type SubscribeOption func(*subscribeOptions)
+
+// WithFilter only receives messages matching the CEL expression, e.g. event == "order.created"
+func WithFilter(expression string) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.filter = expression
+	}
+}
+
+// WithBackoff sets the delay between reconnects. The delay doubles from min up to max,
+// and is randomized by up to half to avoid many clients reconnecting at once.
+func WithBackoff(min time.Duration, max time.Duration) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.minBackoff = min
+		o.maxBackoff = max
+	}
+}
+
+// WithBufferSize sets the size of the Messages channel
+func WithBufferSize(size int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.bufferSize = size
+	}
+}
+
+// WithAutoAck acknowledges messages on reliable topics once they are put on the Messages channel
+func WithAutoAck() SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.autoAck = true
+	}
+}
+
+// WithDialer sets the dialer used to connect, websocket.DefaultDialer is used by default
+func WithDialer(dialer *websocket.Dialer) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.dialer = dialer
+	}
+}
+
+// OnConnect is called every time the subscription connects
+func OnConnect(f func()) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.onConnect = f
+	}
+}
+
+// OnDisconnect is called with the reason every time the subscription disconnects or fails to connect
+func OnDisconnect(f func(error)) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.onDisconnect = f
+	}
+}
+
+// Subscription receives messages on a topic over a websocket, and reconnects until it is closed
+type Subscription struct {
+	url      string
+	ticket   TicketFunc
+	opts     subscribeOptions
+	messages chan Message
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+// Subscribe connects to topic in the background. The subscription ends when ctx is done or Close is called.
+func Subscribe(ctx context.Context, baseURL string, appID string, topic string, ticket TicketFunc, opts ...SubscribeOption) *Subscription {
+	o := subscribeOptions{
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+		bufferSize: defaultBufferSize,
+		dialer:     websocket.DefaultDialer,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	wsURL := strings.TrimSuffix(baseURL, "/")
+	wsURL = strings.Replace(wsURL, "http", "ws", 1)
+	wsURL = wsURL + "/ws/app/" + url.PathEscape(appID) + "/topic/" + url.PathEscape(topic)
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Subscription{
+		url:      wsURL,
+		ticket:   ticket,
+		opts:     o,
+		messages: make(chan Message, o.bufferSize),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go s.run(ctx)
+	return s
+}
+
+// Messages returns the received messages. The channel is closed when the subscription ends.
+func (s *Subscription) Messages() <-chan Message {
+	return s.messages
+}
+
+// Close ends the subscription and waits for it to disconnect
+func (s *Subscription) Close() {
+	s.cancel()
+	<-s.done
+}
+
+// Ack acknowledges a message on a reliable topic. Unacknowledged messages are redelivered.
+func (s *Subscription) Ack(id string) error {
+	return s.write(map[string]string{"type": "ack", "id": id})
+}
+
+// Resend asks for the messages from and to, both inclusive, on a sequenced topic again
+func (s *Subscription) Resend(from int64, to int64) error {
+	return s.write(map[string]any{"type": "resend", "from": from, "to": to})
+}
+
+var errNotConnected = errors.New("not connected")
+
+func (s *Subscription) write(v any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return errNotConnected
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return s.conn.WriteJSON(v)
+}
+
+func (s *Subscription) setConn(conn *websocket.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn = conn
+}
+
+func (s *Subscription) run(ctx context.Context) {
+	defer close(s.done)
+	defer close(s.messages)
+	attempt := 0
+	for {
+		connected, err := s.connect(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			attempt = 0
+		}
+		if s.opts.onDisconnect != nil {
+			s.opts.onDisconnect(err)
+		}
+		timer := time.NewTimer(s.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		attempt++
+	}
+}
+
+// backoff doubles the delay for every failed attempt, with jitter of up to half the delay
+func (s *Subscription) backoff(attempt int) time.Duration {
+	delay := s.opts.maxBackoff
+	if attempt < 32 {
+		delay = min(s.opts.minBackoff<<attempt, s.opts.maxBackoff)
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// connect reads messages until the connection fails. It returns true if it connected.
+func (s *Subscription) connect(ctx context.Context) (bool, error) {
+	token, err := s.ticket(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get ticket: %w", err)
+	}
+	query := url.Values{}
+	query.Set("token", token)
+	if s.opts.filter != "" {
+		query.Set("filter", s.opts.filter)
+	}
+	conn, resp, err := s.opts.dialer.DialContext(ctx, s.url+"?"+query.Encode(), nil)
+	if err != nil {
+		if resp != nil {
+			defer resp.Body.Close()
+			return false, decodeError(resp)
+		}
+		return false, err
+	}
+	defer conn.Close()
+	s.setConn(conn)
+	defer s.setConn(nil)
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+	if s.opts.onConnect != nil {
+		s.opts.onConnect()
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return true, err
+		}
+		msg, ok := decodeFrame(data)
+		if !ok {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case s.messages <- msg:
+		}
+		if s.opts.autoAck && msg.ID != "" {
+			_ = s.Ack(msg.ID)
+		}
+	}
+}
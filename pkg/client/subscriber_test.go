@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDecodeFrame(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+		want  Message
+		ok    bool
+	}{
+		{"envelope", `{"id":"1","seq":2,"topic":"orders/1","event":"created","traceId":"abc","payload":{"a":1}}`,
+			Message{ID: "1", Seq: 2, Topic: "orders/1", Event: "created", TraceID: "abc", Payload: json.RawMessage(`{"a":1}`)}, true},
+		{"envelope with null payload", `{"event":"created","payload":null}`, Message{Payload: json.RawMessage(`{"event":"created","payload":null}`)}, true},
+		{"bare payload", `{"a":1}`, Message{Payload: json.RawMessage(`{"a":1}`)}, true},
+		{"bare payload that is not an object", `[1,2]`, Message{Payload: json.RawMessage(`[1,2]`)}, true},
+		{"not json", `hello`, Message{Payload: json.RawMessage(`hello`)}, true},
+		{"resend complete", `{"type":"resend_complete","from":1,"to":2}`, Message{}, false},
+		{"resend error", `{"type":"resend_error","from":2,"to":1,"error":"invalid resend range"}`, Message{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := decodeFrame([]byte(tt.frame))
+		if ok != tt.ok {
+			t.Errorf("%v: got ok %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if got.ID != tt.want.ID || got.Seq != tt.want.Seq || got.Topic != tt.want.Topic || got.Event != tt.want.Event ||
+			got.TraceID != tt.want.TraceID || string(got.Payload) != string(tt.want.Payload) {
+			t.Errorf("%v: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	s := &Subscription{opts: subscribeOptions{minBackoff: 100 * time.Millisecond, maxBackoff: time.Second}}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{4, time.Second},
+		{40, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if got := s.backoff(tt.attempt); got < tt.max/2 || got > tt.max {
+				t.Fatalf("attempt %v: got %v, want between %v and %v", tt.attempt, got, tt.max/2, tt.max)
+			}
+		}
+	}
+
+	s.opts.minBackoff = 0
+	if got := s.backoff(0); got != 0 {
+		t.Errorf("got %v without backoff, want 0", got)
+	}
+}
+
+func receive(t *testing.T, sub *Subscription) Message {
+	t.Helper()
+	select {
+	case msg, ok := <-sub.Messages():
+		if !ok {
+			t.Fatal("subscription ended")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not receive message")
+	}
+	return Message{}
+}
+
+func waitFor(t *testing.T, connected chan struct{}) {
+	t.Helper()
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not connect")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	gw := newTestGateway(t)
+	c := New(gw.URL, gw.AppID, gw.APIKey)
+	ctx := context.Background()
+	connected := make(chan struct{}, 1)
+	ticket := func(ctx context.Context) (string, error) {
+		return c.CreateTicket(ctx, "user", "orders")
+	}
+	sub := Subscribe(ctx, gw.URL, gw.AppID, "orders", ticket, OnConnect(func() { connected <- struct{}{} }))
+	defer sub.Close()
+	waitFor(t, connected)
+
+	if err := c.Broadcast(ctx, "orders", Broadcast{Event: "created", Payload: map[string]any{"id": 1}}); err != nil {
+		t.Fatal(err)
+	}
+	msg := receive(t, sub)
+	if msg.Event != "created" || string(msg.Payload) != `{"id":1}` {
+		t.Errorf("got %+v, want created with the payload", msg)
+	}
+
+	if err := c.Broadcast(ctx, "orders", Broadcast{Payload: map[string]any{"id": 2}}); err != nil {
+		t.Fatal(err)
+	}
+	msg = receive(t, sub)
+	if msg.Event != "" || string(msg.Payload) != `{"id":2}` {
+		t.Errorf("got %+v, want the bare payload", msg)
+	}
+
+	sub.Close()
+	if _, ok := <-sub.Messages(); ok {
+		t.Error("messages channel is open after Close")
+	}
+}
+
+func TestSubscribeReconnects(t *testing.T) {
+	gw := newTestGateway(t)
+	c := New(gw.URL, gw.AppID, gw.APIKey)
+	ctx := context.Background()
+
+	// The first ticket fails, the second connects, and every reconnect needs a new ticket
+	var tickets atomic.Int32
+	ticket := func(ctx context.Context) (string, error) {
+		if tickets.Add(1) == 1 {
+			return "", errors.New("backend unavailable")
+		}
+		return c.CreateTicket(ctx, "user", "orders")
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	dialer := &websocket.Dialer{NetDialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+		if err == nil {
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+		return conn, err
+	}}
+	connected := make(chan struct{}, 1)
+	disconnects := make(chan error, 10)
+	sub := Subscribe(ctx, gw.URL, gw.AppID, "orders", ticket,
+		WithDialer(dialer),
+		WithBackoff(time.Millisecond, 10*time.Millisecond),
+		OnConnect(func() { connected <- struct{}{} }),
+		OnDisconnect(func(err error) { disconnects <- err }))
+	defer sub.Close()
+
+	waitFor(t, connected)
+	if err := <-disconnects; err == nil || !strings.Contains(err.Error(), "failed to get ticket") {
+		t.Errorf("got disconnect %v, want the ticket error", err)
+	}
+
+	mu.Lock()
+	conns[len(conns)-1].Close()
+	mu.Unlock()
+	if err := <-disconnects; err == nil {
+		t.Error("got disconnect without error")
+	}
+	waitFor(t, connected)
+	if got := tickets.Load(); got != 3 {
+		t.Errorf("got %v tickets, want 3", got)
+	}
+
+	// The gateway removes the topic of the closed connection in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := c.Broadcast(ctx, "orders", Broadcast{Event: "again", Payload: map[string]any{}})
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrTopicNotFound) || time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if msg := receive(t, sub); msg.Event != "again" {
+		t.Errorf("got %+v after reconnecting, want again", msg)
+	}
+}
+
+func TestSubscribeInvalidTicket(t *testing.T) {
+	gw := newTestGateway(t)
+	ticket := func(ctx context.Context) (string, error) {
+		return "not a ticket", nil
+	}
+	disconnects := make(chan error, 1)
+	sub := Subscribe(context.Background(), gw.URL, gw.AppID, "orders", ticket,
+		OnDisconnect(func(err error) {
+			select {
+			case disconnects <- err:
+			default:
+			}
+		}))
+	defer sub.Close()
+
+	err := <-disconnects
+	apiErr := &APIError{}
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 400 || apiErr.Message != "invalid ticket" {
+		t.Errorf("got %v, want a 400 invalid ticket APIError", err)
+	}
+}
@@ -0,0 +1,4 @@
+// Package gatewaypb contains the generated gRPC client and server code for the gateway api
+package gatewaypb
+
+//go:generate protoc -I ../../api/proto --go_out=. --go_opt=module=github.com/bjarke-xyz/ws-gateway/pkg/gatewaypb --go-grpc_out=. --go-grpc_opt=module=github.com/bjarke-xyz/ws-gateway/pkg/gatewaypb gateway/v1/gateway.proto